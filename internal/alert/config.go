@@ -0,0 +1,159 @@
+package alert
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// 规则条件类型
+const (
+	ConditionUnhealthy  = "unhealthy"   // 服务不健康
+	ConditionNotRunning = "not_running" // 容器未运行
+	ConditionExitCode   = "exit_code"   // 容器以非零退出码退出
+	ConditionRestart    = "restart"     // 重启次数增加
+	ConditionOOMKilled  = "oom_killed"  // 容器因内存不足被杀死
+)
+
+// Config 表示告警配置文件
+type Config struct {
+	Webhooks    []WebhookConfig     `yaml:"webhooks"`
+	Rules       []RuleConfig        `yaml:"rules"`
+	Silences    []Silence           `yaml:"silences,omitempty"`
+	Maintenance []MaintenanceWindow `yaml:"maintenance,omitempty"`
+}
+
+// WebhookConfig 表示一个通用 Webhook 通知目标
+type WebhookConfig struct {
+	Name       string            `yaml:"name"`
+	URL        string            `yaml:"url"`
+	Method     string            `yaml:"method,omitempty"`
+	Headers    map[string]string `yaml:"headers,omitempty"`
+	Body       string            `yaml:"body,omitempty"` // JSON 请求体模板，为空则发送默认结构
+	Timeout    time.Duration     `yaml:"timeout,omitempty"`
+	MaxRetries int               `yaml:"max_retries,omitempty"`
+	Backoff    time.Duration     `yaml:"backoff,omitempty"` // 首次重试等待时间，之后指数增长
+
+	template *template.Template
+}
+
+// RuleConfig 表示一条告警规则
+type RuleConfig struct {
+	Name         string        `yaml:"name"`
+	Host         string        `yaml:"host,omitempty"`    // 主机名 glob，为空匹配所有主机
+	Service      string        `yaml:"service,omitempty"` // 服务名 glob，为空匹配所有服务
+	Condition    string        `yaml:"condition"`
+	For          time.Duration `yaml:"for,omitempty"` // 条件持续多久后触发
+	Webhooks     []string      `yaml:"webhooks"`
+	SendResolved bool          `yaml:"send_resolved,omitempty"`
+}
+
+// Silence 表示一个临时静默，在时间范围内匹配的告警不发送通知
+type Silence struct {
+	ID      string    `yaml:"id,omitempty" json:"id"`
+	Rule    string    `yaml:"rule,omitempty" json:"rule,omitempty"`       // 规则名 glob
+	Host    string    `yaml:"host,omitempty" json:"host,omitempty"`       // 主机名 glob
+	Service string    `yaml:"service,omitempty" json:"service,omitempty"` // 服务名 glob
+	Start   time.Time `yaml:"start" json:"start"`
+	End     time.Time `yaml:"end" json:"end"`
+	Comment string    `yaml:"comment,omitempty" json:"comment,omitempty"`
+}
+
+// MaintenanceWindow 表示周期性的维护窗口
+type MaintenanceWindow struct {
+	Name    string   `yaml:"name"`
+	Host    string   `yaml:"host,omitempty"`    // 主机名 glob
+	Service string   `yaml:"service,omitempty"` // 服务名 glob
+	Days    []string `yaml:"days,omitempty"`    // mon, tue ...，为空表示每天
+	Start   string   `yaml:"start"`             // HH:MM
+	End     string   `yaml:"end"`               // HH:MM，小于 Start 表示跨天
+}
+
+// LoadConfig 加载告警配置文件
+func LoadConfig(configPath string) (*Config, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading alert config: %v", err)
+	}
+
+	config := &Config{}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("error parsing alert config: %v", err)
+	}
+
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("invalid alert configuration: %v", err)
+	}
+
+	return config, nil
+}
+
+func (c *Config) validate() error {
+	webhooks := make(map[string]bool)
+	for i := range c.Webhooks {
+		webhook := &c.Webhooks[i]
+		if webhook.Name == "" || webhook.URL == "" {
+			return fmt.Errorf("webhook %d must have a name and url", i)
+		}
+		if webhook.Method == "" {
+			webhook.Method = "POST"
+		}
+		if webhook.Timeout == 0 {
+			webhook.Timeout = 10 * time.Second
+		}
+		if webhook.Backoff == 0 {
+			webhook.Backoff = time.Second
+		}
+		if webhook.Body != "" {
+			tmpl, err := template.New(webhook.Name).Funcs(templateFuncs).Parse(webhook.Body)
+			if err != nil {
+				return fmt.Errorf("webhook '%s' has invalid body template: %v", webhook.Name, err)
+			}
+			webhook.template = tmpl
+		}
+		webhooks[webhook.Name] = true
+	}
+
+	for _, rule := range c.Rules {
+		if rule.Name == "" {
+			return fmt.Errorf("rule has no name")
+		}
+		switch rule.Condition {
+		case ConditionUnhealthy, ConditionNotRunning, ConditionExitCode, ConditionRestart, ConditionOOMKilled:
+		default:
+			return fmt.Errorf("rule '%s' has unknown condition '%s'", rule.Name, rule.Condition)
+		}
+		if _, err := path.Match(rule.Host, ""); err != nil {
+			return fmt.Errorf("rule '%s' has invalid host pattern: %v", rule.Name, err)
+		}
+		if _, err := path.Match(rule.Service, ""); err != nil {
+			return fmt.Errorf("rule '%s' has invalid service pattern: %v", rule.Name, err)
+		}
+		for _, name := range rule.Webhooks {
+			if !webhooks[name] {
+				return fmt.Errorf("rule '%s' references unknown webhook '%s'", rule.Name, name)
+			}
+		}
+	}
+
+	for _, window := range c.Maintenance {
+		if _, err := parseClock(window.Start); err != nil {
+			return fmt.Errorf("maintenance window '%s': %v", window.Name, err)
+		}
+		if _, err := parseClock(window.End); err != nil {
+			return fmt.Errorf("maintenance window '%s': %v", window.Name, err)
+		}
+		for _, day := range window.Days {
+			if _, ok := weekdays[strings.ToLower(day)]; !ok {
+				return fmt.Errorf("maintenance window '%s' has invalid day '%s'", window.Name, day)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,393 @@
+package alert
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/YooLeon/container-debug-online/internal/docker"
+	"go.uber.org/zap"
+)
+
+// 告警状态
+const (
+	StatePending  = "pending"
+	StateFiring   = "firing"
+	StateResolved = "resolved"
+)
+
+// Alert 表示一条规则在某个服务上的当前告警
+type Alert struct {
+	Rule      string    `json:"rule"`
+	Host      string    `json:"host"`
+	Service   string    `json:"service"`
+	Condition string    `json:"condition"`
+	State     string    `json:"state"`
+	Since     time.Time `json:"since"`
+	Message   string    `json:"message"`
+	Silenced  bool      `json:"silenced"`
+}
+
+type alertKey struct {
+	rule    string
+	host    string
+	service string
+}
+
+type alertState struct {
+	since        time.Time
+	firing       bool
+	notified     bool
+	silenced     bool
+	notification Notification
+}
+
+// serviceSnapshot 是评估规则时所需的服务状态
+type serviceSnapshot struct {
+	host         string
+	name         string
+	project      string
+	container    string
+	containerID  string
+	exists       bool
+	running      bool
+	healthy      bool // 端口检查全部通过
+	healthFailed bool // 容器的 HEALTHCHECK 为 unhealthy
+	exitCode     int
+	restartCount int
+	oomKilled    bool
+}
+
+// Engine 在每次状态更新后评估告警规则并发送通知
+type Engine struct {
+	mu       sync.Mutex
+	config   *Config
+	logger   *zap.Logger
+	notifier *notifier
+	webhooks map[string]*WebhookConfig
+	alerts   map[alertKey]*alertState
+	restarts map[alertKey]serviceSnapshot // 上一次观察到的容器，rule 字段为空
+	silences []Silence
+	now      func() time.Time
+}
+
+// NewEngine 创建告警引擎，通过 Watch 关联需要评估的监控器
+func NewEngine(config *Config, logger *zap.Logger) *Engine {
+	e := &Engine{
+		config:   config,
+		logger:   logger,
+		notifier: newNotifier(logger),
+		webhooks: make(map[string]*WebhookConfig),
+		alerts:   make(map[alertKey]*alertState),
+		restarts: make(map[alertKey]serviceSnapshot),
+		silences: append([]Silence(nil), config.Silences...),
+		now:      time.Now,
+	}
+	for i := range config.Webhooks {
+		e.webhooks[config.Webhooks[i].Name] = &config.Webhooks[i]
+	}
+	for i := range e.silences {
+		if e.silences[i].ID == "" {
+			e.silences[i].ID = newSilenceID()
+		}
+	}
+
+	return e
+}
+
+// Watch 在监控器每次状态更新后评估规则
+func (e *Engine) Watch(monitor *docker.Monitor) {
+	monitor.OnUpdate(func(status *docker.MonitorStatus) {
+		e.Evaluate(monitor, status)
+	})
+}
+
+// Close 停止通知投递
+func (e *Engine) Close() {
+	e.notifier.close()
+}
+
+// Evaluate 根据监控器最新的状态评估所有规则
+func (e *Engine) Evaluate(monitor *docker.Monitor, status *docker.MonitorStatus) {
+	e.evaluate(snapshot(monitor, status)...)
+}
+
+// evaluate 根据服务的状态评估所有规则
+func (e *Engine) evaluate(services ...serviceSnapshot) {
+	now := e.now()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.pruneSilences(now)
+	for _, rule := range e.config.Rules {
+		for _, service := range services {
+			if !globMatch(rule.Host, service.host) || !globMatch(rule.Service, service.name) {
+				continue
+			}
+			if rule.Condition == ConditionRestart {
+				e.evaluateRestart(rule, service, now)
+				continue
+			}
+			e.evaluateState(rule, service, now)
+		}
+	}
+
+	for _, service := range services {
+		e.restarts[alertKey{host: service.host, service: service.name}] = service
+	}
+}
+
+func snapshot(monitor *docker.Monitor, status *docker.MonitorStatus) []serviceSnapshot {
+	status.RLock()
+	defer status.RUnlock()
+
+	names := make(map[string]bool)
+	for _, name := range monitor.GetComposeConfig().SortedServices {
+		names[name] = true
+	}
+	for name := range status.Services {
+		names[name] = true
+	}
+
+	snapshots := make([]serviceSnapshot, 0, len(names))
+	for name := range names {
+		snapshot := serviceSnapshot{host: monitor.Name(), name: name}
+		if service, ok := status.Services[name]; ok {
+			snapshot.healthy = service.Healthy
+			if container, ok := status.Containers[service.ContainerID]; ok {
+				snapshot.exists = true
+				snapshot.project = container.Info.Labels["com.docker.compose.project"]
+				snapshot.container = container.Info.Name
+				snapshot.containerID = service.ContainerID
+				snapshot.running = container.Info.Status == "running"
+				snapshot.exitCode = container.ExitCode
+				snapshot.restartCount = container.RestartCount
+				snapshot.oomKilled = container.OOMKilled
+				snapshot.healthFailed = container.Health != nil && container.Health.Status == "unhealthy"
+			}
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].name < snapshots[j].name })
+	return snapshots
+}
+
+// conditionActive 判断状态型条件是否成立，并返回描述信息
+func conditionActive(condition string, service serviceSnapshot) (bool, string) {
+	switch condition {
+	case ConditionUnhealthy:
+		if service.healthFailed {
+			return true, fmt.Sprintf("service %s is unhealthy: health check failing", service.name)
+		}
+		return !service.healthy, fmt.Sprintf("service %s is unhealthy", service.name)
+	case ConditionNotRunning:
+		return !service.running, fmt.Sprintf("service %s is not running", service.name)
+	case ConditionExitCode:
+		return service.exists && !service.running && service.exitCode != 0,
+			fmt.Sprintf("service %s exited with code %d", service.name, service.exitCode)
+	case ConditionOOMKilled:
+		return service.exists && service.oomKilled,
+			fmt.Sprintf("service %s was OOM killed", service.name)
+	}
+	return false, ""
+}
+
+func (e *Engine) evaluateState(rule RuleConfig, service serviceSnapshot, now time.Time) {
+	key := alertKey{rule: rule.Name, host: service.host, service: service.name}
+	state := e.alerts[key]
+	active, message := conditionActive(rule.Condition, service)
+
+	if !active {
+		if state == nil {
+			return
+		}
+		delete(e.alerts, key)
+		if state.firing && state.notified && rule.SendResolved && !e.silenced(rule.Name, service, now) {
+			notification := state.notification
+			notification.Status = StateResolved
+			notification.EndsAt = now
+			e.notify(rule, notification)
+		}
+		return
+	}
+
+	if state == nil {
+		state = &alertState{since: now}
+		e.alerts[key] = state
+	}
+	state.notification = e.newNotification(rule, service, message, state.since)
+
+	if !state.firing && now.Sub(state.since) >= rule.For {
+		state.firing = true
+	}
+	state.silenced = e.silenced(rule.Name, service, now)
+
+	// 静默结束时仍在触发的告警会补发通知
+	if state.firing && !state.notified && !state.silenced {
+		e.notify(rule, state.notification)
+		state.notified = true
+	}
+}
+
+func (e *Engine) evaluateRestart(rule RuleConfig, service serviceSnapshot, now time.Time) {
+	previous, ok := e.restarts[alertKey{host: service.host, service: service.name}]
+	if !ok || !service.exists || previous.containerID != service.containerID {
+		return
+	}
+	if service.restartCount <= previous.restartCount {
+		return
+	}
+	if e.silenced(rule.Name, service, now) {
+		return
+	}
+
+	message := fmt.Sprintf("service %s restarted (restart count %d -> %d)",
+		service.name, previous.restartCount, service.restartCount)
+	e.notify(rule, e.newNotification(rule, service, message, now))
+}
+
+func (e *Engine) newNotification(rule RuleConfig, service serviceSnapshot, message string, since time.Time) Notification {
+	return Notification{
+		Rule:        rule.Name,
+		Status:      StateFiring,
+		Host:        service.host,
+		Condition:   rule.Condition,
+		Project:     service.project,
+		Service:     service.name,
+		Container:   service.container,
+		ContainerID: service.containerID,
+		Message:     message,
+		StartsAt:    since,
+	}
+}
+
+func (e *Engine) notify(rule RuleConfig, notification Notification) {
+	e.logger.Info("Alert notification",
+		zap.String("rule", notification.Rule),
+		zap.String("host", notification.Host),
+		zap.String("service", notification.Service),
+		zap.String("status", notification.Status),
+		zap.String("message", notification.Message))
+
+	for _, name := range rule.Webhooks {
+		if webhook, ok := e.webhooks[name]; ok {
+			e.notifier.enqueue(webhook, notification)
+		}
+	}
+}
+
+func (e *Engine) silenced(rule string, service serviceSnapshot, now time.Time) bool {
+	for _, silence := range e.silences {
+		if silence.Matches(rule, service.host, service.name, now) {
+			return true
+		}
+	}
+	for _, window := range e.config.Maintenance {
+		if window.Active(service.host, service.name, now) {
+			return true
+		}
+	}
+	return false
+}
+
+// Alerts 返回当前处于 pending 或 firing 状态的告警
+func (e *Engine) Alerts() []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	alerts := make([]Alert, 0, len(e.alerts))
+	for key, state := range e.alerts {
+		alert := Alert{
+			Rule:      key.rule,
+			Host:      key.host,
+			Service:   key.service,
+			Condition: state.notification.Condition,
+			State:     StatePending,
+			Since:     state.since,
+			Message:   state.notification.Message,
+			Silenced:  state.silenced,
+		}
+		if state.firing {
+			alert.State = StateFiring
+		}
+		alerts = append(alerts, alert)
+	}
+
+	sort.Slice(alerts, func(i, j int) bool {
+		if alerts[i].Rule != alerts[j].Rule {
+			return alerts[i].Rule < alerts[j].Rule
+		}
+		if alerts[i].Host != alerts[j].Host {
+			return alerts[i].Host < alerts[j].Host
+		}
+		return alerts[i].Service < alerts[j].Service
+	})
+	return alerts
+}
+
+// Silences 返回所有未过期的静默
+func (e *Engine) Silences() []Silence {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.pruneSilences(e.now())
+	return append([]Silence(nil), e.silences...)
+}
+
+// pruneSilences 删除已经过期的静默，调用方需要持有锁
+func (e *Engine) pruneSilences(now time.Time) {
+	silences := e.silences[:0]
+	for _, silence := range e.silences {
+		if now.Before(silence.End) {
+			silences = append(silences, silence)
+		}
+	}
+	e.silences = silences
+}
+
+// AddSilence 添加一个静默并返回带 ID 的静默
+func (e *Engine) AddSilence(silence Silence) (Silence, error) {
+	if silence.Start.IsZero() {
+		silence.Start = e.now()
+	}
+	if !silence.End.After(silence.Start) {
+		return Silence{}, fmt.Errorf("silence end must be after start")
+	}
+	for _, pattern := range []string{silence.Rule, silence.Host, silence.Service} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return Silence{}, fmt.Errorf("invalid pattern '%s': %v", pattern, err)
+		}
+	}
+	silence.ID = newSilenceID()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.silences = append(e.silences, silence)
+	return silence, nil
+}
+
+// RemoveSilence 删除指定 ID 的静默
+func (e *Engine) RemoveSilence(id string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for i, silence := range e.silences {
+		if silence.ID == id {
+			e.silences = append(e.silences[:i], e.silences[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func newSilenceID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
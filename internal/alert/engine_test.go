@@ -0,0 +1,362 @@
+package alert
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/YooLeon/container-debug-online/internal/config"
+	"github.com/YooLeon/container-debug-online/internal/docker"
+	"github.com/YooLeon/container-debug-online/internal/runtime/fake"
+	"github.com/docker/docker/api/types"
+	"go.uber.org/zap"
+)
+
+// recorder 记录 Webhook 收到的通知，前 fail 次请求返回 status
+type recorder struct {
+	mu            sync.Mutex
+	notifications []Notification
+	attempts      []time.Time
+	fail          int
+	status        int
+}
+
+func (rec *recorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.attempts = append(rec.attempts, time.Now())
+	if len(rec.attempts) <= rec.fail {
+		w.WriteHeader(rec.status)
+		return
+	}
+	var notification Notification
+	json.NewDecoder(r.Body).Decode(&notification)
+	rec.notifications = append(rec.notifications, notification)
+}
+
+// wait 等待收到 n 条通知
+func (rec *recorder) wait(t *testing.T, n int) []Notification {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		rec.mu.Lock()
+		got := append([]Notification(nil), rec.notifications...)
+		rec.mu.Unlock()
+		if len(got) >= n || time.Now().After(deadline) {
+			if len(got) != n {
+				t.Fatalf("got %d notifications, want %d: %+v", len(got), n, got)
+			}
+			return got
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func newTestEngine(t *testing.T, rules []RuleConfig, handler http.Handler) (*Engine, *time.Time) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	config := &Config{
+		Webhooks: []WebhookConfig{{Name: "hook", URL: server.URL, Backoff: time.Millisecond}},
+		Rules:    rules,
+	}
+	if err := config.validate(); err != nil {
+		t.Fatal(err)
+	}
+	engine := NewEngine(config, zap.NewNop())
+	t.Cleanup(engine.Close)
+
+	now := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+	engine.now = func() time.Time { return now }
+	return engine, &now
+}
+
+func TestEngineRules(t *testing.T) {
+	rec := &recorder{}
+	engine, now := newTestEngine(t, []RuleConfig{
+		{Name: "down", Service: "web*", Condition: ConditionUnhealthy, For: time.Minute, Webhooks: []string{"hook"}, SendResolved: true},
+		{Name: "restarts", Condition: ConditionRestart, Webhooks: []string{"hook"}},
+	}, rec)
+
+	healthy := serviceSnapshot{host: "local", name: "web", containerID: "c1", exists: true, running: true, healthy: true}
+	unhealthy := healthy
+	unhealthy.healthy = false
+	other := serviceSnapshot{host: "local", name: "db", containerID: "c2", exists: true, running: true}
+
+	engine.evaluate(healthy, other)
+	engine.evaluate(unhealthy, other)
+	alerts := engine.Alerts()
+	if len(alerts) != 1 || alerts[0].State != StatePending || alerts[0].Service != "web" {
+		t.Fatalf("alerts = %+v", alerts)
+	}
+
+	// 持续 For 之后触发，db 不匹配规则的服务名
+	*now = now.Add(time.Minute)
+	engine.evaluate(unhealthy, other)
+	if alerts := engine.Alerts(); len(alerts) != 1 || alerts[0].State != StateFiring {
+		t.Fatalf("alerts = %+v", alerts)
+	}
+	got := rec.wait(t, 1)
+	if got[0].Rule != "down" || got[0].Status != StateFiring || got[0].Service != "web" {
+		t.Errorf("notification = %+v", got[0])
+	}
+
+	// 恢复后发送 resolved
+	*now = now.Add(time.Minute)
+	engine.evaluate(healthy, other)
+	if alerts := engine.Alerts(); len(alerts) != 0 {
+		t.Fatalf("alerts = %+v", alerts)
+	}
+	got = rec.wait(t, 2)
+	if got[1].Status != StateResolved || !got[1].EndsAt.Equal(*now) {
+		t.Errorf("notification = %+v", got[1])
+	}
+
+	// 重启次数增加时通知，换了容器不算重启
+	restarted := healthy
+	restarted.restartCount = 2
+	engine.evaluate(restarted, other)
+	replaced := other
+	replaced.containerID, replaced.restartCount = "c3", 5
+	engine.evaluate(restarted, replaced)
+	got = rec.wait(t, 3)
+	if got[2].Rule != "restarts" || got[2].Service != "web" {
+		t.Errorf("notification = %+v", got[2])
+	}
+}
+
+func TestEngineHealthCheck(t *testing.T) {
+	rec := &recorder{}
+	engine, _ := newTestEngine(t, []RuleConfig{
+		{Name: "down", Condition: ConditionUnhealthy, Webhooks: []string{"hook"}},
+	}, rec)
+
+	// 没有暴露端口，端口检查通过，但容器的 HEALTHCHECK 失败
+	rt := fake.New()
+	rt.AddContainer(fake.Container{
+		ID: "c1c1c1c1c1c1c1c1", Name: "demo-api-1", Project: "demo", Service: "api",
+		Health: &types.Health{Status: "unhealthy", FailingStreak: 3},
+	})
+	rt.AddContainer(fake.Container{
+		ID: "c2c2c2c2c2c2c2c2", Name: "demo-db-1", Project: "demo", Service: "db",
+		Health: &types.Health{Status: "healthy"},
+	})
+	composeConfig := &config.ComposeConfig{
+		Project:        "demo",
+		Services:       map[string]config.ServiceConfig{"api": {}, "db": {}},
+		SortedServices: []string{"api", "db"},
+	}
+	monitor := docker.NewMonitor("local", rt, zap.NewNop(), time.Second, composeConfig)
+	t.Cleanup(func() { monitor.Close() })
+	if err := monitor.UpdateStatus(); err != nil {
+		t.Fatal(err)
+	}
+
+	engine.Evaluate(monitor, monitor.GetAllStatus())
+	alerts := engine.Alerts()
+	if len(alerts) != 1 || alerts[0].Service != "api" || alerts[0].State != StateFiring {
+		t.Fatalf("alerts = %+v", alerts)
+	}
+	if got := rec.wait(t, 1); got[0].Message != "service api is unhealthy: health check failing" {
+		t.Errorf("notification = %+v", got[0])
+	}
+}
+
+func TestEngineSilences(t *testing.T) {
+	rec := &recorder{}
+	engine, now := newTestEngine(t, []RuleConfig{
+		{Name: "down", Condition: ConditionNotRunning, Webhooks: []string{"hook"}},
+	}, rec)
+
+	silence, err := engine.AddSilence(Silence{Service: "web", End: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.AddSilence(Silence{End: now.Add(-time.Minute)}); err == nil {
+		t.Error("expected error for silence ending before start")
+	}
+	if _, err := engine.AddSilence(Silence{Service: "[", End: now.Add(time.Hour)}); err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+
+	stopped := serviceSnapshot{host: "local", name: "web", exists: true}
+	engine.evaluate(stopped)
+	if alerts := engine.Alerts(); len(alerts) != 1 || !alerts[0].Silenced || alerts[0].State != StateFiring {
+		t.Fatalf("alerts = %+v", alerts)
+	}
+
+	// 静默过期后补发通知，过期的静默被删除
+	*now = now.Add(time.Hour)
+	engine.evaluate(stopped)
+	rec.wait(t, 1)
+	if len(engine.silences) != 0 {
+		t.Errorf("expired silences were not pruned: %+v", engine.silences)
+	}
+	if engine.RemoveSilence(silence.ID) {
+		t.Error("removed an expired silence")
+	}
+
+	// 列出时同样删除过期的静默
+	engine.AddSilence(Silence{End: now.Add(time.Minute)})
+	kept, _ := engine.AddSilence(Silence{End: now.Add(time.Hour)})
+	*now = now.Add(30 * time.Minute)
+	if silences := engine.Silences(); len(silences) != 1 || silences[0].ID != kept.ID {
+		t.Errorf("silences = %+v", silences)
+	}
+	if len(engine.silences) != 1 {
+		t.Errorf("stored silences = %+v", engine.silences)
+	}
+	if !engine.RemoveSilence(kept.ID) || len(engine.Silences()) != 0 {
+		t.Error("failed to remove silence")
+	}
+}
+
+func TestSilenceMatches(t *testing.T) {
+	start := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+	silence := Silence{Rule: "disk-*", Host: "prod-?", Start: start, End: start.Add(time.Hour)}
+
+	tests := []struct {
+		name    string
+		rule    string
+		host    string
+		service string
+		at      time.Time
+		want    bool
+	}{
+		{"match", "disk-full", "prod-1", "web", start, true},
+		{"empty service pattern matches all", "disk-full", "prod-2", "db", start.Add(30 * time.Minute), true},
+		{"rule mismatch", "cpu", "prod-1", "web", start, false},
+		{"host mismatch", "disk-full", "staging", "web", start, false},
+		{"before start", "disk-full", "prod-1", "web", start.Add(-time.Second), false},
+		{"end is exclusive", "disk-full", "prod-1", "web", start.Add(time.Hour), false},
+	}
+	for _, tt := range tests {
+		if got := silence.Matches(tt.rule, tt.host, tt.service, tt.at); got != tt.want {
+			t.Errorf("%s: Matches = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMaintenanceWindowActive(t *testing.T) {
+	// 2024-01-05 是周五
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, 1, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name   string
+		window MaintenanceWindow
+		at     time.Time
+		want   bool
+	}{
+		{"inside", MaintenanceWindow{Start: "02:00", End: "04:00"}, at(5, 3, 0), true},
+		{"end is exclusive", MaintenanceWindow{Start: "02:00", End: "04:00"}, at(5, 4, 0), false},
+		{"before", MaintenanceWindow{Start: "02:00", End: "04:00"}, at(5, 1, 59), false},
+		{"day matches", MaintenanceWindow{Days: []string{"Fri"}, Start: "02:00", End: "04:00"}, at(5, 3, 0), true},
+		{"day mismatch", MaintenanceWindow{Days: []string{"sat"}, Start: "02:00", End: "04:00"}, at(5, 3, 0), false},
+		{"service mismatch", MaintenanceWindow{Service: "db", Start: "02:00", End: "04:00"}, at(5, 3, 0), false},
+		{"overnight before midnight", MaintenanceWindow{Days: []string{"fri"}, Start: "23:00", End: "01:00"}, at(5, 23, 30), true},
+		{"overnight after midnight", MaintenanceWindow{Days: []string{"fri"}, Start: "23:00", End: "01:00"}, at(6, 0, 30), true},
+		{"overnight started previous day only", MaintenanceWindow{Days: []string{"fri"}, Start: "23:00", End: "01:00"}, at(5, 0, 30), false},
+		{"overnight gap", MaintenanceWindow{Start: "23:00", End: "01:00"}, at(5, 12, 0), false},
+	}
+	for _, tt := range tests {
+		if got := tt.window.Active("local", "web", tt.at); got != tt.want {
+			t.Errorf("%s: Active = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		fail     int
+		retries  int
+		attempts int
+		wantErr  bool
+	}{
+		{"succeeds after retries", http.StatusServiceUnavailable, 2, 3, 3, false},
+		{"gives up after max retries", http.StatusInternalServerError, 5, 2, 3, true},
+		{"retries rate limiting", http.StatusTooManyRequests, 1, 1, 2, false},
+		{"client errors are not retried", http.StatusBadRequest, 1, 3, 1, true},
+	}
+	for _, tt := range tests {
+		rec := &recorder{fail: tt.fail, status: tt.status}
+		server := httptest.NewServer(rec)
+		n := newNotifier(zap.NewNop())
+		webhook := &WebhookConfig{
+			Name: "hook", URL: server.URL, Method: "POST",
+			Timeout: time.Second, MaxRetries: tt.retries, Backoff: 10 * time.Millisecond,
+		}
+
+		err := n.deliver(webhook, Notification{Rule: "down"})
+		n.close()
+		server.Close()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v", tt.name, err)
+		}
+		if len(rec.attempts) != tt.attempts {
+			t.Errorf("%s: %d attempts, want %d", tt.name, len(rec.attempts), tt.attempts)
+			continue
+		}
+		// 重试间隔指数增长
+		backoff := webhook.Backoff
+		for i := 1; i < len(rec.attempts); i++ {
+			if gap := rec.attempts[i].Sub(rec.attempts[i-1]); gap < backoff {
+				t.Errorf("%s: attempt %d after %v, want at least %v", tt.name, i+1, gap, backoff)
+			}
+			backoff *= 2
+		}
+	}
+}
+
+func TestWebhookIndependentQueues(t *testing.T) {
+	// slow 一直不响应，直到测试结束
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+	rec := &recorder{}
+	fast := httptest.NewServer(rec)
+	defer fast.Close()
+
+	n := newNotifier(zap.NewNop())
+	defer n.close()
+	slowHook := &WebhookConfig{Name: "slow", URL: slow.URL, Method: "POST", Timeout: time.Minute}
+	fastHook := &WebhookConfig{Name: "fast", URL: fast.URL, Method: "POST", Timeout: time.Second}
+
+	n.enqueue(slowHook, Notification{Rule: "first"})
+	n.enqueue(slowHook, Notification{Rule: "second"})
+	n.enqueue(fastHook, Notification{Rule: "first"})
+	n.enqueue(fastHook, Notification{Rule: "second"})
+	got := rec.wait(t, 2)
+	if got[0].Rule != "first" || got[1].Rule != "second" {
+		t.Errorf("notifications = %+v, want in order", got)
+	}
+}
+
+func TestRenderBody(t *testing.T) {
+	config := &Config{Webhooks: []WebhookConfig{
+		{Name: "custom", URL: "http://example", Body: `{"text": {{json .Message}}, "at": "{{rfc3339 .StartsAt}}"}`},
+		{Name: "broken", URL: "http://example", Body: `{"text": {{.Message}}}`},
+	}}
+	if err := config.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	notification := Notification{Message: `web "down"`, StartsAt: time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)}
+	body, err := renderBody(&config.Webhooks[0], notification)
+	if err != nil || string(body) != `{"text": "web \"down\"", "at": "2024-01-02T12:00:00Z"}` {
+		t.Errorf("body = %s, err = %v", body, err)
+	}
+	if _, err := renderBody(&config.Webhooks[1], notification); err == nil {
+		t.Error("expected error for invalid JSON body")
+	}
+}
@@ -0,0 +1,88 @@
+package alert
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// parseClock 解析 HH:MM 格式的时间，返回距离零点的时长
+func parseClock(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day '%s', expected HH:MM", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// globMatch 匹配 glob 模式，空模式匹配所有值
+func globMatch(pattern, value string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(pattern, value)
+	return ok
+}
+
+// Matches 判断静默是否在指定时间覆盖该告警
+func (s Silence) Matches(rule, host, service string, now time.Time) bool {
+	if now.Before(s.Start) || !now.Before(s.End) {
+		return false
+	}
+	return globMatch(s.Rule, rule) && globMatch(s.Host, host) && globMatch(s.Service, service)
+}
+
+// Active 判断维护窗口在指定时间是否生效
+func (w MaintenanceWindow) Active(host, service string, now time.Time) bool {
+	if !globMatch(w.Host, host) || !globMatch(w.Service, service) {
+		return false
+	}
+
+	start, err := parseClock(w.Start)
+	if err != nil {
+		return false
+	}
+	end, err := parseClock(w.End)
+	if err != nil {
+		return false
+	}
+
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	offset := now.Sub(midnight)
+
+	if start <= end {
+		return w.onDay(now.Weekday()) && offset >= start && offset < end
+	}
+
+	// 跨天窗口：当天 start 之后，或前一天开始的窗口在今天 end 之前
+	if offset >= start {
+		return w.onDay(now.Weekday())
+	}
+	if offset < end {
+		return w.onDay(midnight.AddDate(0, 0, -1).Weekday())
+	}
+	return false
+}
+
+func (w MaintenanceWindow) onDay(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if weekdays[strings.ToLower(d)] == day {
+			return true
+		}
+	}
+	return false
+}
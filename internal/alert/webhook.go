@@ -0,0 +1,200 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"text/template"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var templateFuncs = template.FuncMap{
+	// json 将值编码为 JSON，便于在模板中安全地嵌入字符串
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"rfc3339": func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(time.RFC3339)
+	},
+}
+
+// Notification 表示一次告警通知，也是 Webhook 请求体模板的数据
+type Notification struct {
+	Rule        string    `json:"rule"`
+	Status      string    `json:"status"` // firing 或 resolved
+	Host        string    `json:"host"`
+	Condition   string    `json:"condition"`
+	Project     string    `json:"project"`
+	Service     string    `json:"service"`
+	Container   string    `json:"container"`
+	ContainerID string    `json:"container_id"`
+	Message     string    `json:"message"`
+	StartsAt    time.Time `json:"starts_at"`
+	EndsAt      time.Time `json:"ends_at,omitempty"`
+}
+
+type delivery struct {
+	webhook      *WebhookConfig
+	notification Notification
+}
+
+// notifierQueueSize 每个 Webhook 的待投递通知上限
+const notifierQueueSize = 256
+
+// notifier 在后台投递 Webhook 通知，每个 Webhook 有独立的队列和投递协程
+// 同一 Webhook 的通知按顺序投递，一个 Webhook 超时或退避重试不会延迟其他 Webhook
+type notifier struct {
+	client *http.Client
+	logger *zap.Logger
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	queues map[string]chan delivery // key: Webhook 名称
+	closed bool
+	wg     sync.WaitGroup
+}
+
+func newNotifier(logger *zap.Logger) *notifier {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &notifier{
+		client: &http.Client{},
+		logger: logger,
+		ctx:    ctx,
+		cancel: cancel,
+		queues: make(map[string]chan delivery),
+	}
+}
+
+func (n *notifier) enqueue(webhook *WebhookConfig, notification Notification) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return
+	}
+	queue, ok := n.queues[webhook.Name]
+	if !ok {
+		queue = make(chan delivery, notifierQueueSize)
+		n.queues[webhook.Name] = queue
+		n.wg.Add(1)
+		go n.run(queue)
+	}
+
+	select {
+	case queue <- delivery{webhook: webhook, notification: notification}:
+	default:
+		n.logger.Warn("Alert notification queue full, dropping notification",
+			zap.String("rule", notification.Rule),
+			zap.String("webhook", webhook.Name))
+	}
+}
+
+// close 停止所有投递协程，队列中未投递的通知被丢弃
+func (n *notifier) close() {
+	n.mu.Lock()
+	n.closed = true
+	n.mu.Unlock()
+	n.cancel()
+	n.wg.Wait()
+}
+
+// run 按顺序投递一个 Webhook 队列中的通知
+func (n *notifier) run(queue chan delivery) {
+	defer n.wg.Done()
+	for {
+		select {
+		case <-n.ctx.Done():
+			return
+		case d := <-queue:
+			if err := n.deliver(d.webhook, d.notification); err != nil {
+				n.logger.Error("Failed to deliver alert notification",
+					zap.String("rule", d.notification.Rule),
+					zap.String("service", d.notification.Service),
+					zap.String("webhook", d.webhook.Name),
+					zap.Error(err))
+			}
+		}
+	}
+}
+
+// deliver 发送通知，失败时按指数退避重试
+func (n *notifier) deliver(webhook *WebhookConfig, notification Notification) error {
+	body, err := renderBody(webhook, notification)
+	if err != nil {
+		return err
+	}
+
+	backoff := webhook.Backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := n.send(webhook, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= webhook.MaxRetries {
+			return fmt.Errorf("after %d attempts: %v", attempt+1, err)
+		}
+
+		n.logger.Warn("Alert notification failed, retrying",
+			zap.String("webhook", webhook.Name),
+			zap.Duration("backoff", backoff),
+			zap.Error(err))
+
+		select {
+		case <-time.After(backoff):
+		case <-n.ctx.Done():
+			return n.ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// send 发送一次请求，返回失败时是否值得重试
+func (n *notifier) send(webhook *WebhookConfig, body []byte) (bool, error) {
+	ctx, cancel := context.WithTimeout(n.ctx, webhook.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, webhook.Method, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range webhook.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+}
+
+func renderBody(webhook *WebhookConfig, notification Notification) ([]byte, error) {
+	if webhook.template == nil {
+		return json.Marshal(notification)
+	}
+
+	var buf bytes.Buffer
+	if err := webhook.template.Execute(&buf, notification); err != nil {
+		return nil, fmt.Errorf("error rendering webhook body: %v", err)
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, fmt.Errorf("webhook body template produced invalid JSON")
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,289 @@
+// Package archive 将受监控服务的日志持续写入本地压缩文件，容器删除后仍可查询和下载
+package archive
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/YooLeon/container-debug-online/internal/docker"
+	"github.com/YooLeon/container-debug-online/internal/logs"
+	"go.uber.org/zap"
+)
+
+const (
+	// flushInterval 将压缩缓冲写入文件的间隔，决定查询能看到的最新日志
+	flushInterval = time.Second
+	// cleanupInterval 清理过期分段的间隔
+	cleanupInterval = time.Hour
+	// mergeWindow 跟随日志时的重排窗口
+	mergeWindow = 100 * time.Millisecond
+)
+
+// Options 配置日志归档
+type Options struct {
+	Dir         string        // 归档根目录，每个主机一个子目录
+	SegmentSize int64         // 单个分段的最大未压缩字节数
+	SegmentAge  time.Duration // 单个分段的最长时间跨度
+	Retention   time.Duration // 分段保留时间
+}
+
+// Collector 持续跟随一个主机上所有服务的日志并写入归档
+type Collector struct {
+	mu      sync.Mutex
+	monitor *docker.Monitor
+	logger  *zap.Logger
+	options Options
+	dir     string
+	writers map[string]*segmentWriter // key: serviceName
+	index   *trigramIndex
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewCollector 创建日志归档器，归档位于 options.Dir 下以主机名命名的目录
+func NewCollector(monitor *docker.Monitor, options Options, logger *zap.Logger) (*Collector, error) {
+	dir := filepath.Join(options.Dir, monitor.Name())
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating log archive directory: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Collector{
+		monitor: monitor,
+		logger:  logger,
+		options: options,
+		dir:     dir,
+		writers: make(map[string]*segmentWriter),
+		index:   newTrigramIndex(),
+		ctx:     ctx,
+		cancel:  cancel,
+	}, nil
+}
+
+// Host 返回归档所属主机的名称
+func (c *Collector) Host() string {
+	return c.monitor.Name()
+}
+
+// Start 开始跟随 compose 文件中所有服务的日志
+func (c *Collector) Start() {
+	for _, service := range c.monitor.GetComposeConfig().SortedServices {
+		c.wg.Add(1)
+		go func(service string) {
+			defer c.wg.Done()
+			c.collect(service)
+		}(service)
+	}
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.maintain()
+	}()
+}
+
+// Close 停止收集并关闭所有分段
+func (c *Collector) Close() error {
+	c.cancel()
+	c.wg.Wait()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var firstErr error
+	for service, writer := range c.writers {
+		if err := writer.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(c.writers, service)
+	}
+	return firstErr
+}
+
+// collect 跟随一个服务的日志，从归档中最后一条日志之后继续
+func (c *Collector) collect(service string) {
+	options := &logs.Options{Tail: "all", Stream: logs.StreamAll, Format: logs.FormatJSON}
+
+	lastTime, lastContainer := c.lastRecord(service)
+	if !lastTime.IsZero() {
+		options.Since = lastTime
+	}
+
+	target := logs.ServiceTarget(c.monitor, service)
+	for frame := range logs.Aggregate(c.ctx, c.monitor.Runtime(), []logs.Target{target}, options, mergeWindow, c.logger) {
+		// since 包含边界，跳过已归档的日志
+		if shortID(frame.ContainerID) == lastContainer && !frame.Time.After(lastTime) {
+			continue
+		}
+		if err := c.write(service, frame); err != nil {
+			c.logger.Error("Failed to archive log line",
+				zap.String("host", c.Host()),
+				zap.String("service", service),
+				zap.Error(err))
+		}
+	}
+}
+
+// lastRecord 返回服务归档中最后一条日志的时间和容器
+func (c *Collector) lastRecord(service string) (time.Time, string) {
+	segments, err := c.Segments(service)
+	if err != nil || len(segments) == 0 {
+		return time.Time{}, ""
+	}
+
+	last := segments[len(segments)-1]
+	cursor := newCursor(context.Background(), []Segment{last}, time.Time{}, time.Time{})
+	defer cursor.Close()
+
+	var lastTime time.Time
+	for {
+		frame, err := cursor.Next()
+		if err != nil {
+			break
+		}
+		if frame.Time.After(lastTime) {
+			lastTime = frame.Time
+		}
+	}
+	return lastTime, last.ContainerID
+}
+
+// write 将一条日志写入服务的当前分段，必要时轮转
+func (c *Collector) write(service string, frame logs.Frame) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	writer := c.writers[service]
+	containerID := shortID(frame.ContainerID)
+	if writer != nil && (writer.containerID != containerID ||
+		writer.size >= c.options.SegmentSize ||
+		time.Since(writer.opened) >= c.options.SegmentAge) {
+		if err := writer.Close(); err != nil {
+			c.logger.Warn("Failed to close log segment", zap.String("path", writer.path), zap.Error(err))
+		}
+		writer = nil
+	}
+
+	if writer == nil {
+		var err error
+		writer, err = openSegment(filepath.Join(c.dir, service), frame.Time, containerID)
+		if err != nil {
+			delete(c.writers, service)
+			return err
+		}
+		c.writers[service] = writer
+	}
+
+	trigrams, err := writer.Write(frame)
+	if err != nil {
+		return err
+	}
+	c.index.add(writer.path, trigrams)
+	return nil
+}
+
+// maintain 定期刷新压缩缓冲并清理过期分段
+func (c *Collector) maintain() {
+	flush := time.NewTicker(flushInterval)
+	defer flush.Stop()
+	cleanup := time.NewTicker(cleanupInterval)
+	defer cleanup.Stop()
+
+	c.loadIndex()
+	c.removeExpired()
+	for {
+		select {
+		case <-flush.C:
+			c.flush()
+		case <-cleanup.C:
+			c.removeExpired()
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *Collector) flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, writer := range c.writers {
+		if err := writer.Flush(); err != nil {
+			c.logger.Warn("Failed to flush log segment", zap.String("path", writer.path), zap.Error(err))
+		}
+	}
+}
+
+// removeExpired 删除最后写入时间早于保留期限的分段
+func (c *Collector) removeExpired() {
+	if c.options.Retention <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-c.options.Retention)
+
+	services, err := c.Services()
+	if err != nil {
+		c.logger.Warn("Failed to list archived services", zap.Error(err))
+		return
+	}
+
+	c.mu.Lock()
+	active := make(map[string]bool)
+	for _, writer := range c.writers {
+		active[writer.path] = true
+	}
+	c.mu.Unlock()
+
+	for _, service := range services {
+		segments, err := c.Segments(service)
+		if err != nil {
+			continue
+		}
+		for _, segment := range segments {
+			if segment.End.Before(cutoff) && !active[segment.path] {
+				if err := os.Remove(segment.path); err != nil {
+					c.logger.Warn("Failed to remove expired log segment", zap.String("path", segment.path), zap.Error(err))
+					continue
+				}
+				os.Remove(segment.path + indexExt)
+				c.index.remove(segment.path)
+			}
+		}
+	}
+}
+
+// Read 读取服务在时间范围内的归档日志，since 和 until 为零值时不限制
+func (c *Collector) Read(ctx context.Context, service string, since, until time.Time) (*Cursor, error) {
+	segments, err := c.Segments(service)
+	if err != nil {
+		return nil, err
+	}
+
+	// 读取当前分段前先写入压缩缓冲
+	c.flush()
+
+	var selected []Segment
+	for _, segment := range segments {
+		if !since.IsZero() && segment.End.Before(since) {
+			continue
+		}
+		if !until.IsZero() && segment.Start.After(until) {
+			continue
+		}
+		selected = append(selected, segment)
+	}
+	return newCursor(ctx, selected, since, until), nil
+}
+
+// shortID 返回 12 位容器 ID
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
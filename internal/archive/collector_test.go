@@ -0,0 +1,224 @@
+package archive
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/YooLeon/container-debug-online/internal/config"
+	"github.com/YooLeon/container-debug-online/internal/docker"
+	"github.com/YooLeon/container-debug-online/internal/logs"
+	"github.com/YooLeon/container-debug-online/internal/runtime/fake"
+	"go.uber.org/zap"
+)
+
+const (
+	firstID  = "c3c3c3c3c3c3c3c3c3c3c3c3c3c3c3c3"
+	secondID = "d4d4d4d4d4d4d4d4d4d4d4d4d4d4d4d4"
+)
+
+var logTime = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func newMonitor(t *testing.T, rt *fake.Runtime) *docker.Monitor {
+	t.Helper()
+
+	composeConfig := &config.ComposeConfig{
+		Project:        "demo",
+		Services:       map[string]config.ServiceConfig{"api": {Image: "demo/api"}},
+		SortedServices: []string{"api"},
+	}
+	monitor := docker.NewMonitor("local", rt, zap.NewNop(), time.Second, composeConfig)
+	if err := monitor.UpdateStatus(); err != nil {
+		t.Fatalf("UpdateStatus: %v", err)
+	}
+	t.Cleanup(func() { monitor.Close() })
+	return monitor
+}
+
+func startCollector(t *testing.T, monitor *docker.Monitor, options Options) *Collector {
+	t.Helper()
+
+	collector, err := NewCollector(monitor, options, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewCollector: %v", err)
+	}
+	collector.Start()
+	return collector
+}
+
+func readAll(t *testing.T, collector *Collector, since, until time.Time) []logs.Frame {
+	t.Helper()
+
+	cursor, err := collector.Read(context.Background(), "api", since, until)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	defer cursor.Close()
+
+	var frames []logs.Frame
+	for {
+		frame, err := cursor.Next()
+		if err == io.EOF {
+			return frames
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		frames = append(frames, frame)
+	}
+}
+
+// waitFrames 等待归档中出现 n 条日志
+func waitFrames(t *testing.T, collector *Collector, n int) []logs.Frame {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		frames := readAll(t, collector, time.Time{}, time.Time{})
+		if len(frames) >= n || time.Now().After(deadline) {
+			if len(frames) != n {
+				t.Fatalf("got %d archived lines, want %d: %+v", len(frames), n, frames)
+			}
+			return frames
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func defaultOptions(dir string) Options {
+	return Options{Dir: dir, SegmentSize: 1 << 20, SegmentAge: time.Hour, Retention: 24 * time.Hour}
+}
+
+func TestCollectorSurvivesRecreation(t *testing.T) {
+	rt := fake.New()
+	rt.AddContainer(fake.Container{
+		ID:      firstID,
+		Name:    "demo-api-1",
+		Project: "demo",
+		Service: "api",
+		Logs: []fake.LogLine{
+			{Time: logTime, Stream: "stdout", Text: "first started"},
+			{Time: logTime.Add(time.Second), Stream: "stderr", Text: "first warning"},
+		},
+	})
+	monitor := newMonitor(t, rt)
+	dir := t.TempDir()
+
+	collector := startCollector(t, monitor, defaultOptions(dir))
+	waitFrames(t, collector, 2)
+
+	// 正在写入的分段没有 gzip 尾部，也能读到已刷新的日志
+	rt.AppendLog(firstID, fake.LogLine{Time: logTime.Add(2 * time.Second), Stream: "stdout", Text: "first appended"})
+	frames := waitFrames(t, collector, 3)
+	if frames[2].Line != "first appended" || frames[2].Service != "api" || frames[2].Container != "demo-api-1" {
+		t.Errorf("unexpected frame: %+v", frames[2])
+	}
+	if err := collector.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// 删除并重建容器后重新启动归档
+	rt.RemoveContainer(firstID)
+	rt.AddContainer(fake.Container{
+		ID:      secondID,
+		Name:    "demo-api-1",
+		Project: "demo",
+		Service: "api",
+		Logs: []fake.LogLine{
+			{Time: logTime.Add(time.Minute), Stream: "stdout", Text: "second started"},
+		},
+	})
+
+	collector = startCollector(t, monitor, defaultOptions(dir))
+	defer collector.Close()
+	frames = waitFrames(t, collector, 4)
+
+	want := []string{"first started", "first warning", "first appended", "second started"}
+	for i, line := range want {
+		if frames[i].Line != line {
+			t.Errorf("line %d = %q, want %q", i, frames[i].Line, line)
+		}
+	}
+	if frames[3].ContainerID != secondID {
+		t.Errorf("container = %s, want %s", frames[3].ContainerID, secondID)
+	}
+
+	segments, err := collector.Segments("api")
+	if err != nil {
+		t.Fatalf("Segments: %v", err)
+	}
+	if len(segments) != 2 || segments[0].ContainerID != firstID[:12] || segments[1].ContainerID != secondID[:12] {
+		t.Errorf("unexpected segments: %+v", segments)
+	}
+
+	// 按时间范围只读取重建后的日志
+	frames = readAll(t, collector, logTime.Add(30*time.Second), time.Time{})
+	if len(frames) != 1 || frames[0].Line != "second started" {
+		t.Errorf("unexpected frames since recreation: %+v", frames)
+	}
+}
+
+func TestCollectorResumesWithoutDuplicates(t *testing.T) {
+	rt := fake.New()
+	rt.AddContainer(fake.Container{
+		ID:      firstID,
+		Name:    "demo-api-1",
+		Project: "demo",
+		Service: "api",
+		Logs:    []fake.LogLine{{Time: logTime, Stream: "stdout", Text: "started"}},
+	})
+	monitor := newMonitor(t, rt)
+	dir := t.TempDir()
+
+	collector := startCollector(t, monitor, defaultOptions(dir))
+	waitFrames(t, collector, 1)
+	collector.Close()
+
+	rt.AppendLog(firstID, fake.LogLine{Time: logTime.Add(time.Second), Stream: "stdout", Text: "while stopped"})
+
+	collector = startCollector(t, monitor, defaultOptions(dir))
+	defer collector.Close()
+	frames := waitFrames(t, collector, 2)
+	if frames[1].Line != "while stopped" {
+		t.Errorf("unexpected frames: %+v", frames)
+	}
+}
+
+func TestCollectorRotatesBySize(t *testing.T) {
+	rt := fake.New()
+	var lines []fake.LogLine
+	for i := 0; i < 5; i++ {
+		lines = append(lines, fake.LogLine{Time: logTime.Add(time.Duration(i) * time.Second), Stream: "stdout", Text: "line"})
+	}
+	rt.AddContainer(fake.Container{ID: firstID, Name: "demo-api-1", Project: "demo", Service: "api", Logs: lines})
+	monitor := newMonitor(t, rt)
+
+	options := defaultOptions(t.TempDir())
+	options.SegmentSize = 1 // 每行一个分段
+	collector := startCollector(t, monitor, options)
+	defer collector.Close()
+	waitFrames(t, collector, 5)
+
+	segments, err := collector.Segments("api")
+	if err != nil {
+		t.Fatalf("Segments: %v", err)
+	}
+	if len(segments) != 5 {
+		t.Errorf("got %d segments, want 5", len(segments))
+	}
+}
+
+func TestSegmentsRejectsInvalidService(t *testing.T) {
+	monitor := newMonitor(t, fake.New())
+	collector, err := NewCollector(monitor, defaultOptions(t.TempDir()), zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewCollector: %v", err)
+	}
+
+	for _, service := range []string{"", "..", "../other", "a/b"} {
+		if _, err := collector.Segments(service); err == nil {
+			t.Errorf("Segments(%q) succeeded", service)
+		}
+	}
+}
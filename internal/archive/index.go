@@ -0,0 +1,163 @@
+package archive
+
+import (
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/YooLeon/container-debug-online/internal/search"
+	"go.uber.org/zap"
+)
+
+// indexExt 分段三元组索引文件的扩展名，分段关闭时写出
+const indexExt = ".tri"
+
+// trigramIndex 记录每个三元组出现在哪些分段中
+type trigramIndex struct {
+	mu       sync.RWMutex
+	postings map[uint32]map[string]struct{} // key: trigram, value: 分段路径
+	indexed  map[string]bool                // 已建立索引的分段
+}
+
+func newTrigramIndex() *trigramIndex {
+	return &trigramIndex{
+		postings: make(map[uint32]map[string]struct{}),
+		indexed:  make(map[string]bool),
+	}
+}
+
+// add 将分段中的三元组加入索引
+func (idx *trigramIndex) add(path string, trigrams map[uint32]struct{}) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for trigram := range trigrams {
+		segments := idx.postings[trigram]
+		if segments == nil {
+			segments = make(map[string]struct{})
+			idx.postings[trigram] = segments
+		}
+		segments[path] = struct{}{}
+	}
+	idx.indexed[path] = true
+}
+
+// remove 从索引中删除分段
+func (idx *trigramIndex) remove(path string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if !idx.indexed[path] {
+		return
+	}
+	for trigram, segments := range idx.postings {
+		delete(segments, path)
+		if len(segments) == 0 {
+			delete(idx.postings, trigram)
+		}
+	}
+	delete(idx.indexed, path)
+}
+
+// candidate 判断分段是否可能包含所有三元组，未建立索引的分段总是需要扫描
+func (idx *trigramIndex) candidate(path string, trigrams []uint32) bool {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if !idx.indexed[path] {
+		return true
+	}
+	for _, trigram := range trigrams {
+		if _, ok := idx.postings[trigram][path]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// loadIndex 加载所有分段的索引，缺少索引文件的已关闭分段重新扫描建立索引
+func (c *Collector) loadIndex() {
+	services, err := c.Services()
+	if err != nil {
+		c.logger.Warn("Failed to list archived services", zap.Error(err))
+		return
+	}
+
+	for _, service := range services {
+		segments, err := c.Segments(service)
+		if err != nil {
+			continue
+		}
+		for _, segment := range segments {
+			if c.ctx.Err() != nil {
+				return
+			}
+			if c.isActive(segment.path) {
+				continue
+			}
+			if err := c.indexSegment(segment); err != nil {
+				c.logger.Warn("Failed to index log segment", zap.String("path", segment.path), zap.Error(err))
+			}
+		}
+	}
+}
+
+// indexSegment 读取分段的索引文件，不存在时扫描分段并写出
+func (c *Collector) indexSegment(segment Segment) error {
+	if file, err := os.Open(segment.path + indexExt); err == nil {
+		trigrams, err := search.ReadTrigrams(file)
+		file.Close()
+		if err == nil {
+			set := make(map[uint32]struct{}, len(trigrams))
+			for _, trigram := range trigrams {
+				set[trigram] = struct{}{}
+			}
+			c.index.add(segment.path, set)
+			return nil
+		}
+	}
+
+	set := make(map[uint32]struct{})
+	cursor := newCursor(c.ctx, []Segment{segment}, time.Time{}, time.Time{})
+	defer cursor.Close()
+	for {
+		frame, err := cursor.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		search.AddTrigrams(set, frame.Line)
+	}
+
+	c.index.add(segment.path, set)
+	return writeIndex(segment.path, set)
+}
+
+// writeIndex 写出分段的索引文件
+func writeIndex(path string, trigrams map[uint32]struct{}) error {
+	file, err := os.Create(path + indexExt)
+	if err != nil {
+		return err
+	}
+	if err := search.WriteTrigrams(file, trigrams); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// isActive 判断分段是否正在写入
+func (c *Collector) isActive(path string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, writer := range c.writers {
+		if writer.path == path {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+package archive
+
+import (
+	"context"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/YooLeon/container-debug-online/internal/logs"
+	"github.com/YooLeon/container-debug-online/internal/search"
+)
+
+// SearchOptions 表示一次搜索的参数
+type SearchOptions struct {
+	Query   *search.Query
+	Since   time.Time
+	Until   time.Time
+	Context int // 每个匹配前后附带的行数
+	Limit   int // 最多返回的匹配数
+
+	Multiline *logs.Multiline              // 按容器合并多行事件后再匹配，上下文同样以事件计
+	Services  []string                     // 只搜索这些服务，分段统计也只包含这些服务，为 nil 时不限
+	Allowed   func(frame *logs.Frame) bool // 返回 false 的行在匹配和计数之前跳过，为 nil 时不限
+}
+
+// Match 表示一条匹配的日志及其前后的行，上下文只包含同一分段中的日志
+type Match struct {
+	logs.Frame
+	Before []logs.Frame `json:"before,omitempty"`
+	After  []logs.Frame `json:"after,omitempty"`
+}
+
+// SearchResult 表示搜索结果
+type SearchResult struct {
+	Matches   []Match `json:"matches"`
+	Truncated bool    `json:"truncated"` // 匹配数超过 Limit
+	Segments  int     `json:"segments"`  // 时间范围内的分段数
+	Scanned   int     `json:"scanned"`   // 经索引筛选后实际读取的分段数
+}
+
+// Search 在归档中搜索日志，先用三元组索引排除不可能匹配的分段，再逐行匹配
+func (c *Collector) Search(ctx context.Context, options SearchOptions) (*SearchResult, error) {
+	services, err := c.Services()
+	if err != nil {
+		return nil, err
+	}
+
+	// 读取当前分段前先写入压缩缓冲
+	c.flush()
+
+	var permitted map[string]bool
+	if options.Services != nil {
+		permitted = make(map[string]bool, len(options.Services))
+		for _, service := range options.Services {
+			permitted[service] = true
+		}
+	}
+
+	var segments []Segment
+	for _, service := range services {
+		if !options.Query.MatchesService(service) || permitted != nil && !permitted[service] {
+			continue
+		}
+		serviceSegments, err := c.Segments(service)
+		if err != nil {
+			return nil, err
+		}
+		for _, segment := range serviceSegments {
+			if !options.Since.IsZero() && segment.End.Before(options.Since) {
+				continue
+			}
+			if !options.Until.IsZero() && segment.Start.After(options.Until) {
+				continue
+			}
+			segments = append(segments, segment)
+		}
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].Start.Before(segments[j].Start)
+	})
+
+	result := &SearchResult{Matches: []Match{}, Segments: len(segments)}
+	trigrams := options.Query.Trigrams()
+	for _, segment := range segments {
+		if result.Truncated {
+			break
+		}
+		if !c.index.candidate(segment.path, trigrams) {
+			continue
+		}
+		result.Scanned++
+		if err := c.searchSegment(ctx, segment, options, result); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(result.Matches, func(i, j int) bool {
+		return result.Matches[i].Time.Before(result.Matches[j].Time)
+	})
+	return result, nil
+}
+
+// searchSegment 逐行匹配一个分段，达到 Limit 后补齐最后几个匹配的后续行即停止
+func (c *Collector) searchSegment(ctx context.Context, segment Segment, options SearchOptions, result *SearchResult) error {
+	cursor := newCursor(ctx, []Segment{segment}, options.Since, options.Until)
+	defer cursor.Close()
+
+	var grouper *logs.FrameGrouper
+	if options.Multiline != nil {
+		grouper = logs.NewFrameGrouper(options.Multiline)
+	}
+
+	var before []logs.Frame
+	var pending []int // 还需要后续行的匹配
+	// process 处理一个事件，不再需要读取后续行时返回 false
+	process := func(frame logs.Frame) bool {
+		remaining := pending[:0]
+		for _, i := range pending {
+			match := &result.Matches[i]
+			match.After = append(match.After, frame)
+			if len(match.After) < options.Context {
+				remaining = append(remaining, i)
+			}
+		}
+		pending = remaining
+
+		if options.Query.Match(&frame) {
+			if len(result.Matches) >= options.Limit {
+				result.Truncated = true
+			} else {
+				entry := frame.Entry()
+				result.Matches = append(result.Matches, Match{
+					Frame:  logs.NewFrame(&entry, frame.Container, frame.ContainerID, frame.Service),
+					Before: append([]logs.Frame(nil), before...),
+				})
+				if options.Context > 0 {
+					pending = append(pending, len(result.Matches)-1)
+				}
+			}
+		}
+		if result.Truncated && len(pending) == 0 {
+			return false
+		}
+
+		if options.Context > 0 {
+			if len(before) == options.Context {
+				before = before[1:]
+			}
+			before = append(before, frame)
+		}
+		return true
+	}
+
+	for {
+		frame, err := cursor.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if options.Allowed != nil && !options.Allowed(&frame) {
+			continue
+		}
+		if grouper != nil {
+			var done bool
+			if frame, done = grouper.Add(frame); !done {
+				continue
+			}
+		}
+		if !process(frame) {
+			return nil
+		}
+	}
+	if grouper != nil {
+		for _, frame := range grouper.Flush() {
+			if !process(frame) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package archive
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/YooLeon/container-debug-online/internal/config"
+	"github.com/YooLeon/container-debug-online/internal/docker"
+	"github.com/YooLeon/container-debug-online/internal/logs"
+	"github.com/YooLeon/container-debug-online/internal/runtime/fake"
+	"github.com/YooLeon/container-debug-online/internal/search"
+	"go.uber.org/zap"
+)
+
+func newSearchRuntime(lines ...string) *fake.Runtime {
+	var logLines []fake.LogLine
+	for i, line := range lines {
+		logLines = append(logLines, fake.LogLine{Time: logTime.Add(time.Duration(i) * time.Second), Stream: "stdout", Text: line})
+	}
+	rt := fake.New()
+	rt.AddContainer(fake.Container{ID: firstID, Name: "demo-api-1", Project: "demo", Service: "api", Logs: logLines})
+	return rt
+}
+
+func mustParse(t *testing.T, input string) *search.Query {
+	t.Helper()
+
+	query, err := search.Parse(input)
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", input, err)
+	}
+	return query
+}
+
+func TestSearchContext(t *testing.T) {
+	rt := newSearchRuntime("one", "two", "request timeout", "three", "four", "second timeout")
+	collector := startCollector(t, newMonitor(t, rt), defaultOptions(t.TempDir()))
+	defer collector.Close()
+	waitFrames(t, collector, 6)
+
+	result, err := collector.Search(context.Background(), SearchOptions{Query: mustParse(t, "timeout"), Context: 2, Limit: 10})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(result.Matches) != 2 || result.Truncated {
+		t.Fatalf("result = %+v", result)
+	}
+
+	first := result.Matches[0]
+	if first.Line != "request timeout" || first.Service != "api" || first.Container != "demo-api-1" {
+		t.Errorf("first match = %+v", first.Frame)
+	}
+	if len(first.Before) != 2 || first.Before[0].Line != "one" || first.Before[1].Line != "two" {
+		t.Errorf("before = %+v", first.Before)
+	}
+	if len(first.After) != 2 || first.After[0].Line != "three" || first.After[1].Line != "four" {
+		t.Errorf("after = %+v", first.After)
+	}
+	second := result.Matches[1]
+	if len(second.Before) != 2 || second.Before[1].Line != "four" || len(second.After) != 0 {
+		t.Errorf("second match = %+v", second)
+	}
+
+	// 超过 limit 时仍补齐最后一个匹配的后续行
+	result, err = collector.Search(context.Background(), SearchOptions{Query: mustParse(t, "timeout"), Context: 1, Limit: 1})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(result.Matches) != 1 || !result.Truncated || len(result.Matches[0].After) != 1 {
+		t.Errorf("limited result = %+v", result)
+	}
+
+	// 时间范围
+	result, err = collector.Search(context.Background(), SearchOptions{Query: mustParse(t, "timeout"), Since: logTime.Add(3 * time.Second), Limit: 10})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(result.Matches) != 1 || result.Matches[0].Line != "second timeout" {
+		t.Errorf("ranged result = %+v", result)
+	}
+}
+
+func TestSearchUsesIndex(t *testing.T) {
+	rt := newSearchRuntime("alpha", "beta", "request timeout", "gamma", "delta")
+	dir := t.TempDir()
+	options := defaultOptions(dir)
+	options.SegmentSize = 1 // 每行一个分段
+	monitor := newMonitor(t, rt)
+
+	collector := startCollector(t, monitor, options)
+	waitFrames(t, collector, 5)
+
+	result, err := collector.Search(context.Background(), SearchOptions{Query: mustParse(t, "TIMEOUT"), Limit: 10})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(result.Matches) != 1 || result.Segments != 5 || result.Scanned != 1 {
+		t.Errorf("result = %+v", result)
+	}
+	if err := collector.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// 关闭的分段写出索引文件，重新加载后同样可以排除分段
+	segments, err := collector.Segments("api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, segment := range segments {
+		if _, err := os.Stat(segment.path + indexExt); err != nil {
+			t.Errorf("missing index for %s: %v", segment.path, err)
+		}
+	}
+	// 删除一个索引文件，加载时重新建立
+	if err := os.Remove(segments[2].path + indexExt); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := NewCollector(monitor, options, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded.loadIndex()
+	result, err = reloaded.Search(context.Background(), SearchOptions{Query: mustParse(t, `/req\w+ timeout/`), Limit: 10})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(result.Matches) != 1 || result.Scanned != 1 {
+		t.Errorf("reloaded result = %+v", result)
+	}
+	if _, err := os.Stat(segments[2].path + indexExt); err != nil {
+		t.Errorf("index was not rebuilt: %v", err)
+	}
+}
+
+func TestSearchPermissionsAndMultiline(t *testing.T) {
+	rt := fake.New()
+	rt.AddContainer(fake.Container{ID: secondID, Name: "demo-worker-1", Project: "demo", Service: "worker", Logs: []fake.LogLine{
+		{Time: logTime, Stream: "stdout", Text: "worker timeout"},
+	}})
+	rt.AddContainer(fake.Container{ID: firstID, Name: "demo-api-1", Project: "demo", Service: "api", Logs: []fake.LogLine{
+		{Time: logTime.Add(time.Second), Stream: "stdout", Text: "java.lang.IllegalStateException: timeout"},
+		{Time: logTime.Add(2 * time.Second), Stream: "stdout", Text: "\tat com.example.Api.call(Api.java:10)"},
+		{Time: logTime.Add(3 * time.Second), Stream: "stdout", Text: "request timeout"},
+	}})
+	monitor := docker.NewMonitor("local", rt, zap.NewNop(), time.Second, &config.ComposeConfig{
+		Project:        "demo",
+		Services:       map[string]config.ServiceConfig{"api": {Image: "demo/api"}, "worker": {Image: "demo/worker"}},
+		SortedServices: []string{"api", "worker"},
+	})
+	if err := monitor.UpdateStatus(); err != nil {
+		t.Fatalf("UpdateStatus: %v", err)
+	}
+	defer monitor.Close()
+	collector := startCollector(t, monitor, defaultOptions(t.TempDir()))
+	defer collector.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		result, err := collector.Search(context.Background(), SearchOptions{Query: mustParse(t, "timeout"), Limit: 10})
+		if err != nil {
+			t.Fatalf("Search: %v", err)
+		}
+		if len(result.Matches) == 3 || time.Now().After(deadline) {
+			if len(result.Matches) != 3 || result.Segments != 2 {
+				t.Fatalf("result = %+v", result)
+			}
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// 没有权限的服务不计入 limit 和分段统计
+	result, err := collector.Search(context.Background(), SearchOptions{Query: mustParse(t, "timeout"), Limit: 1, Services: []string{"api"}})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(result.Matches) != 1 || result.Matches[0].Service != "api" || result.Segments != 1 || result.Scanned != 1 {
+		t.Errorf("service scoped result = %+v", result)
+	}
+	result, _ = collector.Search(context.Background(), SearchOptions{Query: mustParse(t, "timeout"), Limit: 10, Services: []string{}})
+	if len(result.Matches) != 0 || result.Segments != 0 {
+		t.Errorf("empty services result = %+v", result)
+	}
+
+	// 没有权限的容器在计入 limit 之前跳过，也不出现在上下文中
+	result, _ = collector.Search(context.Background(), SearchOptions{
+		Query:   mustParse(t, "timeout"),
+		Limit:   1,
+		Context: 5,
+		Allowed: func(frame *logs.Frame) bool { return frame.Container != "demo-worker-1" },
+	})
+	if len(result.Matches) != 1 || result.Matches[0].Container != "demo-api-1" || len(result.Matches[0].Before) != 0 {
+		t.Errorf("container scoped result = %+v", result)
+	}
+
+	// 多行事件作为整体匹配，上下文同样以事件计
+	multiline, _ := logs.ParseMultiline("java", "")
+	result, _ = collector.Search(context.Background(), SearchOptions{Query: mustParse(t, `service:api "Api.java"`), Limit: 10, Context: 1, Multiline: multiline})
+	if len(result.Matches) != 1 || !strings.HasPrefix(result.Matches[0].Line, "java.lang.IllegalStateException: timeout\n\tat ") {
+		t.Fatalf("multiline result = %+v", result)
+	}
+	if after := result.Matches[0].After; len(after) != 1 || after[0].Line != "request timeout" {
+		t.Errorf("after = %+v", after)
+	}
+}
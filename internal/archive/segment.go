@@ -0,0 +1,303 @@
+package archive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/YooLeon/container-debug-online/internal/logs"
+	"github.com/YooLeon/container-debug-online/internal/search"
+)
+
+// segmentExt 分段文件的扩展名，文件名为 <开始时间 UnixNano>_<12 位容器 ID>
+const segmentExt = ".ndjson.gz"
+
+// Segment 表示一个归档分段文件，结束时间取文件的最后修改时间
+type Segment struct {
+	Service     string    `json:"service"`
+	ContainerID string    `json:"container_id"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	Size        int64     `json:"size"` // 压缩后的字节数
+	path        string
+}
+
+// record 分段中的一行，服务名由目录决定
+type record struct {
+	Time        time.Time `json:"ts"`
+	Stream      string    `json:"stream"`
+	Container   string    `json:"container"`
+	ContainerID string    `json:"container_id"`
+	Line        string    `json:"line"`
+}
+
+// Services 返回有归档日志的服务
+func (c *Collector) Services() ([]string, error) {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading log archive: %v", err)
+	}
+
+	var services []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			services = append(services, entry.Name())
+		}
+	}
+	return services, nil
+}
+
+// Segments 按开始时间返回服务的归档分段，服务没有归档时返回空列表
+func (c *Collector) Segments(service string) ([]Segment, error) {
+	if service == "" || service != filepath.Base(service) || service == "." || service == ".." {
+		return nil, fmt.Errorf("invalid service name: %s", service)
+	}
+
+	dir := filepath.Join(c.dir, service)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading log archive: %v", err)
+	}
+
+	var segments []Segment
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		start, containerID, ok := strings.Cut(strings.TrimSuffix(name, segmentExt), "_")
+		if !ok {
+			continue
+		}
+		nanos, err := strconv.ParseInt(start, 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		segments = append(segments, Segment{
+			Service:     service,
+			ContainerID: containerID,
+			Start:       time.Unix(0, nanos).UTC(),
+			End:         info.ModTime().UTC(),
+			Size:        info.Size(),
+			path:        filepath.Join(dir, name),
+		})
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].Start.Before(segments[j].Start)
+	})
+	return segments, nil
+}
+
+// segmentWriter 写入当前分段
+type segmentWriter struct {
+	path        string
+	containerID string
+	opened      time.Time
+	size        int64 // 未压缩的字节数
+	dirty       bool
+	file        *os.File
+	gzip        *gzip.Writer
+	trigrams    map[uint32]struct{}
+}
+
+// openSegment 在 dir 中创建新的分段文件
+func openSegment(dir string, start time.Time, containerID string) (*segmentWriter, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating log archive directory: %v", err)
+	}
+
+	// 同一时间开始的分段顺延一纳秒，保持文件名唯一
+	var path string
+	var file *os.File
+	for nanos := start.UnixNano(); ; nanos++ {
+		path = filepath.Join(dir, fmt.Sprintf("%d_%s%s", nanos, containerID, segmentExt))
+		var err error
+		file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("error creating log segment: %v", err)
+		}
+	}
+
+	return &segmentWriter{
+		path:        path,
+		containerID: containerID,
+		opened:      time.Now(),
+		file:        file,
+		gzip:        gzip.NewWriter(file),
+		trigrams:    make(map[uint32]struct{}),
+	}, nil
+}
+
+// Write 写入一行日志，返回该行的三元组
+func (s *segmentWriter) Write(frame logs.Frame) (map[uint32]struct{}, error) {
+	data, err := json.Marshal(record{
+		Time:        frame.Time,
+		Stream:      frame.Stream,
+		Container:   frame.Container,
+		ContainerID: frame.ContainerID,
+		Line:        frame.Line,
+	})
+	if err != nil {
+		return nil, err
+	}
+	data = append(data, '\n')
+
+	n, err := s.gzip.Write(data)
+	s.size += int64(n)
+	s.dirty = true
+	if err != nil {
+		return nil, err
+	}
+
+	trigrams := make(map[uint32]struct{})
+	search.AddTrigrams(trigrams, frame.Line)
+	for trigram := range trigrams {
+		s.trigrams[trigram] = struct{}{}
+	}
+	return trigrams, nil
+}
+
+// Flush 将压缩缓冲写入文件，读取方可以解压到已写入的最后一行
+func (s *segmentWriter) Flush() error {
+	if !s.dirty {
+		return nil
+	}
+	s.dirty = false
+	return s.gzip.Flush()
+}
+
+// Close 关闭分段并写出索引文件
+func (s *segmentWriter) Close() error {
+	if err := s.gzip.Close(); err != nil {
+		s.file.Close()
+		return err
+	}
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	return writeIndex(s.path, s.trigrams)
+}
+
+// Cursor 按顺序读取多个分段中的日志
+type Cursor struct {
+	ctx      context.Context
+	segments []Segment
+	since    time.Time
+	until    time.Time
+
+	file    *os.File
+	reader  *bufio.Reader
+	service string
+}
+
+func newCursor(ctx context.Context, segments []Segment, since, until time.Time) *Cursor {
+	return &Cursor{ctx: ctx, segments: segments, since: since, until: until}
+}
+
+// Next 返回下一条日志，读完所有分段后返回 io.EOF
+func (c *Cursor) Next() (logs.Frame, error) {
+	for {
+		if err := c.ctx.Err(); err != nil {
+			return logs.Frame{}, err
+		}
+
+		if c.reader == nil {
+			if len(c.segments) == 0 {
+				return logs.Frame{}, io.EOF
+			}
+			if err := c.open(c.segments[0]); err != nil {
+				return logs.Frame{}, err
+			}
+			c.segments = c.segments[1:]
+		}
+
+		line, err := c.reader.ReadBytes('\n')
+		if err != nil {
+			// 正在写入的分段没有 gzip 尾部，读到已刷新的最后一行为止
+			c.closeSegment()
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				continue
+			}
+			return logs.Frame{}, err
+		}
+
+		var rec record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			continue
+		}
+		if !c.since.IsZero() && rec.Time.Before(c.since) {
+			continue
+		}
+		if !c.until.IsZero() && rec.Time.After(c.until) {
+			continue
+		}
+		return logs.Frame{
+			Time:        rec.Time,
+			Stream:      rec.Stream,
+			Container:   rec.Container,
+			ContainerID: rec.ContainerID,
+			Service:     c.service,
+			Line:        rec.Line,
+		}, nil
+	}
+}
+
+func (c *Cursor) open(segment Segment) error {
+	file, err := os.Open(segment.path)
+	if err != nil {
+		// 列出后被保留期清理删除的分段
+		if os.IsNotExist(err) {
+			c.reader = bufio.NewReader(strings.NewReader(""))
+			return nil
+		}
+		return fmt.Errorf("error opening log segment: %v", err)
+	}
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		// 刚创建还没有写入数据的分段
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			c.reader = bufio.NewReader(strings.NewReader(""))
+			return nil
+		}
+		return fmt.Errorf("error reading log segment %s: %v", filepath.Base(segment.path), err)
+	}
+	c.file = file
+	c.reader = bufio.NewReader(gz)
+	c.service = segment.Service
+	return nil
+}
+
+func (c *Cursor) closeSegment() {
+	if c.file != nil {
+		c.file.Close()
+		c.file = nil
+	}
+	c.reader = nil
+}
+
+// Close 关闭正在读取的分段
+func (c *Cursor) Close() error {
+	c.closeSegment()
+	return nil
+}
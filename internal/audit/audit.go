@@ -0,0 +1,287 @@
+// Package audit 记录用户操作的审计事件：谁在什么时候从哪里对哪个容器做了什么，结果和耗时
+// 事件以 JSON Lines 追加写入文件，并可同时发送到 syslog
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 审计的操作
+const (
+	ActionLogin         = "login"
+	ActionLogout        = "logout"
+	ActionTerminal      = "terminal"       // 打开交互式终端，耗时为会话时长
+	ActionLogsStream    = "logs.stream"    // 实时日志和聚合日志
+	ActionLogsDownload  = "logs.download"  // 下载容器或服务的日志
+	ActionLogsArchive   = "logs.archive"   // 读取归档日志
+	ActionLogsSearch    = "logs.search"    // 搜索归档日志
+	ActionSilenceCreate = "silence.create" // 创建告警静默
+	ActionSilenceDelete = "silence.delete" // 删除告警静默
+	ActionTokenCreate   = "token.create"   // 创建 API 令牌
+	ActionTokenRevoke   = "token.revoke"   // 吊销 API 令牌
+	ActionQuery         = "audit.query"    // 查询审计日志
+)
+
+// 操作结果
+const (
+	ResultSuccess = "success"
+	ResultDenied  = "denied"  // 认证失败或没有权限
+	ResultFailure = "failure" // 请求无效或执行出错
+)
+
+const (
+	// DefaultQueryLimit 查询未指定 limit 时返回的事件数
+	DefaultQueryLimit = 100
+	// MaxQueryLimit 单次查询最多返回的事件数
+	MaxQueryLimit = 1000
+	// maxLineSize 读取审计文件时单行的最大字节数
+	maxLineSize = 1 << 20
+)
+
+// Event 审计事件
+type Event struct {
+	Time       time.Time         `json:"time"`
+	User       string            `json:"user,omitempty"`
+	Token      string            `json:"token,omitempty"` // 使用 API 令牌时为令牌 ID
+	Remote     string            `json:"remote"`
+	Action     string            `json:"action"`
+	Host       string            `json:"host,omitempty"`
+	Project    string            `json:"project,omitempty"`
+	Service    string            `json:"service,omitempty"`
+	Container  string            `json:"container,omitempty"`
+	Target     string            `json:"target,omitempty"` // 容器以外的操作对象，例如静默或令牌的 ID
+	Params     map[string]string `json:"params,omitempty"`
+	Result     string            `json:"result"`
+	Status     int               `json:"status,omitempty"` // HTTP 状态码
+	Error      string            `json:"error,omitempty"`
+	DurationMS int64             `json:"duration_ms"`
+}
+
+// Options 审计日志的输出，至少需要指定一项
+type Options struct {
+	File   string // JSON Lines 文件，只追加写入
+	Syslog string // "local" 表示本机 syslog，或 udp://host:514、tcp://host:514
+}
+
+// Log 审计日志
+type Log struct {
+	path   string
+	mu     sync.Mutex
+	file   *os.File
+	syslog io.WriteCloser
+}
+
+// Open 打开审计日志文件和 syslog 连接
+func Open(opts Options) (*Log, error) {
+	if opts.File == "" && opts.Syslog == "" {
+		return nil, fmt.Errorf("audit log requires a file or a syslog address")
+	}
+
+	l := &Log{path: opts.File}
+	if opts.File != "" {
+		file, err := os.OpenFile(opts.File, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("error opening audit log: %v", err)
+		}
+		l.file = file
+		if err := terminateLine(file); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("error opening audit log: %v", err)
+		}
+	}
+	if opts.Syslog != "" {
+		writer, err := dialSyslog(opts.Syslog)
+		if err != nil {
+			l.Close()
+			return nil, fmt.Errorf("error connecting to syslog: %v", err)
+		}
+		l.syslog = writer
+	}
+	return l, nil
+}
+
+// terminateLine 上次写入中断时补上换行，避免下一条事件与不完整的行连在一起
+func terminateLine(file *os.File) error {
+	info, err := file.Stat()
+	if err != nil || info.Size() == 0 {
+		return err
+	}
+	last := make([]byte, 1)
+	if _, err := file.ReadAt(last, info.Size()-1); err != nil {
+		return err
+	}
+	if last[0] != '\n' {
+		_, err = file.Write([]byte{'\n'})
+	}
+	return err
+}
+
+// Record 写入一条事件，所有输出都会尝试写入，返回第一个错误
+func (l *Log) Record(event Event) error {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	event.Time = event.Time.UTC()
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var firstErr error
+	if l.file != nil {
+		// 每个事件一次写入，O_APPEND 保证不会覆盖已有内容
+		if _, err := l.file.Write(append(line, '\n')); err != nil {
+			firstErr = fmt.Errorf("error writing audit log: %v", err)
+		}
+	}
+	if l.syslog != nil {
+		if _, err := l.syslog.Write(line); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("error sending audit event to syslog: %v", err)
+		}
+	}
+	return firstErr
+}
+
+// Queryable 判断能否查询，只发送到 syslog 时不能查询
+func (l *Log) Queryable() bool {
+	return l.path != ""
+}
+
+// Query 审计日志的查询条件，空字段表示不限
+type Query struct {
+	User      string
+	Action    string // 支持 glob，例如 logs.*
+	Host      string
+	Service   string
+	Container string
+	Result    string
+	Since     time.Time
+	Until     time.Time
+	Limit     int
+}
+
+// ParseQuery 解析查询参数：user、action、host、service、container、result、
+// since 和 until（RFC 3339 或相对于现在的时长，例如 24h）以及 limit
+func ParseQuery(values url.Values) (Query, error) {
+	q := Query{
+		User:      values.Get("user"),
+		Action:    values.Get("action"),
+		Host:      values.Get("host"),
+		Service:   values.Get("service"),
+		Container: values.Get("container"),
+		Result:    values.Get("result"),
+		Limit:     DefaultQueryLimit,
+	}
+	if _, err := path.Match(q.Action, ""); err != nil {
+		return q, fmt.Errorf("invalid action pattern %q", q.Action)
+	}
+	var err error
+	if q.Since, err = parseTime(values.Get("since")); err != nil {
+		return q, fmt.Errorf("invalid since: %v", err)
+	}
+	if q.Until, err = parseTime(values.Get("until")); err != nil {
+		return q, fmt.Errorf("invalid until: %v", err)
+	}
+	if limit := values.Get("limit"); limit != "" {
+		if q.Limit, err = strconv.Atoi(limit); err != nil || q.Limit <= 0 || q.Limit > MaxQueryLimit {
+			return q, fmt.Errorf("invalid limit: must be between 1 and %d", MaxQueryLimit)
+		}
+	}
+	return q, nil
+}
+
+// parseTime 解析 RFC 3339 时间或相对于现在的时长
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// Match 判断事件是否符合查询条件
+func (q Query) Match(event *Event) bool {
+	if q.Action != "" {
+		if ok, _ := path.Match(q.Action, event.Action); !ok {
+			return false
+		}
+	}
+	return (q.User == "" || q.User == event.User) &&
+		(q.Host == "" || q.Host == event.Host) &&
+		(q.Service == "" || q.Service == event.Service) &&
+		(q.Container == "" || q.Container == event.Container) &&
+		(q.Result == "" || q.Result == event.Result) &&
+		(q.Since.IsZero() || !event.Time.Before(q.Since)) &&
+		(q.Until.IsZero() || event.Time.Before(q.Until))
+}
+
+// Query 从审计文件中查询事件，按时间倒序返回最近的 Limit 条
+func (l *Log) Query(q Query) ([]Event, error) {
+	if !l.Queryable() {
+		return nil, fmt.Errorf("audit log is only sent to syslog")
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultQueryLimit
+	}
+
+	file, err := os.Open(l.path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening audit log: %v", err)
+	}
+	defer file.Close()
+
+	// 保留最后 Limit 条匹配的事件
+	ring := make([]Event, 0, q.Limit)
+	next := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64<<10), maxLineSize)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil || !q.Match(&event) {
+			// 跳过写入中断留下的不完整行
+			continue
+		}
+		if len(ring) < q.Limit {
+			ring = append(ring, event)
+		} else {
+			ring[next] = event
+		}
+		next = (next + 1) % q.Limit
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading audit log: %v", err)
+	}
+
+	events := make([]Event, 0, len(ring))
+	for i := 0; i < len(ring); i++ {
+		events = append(events, ring[(next-1-i+2*len(ring))%len(ring)])
+	}
+	return events, nil
+}
+
+// Close 关闭文件和 syslog 连接
+func (l *Log) Close() error {
+	var err error
+	if l.file != nil {
+		err = l.file.Close()
+	}
+	if l.syslog != nil {
+		if serr := l.syslog.Close(); err == nil {
+			err = serr
+		}
+	}
+	return err
+}
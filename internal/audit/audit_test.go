@@ -0,0 +1,105 @@
+package audit
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogRecordAndQuery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l, err := Open(Options{File: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC)
+	events := []Event{
+		{Time: start, User: "alice", Action: ActionLogin, Result: ResultSuccess},
+		{Time: start.Add(time.Minute), User: "alice", Action: ActionTerminal, Container: "demo-api-1", Result: ResultSuccess},
+		{Time: start.Add(2 * time.Minute), User: "bob", Action: ActionLogsDownload, Container: "demo-api-1", Result: ResultDenied},
+		{Time: start.Add(3 * time.Minute), User: "alice", Action: ActionLogsStream, Container: "demo-worker-1", Result: ResultSuccess},
+	}
+	for _, event := range events {
+		if err := l.Record(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 模拟中断的写入留下的不完整行
+	l.file.WriteString(`{"time":"2024-01-02T03:05:00Z","user":"tr`)
+	l.Close()
+
+	// 重新打开后继续追加，已有事件保留，不完整的行被跳过
+	if l, err = Open(Options{File: path}); err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if err := l.Record(Event{Time: start.Add(4 * time.Minute), User: "bob", Action: ActionLogout, Result: ResultSuccess}); err != nil {
+		t.Fatal(err)
+	}
+
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("audit log mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	tests := []struct {
+		query string
+		want  []string // 按时间倒序的 user/action
+	}{
+		{"", []string{"bob/logout", "alice/logs.stream", "bob/logs.download", "alice/terminal", "alice/login"}},
+		{"user=alice&limit=2", []string{"alice/logs.stream", "alice/terminal"}},
+		{"action=logs.*", []string{"alice/logs.stream", "bob/logs.download"}},
+		{"container=demo-api-1&result=denied", []string{"bob/logs.download"}},
+		{"since=2024-01-02T03:01:00Z&until=2024-01-02T03:03:00Z", []string{"bob/logs.download", "alice/terminal"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			values, _ := url.ParseQuery(tt.query)
+			q, err := ParseQuery(values)
+			if err != nil {
+				t.Fatal(err)
+			}
+			events, err := l.Query(q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, event := range events {
+				got = append(got, event.User+"/"+event.Action)
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseQueryInvalid(t *testing.T) {
+	for _, query := range []string{"limit=0", "limit=5000", "since=yesterday", "action=["} {
+		values, _ := url.ParseQuery(query)
+		if _, err := ParseQuery(values); err == nil {
+			t.Errorf("expected error for %q", query)
+		}
+	}
+}
+
+func TestOpenInvalid(t *testing.T) {
+	if _, err := Open(Options{}); err == nil {
+		t.Error("opened an audit log without outputs")
+	}
+	if _, err := Open(Options{Syslog: "http://localhost:514"}); err == nil {
+		t.Error("accepted an invalid syslog address")
+	}
+
+	l, err := Open(Options{Syslog: "udp://127.0.0.1:1"})
+	if err != nil {
+		t.Skipf("syslog unavailable: %v", err)
+	}
+	defer l.Close()
+	if _, err := l.Query(Query{}); err == nil || l.Queryable() {
+		t.Error("queried a syslog-only audit log")
+	}
+}
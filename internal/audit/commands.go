@@ -0,0 +1,392 @@
+package audit
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// ActionCommand 终端中提交的命令
+const ActionCommand = "terminal.command"
+
+// maxCommandLength 单条命令的最大字符数，超出部分丢弃
+const maxCommandLength = 16 << 10
+
+// maxPromptLength 检测密码提示时保留的输出行末尾字符数
+const maxPromptLength = 256
+
+// passwordPrompt 不回显输入的密码提示，例如 sudo、ssh 和 passwd 的提示
+var passwordPrompt = regexp.MustCompile(`(?i)(?:password|passphrase|口令|密码).*[:：]\s*$`)
+
+// 括号粘贴模式的起止标记
+const (
+	pasteStart = "200"
+	pasteEnd   = "\x1b[201~"
+)
+
+// Command 从终端输入还原出的一条命令
+type Command struct {
+	Line        string
+	Pasted      bool // 包含括号粘贴的内容
+	Approximate bool // 使用了补全、反向搜索或本会话之外的历史记录，实际执行的命令可能不同
+	Secret      bool // 在密码提示之后输入，Line 已替换为 [REDACTED]
+}
+
+// 转义序列的解析状态
+const (
+	stateNormal = iota
+	stateEscape // 收到 ESC
+	stateCSI    // ESC [ 之后，收集参数直到结束字符
+	stateSS3    // ESC O 之后的一个字符
+	statePaste  // 括号粘贴中
+	stateOSC    // 输出中 ESC ] 之后的窗口标题等，直到 BEL 或 ESC
+)
+
+// CommandParser 按照 readline 的常见按键，从终端的输入流中还原用户提交的命令行
+// 只能看到输入，无法得知 shell 的补全结果等，因此是启发式的
+type CommandParser struct {
+	line    []rune
+	cursor  int
+	pasted  bool
+	approx  bool
+	lastCR  bool
+	state   int
+	params  []rune
+	marker  []rune // 粘贴中可能是结束标记开头的字符
+	pasteCR bool
+	history []string
+	recall  int // 当前浏览的历史记录位置，等于 len(history) 表示正在编辑新命令
+
+	// 终端输出中当前行的内容，用于检测密码提示
+	output      []rune
+	outputState int
+	secret      bool // 输出停在密码提示上，下一行输入是密码
+}
+
+// NewCommandParser 创建命令解析器，每个终端会话一个
+func NewCommandParser() *CommandParser {
+	return &CommandParser{}
+}
+
+// Write 处理一段输入，返回其中提交的命令，空命令不返回
+func (p *CommandParser) Write(data string) []Command {
+	var commands []Command
+	for _, r := range data {
+		if cmd, ok := p.feed(r); ok {
+			commands = append(commands, cmd)
+		}
+	}
+	return commands
+}
+
+// Output 处理一段终端输出，输出停在密码提示上时，下一次提交的内容不记录
+// 密码提示之后的换行表示提示已经结束，例如程序超时退出
+func (p *CommandParser) Output(data string) {
+	for _, r := range data {
+		switch p.outputState {
+		case stateEscape:
+			switch r {
+			case '[':
+				p.outputState = stateCSI
+			case ']':
+				p.outputState = stateOSC
+			default:
+				p.outputState = stateNormal
+			}
+			continue
+		case stateCSI:
+			if r < 0x20 || r > 0x3f {
+				p.outputState = stateNormal
+			}
+			continue
+		case stateOSC:
+			switch r {
+			case 0x07:
+				p.outputState = stateNormal
+			case 0x1b:
+				p.outputState = stateEscape
+			}
+			continue
+		}
+
+		switch r {
+		case 0x1b:
+			p.outputState = stateEscape
+		case '\n':
+			p.output, p.secret = p.output[:0], false
+		case '\r':
+			p.output = p.output[:0]
+		default:
+			if unicode.IsPrint(r) {
+				p.output = append(p.output, r)
+			}
+		}
+	}
+	if len(p.output) > maxPromptLength {
+		p.output = append(p.output[:0], p.output[len(p.output)-maxPromptLength:]...)
+	}
+	if passwordPrompt.MatchString(string(p.output)) {
+		p.secret = true
+	}
+}
+
+// feed 处理一个字符，提交命令时返回 true
+func (p *CommandParser) feed(r rune) (Command, bool) {
+	switch p.state {
+	case stateEscape:
+		p.state = stateNormal
+		switch r {
+		case '[':
+			p.state, p.params = stateCSI, p.params[:0]
+		case 'O':
+			p.state = stateSS3
+		case 'b', 'B':
+			p.cursor = p.wordStart()
+		case 'f', 'F':
+			p.cursor = p.wordEnd()
+		case 'd', 'D':
+			p.delete(p.cursor, p.wordEnd())
+		case 0x7f, '\b':
+			p.delete(p.wordStart(), p.cursor)
+		}
+		return Command{}, false
+	case stateCSI:
+		// 参数和中间字符在 0x20-0x3f，结束字符在 0x40-0x7e
+		if r >= 0x20 && r <= 0x3f {
+			p.params = append(p.params, r)
+			return Command{}, false
+		}
+		p.state = stateNormal
+		p.csi(string(p.params), r)
+		return Command{}, false
+	case stateSS3:
+		p.state = stateNormal
+		p.csi("", r)
+		return Command{}, false
+	case statePaste:
+		p.pasteRune(r)
+		return Command{}, false
+	}
+
+	lastCR := p.lastCR
+	p.lastCR = r == '\r'
+	switch r {
+	case '\r':
+		return p.submit()
+	case '\n':
+		// \r\n 只提交一次
+		if lastCR {
+			return Command{}, false
+		}
+		return p.submit()
+	case 0x1b:
+		p.state = stateEscape
+	case 0x7f, '\b': // 退格
+		if p.cursor > 0 {
+			p.delete(p.cursor-1, p.cursor)
+		}
+	case 0x01: // Ctrl-A
+		p.cursor = 0
+	case 0x05: // Ctrl-E
+		p.cursor = len(p.line)
+	case 0x02: // Ctrl-B
+		p.move(-1)
+	case 0x06: // Ctrl-F
+		p.move(1)
+	case 0x04: // Ctrl-D，空行时为退出
+		if p.cursor < len(p.line) {
+			p.delete(p.cursor, p.cursor+1)
+		}
+	case 0x0b: // Ctrl-K
+		p.delete(p.cursor, len(p.line))
+	case 0x15: // Ctrl-U
+		p.delete(0, p.cursor)
+	case 0x17: // Ctrl-W
+		p.delete(p.spaceWordStart(), p.cursor)
+	case 0x03: // Ctrl-C 放弃当前行
+		p.reset()
+	case 0x10: // Ctrl-P
+		p.recallHistory(-1)
+	case 0x0e: // Ctrl-N
+		p.recallHistory(1)
+	case '\t', 0x12: // 补全和 Ctrl-R 反向搜索的结果只有 shell 知道
+		p.approx = true
+	default:
+		if unicode.IsPrint(r) {
+			p.insert(r)
+		}
+	}
+	return Command{}, false
+}
+
+// csi 处理光标键、Home/End/Delete 和括号粘贴等转义序列
+func (p *CommandParser) csi(params string, final rune) {
+	// 带修饰键的方向键，例如 Ctrl-→ 为 ESC [1;5C，按单词移动
+	modified := strings.Contains(params, ";")
+	switch {
+	case final == 'A':
+		p.recallHistory(-1)
+	case final == 'B':
+		p.recallHistory(1)
+	case final == 'C' && modified:
+		p.cursor = p.wordEnd()
+	case final == 'D' && modified:
+		p.cursor = p.wordStart()
+	case final == 'C':
+		p.move(1)
+	case final == 'D':
+		p.move(-1)
+	case final == 'H' || (final == '~' && (params == "1" || params == "7")):
+		p.cursor = 0
+	case final == 'F' || (final == '~' && (params == "4" || params == "8")):
+		p.cursor = len(p.line)
+	case final == '~' && params == "3":
+		if p.cursor < len(p.line) {
+			p.delete(p.cursor, p.cursor+1)
+		}
+	case final == '~' && params == pasteStart:
+		p.state, p.marker, p.pasteCR = statePaste, p.marker[:0], false
+		p.pasted = true
+	}
+}
+
+// pasteRune 粘贴的内容原样插入，其中的换行不提交命令，直到遇到结束标记
+func (p *CommandParser) pasteRune(r rune) {
+	p.marker = append(p.marker, r)
+	if marker := string(p.marker); strings.HasPrefix(pasteEnd, marker) {
+		if marker == pasteEnd {
+			p.state, p.marker = stateNormal, p.marker[:0]
+		}
+		return
+	}
+
+	// 不是结束标记，最后一个 ESC 可能是新的结束标记的开头
+	pending := p.marker
+	if r == 0x1b {
+		pending = pending[:len(pending)-1]
+	}
+	for _, c := range pending {
+		switch {
+		case c == '\n' && p.pasteCR:
+		case c == '\r' || c == '\n':
+			p.insert('\n')
+		case unicode.IsPrint(c) || c == '\t':
+			p.insert(c)
+		}
+		p.pasteCR = c == '\r'
+	}
+	if r == 0x1b {
+		p.marker = append(p.marker[:0], r)
+	} else {
+		p.marker = p.marker[:0]
+	}
+}
+
+// submit 提交当前行并记入历史
+func (p *CommandParser) submit() (Command, bool) {
+	cmd := Command{Line: string(p.line), Pasted: p.pasted, Approximate: p.approx}
+	p.reset()
+	// 密码不进入历史记录，shell 的历史中同样没有
+	if p.secret {
+		p.secret = false
+		return Command{Line: redacted, Secret: true}, true
+	}
+	if strings.TrimSpace(cmd.Line) == "" {
+		return Command{}, false
+	}
+	p.history = append(p.history, cmd.Line)
+	p.recall = len(p.history)
+	return cmd, true
+}
+
+// reset 清空当前行
+func (p *CommandParser) reset() {
+	p.line, p.cursor, p.pasted, p.approx = p.line[:0], 0, false, false
+	p.recall = len(p.history)
+}
+
+// recallHistory 在本会话提交过的命令中移动，超出本会话时 shell 可能显示更早的历史
+func (p *CommandParser) recallHistory(delta int) {
+	next := p.recall + delta
+	switch {
+	case next < 0:
+		p.approx = true
+		return
+	case next > len(p.history):
+		return
+	case next == len(p.history):
+		p.line = p.line[:0]
+	default:
+		p.line = append(p.line[:0], []rune(p.history[next])...)
+	}
+	p.recall = next
+	p.cursor = len(p.line)
+}
+
+// insert 在光标处插入字符
+func (p *CommandParser) insert(runes ...rune) {
+	room := maxCommandLength - len(p.line)
+	if room <= 0 {
+		return
+	}
+	if len(runes) > room {
+		runes = runes[:room]
+	}
+	p.line = append(p.line[:p.cursor], append(runes, p.line[p.cursor:]...)...)
+	p.cursor += len(runes)
+}
+
+// delete 删除 [from, to) 之间的字符，光标移到 from
+func (p *CommandParser) delete(from, to int) {
+	if from >= to {
+		return
+	}
+	p.line = append(p.line[:from], p.line[to:]...)
+	p.cursor = from
+}
+
+func (p *CommandParser) move(delta int) {
+	if next := p.cursor + delta; next >= 0 && next <= len(p.line) {
+		p.cursor = next
+	}
+}
+
+// wordStart 返回光标前一个单词（字母和数字）的起点
+func (p *CommandParser) wordStart() int {
+	i := p.cursor
+	for i > 0 && !isWordRune(p.line[i-1]) {
+		i--
+	}
+	for i > 0 && isWordRune(p.line[i-1]) {
+		i--
+	}
+	return i
+}
+
+// wordEnd 返回光标后一个单词的终点
+func (p *CommandParser) wordEnd() int {
+	i := p.cursor
+	for i < len(p.line) && !isWordRune(p.line[i]) {
+		i++
+	}
+	for i < len(p.line) && isWordRune(p.line[i]) {
+		i++
+	}
+	return i
+}
+
+// spaceWordStart 返回光标前以空白分隔的单词的起点，用于 Ctrl-W
+func (p *CommandParser) spaceWordStart() int {
+	i := p.cursor
+	for i > 0 && unicode.IsSpace(p.line[i-1]) {
+		i--
+	}
+	for i > 0 && !unicode.IsSpace(p.line[i-1]) {
+		i--
+	}
+	return i
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
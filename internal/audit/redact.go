@@ -0,0 +1,95 @@
+package audit
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// redacted 替换敏感内容的文本
+const redacted = "[REDACTED]"
+
+// DefaultRedactPatterns 默认脱敏的内容：密码、令牌等参数的值，Authorization 头，URL 中的密码和本服务的 API 令牌
+var DefaultRedactPatterns = []string{
+	`(?i)(?:pass(?:word|wd)?|secret|token|api[_-]?key|access[_-]?key|private[_-]?key)\w*["']?\s*[=:]\s*(["']?[^\s"']+["']?)`,
+	`(?i)--(?:password|passwd|secret|token)(?:=|\s+)(\S+)`,
+	`(?i)authorization:\s*(?:bearer|basic|token)\s+([^\s"']+)`,
+	`\b(?:mysql|mysqldump|mariadb)\b.*?\s-p(\S+)`,
+	`://[^/\s:@]+:([^/\s@]+)@`,
+	`\bcdo_[0-9a-f]{16}_[A-Za-z0-9_-]+`,
+}
+
+// Redactor 在记录命令前替换敏感内容
+// 含有捕获组的模式只替换捕获组，保留参数名等上下文，否则替换整个匹配
+type Redactor struct {
+	patterns []*regexp.Regexp
+}
+
+// NewRedactor 编译脱敏模式
+func NewRedactor(patterns []string) (*Redactor, error) {
+	r := &Redactor{}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact pattern %q: %v", pattern, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+// LoadRedactPatterns 读取脱敏模式文件，每行一个正则表达式，忽略空行和 # 开头的注释
+func LoadRedactPatterns(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading redact patterns: %v", err)
+	}
+	defer file.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading redact patterns: %v", err)
+	}
+	return patterns, nil
+}
+
+// Redact 替换文本中所有匹配的敏感内容
+func (r *Redactor) Redact(text string) string {
+	for _, re := range r.patterns {
+		if re.NumSubexp() == 0 {
+			text = re.ReplaceAllLiteralString(text, redacted)
+			continue
+		}
+		text = replaceGroups(re, text)
+	}
+	return text
+}
+
+// replaceGroups 只替换匹配中的捕获组
+func replaceGroups(re *regexp.Regexp, text string) string {
+	var b strings.Builder
+	last := 0
+	for _, match := range re.FindAllStringSubmatchIndex(text, -1) {
+		for group := 1; group*2 < len(match); group++ {
+			start, end := match[group*2], match[group*2+1]
+			if start < last || start < 0 {
+				continue
+			}
+			b.WriteString(text[last:start])
+			b.WriteString(redacted)
+			last = end
+		}
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
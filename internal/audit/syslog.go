@@ -0,0 +1,26 @@
+//go:build !windows && !plan9
+
+package audit
+
+import (
+	"fmt"
+	"io"
+	"log/syslog"
+	"net/url"
+)
+
+// syslogTag 审计事件在 syslog 中的标签
+const syslogTag = "container-debug-online"
+
+// dialSyslog 连接 syslog，事件以 authpriv 设施发送
+func dialSyslog(address string) (io.WriteCloser, error) {
+	priority := syslog.LOG_AUTHPRIV | syslog.LOG_INFO
+	if address == "local" {
+		return syslog.New(priority, syslogTag)
+	}
+	u, err := url.Parse(address)
+	if err != nil || (u.Scheme != "udp" && u.Scheme != "tcp") || u.Host == "" {
+		return nil, fmt.Errorf("invalid syslog address %q, use local, udp://host:port or tcp://host:port", address)
+	}
+	return syslog.Dial(u.Scheme, u.Host, priority, syslogTag)
+}
@@ -0,0 +1,13 @@
+//go:build windows || plan9
+
+package audit
+
+import (
+	"fmt"
+	"io"
+)
+
+// dialSyslog 当前平台不支持 syslog
+func dialSyslog(address string) (io.WriteCloser, error) {
+	return nil, fmt.Errorf("syslog is not supported on this platform")
+}
@@ -0,0 +1,40 @@
+package auth
+
+import "context"
+
+type contextKey struct{}
+
+// identity 表示已认证的用户
+type identity struct {
+	name   string
+	groups []string
+	token  *Token // 使用 API 令牌认证时不为 nil
+}
+
+// WithUser 将已认证的用户名及其所属组附加到 ctx
+func WithUser(ctx context.Context, name string, groups ...string) context.Context {
+	return context.WithValue(ctx, contextKey{}, identity{name: name, groups: groups})
+}
+
+// WithToken 将通过 API 令牌认证的用户附加到 ctx
+func WithToken(ctx context.Context, token *Token) context.Context {
+	return context.WithValue(ctx, contextKey{}, identity{name: token.User, groups: token.Groups, token: token})
+}
+
+// UserFromContext 返回请求的用户名，未认证时为空
+func UserFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(identity)
+	return id.name
+}
+
+// GroupsFromContext 返回请求用户所属的组，来自单点登录的组声明
+func GroupsFromContext(ctx context.Context) []string {
+	id, _ := ctx.Value(contextKey{}).(identity)
+	return id.groups
+}
+
+// TokenFromContext 返回请求使用的 API 令牌，未使用令牌时为 nil
+func TokenFromContext(ctx context.Context) *Token {
+	id, _ := ctx.Value(contextKey{}).(identity)
+	return id.token
+}
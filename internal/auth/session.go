@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// SessionCookie 会话 cookie 的名称
+	SessionCookie = "container_debug_session"
+	// CSRFHeader 使用会话 cookie 的修改类请求必须携带的 CSRF 令牌请求头
+	CSRFHeader = "X-CSRF-Token"
+)
+
+// Session 表示一个登录会话
+type Session struct {
+	User      string    `json:"user"`
+	Groups    []string  `json:"groups,omitempty"` // 单点登录的组声明
+	CSRFToken string    `json:"csrf_token"`
+	Expires   time.Time `json:"expires"`
+}
+
+// Sessions 在内存中保存登录会话，cookie 中只保存签名后的会话 ID
+type Sessions struct {
+	ttl time.Duration
+	key []byte
+
+	mu       sync.Mutex
+	sessions map[string]*Session // key: 会话 ID
+}
+
+// NewSessions 创建会话存储，会话在登录 ttl 后过期
+func NewSessions(ttl time.Duration) (*Sessions, error) {
+	key, err := randomBytes(32)
+	if err != nil {
+		return nil, err
+	}
+	return &Sessions{ttl: ttl, key: key, sessions: make(map[string]*Session)}, nil
+}
+
+// Create 为用户创建会话，返回会话和 cookie 值
+func (s *Sessions) Create(user string, groups []string) (*Session, string, error) {
+	id, err := randomToken()
+	if err != nil {
+		return nil, "", err
+	}
+	csrf, err := randomToken()
+	if err != nil {
+		return nil, "", err
+	}
+	session := &Session{User: user, Groups: groups, CSRFToken: csrf, Expires: time.Now().Add(s.ttl)}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// 顺便清理过期的会话
+	now := time.Now()
+	for key, existing := range s.sessions {
+		if now.After(existing.Expires) {
+			delete(s.sessions, key)
+		}
+	}
+	s.sessions[id] = session
+	copied := *session
+	return &copied, id + "." + s.sign(id), nil
+}
+
+// Get 校验 cookie 值并返回未过期的会话
+func (s *Sessions) Get(value string) (*Session, bool) {
+	id, ok := s.verify(value)
+	if !ok {
+		return nil, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(session.Expires) {
+		delete(s.sessions, id)
+		return nil, false
+	}
+	copied := *session
+	return &copied, true
+}
+
+// Delete 删除 cookie 对应的会话
+func (s *Sessions) Delete(value string) {
+	if id, ok := s.verify(value); ok {
+		s.mu.Lock()
+		delete(s.sessions, id)
+		s.mu.Unlock()
+	}
+}
+
+// Cookie 返回会话 cookie，secure 为 true 时只通过 HTTPS 发送
+func (s *Sessions) Cookie(value string, session *Session, secure bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     SessionCookie,
+		Value:    value,
+		Path:     "/",
+		Expires:  session.Expires,
+		MaxAge:   int(time.Until(session.Expires).Seconds()),
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// ClearCookie 返回删除会话 cookie 的 cookie
+func ClearCookie(secure bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     SessionCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// CheckCSRF 以恒定时间比较 CSRF 令牌
+func (session *Session) CheckCSRF(token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(session.CSRFToken)) == 1
+}
+
+func (s *Sessions) sign(id string) string {
+	h := hmac.New(sha256.New, s.key)
+	h.Write([]byte(id))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// verify 校验 cookie 值的签名，返回会话 ID
+func (s *Sessions) verify(value string) (string, bool) {
+	id, signature, ok := strings.Cut(value, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(s.sign(id))) {
+		return "", false
+	}
+	return id, true
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func randomToken() (string, error) {
+	b, err := randomBytes(32)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
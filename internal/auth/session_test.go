@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessions(t *testing.T) {
+	sessions, err := NewSessions(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session, value, err := sessions.Create("alice", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.User != "alice" || session.CSRFToken == "" || time.Until(session.Expires) < 59*time.Minute {
+		t.Errorf("session = %+v", session)
+	}
+
+	got, ok := sessions.Get(value)
+	if !ok || got.User != "alice" || !got.CheckCSRF(session.CSRFToken) || got.CheckCSRF("") || got.CheckCSRF("other") {
+		t.Errorf("Get = %+v, %v", got, ok)
+	}
+
+	// 篡改签名或会话 ID
+	last := "A"
+	if value[len(value)-1] == 'A' {
+		last = "B"
+	}
+	if _, ok := sessions.Get(value[:len(value)-1] + last); ok {
+		t.Error("accepted tampered signature")
+	}
+	if _, ok := sessions.Get("x" + value); ok {
+		t.Error("accepted tampered id")
+	}
+	// 其他实例签发的 cookie
+	other, _ := NewSessions(time.Hour)
+	if _, ok := other.Get(value); ok {
+		t.Error("accepted cookie from another key")
+	}
+
+	cookie := sessions.Cookie(value, session, true)
+	if !cookie.HttpOnly || !cookie.Secure || cookie.Name != SessionCookie || cookie.MaxAge <= 0 {
+		t.Errorf("cookie = %+v", cookie)
+	}
+
+	sessions.Delete(value)
+	if _, ok := sessions.Get(value); ok {
+		t.Error("session still valid after logout")
+	}
+}
+
+func TestSessionExpiry(t *testing.T) {
+	sessions, err := NewSessions(-time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, value, err := sessions.Create("alice", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := sessions.Get(value); ok {
+		t.Error("expired session accepted")
+	}
+	if len(sessions.sessions) != 0 {
+		t.Error("expired session not removed")
+	}
+}
@@ -0,0 +1,250 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/YooLeon/container-debug-online/internal/rbac"
+	"go.uber.org/zap"
+)
+
+const (
+	// TokenPrefix API 令牌的前缀，便于在日志和代码仓库中识别泄露的令牌
+	TokenPrefix = "cdo_"
+
+	// lastUsedInterval 最后使用时间在该间隔内不重复写入文件
+	lastUsedInterval = time.Minute
+	// tokenRetention 过期或吊销的令牌保留该时间后从文件中删除
+	tokenRetention = 30 * 24 * time.Hour
+)
+
+// Token 表示一个 API 令牌，令牌本身只在创建时返回一次
+type Token struct {
+	ID           string     `json:"id"`
+	Name         string     `json:"name"`
+	User         string     `json:"user"`             // 令牌以该用户的身份访问，权限为用户权限与 Scope 的交集
+	Groups       []string   `json:"groups,omitempty"`   // 创建时用户所属的组
+	Accounts     []string   `json:"accounts,omitempty"` // 创建时账号文件中存在的 User 和 CreatedBy，任一账号被删除后令牌失效
+	Scope        rbac.Scope `json:"scope"`
+	CreatedBy    string     `json:"created_by"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	LastUsedAt   *time.Time `json:"last_used_at,omitempty"`
+	LastUsedFrom string     `json:"last_used_from,omitempty"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Active 判断令牌是否未过期且未吊销
+func (t *Token) Active(now time.Time) bool {
+	return t.RevokedAt == nil && now.Before(t.ExpiresAt)
+}
+
+// storedToken 令牌文件中的记录，只保存令牌密钥的 SHA-256
+type storedToken struct {
+	Token
+	Hash string `json:"hash"`
+
+	usageSaved time.Time // 最后一次写入使用记录的时间
+}
+
+// tokensFile 令牌文件的格式
+type tokensFile struct {
+	Tokens []*storedToken `json:"tokens"`
+}
+
+// Tokens 管理 API 令牌并保存到文件
+type Tokens struct {
+	path string
+
+	mu     sync.Mutex
+	tokens map[string]*storedToken // key: 令牌 ID
+}
+
+// LoadTokens 加载令牌文件，文件不存在时从空开始
+func LoadTokens(path string) (*Tokens, error) {
+	tokens := &Tokens{path: path, tokens: make(map[string]*storedToken)}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return tokens, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading tokens file: %v", err)
+	}
+	var file tokensFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("error parsing tokens file: %v", err)
+	}
+	for _, token := range file.Tokens {
+		tokens.tokens[token.ID] = token
+	}
+	return tokens, nil
+}
+
+// Create 创建令牌，token 需要设置 Name、User、Scope、CreatedBy 和 ExpiresAt
+// 返回保存的令牌和只在此时可见的令牌值
+func (t *Tokens) Create(token Token) (*Token, string, error) {
+	if token.Name == "" || token.User == "" {
+		return nil, "", fmt.Errorf("token name and user are required")
+	}
+	if err := token.Scope.Validate(); err != nil {
+		return nil, "", fmt.Errorf("invalid token scope: %v", err)
+	}
+	if !token.ExpiresAt.After(time.Now()) {
+		return nil, "", fmt.Errorf("token expiry must be in the future")
+	}
+
+	idBytes, err := randomBytes(8)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := randomToken()
+	if err != nil {
+		return nil, "", err
+	}
+	token.ID = hex.EncodeToString(idBytes)
+	token.CreatedAt = time.Now().UTC()
+	token.LastUsedAt, token.LastUsedFrom, token.RevokedAt = nil, "", nil
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tokens[token.ID] = &storedToken{Token: token, Hash: hashSecret(secret)}
+	if err := t.save(); err != nil {
+		delete(t.tokens, token.ID)
+		return nil, "", err
+	}
+	return &token, TokenPrefix + token.ID + "_" + secret, nil
+}
+
+// Authenticate 校验令牌值，返回有效的令牌并记录最后使用时间和来源地址
+func (t *Tokens) Authenticate(value, remote string) (*Token, bool) {
+	id, secret, ok := strings.Cut(strings.TrimPrefix(value, TokenPrefix), "_")
+	if !ok || !strings.HasPrefix(value, TokenPrefix) {
+		return nil, false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stored, ok := t.tokens[id]
+	if !ok || subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(stored.Hash)) != 1 {
+		return nil, false
+	}
+	now := time.Now().UTC()
+	if !stored.Active(now) {
+		return nil, false
+	}
+
+	// 只记录来源主机，客户端每个连接的端口都不同；间隔内的使用只更新内存
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	stored.LastUsedAt, stored.LastUsedFrom = &now, remote
+	if now.Sub(stored.usageSaved) >= lastUsedInterval {
+		stored.usageSaved = now
+		if err := t.save(); err != nil {
+			zap.L().Warn("Failed to record API token usage", zap.String("token", id), zap.Error(err))
+		}
+	}
+	token := stored.Token
+	return &token, true
+}
+
+// Get 返回令牌
+func (t *Tokens) Get(id string) (*Token, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stored, ok := t.tokens[id]
+	if !ok {
+		return nil, false
+	}
+	token := stored.Token
+	return &token, true
+}
+
+// List 按创建时间返回所有令牌，包括已过期和已吊销的
+func (t *Tokens) List() []Token {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	list := make([]Token, 0, len(t.tokens))
+	for _, stored := range t.tokens {
+		list = append(list, stored.Token)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+// Revoke 吊销令牌，已吊销的令牌保持不变
+func (t *Tokens) Revoke(id string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stored, ok := t.tokens[id]
+	if !ok {
+		return fmt.Errorf("token %s not found", id)
+	}
+	if stored.RevokedAt != nil {
+		return nil
+	}
+	now := time.Now().UTC()
+	stored.RevokedAt = &now
+	if err := t.save(); err != nil {
+		stored.RevokedAt = nil
+		return err
+	}
+	return nil
+}
+
+// save 清理失效已久的令牌并写入文件，调用方需持有锁
+// 先写入临时文件再重命名，避免写入中断时损坏文件
+func (t *Tokens) save() error {
+	now := time.Now()
+	file := tokensFile{Tokens: make([]*storedToken, 0, len(t.tokens))}
+	for id, stored := range t.tokens {
+		end := stored.ExpiresAt
+		if stored.RevokedAt != nil {
+			end = *stored.RevokedAt
+		}
+		if now.Sub(end) > tokenRetention {
+			delete(t.tokens, id)
+			continue
+		}
+		file.Tokens = append(file.Tokens, stored)
+	}
+	sort.Slice(file.Tokens, func(i, j int) bool { return file.Tokens[i].CreatedAt.Before(file.Tokens[j].CreatedAt) })
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(t.path), filepath.Base(t.path)+".*")
+	if err != nil {
+		return fmt.Errorf("error writing tokens file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing tokens file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing tokens file: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), t.path); err != nil {
+		return fmt.Errorf("error writing tokens file: %v", err)
+	}
+	return nil
+}
+
+// hashSecret 令牌密钥为 256 位随机数，直接使用 SHA-256 保存
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
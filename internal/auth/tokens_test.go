@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/YooLeon/container-debug-online/internal/rbac"
+)
+
+func newTestToken(name string, expires time.Time) Token {
+	return Token{
+		Name:      name,
+		User:      "alice",
+		Scope:     rbac.Scope{Actions: []rbac.Action{rbac.ActionList, rbac.ActionLogs}, Projects: []string{"shop"}},
+		CreatedBy: "alice",
+		ExpiresAt: expires,
+	}
+}
+
+func TestTokens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	tokens, err := LoadTokens(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, value, err := tokens.Create(newTestToken("ci", time.Now().Add(time.Hour)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(value, TokenPrefix+token.ID+"_") {
+		t.Errorf("token value = %q", value)
+	}
+
+	got, ok := tokens.Authenticate(value, "10.0.0.1:1234")
+	if !ok || got.ID != token.ID || got.User != "alice" || got.LastUsedAt == nil || got.LastUsedFrom != "10.0.0.1" {
+		t.Fatalf("Authenticate = %+v, %v", got, ok)
+	}
+	// 间隔内的使用只更新内存，不重复写入文件
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens.Authenticate(value, "10.0.0.1:5678")
+	tokens.Authenticate(value, "[fd00::2]:1234")
+	if after, _ := os.ReadFile(path); string(after) != string(before) {
+		t.Error("tokens file rewritten within the last-used interval")
+	}
+	if stored, _ := tokens.Get(token.ID); stored.LastUsedFrom != "fd00::2" {
+		t.Errorf("LastUsedFrom = %q", stored.LastUsedFrom)
+	}
+	for _, invalid := range []string{value + "x", strings.TrimPrefix(value, TokenPrefix), TokenPrefix + "missing_secret", ""} {
+		if _, ok := tokens.Authenticate(invalid, ""); ok {
+			t.Errorf("accepted %q", invalid)
+		}
+	}
+
+	// 文件中只保存哈希，重新加载后令牌和最后使用时间仍然有效
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := value[strings.LastIndex(value, token.ID+"_")+len(token.ID)+1:]
+	if strings.Contains(string(data), secret) {
+		t.Error("tokens file contains the plain token")
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("tokens file mode = %v, %v", info.Mode(), err)
+	}
+	reloaded, err := LoadTokens(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored, ok := reloaded.Get(token.ID); !ok || stored.LastUsedAt == nil {
+		t.Errorf("reloaded token = %+v", stored)
+	}
+	if _, ok := reloaded.Authenticate(value, ""); !ok {
+		t.Error("reloaded token rejected")
+	}
+
+	// 吊销后不能再使用，但仍保留在列表中
+	if err := reloaded.Revoke(token.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reloaded.Authenticate(value, ""); ok {
+		t.Error("revoked token accepted")
+	}
+	if list := reloaded.List(); len(list) != 1 || list[0].RevokedAt == nil {
+		t.Errorf("List = %+v", list)
+	}
+	if err := reloaded.Revoke("missing"); err == nil {
+		t.Error("revoked unknown token")
+	}
+}
+
+func TestTokenExpiry(t *testing.T) {
+	tokens, err := LoadTokens(filepath.Join(t.TempDir(), "tokens.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := tokens.Create(newTestToken("past", time.Now().Add(-time.Minute))); err == nil {
+		t.Error("created expired token")
+	}
+
+	token, value, err := tokens.Create(newTestToken("short", time.Now().Add(50*time.Millisecond)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, ok := tokens.Authenticate(value, ""); ok {
+		t.Error("expired token accepted")
+	}
+	if stored, _ := tokens.Get(token.ID); stored.Active(time.Now()) {
+		t.Error("expired token is active")
+	}
+}
+
+func TestTokenValidation(t *testing.T) {
+	tokens, err := LoadTokens(filepath.Join(t.TempDir(), "tokens.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expires := time.Now().Add(time.Hour)
+	for _, token := range []Token{
+		{User: "alice", Scope: rbac.Scope{Actions: []rbac.Action{rbac.ActionList}}, ExpiresAt: expires},
+		{Name: "ci", Scope: rbac.Scope{Actions: []rbac.Action{rbac.ActionList}}, ExpiresAt: expires},
+		{Name: "ci", User: "alice", ExpiresAt: expires},
+		{Name: "ci", User: "alice", Scope: rbac.Scope{Actions: []rbac.Action{"root"}}, ExpiresAt: expires},
+	} {
+		if _, _, err := tokens.Create(token); err == nil {
+			t.Errorf("expected error for %+v", token)
+		}
+	}
+	if len(tokens.List()) != 0 {
+		t.Error("invalid tokens were stored")
+	}
+}
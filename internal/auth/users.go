@@ -0,0 +1,279 @@
+// Package auth 管理登录账号与密码校验
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v2"
+)
+
+// verifiedTTL 校验成功的密码在该时间内不再重复计算哈希
+const verifiedTTL = 5 * time.Minute
+
+// User 表示一个账号
+type User struct {
+	Name         string `yaml:"name"`
+	PasswordHash string `yaml:"password_hash"` // bcrypt ($2a$, $2b$, $2y$) 或 argon2 ($argon2id$, $argon2i$)
+}
+
+// usersFile 表示 YAML 格式的账号文件
+type usersFile struct {
+	Users []User `yaml:"users"`
+}
+
+// Users 保存账号并校验密码
+type Users struct {
+	users map[string]User
+
+	mu       sync.Mutex
+	key      []byte                // 缓存校验结果时使用的随机密钥
+	verified map[string]verifiedAt // key: 用户名
+}
+
+type verifiedAt struct {
+	mac []byte
+	at  time.Time
+}
+
+// LoadUsers 加载账号文件，.yaml 和 .yml 文件按 YAML 解析，其他文件按 htpasswd 格式解析
+func LoadUsers(path string) (*Users, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading users file: %v", err)
+	}
+
+	var users []User
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var file usersFile
+		if err := yaml.UnmarshalStrict(data, &file); err != nil {
+			return nil, fmt.Errorf("error parsing users file: %v", err)
+		}
+		users = file.Users
+	default:
+		if users, err = ParseHtpasswd(data); err != nil {
+			return nil, err
+		}
+	}
+	return NewUsers(users)
+}
+
+// ParseHtpasswd 解析 htpasswd 格式，每行为 name:hash，忽略空行和 # 开头的注释
+func ParseHtpasswd(data []byte) ([]User, error) {
+	var users []User
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, hash, ok := strings.Cut(text, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid htpasswd line %d", line)
+		}
+		users = append(users, User{Name: name, PasswordHash: hash})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading htpasswd: %v", err)
+	}
+	return users, nil
+}
+
+// NewUsers 校验账号列表，用户名不能重复，哈希必须是支持的格式
+func NewUsers(users []User) (*Users, error) {
+	if len(users) == 0 {
+		return nil, fmt.Errorf("no users defined")
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	u := &Users{users: make(map[string]User), key: key, verified: make(map[string]verifiedAt)}
+	for _, user := range users {
+		if user.Name == "" {
+			return nil, fmt.Errorf("user without name")
+		}
+		if _, ok := u.users[user.Name]; ok {
+			return nil, fmt.Errorf("duplicate user: %s", user.Name)
+		}
+		if err := checkHash(user.PasswordHash); err != nil {
+			return nil, fmt.Errorf("user %s: %v", user.Name, err)
+		}
+		u.users[user.Name] = user
+	}
+	return u, nil
+}
+
+// SingleUser 创建只有一个账号的列表，用于 -password 等单密码配置
+func SingleUser(name, password string) (*Users, error) {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	return NewUsers([]User{{Name: name, PasswordHash: hash}})
+}
+
+// Authenticate 校验用户名和密码，用户不存在时同样计算一次哈希，避免通过耗时判断用户是否存在
+func (u *Users) Authenticate(name, password string) bool {
+	mac := u.mac(password)
+	u.mu.Lock()
+	cached, ok := u.verified[name]
+	u.mu.Unlock()
+	if ok && time.Since(cached.at) < verifiedTTL && hmac.Equal(cached.mac, mac) {
+		return true
+	}
+
+	user, exists := u.users[name]
+	if !exists {
+		bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+		return false
+	}
+	valid, err := VerifyPassword(user.PasswordHash, password)
+	if err != nil || !valid {
+		return false
+	}
+
+	u.mu.Lock()
+	u.verified[name] = verifiedAt{mac: mac, at: time.Now()}
+	u.mu.Unlock()
+	return true
+}
+
+// Has 判断账号是否存在
+func (u *Users) Has(name string) bool {
+	_, ok := u.users[name]
+	return ok
+}
+
+// Names 返回所有用户名
+func (u *Users) Names() []string {
+	names := make([]string, 0, len(u.users))
+	for name := range u.users {
+		names = append(names, name)
+	}
+	return names
+}
+
+func (u *Users) mac(password string) []byte {
+	h := hmac.New(sha256.New, u.key)
+	h.Write([]byte(password))
+	return h.Sum(nil)
+}
+
+var (
+	dummyOnce sync.Once
+	dummy     []byte
+)
+
+// dummyHash 用于不存在的用户，使校验耗时与存在的用户一致
+func dummyHash() []byte {
+	dummyOnce.Do(func() {
+		dummy, _ = bcrypt.GenerateFromPassword([]byte("container-debug-online"), bcrypt.DefaultCost)
+	})
+	return dummy
+}
+
+// HashPassword 使用 bcrypt 计算密码哈希
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// VerifyPassword 校验密码，哈希格式不支持时返回错误
+func VerifyPassword(hash, password string) (bool, error) {
+	if err := checkHash(hash); err != nil {
+		return false, err
+	}
+	if strings.HasPrefix(hash, "$argon2") {
+		params, _ := parseArgon2(hash)
+		var actual []byte
+		if params.variant == "argon2id" {
+			actual = argon2.IDKey([]byte(password), params.salt, params.iterations, params.memory, params.threads, uint32(len(params.key)))
+		} else {
+			actual = argon2.Key([]byte(password), params.salt, params.iterations, params.memory, params.threads, uint32(len(params.key)))
+		}
+		return subtle.ConstantTimeCompare(actual, params.key) == 1, nil
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil, nil
+}
+
+// checkHash 检查哈希格式，不计算哈希
+func checkHash(hash string) error {
+	switch {
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return fmt.Errorf("invalid bcrypt hash: %v", err)
+		}
+		return nil
+	case strings.HasPrefix(hash, "$argon2id$"), strings.HasPrefix(hash, "$argon2i$"):
+		_, err := parseArgon2(hash)
+		return err
+	}
+	return fmt.Errorf("unsupported password hash, use bcrypt or argon2")
+}
+
+type argon2Params struct {
+	variant    string
+	memory     uint32
+	iterations uint32
+	threads    uint8
+	salt       []byte
+	key        []byte
+}
+
+// parseArgon2 解析 PHC 格式的 argon2 哈希：$argon2id$v=19$m=65536,t=3,p=4$salt$hash
+func parseArgon2(hash string) (argon2Params, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return argon2Params{}, fmt.Errorf("invalid argon2 hash")
+	}
+
+	params := argon2Params{variant: parts[1]}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return argon2Params{}, fmt.Errorf("unsupported argon2 version: %s", parts[2])
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.threads); err != nil ||
+		params.iterations == 0 || params.threads == 0 {
+		return argon2Params{}, fmt.Errorf("invalid argon2 parameters: %s", parts[3])
+	}
+	var err error
+	if params.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return argon2Params{}, fmt.Errorf("invalid argon2 salt: %v", err)
+	}
+	if params.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(params.key) == 0 {
+		return argon2Params{}, fmt.Errorf("invalid argon2 hash value")
+	}
+	return params, nil
+}
+
+// ReadPasswordFile 读取密码文件，去掉结尾的换行符
+func ReadPasswordFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("error reading password file: %v", err)
+	}
+	password := strings.TrimRight(string(data), "\r\n")
+	if password == "" {
+		return "", fmt.Errorf("password file %s is empty", path)
+	}
+	return password, nil
+}
@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func bcryptHash(t *testing.T, password string) string {
+	t.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(hash)
+}
+
+func argon2Hash(password string) string {
+	salt := []byte("0123456789abcdef")
+	key := argon2.IDKey([]byte(password), salt, 1, 64, 1, 32)
+	return fmt.Sprintf("$argon2id$v=%d$m=64,t=1,p=1$%s$%s", argon2.Version,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadUsersHtpasswd(t *testing.T) {
+	path := writeFile(t, "htpasswd", fmt.Sprintf("# accounts\nalice:%s\n\nbob:%s\n", bcryptHash(t, "alice-secret"), argon2Hash("bob-secret")))
+
+	users, err := LoadUsers(path)
+	if err != nil {
+		t.Fatalf("LoadUsers: %v", err)
+	}
+
+	tests := []struct {
+		name, password string
+		want           bool
+	}{
+		{"alice", "alice-secret", true},
+		{"alice", "bob-secret", false},
+		{"bob", "bob-secret", true},
+		{"bob", "", false},
+		{"carol", "alice-secret", false},
+	}
+	for _, tt := range tests {
+		if got := users.Authenticate(tt.name, tt.password); got != tt.want {
+			t.Errorf("Authenticate(%s, %s) = %v, want %v", tt.name, tt.password, got, tt.want)
+		}
+		// 第二次使用缓存的结果
+		if got := users.Authenticate(tt.name, tt.password); got != tt.want {
+			t.Errorf("cached Authenticate(%s, %s) = %v, want %v", tt.name, tt.password, got, tt.want)
+		}
+	}
+}
+
+func TestLoadUsersYAML(t *testing.T) {
+	path := writeFile(t, "users.yaml", fmt.Sprintf("users:\n  - name: alice\n    password_hash: '%s'\n", bcryptHash(t, "secret")))
+
+	users, err := LoadUsers(path)
+	if err != nil {
+		t.Fatalf("LoadUsers: %v", err)
+	}
+	if !users.Authenticate("alice", "secret") || users.Authenticate("alice", "wrong") {
+		t.Error("unexpected authentication result")
+	}
+}
+
+func TestLoadUsersInvalid(t *testing.T) {
+	hash := bcryptHash(t, "secret")
+	files := map[string]string{
+		"plaintext.htpasswd": "alice:secret\n",
+		"md5.htpasswd":       "alice:$apr1$abc$def\n",
+		"nocolon.htpasswd":   "alice\n",
+		"duplicate.htpasswd": "alice:" + hash + "\nalice:" + hash + "\n",
+		"empty.htpasswd":     "# nobody\n",
+		"argon2.htpasswd":    "alice:$argon2id$v=19$m=64,t=0,p=1$c2FsdA$a2V5\n",
+		"unknown.yaml":       "users:\n  - name: alice\n    password: secret\n",
+	}
+	for name, content := range files {
+		if _, err := LoadUsers(writeFile(t, name, content)); err == nil {
+			t.Errorf("%s: LoadUsers succeeded", name)
+		}
+	}
+}
+
+func TestSingleUser(t *testing.T) {
+	users, err := SingleUser("admin", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !users.Authenticate("admin", "secret") || users.Authenticate("root", "secret") {
+		t.Error("unexpected authentication result")
+	}
+}
+
+func TestReadPasswordFile(t *testing.T) {
+	password, err := ReadPasswordFile(writeFile(t, "password", "s3cret\n"))
+	if err != nil || password != "s3cret" {
+		t.Errorf("ReadPasswordFile = %q, %v", password, err)
+	}
+	if _, err := ReadPasswordFile(writeFile(t, "empty", "\n")); err == nil {
+		t.Error("empty password file accepted")
+	}
+}
+
+func TestUserContext(t *testing.T) {
+	if name := UserFromContext(context.Background()); name != "" {
+		t.Errorf("user = %q, want empty", name)
+	}
+	if name := UserFromContext(WithUser(context.Background(), "alice")); name != "alice" {
+		t.Errorf("user = %q, want alice", name)
+	}
+}
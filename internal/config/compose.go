@@ -13,6 +13,7 @@ type ComposeConfig struct {
 	Version        string                   `yaml:"version"`
 	Services       map[string]ServiceConfig `yaml:"services"`
 	Path           string                   `yaml:"-"`
+	Project        string                   `yaml:"-"` // 非空时按 compose 项目名匹配容器
 	SortedServices []string                 `yaml:"-"`
 }
 
@@ -2,31 +2,153 @@ package config
 
 import (
 	"flag"
+	"os"
+	"strings"
 	"time"
 )
 
+// PasswordEnv 未指定 -password 时读取密码的环境变量
+const PasswordEnv = "CONTAINER_DEBUG_PASSWORD"
+
 type Config struct {
 	ServerPort      int
 	ServerHost      string
 	ComposePath     string
+	HostsPath       string
+	Runtime         string
 	MonitorInterval time.Duration
 	Password        string
+	PasswordFile    string
+	UsersPath       string
+	PolicyPath      string
+	OIDCPath        string
+	TokensPath      string
+	AuditLogPath    string
+	AuditSyslog     string
+	AuditCommands   bool
+	AuditRedactPath string
+	SessionTTL      time.Duration
+	AlertRulesPath  string
+	CrashLoopCount  int
+	CrashLoopWindow time.Duration
+	CrashLogLines   int
+
+	LogArchiveDir         string
+	LogArchiveRetention   time.Duration
+	LogArchiveSegmentSize int64
+	LogArchiveSegmentAge  time.Duration
+
+	LogPatterns          bool
+	LogPatternsRetention time.Duration
+
+	TLSCert       string
+	TLSKey        string
+	TLSSelfSigned bool
+	TLSClientCA   string
+	TLSClientAuth string
+
+	WSAllowedOrigins     []string
+	WSMaxSessions        int
+	WSMaxSessionsPerUser int
+	WSMaxMessageSize     int64
 }
 
 func LoadConfig() *Config {
 	serverPort := flag.Int("port", 14264, "Server port")
 	serverHost := flag.String("host", "0.0.0.0", "Server host")
 	composePath := flag.String("compose", "", "Path to docker-compose.yml")
+	hostsPath := flag.String("hosts", "", "Path to Docker hosts file")
+	runtime := flag.String("runtime", "docker", "Container runtime when no hosts file is given: docker or podman")
 	monitorInterval := flag.Duration("interval", 5*time.Second, "Monitor interval")
-	password := flag.String("password", "", "Authentication password")
+	password := flag.String("password", "", "Authentication password for user admin (deprecated: visible in ps, use -password-file or "+PasswordEnv+")")
+	passwordFile := flag.String("password-file", "", "File containing the password for user admin")
+	usersPath := flag.String("users", "", "Users file: htpasswd (bcrypt or argon2) or YAML")
+	sessionTTL := flag.Duration("session-ttl", 12*time.Hour, "How long a login session stays valid")
+	oidcPath := flag.String("oidc", "", "OIDC single sign-on config file (YAML)")
+	tokensPath := flag.String("tokens", "", "API token store file (JSON), empty disables API tokens")
+	auditLogPath := flag.String("audit-log", "", "Append-only audit log file (JSON Lines) of user actions, empty disables it")
+	auditSyslog := flag.String("audit-syslog", "", "Also send audit events to syslog: local, udp://host:port or tcp://host:port")
+	auditCommands := flag.Bool("audit-commands", false, "Record commands typed in web terminals to the audit log")
+	auditRedactPath := flag.String("audit-redact", "", "File of extra regular expressions, one per line, redacted from recorded terminal commands")
+	policyPath := flag.String("policy", "", "Role-based access policy file (YAML), empty grants every user full access")
+	alertRulesPath := flag.String("alert-rules", "", "Path to alert rules file")
+	crashLoopCount := flag.Int("crash-loop-restarts", 3, "Restarts within the crash loop window that mark a service as crash looping")
+	crashLoopWindow := flag.Duration("crash-loop-window", 5*time.Minute, "Crash loop detection window")
+	crashLogLines := flag.Int("crash-log-lines", 50, "Log lines captured when a container exits")
+
+	logArchiveDir := flag.String("log-archive", "", "Directory for the persistent log archive, empty disables it")
+	logArchiveRetention := flag.Duration("log-archive-retention", 7*24*time.Hour, "How long archived log segments are kept")
+	logArchiveSegmentSize := flag.Int64("log-archive-segment-size", 64, "Maximum uncompressed size of a log archive segment in MB")
+	logArchiveSegmentAge := flag.Duration("log-archive-segment-age", time.Hour, "Maximum time span of a log archive segment")
+	logPatterns := flag.Bool("log-patterns", false, "Cluster service logs into patterns and report new or spiking ones")
+	logPatternsRetention := flag.Duration("log-patterns-retention", 24*time.Hour, "How long pattern frequencies are kept")
+	tlsCert := flag.String("tls-cert", "", "TLS certificate file, reloaded when it changes")
+	tlsKey := flag.String("tls-key", "", "TLS private key file, reloaded when it changes")
+	tlsSelfSigned := flag.Bool("tls-self-signed", false, "Serve HTTPS with a generated self-signed certificate (development only)")
+	tlsClientCA := flag.String("tls-client-ca", "", "CA bundle for client certificate authentication, empty disables it")
+	tlsClientAuth := flag.String("tls-client-auth", "require", "Client certificate mode when -tls-client-ca is set: require or optional")
+	wsAllowedOrigins := flag.String("ws-allowed-origins", "", "Comma-separated origins allowed to open WebSockets besides the same origin, globs such as https://*.example.com")
+	wsMaxSessions := flag.Int("ws-max-sessions", 256, "Maximum concurrent terminal and log WebSocket sessions, 0 for no limit")
+	wsMaxSessionsPerUser := flag.Int("ws-max-sessions-per-user", 16, "Maximum concurrent terminal and log WebSocket sessions per user, 0 for no limit")
+	wsMaxMessageSize := flag.Int64("ws-max-message-size", 64<<10, "Maximum size in bytes of a WebSocket message from the client")
 
 	flag.Parse()
 
+	if *password == "" {
+		*password = os.Getenv(PasswordEnv)
+	}
+
 	return &Config{
 		ServerPort:      *serverPort,
 		ServerHost:      *serverHost,
 		ComposePath:     *composePath,
+		HostsPath:       *hostsPath,
+		Runtime:         *runtime,
 		MonitorInterval: *monitorInterval,
 		Password:        *password,
+		PasswordFile:    *passwordFile,
+		UsersPath:       *usersPath,
+		PolicyPath:      *policyPath,
+		OIDCPath:        *oidcPath,
+		TokensPath:      *tokensPath,
+		AuditLogPath:    *auditLogPath,
+		AuditSyslog:     *auditSyslog,
+		AuditCommands:   *auditCommands,
+		AuditRedactPath: *auditRedactPath,
+		SessionTTL:      *sessionTTL,
+		AlertRulesPath:  *alertRulesPath,
+		CrashLoopCount:  *crashLoopCount,
+		CrashLoopWindow: *crashLoopWindow,
+		CrashLogLines:   *crashLogLines,
+
+		LogArchiveDir:         *logArchiveDir,
+		LogArchiveRetention:   *logArchiveRetention,
+		LogArchiveSegmentSize: *logArchiveSegmentSize << 20,
+		LogArchiveSegmentAge:  *logArchiveSegmentAge,
+
+		LogPatterns:          *logPatterns,
+		LogPatternsRetention: *logPatternsRetention,
+
+		TLSCert:       *tlsCert,
+		TLSKey:        *tlsKey,
+		TLSSelfSigned: *tlsSelfSigned,
+		TLSClientCA:   *tlsClientCA,
+		TLSClientAuth: *tlsClientAuth,
+
+		WSAllowedOrigins:     splitList(*wsAllowedOrigins),
+		WSMaxSessions:        *wsMaxSessions,
+		WSMaxSessionsPerUser: *wsMaxSessionsPerUser,
+		WSMaxMessageSize:     *wsMaxMessageSize,
+	}
+}
+
+// splitList 拆分逗号分隔的参数，忽略空项
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
 	}
+	return list
 }
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultHostName 未配置主机文件时使用的主机名
+const DefaultHostName = "local"
+
+// HostsConfig 表示多主机配置文件
+type HostsConfig struct {
+	Hosts []HostConfig `yaml:"hosts"`
+}
+
+// HostConfig 表示一个 Docker 引擎端点
+type HostConfig struct {
+	Name        string     `yaml:"name"`
+	Runtime     string     `yaml:"runtime,omitempty"`      // docker 或 podman，默认 docker
+	Host        string     `yaml:"host,omitempty"`         // unix:///var/run/docker.sock, tcp://host:2376, ssh://user@host，为空时使用环境变量或默认套接字
+	TLS         *TLSConfig `yaml:"tls,omitempty"`          // tcp 连接的 TLS 证书
+	SSHIdentity string     `yaml:"ssh_identity,omitempty"` // ssh 连接使用的私钥
+	Compose     string     `yaml:"compose,omitempty"`      // 本地 docker-compose.yml 路径，为空时使用 -compose 参数
+	Project     string     `yaml:"project,omitempty"`      // compose 项目名，远程主机按项目名而非文件路径匹配容器
+}
+
+// TLSConfig 表示 Docker 客户端 TLS 配置
+type TLSConfig struct {
+	CA                 string `yaml:"ca,omitempty"`
+	Cert               string `yaml:"cert,omitempty"`
+	Key                string `yaml:"key,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"`
+}
+
+// LoadHostsConfig 加载多主机配置文件
+func LoadHostsConfig(configPath string) ([]HostConfig, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading hosts file: %v", err)
+	}
+
+	config := &HostsConfig{}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("error parsing hosts file: %v", err)
+	}
+
+	if len(config.Hosts) == 0 {
+		return nil, fmt.Errorf("no hosts defined in hosts file")
+	}
+
+	names := make(map[string]bool)
+	for _, host := range config.Hosts {
+		if host.Name == "" {
+			return nil, fmt.Errorf("host '%s' has no name", host.Host)
+		}
+		if names[host.Name] {
+			return nil, fmt.Errorf("duplicate host name '%s'", host.Name)
+		}
+		names[host.Name] = true
+	}
+
+	return config.Hosts, nil
+}
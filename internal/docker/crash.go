@@ -0,0 +1,287 @@
+package docker
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/stdcopy"
+	"go.uber.org/zap"
+)
+
+// Crash 表示容器的一次退出
+type Crash struct {
+	ContainerID  string    `json:"container_id"`
+	Container    string    `json:"container"`
+	Service      string    `json:"service"`
+	ExitCode     int       `json:"exit_code"`
+	OOMKilled    bool      `json:"oom_killed"`
+	Error        string    `json:"error,omitempty"`
+	StartedAt    time.Time `json:"started_at"`
+	FinishedAt   time.Time `json:"finished_at"`
+	RestartCount int       `json:"restart_count"`
+	LogTail      []string  `json:"log_tail"`
+}
+
+// ServiceCrashes 表示一个服务的退出记录和崩溃循环状态
+type ServiceCrashes struct {
+	Service   string   `json:"service"`
+	CrashLoop bool     `json:"crash_loop"`
+	Restarts  int      `json:"restarts"` // 检测窗口内的重启次数
+	Crashes   []*Crash `json:"crashes"`  // 按时间倒序
+}
+
+// CrashOptions 配置崩溃检测
+type CrashOptions struct {
+	LoopRestarts int           // 窗口内达到该重启次数视为崩溃循环
+	LoopWindow   time.Duration // 崩溃循环检测窗口
+	LogLines     int           // 每次退出保留的日志行数
+	MaxCrashes   int           // 每个服务保留的退出记录数
+}
+
+type containerRun struct {
+	finishedAt   time.Time
+	restartCount int
+}
+
+// CrashTracker 检测容器退出和崩溃循环，并记录退出前的日志
+type CrashTracker struct {
+	mu       sync.Mutex
+	monitor  *Monitor
+	logger   *zap.Logger
+	options  CrashOptions
+	runs     map[string]containerRun // key: containerID
+	crashes  map[string][]*Crash     // key: serviceName
+	restarts map[string][]time.Time  // key: serviceName
+	now      func() time.Time
+}
+
+// NewCrashTracker 创建崩溃检测器并注册到监控器
+func NewCrashTracker(monitor *Monitor, options CrashOptions) *CrashTracker {
+	if options.MaxCrashes <= 0 {
+		options.MaxCrashes = 20
+	}
+
+	t := &CrashTracker{
+		monitor:  monitor,
+		logger:   monitor.logger,
+		options:  options,
+		runs:     make(map[string]containerRun),
+		crashes:  make(map[string][]*Crash),
+		restarts: make(map[string][]time.Time),
+		now:      time.Now,
+	}
+	monitor.OnUpdate(t.observe)
+	return t
+}
+
+// Host 返回所跟踪主机的名称
+func (t *CrashTracker) Host() string {
+	return t.monitor.Name()
+}
+
+func (t *CrashTracker) observe(status *MonitorStatus) {
+	var deaths []*Crash
+
+	status.RLock()
+	t.mu.Lock()
+	seen := make(map[string]bool, len(status.Containers))
+	for id, container := range status.Containers {
+		seen[id] = true
+		previous, known := t.runs[id]
+		t.runs[id] = containerRun{finishedAt: container.FinishedAt, restartCount: container.RestartCount}
+
+		if container.FinishedAt.IsZero() {
+			continue
+		}
+		// 首次观察到的容器只有在已经退出时才记录，避免把历史重启当作新的退出
+		if known && container.FinishedAt.Equal(previous.finishedAt) {
+			continue
+		}
+		if !known && container.Info.Status == "running" {
+			continue
+		}
+		// 正常退出和 docker stop 之类的主动停止不是崩溃，例如重新部署；
+		// 但退出后被重启策略重新拉起时，无论退出码如何都计入崩溃循环
+		restarted := container.Info.Status == "restarting" || (known && container.RestartCount > previous.restartCount)
+		if stoppedCleanly(container) && !restarted {
+			continue
+		}
+
+		crash := &Crash{
+			ContainerID:  id,
+			Container:    container.Info.Name,
+			Service:      container.Info.Service,
+			ExitCode:     container.ExitCode,
+			OOMKilled:    container.OOMKilled,
+			Error:        container.Error,
+			StartedAt:    container.StartedAt,
+			FinishedAt:   container.FinishedAt,
+			RestartCount: container.RestartCount,
+		}
+		t.record(crash, previous.restartCount, known)
+		deaths = append(deaths, crash)
+	}
+	for id := range t.runs {
+		if !seen[id] {
+			delete(t.runs, id)
+		}
+	}
+	t.mu.Unlock()
+	status.RUnlock()
+
+	for _, crash := range deaths {
+		t.logger.Warn("Container exited",
+			zap.String("service", crash.Service),
+			zap.String("container", crash.Container),
+			zap.Int("exitCode", crash.ExitCode),
+			zap.Bool("oomKilled", crash.OOMKilled))
+		if t.options.LogLines > 0 {
+			go t.captureLogs(crash)
+		}
+	}
+}
+
+// stoppedCleanly 判断容器是否正常退出或被主动停止：退出码为 0，
+// 或者没有因内存不足被杀死时收到 SIGTERM（143）或 SIGKILL（137）
+func stoppedCleanly(container *ContainerStatus) bool {
+	switch container.ExitCode {
+	case 0:
+		return container.Error == ""
+	case 128 + 15, 128 + 9:
+		return !container.OOMKilled
+	}
+	return false
+}
+
+// record 保存退出记录并更新重启时间序列，调用方需持有锁
+func (t *CrashTracker) record(crash *Crash, previousRestarts int, known bool) {
+	service := crash.Service
+	crashes := append([]*Crash{crash}, t.crashes[service]...)
+	if len(crashes) > t.options.MaxCrashes {
+		crashes = crashes[:t.options.MaxCrashes]
+	}
+	t.crashes[service] = crashes
+
+	// 两次轮询之间可能发生多次重启，按重启次数差值计数
+	restarts := 1
+	if known && crash.RestartCount > previousRestarts {
+		restarts = crash.RestartCount - previousRestarts
+	}
+	for i := 0; i < restarts; i++ {
+		t.restarts[service] = append(t.restarts[service], crash.FinishedAt)
+	}
+	t.restarts[service] = t.prune(t.restarts[service])
+}
+
+// prune 删除检测窗口之外的重启记录
+func (t *CrashTracker) prune(times []time.Time) []time.Time {
+	cutoff := t.now().Add(-t.options.LoopWindow)
+	kept := times[:0]
+	for _, at := range times {
+		if at.After(cutoff) {
+			kept = append(kept, at)
+		}
+	}
+	return kept
+}
+
+// captureLogs 获取容器退出前的最后几行日志
+func (t *CrashTracker) captureLogs(crash *Crash) {
+	m := t.monitor
+	inspect, err := m.runtime.ContainerInspect(m.ctx, crash.ContainerID)
+	if err != nil {
+		t.logger.Warn("Failed to inspect exited container",
+			zap.String("containerID", crash.ContainerID),
+			zap.Error(err))
+		return
+	}
+
+	reader, err := m.runtime.ContainerLogs(m.ctx, crash.ContainerID, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Tail:       strconv.Itoa(t.options.LogLines),
+		// 容器可能已经重启，只取本次退出之前的日志
+		Until: strconv.FormatInt(crash.FinishedAt.Add(time.Second).Unix(), 10),
+	})
+	if err != nil {
+		t.logger.Warn("Failed to get logs of exited container",
+			zap.String("containerID", crash.ContainerID),
+			zap.Error(err))
+		return
+	}
+	defer reader.Close()
+
+	var buf bytes.Buffer
+	if inspect.Config.Tty {
+		_, err = io.Copy(&buf, reader)
+	} else {
+		_, err = stdcopy.StdCopy(&buf, &buf, reader)
+	}
+	if err != nil {
+		t.logger.Warn("Failed to read logs of exited container",
+			zap.String("containerID", crash.ContainerID),
+			zap.Error(err))
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(&buf)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimRight(scanner.Text(), "\r"))
+	}
+
+	t.mu.Lock()
+	crash.LogTail = lines
+	t.mu.Unlock()
+}
+
+// Crashes 返回指定服务的退出记录，service 为空时返回所有服务
+func (t *CrashTracker) Crashes(service string) []ServiceCrashes {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	names := make([]string, 0, len(t.crashes))
+	for name := range t.crashes {
+		if service == "" || name == service {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	result := make([]ServiceCrashes, 0, len(names))
+	for _, name := range names {
+		t.restarts[name] = t.prune(t.restarts[name])
+		crashes := make([]*Crash, len(t.crashes[name]))
+		for i, crash := range t.crashes[name] {
+			copied := *crash
+			crashes[i] = &copied
+		}
+		result = append(result, ServiceCrashes{
+			Service:   name,
+			CrashLoop: t.inLoop(name),
+			Restarts:  len(t.restarts[name]),
+			Crashes:   crashes,
+		})
+	}
+	return result
+}
+
+// CrashLoop 判断服务是否处于崩溃循环
+func (t *CrashTracker) CrashLoop(service string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.restarts[service] = t.prune(t.restarts[service])
+	return t.inLoop(service)
+}
+
+func (t *CrashTracker) inLoop(service string) bool {
+	return t.options.LoopRestarts > 0 && len(t.restarts[service]) >= t.options.LoopRestarts
+}
@@ -0,0 +1,156 @@
+package docker
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func newTestCrashTracker(now time.Time) *CrashTracker {
+	return &CrashTracker{
+		logger:   zap.NewNop(),
+		options:  CrashOptions{LoopRestarts: 3, LoopWindow: 5 * time.Minute, MaxCrashes: 20},
+		runs:     make(map[string]containerRun),
+		crashes:  make(map[string][]*Crash),
+		restarts: make(map[string][]time.Time),
+		now:      func() time.Time { return now },
+	}
+}
+
+func TestCrashTrackerObserve(t *testing.T) {
+	now := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+	container := func(state string, exitCode, restarts int, finished time.Duration) *ContainerStatus {
+		c := &ContainerStatus{
+			Info:         ContainerInfo{ID: "c1", Name: "app-web-1", Status: state, Service: "web"},
+			ExitCode:     exitCode,
+			RestartCount: restarts,
+		}
+		if finished != 0 {
+			c.FinishedAt = now.Add(-finished)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name      string
+		polls     []*ContainerStatus
+		crashes   int
+		restarts  int
+		crashLoop bool
+	}{
+		{
+			name:  "first sighting of a running container ignores earlier exits",
+			polls: []*ContainerStatus{container("running", 1, 5, time.Minute)},
+		},
+		{
+			name:     "first sighting of an exited container",
+			polls:    []*ContainerStatus{container("exited", 1, 0, time.Minute)},
+			crashes:  1,
+			restarts: 1,
+		},
+		{
+			name: "same exit is recorded once",
+			polls: []*ContainerStatus{
+				container("running", 0, 0, 0),
+				container("restarting", 2, 1, time.Minute),
+				container("restarting", 2, 1, time.Minute),
+			},
+			crashes:  1,
+			restarts: 1,
+		},
+		{
+			name: "restart count delta between polls",
+			polls: []*ContainerStatus{
+				container("running", 0, 1, 0),
+				container("running", 1, 4, 10*time.Second),
+			},
+			crashes:   1,
+			restarts:  3,
+			crashLoop: true,
+		},
+		{
+			name: "restarts outside the window are not counted",
+			polls: []*ContainerStatus{
+				container("running", 0, 0, 0),
+				container("running", 1, 3, 10*time.Minute),
+			},
+			crashes: 1,
+		},
+		{
+			name: "clean exit",
+			polls: []*ContainerStatus{
+				container("running", 0, 0, 0),
+				container("exited", 0, 0, time.Second),
+			},
+		},
+		{
+			name: "docker stop",
+			polls: []*ContainerStatus{
+				container("running", 0, 0, 0),
+				container("exited", 143, 0, time.Second),
+				container("running", 143, 0, time.Second),
+				container("exited", 137, 0, 500*time.Millisecond),
+			},
+		},
+		{
+			name: "redeploys do not make a crash loop",
+			polls: []*ContainerStatus{
+				container("running", 0, 0, 0),
+				container("exited", 143, 0, 3*time.Minute),
+				container("exited", 143, 0, 2*time.Minute),
+				container("exited", 0, 0, time.Minute),
+				container("exited", 1, 0, 10*time.Second),
+			},
+			crashes:  1,
+			restarts: 1,
+		},
+		{
+			name: "clean exits followed by restarts make a crash loop",
+			polls: []*ContainerStatus{
+				container("running", 0, 0, 0),
+				container("running", 0, 1, 40*time.Second),
+				container("restarting", 0, 2, 20*time.Second),
+				container("running", 143, 3, 5*time.Second),
+			},
+			crashes:   3,
+			restarts:  3,
+			crashLoop: true,
+		},
+		{
+			name: "oom kill is a crash",
+			polls: []*ContainerStatus{
+				container("running", 0, 0, 0),
+				func() *ContainerStatus {
+					c := container("exited", 137, 0, time.Second)
+					c.OOMKilled = true
+					return c
+				}(),
+			},
+			crashes:  1,
+			restarts: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		tracker := newTestCrashTracker(now)
+		for _, c := range tt.polls {
+			tracker.observe(&MonitorStatus{Containers: map[string]*ContainerStatus{"c1": c}})
+		}
+
+		crashes := tracker.Crashes("web")
+		got := 0
+		if len(crashes) > 0 {
+			got = len(crashes[0].Crashes)
+			if crashes[0].Restarts != tt.restarts {
+				t.Errorf("%s: restarts = %d, want %d", tt.name, crashes[0].Restarts, tt.restarts)
+			}
+		}
+		if got != tt.crashes {
+			t.Errorf("%s: crashes = %d, want %d", tt.name, got, tt.crashes)
+		}
+		if loop := tracker.CrashLoop("web"); loop != tt.crashLoop {
+			t.Errorf("%s: crash loop = %v, want %v", tt.name, loop, tt.crashLoop)
+		}
+	}
+}
@@ -9,19 +9,21 @@ import (
 	"time"
 
 	"github.com/YooLeon/container-debug-online/internal/config"
+	"github.com/YooLeon/container-debug-online/internal/runtime"
 	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/client"
 	"go.uber.org/zap"
 )
 
 type Monitor struct {
-	client        *client.Client
+	name          string
+	runtime       runtime.Runtime
 	ctx           context.Context
 	cancel        context.CancelFunc
 	logger        *zap.Logger
 	interval      time.Duration
 	composeConfig *config.ComposeConfig
 	status        *MonitorStatus
+	listeners     []func(*MonitorStatus)
 }
 
 type ContainerInfo struct {
@@ -33,9 +35,10 @@ type ContainerInfo struct {
 	Inspect types.ContainerJSON `json:"inspect"`
 }
 
-// NewMonitor 创建新的 Docker 监控器
+// NewMonitor 创建新的 Docker 监控器，name 为所监控主机的名称
 func NewMonitor(
-	client *client.Client,
+	name string,
+	rt runtime.Runtime,
 	logger *zap.Logger,
 	interval time.Duration,
 	composeConfig *config.ComposeConfig,
@@ -43,7 +46,8 @@ func NewMonitor(
 	ctx, cancel := context.WithCancel(context.Background())
 
 	return &Monitor{
-		client:        client,
+		name:          name,
+		runtime:       rt,
 		ctx:           ctx,
 		cancel:        cancel,
 		logger:        logger,
@@ -56,9 +60,14 @@ func NewMonitor(
 	}
 }
 
-// Client 返回 Docker 客户端
-func (m *Monitor) Client() *client.Client {
-	return m.client
+// Name 返回所监控主机的名称
+func (m *Monitor) Name() string {
+	return m.name
+}
+
+// Runtime 返回容器运行时
+func (m *Monitor) Runtime() runtime.Runtime {
+	return m.runtime
 }
 
 // Context 返回上下文
@@ -68,19 +77,19 @@ func (m *Monitor) Context() context.Context {
 
 // ResizeExecTTY 调整终端大小
 func (m *Monitor) ResizeExecTTY(execID string, height, width uint) error {
-	return m.client.ContainerExecResize(m.ctx, execID, types.ResizeOptions{
+	return m.runtime.ContainerExecResize(m.ctx, execID, types.ResizeOptions{
 		Height: height,
 		Width:  width,
 	})
 }
 
-// Close 关闭 Docker 客户端连接
+// Close 关闭容器运行时连接
 func (m *Monitor) Close() error {
 	if m.cancel != nil {
 		m.cancel()
 	}
-	if m.client != nil {
-		return m.client.Close()
+	if m.runtime != nil {
+		return m.runtime.Close()
 	}
 	return nil
 }
@@ -89,6 +98,23 @@ func (m *Monitor) GetComposeConfig() *config.ComposeConfig {
 	return m.composeConfig
 }
 
+// Project 返回主机上 compose 项目的名称，未配置时从已发现的容器标签中获取
+func (m *Monitor) Project() string {
+	if m.composeConfig.Project != "" {
+		return m.composeConfig.Project
+	}
+
+	status := m.GetAllStatus()
+	status.RLock()
+	defer status.RUnlock()
+	for _, container := range status.Containers {
+		if project := container.Info.Labels["com.docker.compose.project"]; project != "" {
+			return project
+		}
+	}
+	return ""
+}
+
 // GetComposePath 返回当前的 compose 文件路径
 func (m *Monitor) GetComposePath() string {
 	return m.composeConfig.Path
@@ -96,7 +122,7 @@ func (m *Monitor) GetComposePath() string {
 
 // 检查端口是否正常监听
 func (m *Monitor) checkPortHealth(containerID string, port string) bool {
-	inspect, err := m.client.ContainerInspect(m.ctx, containerID)
+	inspect, err := m.runtime.ContainerInspect(m.ctx, containerID)
 	if err != nil {
 		return false
 	}
@@ -126,8 +152,25 @@ func (m *Monitor) checkPortHealth(containerID string, port string) bool {
 	return true
 }
 
+// OnUpdate 注册状态更新回调，每次 UpdateStatus 成功后调用
+// 回调在状态锁释放后执行，需要在开始监控循环之前注册
+func (m *Monitor) OnUpdate(fn func(*MonitorStatus)) {
+	m.listeners = append(m.listeners, fn)
+}
+
 // UpdateStatus 更新监控状态
 func (m *Monitor) UpdateStatus() error {
+	if err := m.updateStatus(); err != nil {
+		return err
+	}
+
+	for _, fn := range m.listeners {
+		fn(m.status)
+	}
+	return nil
+}
+
+func (m *Monitor) updateStatus() error {
 	m.status.Lock()
 	defer m.status.Unlock()
 
@@ -136,14 +179,14 @@ func (m *Monitor) UpdateStatus() error {
 	newServices := make(map[string]*ServiceStatus)
 
 	// 获取所有容器
-	containers, err := m.client.ContainerList(m.ctx, types.ContainerListOptions{All: true})
+	containers, err := m.runtime.ContainerList(m.ctx, types.ContainerListOptions{All: true})
 	if err != nil {
 		return err
 	}
 
 	// 如果指定了compose文件，获取其绝对路径
 	var targetComposePath string
-	if m.composeConfig.Path != "" {
+	if m.composeConfig.Path != "" && m.composeConfig.Project == "" {
 		targetComposePath, err = filepath.Abs(m.composeConfig.Path)
 		if err != nil {
 			return fmt.Errorf("failed to get absolute path for compose file: %v", err)
@@ -151,8 +194,17 @@ func (m *Monitor) UpdateStatus() error {
 	}
 
 	for _, container := range containers {
-		// 如果指定了compose文件，检查容器是否属于该compose项目
-		if m.composeConfig.Path != "" {
+		// 远程主机上的 compose 文件路径与本地不同，按项目名匹配
+		if m.composeConfig.Project != "" {
+			serviceName := container.Labels["com.docker.compose.service"]
+			if container.Labels["com.docker.compose.project"] != m.composeConfig.Project {
+				continue
+			}
+			if _, exists := m.composeConfig.Services[serviceName]; !exists {
+				continue
+			}
+		} else if m.composeConfig.Path != "" {
+			// 如果指定了compose文件，检查容器是否属于该compose项目
 			configFile := container.Labels["com.docker.compose.project.config_files"]
 			workDir := container.Labels["com.docker.compose.project.working_dir"]
 			serviceName := container.Labels["com.docker.compose.service"]
@@ -183,7 +235,7 @@ func (m *Monitor) UpdateStatus() error {
 		}
 
 		// 获取容器详细信息
-		inspect, err := m.client.ContainerInspect(m.ctx, container.ID)
+		inspect, err := m.runtime.ContainerInspect(m.ctx, container.ID)
 		if err != nil {
 			m.logger.Warn("Failed to inspect container",
 				zap.String("containerID", container.ID),
@@ -203,7 +255,10 @@ func (m *Monitor) UpdateStatus() error {
 			healthStatus = &HealthStatus{
 				Status:        inspect.State.Health.Status,
 				FailingStreak: inspect.State.Health.FailingStreak,
-				LastCheck:     inspect.State.Health.Log[len(inspect.State.Health.Log)-1].End,
+			}
+			// 健康检查尚未执行时日志为空
+			if n := len(inspect.State.Health.Log); n > 0 {
+				healthStatus.LastCheck = inspect.State.Health.Log[n-1].End
 			}
 			
 			// 获取最近的健康检查日志
@@ -228,6 +283,11 @@ func (m *Monitor) UpdateStatus() error {
 			LastCheck:    time.Now(),
 			Health:       healthStatus,
 			ExitCode:     inspect.State.ExitCode,
+			RestartCount: inspect.RestartCount,
+			OOMKilled:    inspect.State.OOMKilled,
+			Error:        inspect.State.Error,
+			StartedAt:    parseStateTime(inspect.State.StartedAt),
+			FinishedAt:   parseStateTime(inspect.State.FinishedAt),
 		}
 
 		newContainers[container.ID] = containerStatus
@@ -273,11 +333,21 @@ func (m *Monitor) UpdateStatus() error {
 	m.logger.Debug("Status updated",
 		zap.Int("containers", len(newContainers)),
 		zap.Int("services", len(newServices)),
+		zap.String("host", m.name),
 		zap.String("compose_path", m.composeConfig.Path))
 
 	return nil
 }
 
+// parseStateTime 解析容器状态中的时间，Docker 使用零值时间表示未发生
+func parseStateTime(value string) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil || t.Year() <= 1 {
+		return time.Time{}
+	}
+	return t
+}
+
 // GetAllStatus 获取所有状态
 func (m *Monitor) GetAllStatus() *MonitorStatus {
 	m.status.RLock()
@@ -32,6 +32,11 @@ type ContainerStatus struct {
 	LastCheck    time.Time          `json:"last_check"`
 	Health       *HealthStatus      `json:"health"`      // 添加健康状态
 	ExitCode     int               `json:"exit_code"`   // 添加退出码
+	RestartCount int               `json:"restart_count"` // 重启次数
+	OOMKilled    bool              `json:"oom_killed"`    // 是否因内存不足被杀死
+	Error        string            `json:"error"`         // 引擎记录的错误信息
+	StartedAt    time.Time         `json:"started_at"`    // 最近一次启动时间
+	FinishedAt   time.Time         `json:"finished_at"`   // 最近一次退出时间
 }
 
 // MonitorStatus 存储监控状态
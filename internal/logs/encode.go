@@ -0,0 +1,164 @@
+package logs
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// 下载日志的压缩方式
+const (
+	CompressNone = ""
+	CompressGzip = "gzip"
+	CompressZstd = "zstd"
+)
+
+// csvHeader CSV 格式的列
+var csvHeader = []string{"ts", "stream", "container", "service", "level", "line"}
+
+// Encoder 将日志帧写为下载文件的格式
+type Encoder interface {
+	Encode(frame Frame) error
+	// Flush 写出缓冲的内容，不关闭底层的 Writer
+	Flush() error
+}
+
+// NewEncoder 创建指定格式的编码器：text、json (NDJSON) 或 csv
+func NewEncoder(w io.Writer, format string) (Encoder, error) {
+	switch format {
+	case FormatText:
+		return &textEncoder{w: w}, nil
+	case FormatJSON:
+		return &jsonEncoder{encoder: json.NewEncoder(w)}, nil
+	case FormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(csvHeader); err != nil {
+			return nil, err
+		}
+		return &csvEncoder{writer: writer}, nil
+	}
+	return nil, fmt.Errorf("unsupported format: %s", format)
+}
+
+// Extension 返回格式对应的文件扩展名
+func Extension(format string) string {
+	switch format {
+	case FormatJSON:
+		return ".ndjson"
+	case FormatCSV:
+		return ".csv"
+	}
+	return ".log"
+}
+
+// ContentType 返回格式对应的 MIME 类型
+func ContentType(format string) string {
+	switch format {
+	case FormatJSON:
+		return "application/x-ndjson"
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	}
+	return "text/plain; charset=utf-8"
+}
+
+type textEncoder struct {
+	w io.Writer
+}
+
+func (e *textEncoder) Encode(frame Frame) error {
+	_, err := io.WriteString(e.w, frame.Entry().Text())
+	return err
+}
+
+func (e *textEncoder) Flush() error {
+	return nil
+}
+
+type jsonEncoder struct {
+	encoder *json.Encoder
+}
+
+func (e *jsonEncoder) Encode(frame Frame) error {
+	return e.encoder.Encode(frame)
+}
+
+func (e *jsonEncoder) Flush() error {
+	return nil
+}
+
+type csvEncoder struct {
+	writer *csv.Writer
+}
+
+func (e *csvEncoder) Encode(frame Frame) error {
+	return e.writer.Write([]string{
+		frame.Time.Format(TimestampFormat),
+		frame.Stream,
+		frame.Container,
+		frame.Service,
+		frame.Level,
+		frame.Line,
+	})
+}
+
+func (e *csvEncoder) Flush() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+// ParseCompression 校验压缩方式
+func ParseCompression(method string) (string, error) {
+	switch method {
+	case CompressNone, CompressGzip, CompressZstd:
+		return method, nil
+	}
+	return "", fmt.Errorf("unsupported compression: %s", method)
+}
+
+// Compress 按压缩方式包装 w，关闭返回的 Writer 时写出压缩尾部，不关闭 w
+func Compress(w io.Writer, method string) (io.WriteCloser, error) {
+	switch method {
+	case CompressGzip:
+		return gzip.NewWriter(w), nil
+	case CompressZstd:
+		return zstd.NewWriter(w)
+	case CompressNone:
+		return nopCloser{w}, nil
+	}
+	return nil, fmt.Errorf("unsupported compression: %s", method)
+}
+
+// CompressionExtension 返回压缩方式对应的文件扩展名
+func CompressionExtension(method string) string {
+	switch method {
+	case CompressGzip:
+		return ".gz"
+	case CompressZstd:
+		return ".zst"
+	}
+	return ""
+}
+
+// CompressionContentType 返回压缩文件的 MIME 类型
+func CompressionContentType(method string) string {
+	switch method {
+	case CompressGzip:
+		return "application/gzip"
+	case CompressZstd:
+		return "application/zstd"
+	}
+	return ""
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
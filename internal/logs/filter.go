@@ -0,0 +1,104 @@
+package logs
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 字段过滤的比较运算符，两个字符的运算符需要先匹配
+var filterOperators = []string{"!=", ">=", "<=", "=", ">", "<"}
+
+// FieldFilter 表示对 JSON 日志字段的过滤条件，例如 level>=warn、user_id=42
+type FieldFilter struct {
+	Key      string
+	Operator string
+	Value    string
+}
+
+// ParseFieldFilter 解析过滤表达式
+func ParseFieldFilter(expr string) (FieldFilter, error) {
+	index, operator := -1, ""
+	for _, op := range filterOperators {
+		if i := strings.Index(expr, op); i >= 0 && (index < 0 || i < index) {
+			index, operator = i, op
+		}
+	}
+	if index <= 0 {
+		return FieldFilter{}, fmt.Errorf("invalid filter: %s", expr)
+	}
+
+	filter := FieldFilter{
+		Key:      strings.TrimSpace(expr[:index]),
+		Operator: operator,
+		Value:    strings.TrimSpace(expr[index+len(operator):]),
+	}
+	if filter.Key == "level" {
+		level := levelAliases[strings.ToLower(filter.Value)]
+		if level == "" {
+			return FieldFilter{}, fmt.Errorf("invalid level: %s", filter.Value)
+		}
+		filter.Value = level
+	}
+	return filter, nil
+}
+
+// Match 判断解析后的日志是否满足条件，不是 JSON 的日志行不满足任何条件
+func (f FieldFilter) Match(parsed *Parsed) bool {
+	if parsed == nil {
+		return false
+	}
+	value, ok := parsed.lookup(f.Key)
+	if !ok {
+		return f.Operator == "!="
+	}
+
+	if f.Key == "level" {
+		return compare(f.Operator, levelRank(stringValue(value))-levelRank(f.Value))
+	}
+
+	actual := stringValue(value)
+	switch f.Operator {
+	case "=":
+		return actual == f.Value
+	case "!=":
+		return actual != f.Value
+	}
+
+	// 数字按数值比较，其余按字符串比较
+	if number, ok := value.(json.Number); ok {
+		if expected, err := strconv.ParseFloat(f.Value, 64); err == nil {
+			if actual, err := number.Float64(); err == nil {
+				switch {
+				case actual < expected:
+					return compare(f.Operator, -1)
+				case actual > expected:
+					return compare(f.Operator, 1)
+				default:
+					return compare(f.Operator, 0)
+				}
+			}
+		}
+	}
+	return compare(f.Operator, strings.Compare(actual, f.Value))
+}
+
+// compare 根据比较结果 (负数、零、正数) 判断运算符是否成立
+func compare(operator string, result int) bool {
+	switch operator {
+	case "=":
+		return result == 0
+	case "!=":
+		return result != 0
+	case ">=":
+		return result >= 0
+	case "<=":
+		return result <= 0
+	case ">":
+		return result > 0
+	case "<":
+		return result < 0
+	}
+	return false
+}
@@ -0,0 +1,186 @@
+package logs
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/YooLeon/container-debug-online/internal/runtime"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"go.uber.org/zap"
+)
+
+// reattachInterval 没有收到容器启动事件时重新检查容器的间隔
+const reattachInterval = 2 * time.Second
+
+// Target 表示聚合日志中的一个来源
+type Target struct {
+	Service string
+	// Resolve 返回来源当前对应的容器 ID，容器不存在时返回空字符串
+	Resolve func(ctx context.Context) string
+	// Matches 判断容器启动事件的属性是否属于该来源，用于容器重建后立即重新附加
+	Matches func(attributes map[string]string) bool
+}
+
+// Aggregate 同时跟随多个来源的日志，按时间戳合并后输出
+// 容器被重建后会自动附加到新容器；指定了 until 时读取一次后结束
+func Aggregate(ctx context.Context, rt runtime.Runtime, targets []Target, options *Options, window time.Duration, logger *zap.Logger) <-chan Frame {
+	frames := make(chan Frame)
+	follow := options.Until.IsZero()
+
+	wakes := make([]chan struct{}, len(targets))
+	for i := range wakes {
+		wakes[i] = make(chan struct{}, 1)
+	}
+	if follow {
+		go watchStarts(ctx, rt, targets, wakes)
+	}
+
+	done := make(chan struct{})
+	for i := range targets {
+		go func(target Target, wake <-chan struct{}) {
+			defer func() { done <- struct{}{} }()
+			f := &follower{runtime: rt, target: target, options: options, out: frames, logger: logger}
+			f.run(ctx, follow, wake)
+		}(targets[i], wakes[i])
+	}
+	go func() {
+		for range targets {
+			<-done
+		}
+		close(frames)
+	}()
+
+	return Merge(ctx, frames, window)
+}
+
+// watchStarts 订阅容器启动事件并唤醒对应来源的跟随协程
+func watchStarts(ctx context.Context, rt runtime.Runtime, targets []Target, wakes []chan struct{}) {
+	args := filters.NewArgs(
+		filters.Arg("type", "container"),
+		filters.Arg("event", "start"),
+	)
+	messages, errs := rt.Events(ctx, types.EventsOptions{Filters: args})
+	for {
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			for i, target := range targets {
+				if target.Matches != nil && target.Matches(msg.Actor.Attributes) {
+					select {
+					case wakes[i] <- struct{}{}:
+					default:
+					}
+				}
+			}
+		case <-errs:
+			// 事件流中断时依靠定时检查重新附加
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// follower 跟随一个来源的日志
+type follower struct {
+	runtime runtime.Runtime
+	target  Target
+	options *Options
+	out     chan<- Frame
+	logger  *zap.Logger
+
+	containerID string
+	last        time.Time // 当前容器已发送的最后一行的时间
+}
+
+func (f *follower) run(ctx context.Context, follow bool, wake <-chan struct{}) {
+	ticker := time.NewTicker(reattachInterval)
+	defer ticker.Stop()
+
+	for {
+		if id := f.target.Resolve(ctx); id != "" {
+			if err := f.stream(ctx, id, follow); err != nil && ctx.Err() == nil {
+				f.logger.Warn("Error following logs",
+					zap.String("service", f.target.Service),
+					zap.String("containerID", id),
+					zap.Error(err))
+			}
+		}
+		if !follow {
+			return
+		}
+
+		select {
+		case <-wake:
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// stream 跟随一个容器的日志直到日志流结束
+// 再次附加到同一容器时从上次的位置继续，附加到新容器时从新容器的第一行开始
+func (f *follower) stream(ctx context.Context, id string, follow bool) error {
+	inspect, err := f.runtime.ContainerInspect(ctx, id)
+	if err != nil {
+		return err
+	}
+	name := strings.TrimPrefix(inspect.Name, "/")
+
+	options := f.options.ContainerLogsOptions(follow)
+	resumeFrom := time.Time{}
+	switch {
+	case f.containerID == id && !f.last.IsZero():
+		// 已停止的容器没有新日志，等待启动事件
+		if inspect.State != nil && !inspect.State.Running {
+			return nil
+		}
+		resumeFrom = f.last
+		options.Since = resumeFrom.Format(time.RFC3339Nano)
+		options.Tail = "all"
+	case f.containerID != "" && f.containerID != id:
+		options.Since = ""
+		options.Tail = "all"
+	}
+	if f.containerID != id {
+		f.containerID = id
+		f.last = time.Time{}
+	}
+
+	logReader, err := f.runtime.ContainerLogs(ctx, id, options)
+	if err != nil {
+		return err
+	}
+	defer logReader.Close()
+
+	reader := f.options.NewReader(ctx, logReader, inspect.Config.Tty)
+	for {
+		entry, err := reader.Next()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		// since 包含边界，跳过已发送过的行
+		if !resumeFrom.IsZero() && !entry.Time.After(resumeFrom) {
+			continue
+		}
+		f.last = entry.Time
+		if !f.options.Match(&entry) {
+			continue
+		}
+
+		select {
+		case f.out <- NewFrame(&entry, name, inspect.ID, f.target.Service):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package logs
+
+import (
+	"time"
+)
+
+// 日志输出格式
+const (
+	FormatText = "text" // 原始文本，每条消息一行
+	FormatJSON = "json" // 每条消息一个 Frame，下载时为 NDJSON
+	FormatCSV  = "csv"  // 仅用于下载
+)
+
+// Frame 表示 JSON 格式下的一条日志消息
+type Frame struct {
+	Time        time.Time `json:"ts"`
+	Stream      string    `json:"stream"`
+	Container   string    `json:"container"`
+	ContainerID string    `json:"container_id"`
+	Service     string    `json:"service"`
+	Line        string    `json:"line"`
+
+	// 以下字段仅在日志行为 JSON 时存在
+	Level   string                 `json:"level,omitempty"`
+	Message string                 `json:"msg,omitempty"`
+	LogTime *time.Time             `json:"log_ts,omitempty"` // 日志内容中的时间
+	TraceID string                 `json:"trace_id,omitempty"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+}
+
+// NewFrame 为日志行附加容器信息，JSON 日志会附带提取的级别、消息和字段
+func NewFrame(entry *Entry, container, containerID, service string) Frame {
+	frame := Frame{
+		Time:        entry.Time,
+		Stream:      entry.Stream,
+		Container:   container,
+		ContainerID: containerID,
+		Service:     service,
+		Line:        entry.Line,
+	}
+	if parsed := entry.JSON(); parsed != nil {
+		frame.Level = parsed.Level
+		frame.Message = parsed.Message
+		frame.TraceID = parsed.TraceID
+		if len(parsed.Fields) > 0 {
+			frame.Fields = parsed.Fields
+		}
+		if !parsed.Time.IsZero() {
+			frame.LogTime = &parsed.Time
+		}
+	}
+	return frame
+}
+
+// Entry 返回去掉容器信息后的日志行
+func (f Frame) Entry() Entry {
+	return Entry{Time: f.Time, Stream: f.Stream, Line: f.Line}
+}
@@ -0,0 +1,108 @@
+package logs
+
+import (
+	"container/heap"
+	"context"
+	"time"
+)
+
+// maxBuffered 重排缓冲区的最大行数，超出时提前输出最早的行
+const maxBuffered = 10000
+
+// Merge 合并多个来源的日志帧，按时间戳排序后输出
+// 每帧在缓冲区中停留 window 时间，等待来自其他来源的更早的日志；in 关闭后输出剩余的帧并关闭返回的通道
+func Merge(ctx context.Context, in <-chan Frame, window time.Duration) <-chan Frame {
+	out := make(chan Frame)
+
+	go func() {
+		defer close(out)
+
+		buffer := &frameHeap{}
+		var seq uint64
+		timer := time.NewTimer(window)
+		defer timer.Stop()
+
+		send := func(frame Frame) bool {
+			select {
+			case out <- frame:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		// flush 输出所有到期的帧，返回下一帧到期前需要等待的时间
+		flush := func(all bool) (time.Duration, bool) {
+			now := time.Now()
+			for buffer.Len() > 0 {
+				next := (*buffer)[0]
+				if wait := next.arrival.Add(window).Sub(now); !all && wait > 0 && buffer.Len() <= maxBuffered {
+					return wait, true
+				}
+				heap.Pop(buffer)
+				if !send(next.frame) {
+					return 0, false
+				}
+			}
+			return window, true
+		}
+
+		for {
+			select {
+			case frame, ok := <-in:
+				if !ok {
+					flush(true)
+					return
+				}
+				seq++
+				heap.Push(buffer, bufferedFrame{frame: frame, arrival: time.Now(), seq: seq})
+				if buffer.Len() > maxBuffered {
+					if _, ok := flush(false); !ok {
+						return
+					}
+				}
+			case <-timer.C:
+				wait, ok := flush(false)
+				if !ok {
+					return
+				}
+				timer.Reset(wait)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// bufferedFrame 表示缓冲区中的一帧，seq 保证相同时间戳的帧按到达顺序输出
+type bufferedFrame struct {
+	frame   Frame
+	arrival time.Time
+	seq     uint64
+}
+
+// frameHeap 按时间戳排序的最小堆
+type frameHeap []bufferedFrame
+
+func (h frameHeap) Len() int { return len(h) }
+
+func (h frameHeap) Less(i, j int) bool {
+	if h[i].frame.Time.Equal(h[j].frame.Time) {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].frame.Time.Before(h[j].frame.Time)
+}
+
+func (h frameHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *frameHeap) Push(x interface{}) { *h = append(*h, x.(bufferedFrame)) }
+
+func (h *frameHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
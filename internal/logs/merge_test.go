@@ -0,0 +1,52 @@
+package logs
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMergeOrdersWithinWindow(t *testing.T) {
+	base := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	in := make(chan Frame)
+	out := Merge(context.Background(), in, 100*time.Millisecond)
+
+	go func() {
+		// 来自不同服务的日志乱序到达
+		in <- Frame{Time: base.Add(3 * time.Second), Service: "api", Line: "c"}
+		in <- Frame{Time: base.Add(1 * time.Second), Service: "worker", Line: "a"}
+		in <- Frame{Time: base.Add(2 * time.Second), Service: "api", Line: "b1"}
+		in <- Frame{Time: base.Add(2 * time.Second), Service: "worker", Line: "b2"}
+		close(in)
+	}()
+
+	var got []string
+	for frame := range out {
+		got = append(got, frame.Line)
+	}
+	want := []string{"a", "b1", "b2", "c"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestMergeReleasesAfterWindow(t *testing.T) {
+	in := make(chan Frame)
+	out := Merge(context.Background(), in, 50*time.Millisecond)
+	defer close(in)
+
+	in <- Frame{Time: time.Now(), Line: "first"}
+	select {
+	case frame := <-out:
+		if frame.Line != "first" {
+			t.Errorf("line = %q, want first", frame.Line)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("frame not released after the reorder window")
+	}
+}
@@ -0,0 +1,291 @@
+package logs
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 多行分组的内置预设
+const (
+	PresetJava   = "java"
+	PresetPython = "python"
+	PresetGo     = "go"
+	PresetIndent = "indent" // 以空白开头的行属于上一行
+)
+
+const (
+	// maxGroupLines 单个事件的最大行数，超出后开始新事件
+	maxGroupLines = 500
+	// groupTimeout 跟随日志时，超过该时间没有后续行则输出当前事件
+	groupTimeout = 500 * time.Millisecond
+)
+
+var (
+	javaContinue = regexp.MustCompile(`^(\s+at |\s+\.\.\. \d+ (more|common frames omitted)|Caused by: |\s*Suppressed: )`)
+
+	pythonStart     = regexp.MustCompile(`^Traceback \(most recent call last\):`)
+	pythonContinue  = regexp.MustCompile(`^(\s|$|During handling of the above exception|The above exception was the direct cause)`)
+	pythonException = regexp.MustCompile(`^[\w.]+(: .*)?$`)
+
+	goStart    = regexp.MustCompile(`^(panic: |fatal error: )`)
+	goContinue = regexp.MustCompile(`^(\s|$|goroutine \d+ \[|created by |\[signal |exit status |[\w./*()-]+\(.*\)$)`)
+)
+
+// pythonEnd 表示 Python 回溯已输出异常信息，只接受异常链的提示
+const pythonEnd = PresetPython + "-end"
+
+// Multiline 表示多行分组配置
+type Multiline struct {
+	Presets  []string
+	Continue *regexp.Regexp // 匹配的行属于上一行
+}
+
+// ParseMultiline 解析逗号分隔的预设列表与自定义续行正则，都为空时返回 nil
+func ParseMultiline(presets, pattern string) (*Multiline, error) {
+	if presets == "" && pattern == "" {
+		return nil, nil
+	}
+
+	multiline := &Multiline{}
+	for _, preset := range strings.Split(presets, ",") {
+		preset = strings.TrimSpace(preset)
+		switch preset {
+		case "":
+		case PresetJava, PresetPython, PresetGo, PresetIndent:
+			multiline.Presets = append(multiline.Presets, preset)
+		default:
+			return nil, fmt.Errorf("unknown multiline preset: %s", preset)
+		}
+	}
+	if pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid multiline pattern: %v", err)
+		}
+		multiline.Continue = re
+	}
+	return multiline, nil
+}
+
+// EntryReader 逐个读取日志事件
+type EntryReader interface {
+	Next() (Entry, error)
+}
+
+// Grouper 将堆栈等多行输出合并为一个事件，事件的 Line 中以换行符分隔各行
+type Grouper struct {
+	grouping
+	ctx     context.Context
+	entries chan readResult
+	err     error
+}
+
+// grouping 正在合并的事件
+type grouping struct {
+	config  *Multiline
+	pending *Entry
+	lines   int
+	mode    string // 当前事件由哪个预设开始，决定后续行的规则
+}
+
+type readResult struct {
+	entry Entry
+	err   error
+}
+
+// NewGrouper 创建多行分组读取器，ctx 结束后停止读取 source
+func NewGrouper(ctx context.Context, source EntryReader, config *Multiline) *Grouper {
+	g := &Grouper{
+		grouping: grouping{config: config},
+		ctx:      ctx,
+		entries:  make(chan readResult),
+	}
+
+	go func() {
+		for {
+			entry, err := source.Next()
+			select {
+			case g.entries <- readResult{entry: entry, err: err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	return g
+}
+
+// Next 返回下一个事件，事件在遇到不属于它的行、达到行数上限或等待超时后输出
+func (g *Grouper) Next() (Entry, error) {
+	for {
+		if g.err != nil {
+			if g.pending != nil {
+				return g.flush(), nil
+			}
+			return Entry{}, g.err
+		}
+
+		var timeout <-chan time.Time
+		var timer *time.Timer
+		if g.pending != nil {
+			timer = time.NewTimer(groupTimeout)
+			timeout = timer.C
+		}
+
+		select {
+		case result := <-g.entries:
+			if timer != nil {
+				timer.Stop()
+			}
+			if event, ok := g.receive(result); ok {
+				return event, nil
+			}
+		case <-timeout:
+			return g.flush(), nil
+		case <-g.ctx.Done():
+			return Entry{}, g.ctx.Err()
+		}
+	}
+}
+
+func (g *Grouper) receive(result readResult) (Entry, bool) {
+	if result.err != nil {
+		g.err = result.err
+		return Entry{}, false
+	}
+	return g.add(result.entry)
+}
+
+// add 将一行加入当前事件，当前事件结束时返回它
+func (g *grouping) add(entry Entry) (Entry, bool) {
+	if g.pending != nil && g.pending.Stream == entry.Stream && g.lines < maxGroupLines && g.continues(entry.Line) {
+		g.pending.Line += "\n" + entry.Line
+		g.lines++
+		return Entry{}, false
+	}
+
+	var event Entry
+	flushed := g.pending != nil
+	if flushed {
+		event = g.flush()
+	}
+	g.start(entry)
+	return event, flushed
+}
+
+func (g *grouping) start(entry Entry) {
+	g.pending = &entry
+	g.lines = 1
+	g.mode = ""
+	for _, preset := range g.config.Presets {
+		if (preset == PresetPython && pythonStart.MatchString(entry.Line)) ||
+			(preset == PresetGo && goStart.MatchString(entry.Line)) {
+			g.mode = preset
+		}
+	}
+}
+
+func (g *grouping) flush() Entry {
+	event := *g.pending
+	g.pending = nil
+	g.mode = ""
+	return event
+}
+
+// continues 判断一行是否属于当前事件
+func (g *grouping) continues(line string) bool {
+	switch g.mode {
+	case PresetPython:
+		if pythonContinue.MatchString(line) || pythonStart.MatchString(line) {
+			return true
+		}
+		// 回溯最后一行为不缩进的异常信息
+		if pythonException.MatchString(line) {
+			g.mode = pythonEnd
+			return true
+		}
+		return false
+	case pythonEnd:
+		if strings.HasPrefix(line, "During handling") || strings.HasPrefix(line, "The above exception") || line == "" {
+			g.mode = PresetPython
+			return true
+		}
+		return false
+	case PresetGo:
+		return goContinue.MatchString(line)
+	}
+
+	if g.config.Continue != nil && g.config.Continue.MatchString(line) {
+		return true
+	}
+	for _, preset := range g.config.Presets {
+		switch preset {
+		case PresetJava:
+			if javaContinue.MatchString(line) {
+				return true
+			}
+		case PresetIndent:
+			if line != "" && (line[0] == ' ' || line[0] == '\t') {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// FrameGrouper 按容器分别合并多行事件，用于归档这类已经写完、多个容器交错的日志
+// 事件在同一容器出现不属于它的行时输出，因此不同容器的事件之间可能不按时间排序
+type FrameGrouper struct {
+	config *Multiline
+	groups map[string]*frameGroup // key: containerID
+}
+
+type frameGroup struct {
+	grouping
+	frame Frame // 事件第一行，提供容器信息
+}
+
+// NewFrameGrouper 创建按容器分组的合并器
+func NewFrameGrouper(config *Multiline) *FrameGrouper {
+	return &FrameGrouper{config: config, groups: make(map[string]*frameGroup)}
+}
+
+// Add 加入一行，该容器之前的事件因此结束时返回它
+func (g *FrameGrouper) Add(frame Frame) (Frame, bool) {
+	fg, ok := g.groups[frame.ContainerID]
+	if !ok {
+		fg = &frameGroup{grouping: grouping{config: g.config}}
+		g.groups[frame.ContainerID] = fg
+	}
+
+	previous := fg.frame
+	event, done := fg.add(frame.Entry())
+	if fg.lines == 1 {
+		fg.frame = frame
+	}
+	if !done {
+		return Frame{}, false
+	}
+	return NewFrame(&event, previous.Container, previous.ContainerID, previous.Service), true
+}
+
+// Flush 返回所有未结束的事件，按开始时间排序
+func (g *FrameGrouper) Flush() []Frame {
+	events := make([]Frame, 0, len(g.groups))
+	for id, fg := range g.groups {
+		if fg.pending != nil {
+			event := fg.flush()
+			events = append(events, NewFrame(&event, fg.frame.Container, fg.frame.ContainerID, fg.frame.Service))
+		}
+		delete(g.groups, id)
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+	return events
+}
@@ -0,0 +1,193 @@
+package logs
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sliceReader 依次返回给定的行
+type sliceReader struct {
+	lines []string
+}
+
+func (r *sliceReader) Next() (Entry, error) {
+	if len(r.lines) == 0 {
+		return Entry{}, io.EOF
+	}
+	line := r.lines[0]
+	r.lines = r.lines[1:]
+	return Entry{Stream: StreamStdout, Line: line}, nil
+}
+
+func group(t *testing.T, presets, pattern string, lines ...string) []string {
+	t.Helper()
+
+	config, err := ParseMultiline(presets, pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	grouper := NewGrouper(context.Background(), &sliceReader{lines: lines}, config)
+
+	var events []string
+	for {
+		entry, err := grouper.Next()
+		if err == io.EOF {
+			return events
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, entry.Line)
+	}
+}
+
+func assertEvents(t *testing.T, got []string, want ...string) {
+	t.Helper()
+
+	if strings.Join(got, "\n--\n") != strings.Join(want, "\n--\n") {
+		t.Errorf("events:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestGroupJava(t *testing.T) {
+	got := group(t, "java", "",
+		"INFO starting",
+		"java.lang.IllegalStateException: boom",
+		"\tat com.example.App.run(App.java:10)",
+		"\tat com.example.App.main(App.java:5)",
+		"Caused by: java.io.IOException: disk",
+		"\tat com.example.Disk.read(Disk.java:3)",
+		"\t... 2 more",
+		"INFO recovered",
+	)
+	assertEvents(t, got,
+		"INFO starting",
+		"java.lang.IllegalStateException: boom\n\tat com.example.App.run(App.java:10)\n\tat com.example.App.main(App.java:5)\nCaused by: java.io.IOException: disk\n\tat com.example.Disk.read(Disk.java:3)\n\t... 2 more",
+		"INFO recovered",
+	)
+}
+
+func TestGroupPython(t *testing.T) {
+	got := group(t, "python", "",
+		"Traceback (most recent call last):",
+		`  File "app.py", line 3, in <module>`,
+		"    main()",
+		"KeyError: 'id'",
+		"",
+		"During handling of the above exception, another exception occurred:",
+		"",
+		"Traceback (most recent call last):",
+		`  File "app.py", line 5, in <module>`,
+		"ValueError: bad",
+		"INFO next request",
+	)
+	if len(got) != 2 || got[1] != "INFO next request" {
+		t.Fatalf("events = %q", got)
+	}
+	if !strings.HasPrefix(got[0], "Traceback") || !strings.HasSuffix(got[0], "ValueError: bad") {
+		t.Errorf("traceback event = %q", got[0])
+	}
+}
+
+func TestGroupGo(t *testing.T) {
+	got := group(t, "go", "",
+		"panic: runtime error: index out of range [3] with length 1",
+		"",
+		"goroutine 1 [running]:",
+		"main.handler(...)",
+		"\t/app/main.go:12",
+		"main.main()",
+		"\t/app/main.go:20 +0x1d",
+		"exit status 2",
+		"starting server",
+	)
+	if len(got) != 2 || got[1] != "starting server" || strings.Count(got[0], "\n") != 7 {
+		t.Errorf("events = %q", got)
+	}
+}
+
+func TestGroupIndentAndPattern(t *testing.T) {
+	assertEvents(t, group(t, "indent", "", "config:", "  a: 1", "  b: 2", "done"),
+		"config:\n  a: 1\n  b: 2", "done")
+	assertEvents(t, group(t, "", `^\+`, "sum", "+1", "+2", "end"),
+		"sum\n+1\n+2", "end")
+}
+
+func TestGroupFlushesAfterTimeout(t *testing.T) {
+	config, _ := ParseMultiline("java", "")
+	source := make(chan Entry)
+	grouper := NewGrouper(context.Background(), chanReader(source), config)
+
+	go func() { source <- Entry{Line: "java.lang.Error: x"} }()
+	start := time.Now()
+	entry, err := grouper.Next()
+	if err != nil || entry.Line != "java.lang.Error: x" {
+		t.Fatalf("Next = %q, %v", entry.Line, err)
+	}
+	if elapsed := time.Since(start); elapsed < groupTimeout {
+		t.Errorf("event released after %v, before the timeout", elapsed)
+	}
+}
+
+type chanReader chan Entry
+
+func (c chanReader) Next() (Entry, error) {
+	return <-c, nil
+}
+
+func TestParseMultilineErrors(t *testing.T) {
+	if _, err := ParseMultiline("cobol", ""); err == nil {
+		t.Error("unknown preset should fail")
+	}
+	if _, err := ParseMultiline("", "("); err == nil {
+		t.Error("invalid pattern should fail")
+	}
+	if config, err := ParseMultiline("", ""); config != nil || err != nil {
+		t.Errorf("empty config = %v, %v", config, err)
+	}
+}
+
+func TestFrameGrouper(t *testing.T) {
+	config, _ := ParseMultiline("java", "")
+	grouper := NewFrameGrouper(config)
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	frame := func(id, line string, offset int) Frame {
+		return Frame{Time: start.Add(time.Duration(offset) * time.Second), Stream: StreamStdout, Container: "app-" + id, ContainerID: id, Service: "app", Line: line}
+	}
+
+	// 两个容器的堆栈交错写入
+	var events []Frame
+	for _, f := range []Frame{
+		frame("a", "java.lang.Error: a", 0),
+		frame("b", "java.lang.Error: b", 1),
+		frame("a", "\tat A.run(A.java:1)", 2),
+		frame("b", "\tat B.run(B.java:1)", 3),
+		frame("a", "a done", 4),
+		frame("b", "\tat B.main(B.java:2)", 5),
+	} {
+		if event, ok := grouper.Add(f); ok {
+			events = append(events, event)
+		}
+	}
+	events = append(events, grouper.Flush()...)
+
+	want := []Frame{
+		frame("a", "java.lang.Error: a\n\tat A.run(A.java:1)", 0),
+		frame("b", "java.lang.Error: b\n\tat B.run(B.java:1)\n\tat B.main(B.java:2)", 1),
+		frame("a", "a done", 4),
+	}
+	if len(events) != len(want) {
+		t.Fatalf("events = %+v", events)
+	}
+	for i := range want {
+		if events[i].Line != want[i].Line || events[i].ContainerID != want[i].ContainerID || !events[i].Time.Equal(want[i].Time) {
+			t.Errorf("event %d = %+v, want %+v", i, events[i], want[i])
+		}
+	}
+	if len(grouper.Flush()) != 0 {
+		t.Error("Flush returned events twice")
+	}
+}
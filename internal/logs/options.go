@@ -0,0 +1,191 @@
+// Package logs 处理容器日志的查询参数与过滤
+package logs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// 日志流选择
+const (
+	StreamAll    = "all"
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// Options 表示日志查询参数
+type Options struct {
+	Since     time.Time
+	Until     time.Time
+	Tail      string // 行数或 all
+	Stream    string // all, stdout 或 stderr
+	Include   *regexp.Regexp
+	Exclude   *regexp.Regexp
+	Format    string // text、json 或 csv
+	Fields    []FieldFilter
+	Multiline *Multiline
+}
+
+// ParseOptions 从查询参数解析日志选项，未指定 tail 时使用 defaultTail
+//
+//	since, until  RFC3339 时间或相对时长，如 15m
+//	tail          行数或 all
+//	stream        all, stdout 或 stderr
+//	include       只保留匹配的行
+//	exclude       丢弃匹配的行
+//	format        text、json (ndjson) 或 csv
+//	filter        JSON 日志字段条件，可重复，如 level>=warn、user_id=42
+//	level         最低日志级别，等同于 filter=level>=LEVEL
+//	multiline     多行分组预设，逗号分隔：java, python, go, indent
+//	multiline_pattern  自定义续行正则，匹配的行属于上一行
+func ParseOptions(query url.Values, defaultTail string) (*Options, error) {
+	now := time.Now()
+	options := &Options{
+		Tail:   defaultTail,
+		Stream: StreamAll,
+		Format: FormatText,
+	}
+
+	var err error
+	if options.Since, err = parseTime(query.Get("since"), now); err != nil {
+		return nil, fmt.Errorf("invalid since: %v", err)
+	}
+	if options.Until, err = parseTime(query.Get("until"), now); err != nil {
+		return nil, fmt.Errorf("invalid until: %v", err)
+	}
+	if !options.Since.IsZero() && !options.Until.IsZero() && options.Until.Before(options.Since) {
+		return nil, fmt.Errorf("until is before since")
+	}
+
+	if tail := query.Get("tail"); tail != "" {
+		if tail != "all" {
+			n, err := strconv.Atoi(tail)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid tail: %s", tail)
+			}
+		}
+		options.Tail = tail
+	}
+
+	if stream := query.Get("stream"); stream != "" {
+		switch stream {
+		case StreamAll, StreamStdout, StreamStderr:
+			options.Stream = stream
+		default:
+			return nil, fmt.Errorf("invalid stream: %s", stream)
+		}
+	}
+
+	if format := query.Get("format"); format != "" {
+		switch format {
+		case FormatText, FormatJSON, FormatCSV:
+			options.Format = format
+		case "ndjson":
+			options.Format = FormatJSON
+		default:
+			return nil, fmt.Errorf("invalid format: %s", format)
+		}
+	}
+
+	if level := query.Get("level"); level != "" {
+		filter, err := ParseFieldFilter("level>=" + level)
+		if err != nil {
+			return nil, err
+		}
+		options.Fields = append(options.Fields, filter)
+	}
+	for _, expr := range query["filter"] {
+		filter, err := ParseFieldFilter(expr)
+		if err != nil {
+			return nil, err
+		}
+		options.Fields = append(options.Fields, filter)
+	}
+
+	if options.Multiline, err = ParseMultiline(query.Get("multiline"), query.Get("multiline_pattern")); err != nil {
+		return nil, err
+	}
+
+	if include := query.Get("include"); include != "" {
+		if options.Include, err = regexp.Compile(include); err != nil {
+			return nil, fmt.Errorf("invalid include pattern: %v", err)
+		}
+	}
+	if exclude := query.Get("exclude"); exclude != "" {
+		if options.Exclude, err = regexp.Compile(exclude); err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern: %v", err)
+		}
+	}
+
+	return options, nil
+}
+
+// parseTime 解析 RFC3339 时间或相对于 now 的时长
+func parseTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected RFC3339 time or duration, got %s", value)
+	}
+	if d < 0 {
+		return time.Time{}, fmt.Errorf("duration must be positive: %s", value)
+	}
+	return now.Add(-d), nil
+}
+
+// ContainerLogsOptions 转换为运行时的日志选项，始终带时间戳
+func (o *Options) ContainerLogsOptions(follow bool) types.ContainerLogsOptions {
+	options := types.ContainerLogsOptions{
+		ShowStdout: o.Stream != StreamStderr,
+		ShowStderr: o.Stream != StreamStdout,
+		Follow:     follow,
+		Timestamps: true,
+		Tail:       o.Tail,
+	}
+	if !o.Since.IsZero() {
+		options.Since = o.Since.Format(time.RFC3339Nano)
+	}
+	if !o.Until.IsZero() {
+		options.Until = o.Until.Format(time.RFC3339Nano)
+	}
+	return options
+}
+
+// NewReader 创建按选项读取日志事件的读取器，r 为按 ContainerLogsOptions 获取的日志流
+// 配置了多行分组时，ctx 结束后停止读取
+func (o *Options) NewReader(ctx context.Context, r io.Reader, tty bool) EntryReader {
+	reader := NewReader(r, tty, true)
+	if o.Multiline == nil {
+		return reader
+	}
+	return NewGrouper(ctx, reader, o.Multiline)
+}
+
+// Match 判断一行日志是否通过 include/exclude 与字段过滤
+// 正则匹配不含时间戳的原始行，字段过滤只对 JSON 日志生效
+func (o *Options) Match(entry *Entry) bool {
+	if o.Include != nil && !o.Include.MatchString(entry.Line) {
+		return false
+	}
+	if o.Exclude != nil && o.Exclude.MatchString(entry.Line) {
+		return false
+	}
+	for _, filter := range o.Fields {
+		if !filter.Match(entry.JSON()) {
+			return false
+		}
+	}
+	return true
+}
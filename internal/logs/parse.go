@@ -0,0 +1,178 @@
+package logs
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"time"
+)
+
+// 日志级别，按严重程度排序
+var levels = []string{"trace", "debug", "info", "warn", "error", "fatal"}
+
+// 各日志库的级别写法
+var levelAliases = map[string]string{
+	"trace":    "trace",
+	"debug":    "debug",
+	"info":     "info",
+	"notice":   "info",
+	"warn":     "warn",
+	"warning":  "warn",
+	"error":    "error",
+	"err":      "error",
+	"dpanic":   "error",
+	"fatal":    "fatal",
+	"panic":    "fatal",
+	"critical": "fatal",
+	"crit":     "fatal",
+}
+
+// 常见日志库使用的字段名，按优先级排列
+var (
+	levelKeys   = []string{"level", "lvl", "severity", "log.level"}
+	messageKeys = []string{"msg", "message"}
+	timeKeys    = []string{"ts", "time", "timestamp", "@timestamp"}
+	traceKeys   = []string{"trace_id", "traceId", "traceID", "trace.id"}
+)
+
+// Parsed 表示从 JSON 日志行中提取的结构化内容
+type Parsed struct {
+	Level   string // 统一为 trace, debug, info, warn, error, fatal，无法识别时为空
+	Message string
+	Time    time.Time
+	TraceID string
+	Fields  map[string]interface{} // 除以上字段外的其他字段
+}
+
+// ParseJSON 解析 zap、logrus、bunyan 等库输出的 JSON 日志行，不是 JSON 对象时返回 nil
+func ParseJSON(line string) *Parsed {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "{") || !strings.HasSuffix(line, "}") {
+		return nil
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(line))
+	decoder.UseNumber()
+	var fields map[string]interface{}
+	if err := decoder.Decode(&fields); err != nil {
+		return nil
+	}
+
+	parsed := &Parsed{Fields: fields}
+	if value, ok := takeField(fields, levelKeys); ok {
+		parsed.Level = normalizeLevel(value)
+	}
+	if value, ok := takeField(fields, messageKeys); ok {
+		parsed.Message = stringValue(value)
+	}
+	if value, ok := takeField(fields, timeKeys); ok {
+		parsed.Time = parseLogTime(value)
+	}
+	if value, ok := takeField(fields, traceKeys); ok {
+		parsed.TraceID = stringValue(value)
+	}
+	return parsed
+}
+
+// takeField 取出第一个存在的字段并从 fields 中删除
+func takeField(fields map[string]interface{}, keys []string) (interface{}, bool) {
+	for _, key := range keys {
+		if value, ok := fields[key]; ok {
+			delete(fields, key)
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// normalizeLevel 统一级别写法，bunyan 使用 10 到 60 的数字级别
+func normalizeLevel(value interface{}) string {
+	if number, ok := value.(json.Number); ok {
+		n, err := number.Int64()
+		if err != nil || n < 10 {
+			return ""
+		}
+		index := int(n/10) - 1
+		if index >= len(levels) {
+			index = len(levels) - 1
+		}
+		return levels[index]
+	}
+	return levelAliases[strings.ToLower(stringValue(value))]
+}
+
+// levelRank 返回级别的严重程度，未知级别返回 -1
+func levelRank(level string) int {
+	for i, l := range levels {
+		if l == level {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseLogTime 解析 RFC3339 字符串或 Unix 秒数（zap 默认格式）
+func parseLogTime(value interface{}) time.Time {
+	switch v := value.(type) {
+	case json.Number:
+		seconds, err := v.Float64()
+		if err != nil {
+			return time.Time{}
+		}
+		whole, frac := math.Modf(seconds)
+		return time.Unix(int64(whole), int64(frac*1e9)).UTC()
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return time.Time{}
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// stringValue 将 JSON 值转换为用于比较和显示的字符串
+func stringValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case nil:
+		return "null"
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// lookup 按字段名查找值，找不到时按点号分隔的路径查找嵌套对象
+func (p *Parsed) lookup(key string) (interface{}, bool) {
+	switch key {
+	case "level":
+		return p.Level, p.Level != ""
+	case "msg", "message":
+		return p.Message, true
+	case "trace_id":
+		return p.TraceID, p.TraceID != ""
+	}
+
+	if value, ok := p.Fields[key]; ok {
+		return value, true
+	}
+	var current interface{} = p.Fields
+	for _, part := range strings.Split(key, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = object[part]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
@@ -0,0 +1,130 @@
+package logs
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestParseJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		level   string
+		message string
+		time    time.Time
+		traceID string
+		fields  []string
+	}{
+		{
+			name:    "zap",
+			line:    `{"level":"warn","ts":1704164645.5,"caller":"api/main.go:12","msg":"slow request","trace_id":"abc","user_id":42}`,
+			level:   "warn",
+			message: "slow request",
+			time:    time.Unix(1704164645, 5e8),
+			traceID: "abc",
+			fields:  []string{"caller", "user_id"},
+		},
+		{
+			name:    "logrus",
+			line:    `{"level":"warning","msg":"disk almost full","time":"2024-01-02T03:04:05Z","disk":"/data"}`,
+			level:   "warn",
+			message: "disk almost full",
+			time:    time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+			fields:  []string{"disk"},
+		},
+		{
+			name:    "bunyan",
+			line:    `{"name":"api","hostname":"h","pid":1,"level":50,"msg":"boom","time":"2024-01-02T03:04:05.000Z","v":0}`,
+			level:   "error",
+			message: "boom",
+			time:    time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+			fields:  []string{"name", "hostname", "pid", "v"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed := ParseJSON(tt.line)
+			if parsed == nil {
+				t.Fatal("line not parsed")
+			}
+			if parsed.Level != tt.level || parsed.Message != tt.message || parsed.TraceID != tt.traceID {
+				t.Errorf("parsed = %+v", parsed)
+			}
+			if !parsed.Time.Equal(tt.time) {
+				t.Errorf("time = %v, want %v", parsed.Time, tt.time)
+			}
+			if len(parsed.Fields) != len(tt.fields) {
+				t.Errorf("fields = %v, want keys %v", parsed.Fields, tt.fields)
+			}
+			for _, key := range tt.fields {
+				if _, ok := parsed.Fields[key]; !ok {
+					t.Errorf("missing field %s", key)
+				}
+			}
+		})
+	}
+
+	for _, line := range []string{"plain text", "{broken", `["array"]`, ""} {
+		if ParseJSON(line) != nil {
+			t.Errorf("ParseJSON(%q) should return nil", line)
+		}
+	}
+}
+
+func TestFieldFilters(t *testing.T) {
+	lines := map[string]string{
+		"info":  `{"level":"info","msg":"ok","user_id":42,"http":{"status":200}}`,
+		"warn":  `{"level":"warn","msg":"slow","user_id":7,"http":{"status":200}}`,
+		"error": `{"level":"error","msg":"fail","user_id":42,"http":{"status":503}}`,
+		"plain": `plain text`,
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"level=warn", []string{"warn", "error"}},
+		{"filter=level>=warn", []string{"warn", "error"}},
+		{"filter=level<info", nil},
+		{"filter=user_id=42", []string{"info", "error"}},
+		{"filter=user_id!=42", []string{"warn"}},
+		{"filter=http.status>=500", []string{"error"}},
+		{"filter=user_id>10&filter=level=info", []string{"info"}},
+		{"filter=msg=slow", []string{"warn"}},
+	}
+
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		options, err := ParseOptions(query, "all")
+		if err != nil {
+			t.Fatalf("%s: %v", tt.query, err)
+		}
+
+		matched := map[string]bool{}
+		for name, line := range lines {
+			entry := Entry{Line: line}
+			if options.Match(&entry) {
+				matched[name] = true
+			}
+		}
+		if len(matched) != len(tt.want) {
+			t.Errorf("%s: matched %v, want %v", tt.query, matched, tt.want)
+			continue
+		}
+		for _, name := range tt.want {
+			if !matched[name] {
+				t.Errorf("%s: matched %v, want %v", tt.query, matched, tt.want)
+			}
+		}
+	}
+}
+
+func TestParseFieldFilterErrors(t *testing.T) {
+	for _, expr := range []string{"noop", "=42", "level>=loud"} {
+		if _, err := ParseFieldFilter(expr); err == nil {
+			t.Errorf("ParseFieldFilter(%q) should fail", expr)
+		}
+	}
+}
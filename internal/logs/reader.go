@@ -0,0 +1,204 @@
+package logs
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Docker 日志时间戳格式，纳秒固定 9 位
+const TimestampFormat = "2006-01-02T15:04:05.000000000Z07:00"
+
+// 多路复用日志帧头中的流类型
+const (
+	frameStdin  = 0
+	frameStdout = 1
+	frameStderr = 2
+	frameSystem = 3
+)
+
+// Entry 表示一行完整的容器日志
+type Entry struct {
+	Time   time.Time
+	Stream string // stdout 或 stderr，TTY 容器只有 stdout
+	Line   string // 不含时间戳和换行符
+
+	parsed     *Parsed
+	parsedDone bool
+}
+
+// JSON 返回解析后的 JSON 日志，不是 JSON 时返回 nil，结果会被缓存
+func (e *Entry) JSON() *Parsed {
+	if !e.parsedDone {
+		e.parsed = ParseJSON(e.Line)
+		e.parsedDone = true
+	}
+	return e.parsed
+}
+
+// Text 按 Docker 的格式输出带时间戳的一行
+func (e Entry) Text() string {
+	if e.Time.IsZero() {
+		return e.Line + "\n"
+	}
+	return e.Time.Format(TimestampFormat) + " " + e.Line + "\n"
+}
+
+// Reader 从 ContainerLogs 的输出中逐行读取日志
+// 多路复用格式下，同一流被拆成多帧的行会重新拼接
+type Reader struct {
+	reader     *bufio.Reader
+	tty        bool
+	timestamps bool
+	pending    map[string]*pendingLine
+	queue      []Entry
+	err        error
+}
+
+// pendingLine 表示某个流尚未遇到换行符的行
+type pendingLine struct {
+	time time.Time
+	data []byte
+}
+
+// NewReader 创建日志读取器，tty 表示容器是否使用 TTY，timestamps 表示日志是否带时间戳前缀
+func NewReader(r io.Reader, tty, timestamps bool) *Reader {
+	return &Reader{
+		reader:     bufio.NewReader(r),
+		tty:        tty,
+		timestamps: timestamps,
+		pending:    make(map[string]*pendingLine),
+	}
+}
+
+// Next 返回下一行日志，日志结束时返回 io.EOF
+func (r *Reader) Next() (Entry, error) {
+	for len(r.queue) == 0 {
+		if r.err != nil {
+			return Entry{}, r.err
+		}
+		if r.tty {
+			r.readLine()
+		} else {
+			r.readFrame()
+		}
+	}
+
+	entry := r.queue[0]
+	r.queue = r.queue[1:]
+	return entry, nil
+}
+
+// readLine 读取 TTY 格式的一行
+func (r *Reader) readLine() {
+	line, err := r.reader.ReadString('\n')
+	if line != "" {
+		r.push(StreamStdout, []byte(line))
+	}
+	if err != nil {
+		r.fail(err)
+	}
+}
+
+// readFrame 读取多路复用格式的一帧，帧头为 1 字节流类型、3 字节填充和 4 字节长度
+func (r *Reader) readFrame() {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(r.reader, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = fmt.Errorf("truncated log frame header")
+		}
+		r.fail(err)
+		return
+	}
+
+	size := binary.BigEndian.Uint32(header[4:])
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r.reader, payload); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = fmt.Errorf("truncated log frame")
+		}
+		r.fail(err)
+		return
+	}
+
+	switch header[0] {
+	case frameStdin, frameStdout:
+		r.push(StreamStdout, payload)
+	case frameStderr:
+		r.push(StreamStderr, payload)
+	case frameSystem:
+		r.fail(fmt.Errorf("error from daemon in stream: %s", payload))
+	default:
+		r.fail(fmt.Errorf("unrecognized log stream: %d", header[0]))
+	}
+}
+
+// push 将一段输出加入对应流的未完成行，完整的行进入队列
+func (r *Reader) push(stream string, data []byte) {
+	pending := r.pending[stream]
+	if pending == nil {
+		pending = &pendingLine{}
+		r.pending[stream] = pending
+	}
+
+	for len(data) > 0 {
+		// 被拆分的长行，每一段都带有时间戳前缀，只保留第一段的时间
+		if r.timestamps {
+			t, rest, ok := splitTimestamp(data)
+			if ok {
+				if len(pending.data) == 0 {
+					pending.time = t
+				}
+				data = rest
+			}
+		}
+
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			pending.data = append(pending.data, data...)
+			return
+		}
+		pending.data = append(pending.data, data[:i]...)
+		r.emit(stream, pending)
+		data = data[i+1:]
+	}
+}
+
+func (r *Reader) emit(stream string, pending *pendingLine) {
+	r.queue = append(r.queue, Entry{
+		Time:   pending.time,
+		Stream: stream,
+		Line:   strings.TrimSuffix(string(pending.data), "\r"),
+	})
+	pending.time = time.Time{}
+	pending.data = nil
+}
+
+// fail 记录错误，正常结束时先输出各流中没有换行符的最后一行
+func (r *Reader) fail(err error) {
+	if err == io.EOF {
+		for _, stream := range []string{StreamStdout, StreamStderr} {
+			if pending := r.pending[stream]; pending != nil && len(pending.data) > 0 {
+				r.emit(stream, pending)
+			}
+		}
+	}
+	r.err = err
+}
+
+// splitTimestamp 拆分行首的 RFC3339 时间戳
+func splitTimestamp(data []byte) (time.Time, []byte, bool) {
+	i := bytes.IndexByte(data, ' ')
+	if i < 0 {
+		return time.Time{}, data, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, string(data[:i]))
+	if err != nil {
+		return time.Time{}, data, false
+	}
+	return t, data[i+1:], true
+}
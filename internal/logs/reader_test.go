@@ -0,0 +1,107 @@
+package logs
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// frames 构造多路复用格式的日志，stream 为 1 (stdout) 或 2 (stderr)
+func frames(chunks ...interface{}) io.Reader {
+	var buf bytes.Buffer
+	for i := 0; i < len(chunks); i += 2 {
+		stream := stdcopy.Stdout
+		if chunks[i].(int) == 2 {
+			stream = stdcopy.Stderr
+		}
+		stdcopy.NewStdWriter(&buf, stream).Write([]byte(chunks[i+1].(string)))
+	}
+	return &buf
+}
+
+func readAll(t *testing.T, r *Reader) []Entry {
+	t.Helper()
+
+	var entries []Entry
+	for {
+		entry, err := r.Next()
+		if err == io.EOF {
+			return entries
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+}
+
+func TestReaderReassemblesPartialFrames(t *testing.T) {
+	ts1 := "2024-01-02T03:04:05.000000001Z"
+	ts2 := "2024-01-02T03:04:06.000000002Z"
+	input := frames(
+		1, ts1+" first half ",
+		2, ts2+" error line\n",
+		1, ts2+" second half\n",
+		1, ts2+" two\n"+ts2+" lines\n",
+		2, ts2+" no newline",
+	)
+
+	entries := readAll(t, NewReader(input, false, true))
+	want := []Entry{
+		{Stream: StreamStderr, Line: "error line"},
+		{Stream: StreamStdout, Line: "first half second half"},
+		{Stream: StreamStdout, Line: "two"},
+		{Stream: StreamStdout, Line: "lines"},
+		{Stream: StreamStderr, Line: "no newline"},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entries, want %d: %+v", len(entries), len(want), entries)
+	}
+	for i := range want {
+		if entries[i].Stream != want[i].Stream || entries[i].Line != want[i].Line {
+			t.Errorf("entry %d = %+v, want %+v", i, entries[i], want[i])
+		}
+	}
+
+	// 拼接的行保留第一段的时间
+	if first, _ := time.Parse(time.RFC3339Nano, ts1); !entries[1].Time.Equal(first) {
+		t.Errorf("reassembled time = %v, want %v", entries[1].Time, first)
+	}
+	if got := entries[0].Text(); got != ts2+" error line\n" {
+		t.Errorf("Text() = %q", got)
+	}
+}
+
+func TestReaderTTY(t *testing.T) {
+	input := strings.NewReader("2024-01-02T03:04:05Z hello\r\n2024-01-02T03:04:06Z world")
+
+	entries := readAll(t, NewReader(input, true, true))
+	if len(entries) != 2 || entries[0].Line != "hello" || entries[1].Line != "world" {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+	for _, entry := range entries {
+		if entry.Stream != StreamStdout || entry.Time.IsZero() {
+			t.Errorf("unexpected entry: %+v", entry)
+		}
+	}
+}
+
+func TestReaderWithoutTimestamps(t *testing.T) {
+	entries := readAll(t, NewReader(frames(1, "2024-01-02T03:04:05Z looks like a time\n"), false, false))
+	if len(entries) != 1 || entries[0].Line != "2024-01-02T03:04:05Z looks like a time" || !entries[0].Time.IsZero() {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+}
+
+func TestReaderDaemonError(t *testing.T) {
+	var buf bytes.Buffer
+	stdcopy.NewStdWriter(&buf, stdcopy.Systemerr).Write([]byte("boom"))
+
+	if _, err := NewReader(&buf, false, false).Next(); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("err = %v, want daemon error", err)
+	}
+}
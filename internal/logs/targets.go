@@ -0,0 +1,55 @@
+package logs
+
+import (
+	"context"
+
+	"github.com/YooLeon/container-debug-online/internal/docker"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// ServiceTarget 返回跟随服务当前容器的日志来源
+func ServiceTarget(monitor *docker.Monitor, service string) Target {
+	project := monitor.Project()
+	rt := monitor.Runtime()
+
+	return Target{
+		Service: service,
+		Resolve: func(ctx context.Context) string {
+			// 不知道项目名时使用监控器的结果，避免匹配到其他项目的同名服务
+			if project == "" {
+				status := monitor.GetAllStatus()
+				status.RLock()
+				defer status.RUnlock()
+				if serviceStatus, ok := status.Services[service]; ok {
+					return serviceStatus.ContainerID
+				}
+				return ""
+			}
+
+			args := filters.NewArgs(
+				filters.Arg("label", "com.docker.compose.project="+project),
+				filters.Arg("label", "com.docker.compose.service="+service),
+			)
+			containers, err := rt.ContainerList(ctx, types.ContainerListOptions{All: true, Filters: args})
+			if err != nil || len(containers) == 0 {
+				return ""
+			}
+			// 优先选择运行中的容器，否则选择最新创建的容器
+			latest := containers[0]
+			for _, container := range containers {
+				if container.State == "running" {
+					return container.ID
+				}
+				if container.Created > latest.Created {
+					latest = container
+				}
+			}
+			return latest.ID
+		},
+		Matches: func(attributes map[string]string) bool {
+			return attributes["com.docker.compose.service"] == service &&
+				(project == "" || attributes["com.docker.compose.project"] == project)
+		},
+	}
+}
@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/YooLeon/container-debug-online/internal/docker"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 容器可能处于的状态，参考 Docker API 中的 State.Status
+var containerStates = []string{"created", "running", "paused", "restarting", "removing", "exited", "dead"}
+
+var containerLabels = []string{"project", "service", "container"}
+
+// StatusCollector 在抓取时从监控器读取容器和服务状态
+type StatusCollector struct {
+	monitor *docker.Monitor
+
+	containerState         *prometheus.Desc
+	containerPortHealthy   *prometheus.Desc
+	containerFailingStreak *prometheus.Desc
+	containerExitCode      *prometheus.Desc
+	containerRestartCount  *prometheus.Desc
+	serviceHealthy         *prometheus.Desc
+	lastUpdateAge          *prometheus.Desc
+}
+
+// NewStatusCollector 创建状态采集器，所有指标带有主机名标签
+func NewStatusCollector(monitor *docker.Monitor) *StatusCollector {
+	hostLabel := prometheus.Labels{"host": monitor.Name()}
+	return &StatusCollector{
+		monitor: monitor,
+		containerState: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "container", "state"),
+			"Container state, 1 for the current state and 0 otherwise.",
+			append(containerLabels, "state"), hostLabel,
+		),
+		containerPortHealthy: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "container", "port_healthy"),
+			"Whether an exposed container port accepts TCP connections.",
+			append(containerLabels, "port"), hostLabel,
+		),
+		containerFailingStreak: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "container", "health_failing_streak"),
+			"Number of consecutive failed health checks.",
+			containerLabels, hostLabel,
+		),
+		containerExitCode: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "container", "exit_code"),
+			"Exit code of the last container run.",
+			containerLabels, hostLabel,
+		),
+		containerRestartCount: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "container", "restart_count"),
+			"Number of times the container has been restarted by the engine.",
+			containerLabels, hostLabel,
+		),
+		serviceHealthy: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "service", "healthy"),
+			"Whether the compose service is considered healthy.",
+			[]string{"project", "service"}, hostLabel,
+		),
+		lastUpdateAge: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "monitor", "last_update_age_seconds"),
+			"Seconds since the monitor status was last updated.",
+			nil, hostLabel,
+		),
+	}
+}
+
+// Register 将监控器的状态采集器注册到默认注册表
+func Register(monitor *docker.Monitor) error {
+	return prometheus.Register(NewStatusCollector(monitor))
+}
+
+// Describe 实现 prometheus.Collector
+func (c *StatusCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.containerState
+	ch <- c.containerPortHealthy
+	ch <- c.containerFailingStreak
+	ch <- c.containerExitCode
+	ch <- c.containerRestartCount
+	ch <- c.serviceHealthy
+	ch <- c.lastUpdateAge
+}
+
+// Collect 实现 prometheus.Collector
+func (c *StatusCollector) Collect(ch chan<- prometheus.Metric) {
+	status := c.monitor.GetAllStatus()
+	status.RLock()
+	defer status.RUnlock()
+
+	if !status.LastUpdate.IsZero() {
+		ch <- prometheus.MustNewConstMetric(c.lastUpdateAge, prometheus.GaugeValue,
+			time.Since(status.LastUpdate).Seconds())
+	}
+
+	for _, container := range status.Containers {
+		project := container.Info.Labels["com.docker.compose.project"]
+		labels := []string{project, container.Info.Service, container.Info.Name}
+
+		for _, state := range containerStates {
+			ch <- prometheus.MustNewConstMetric(c.containerState, prometheus.GaugeValue,
+				boolToFloat(container.Info.Status == state), append(labels, state)...)
+		}
+		for port, healthy := range container.PortsHealthy {
+			ch <- prometheus.MustNewConstMetric(c.containerPortHealthy, prometheus.GaugeValue,
+				boolToFloat(healthy), append(labels, port)...)
+		}
+		if container.Health != nil {
+			ch <- prometheus.MustNewConstMetric(c.containerFailingStreak, prometheus.GaugeValue,
+				float64(container.Health.FailingStreak), labels...)
+		}
+		ch <- prometheus.MustNewConstMetric(c.containerExitCode, prometheus.GaugeValue,
+			float64(container.ExitCode), labels...)
+		ch <- prometheus.MustNewConstMetric(c.containerRestartCount, prometheus.GaugeValue,
+			float64(container.RestartCount), labels...)
+	}
+
+	for name, service := range status.Services {
+		var project string
+		if container, ok := status.Containers[service.ContainerID]; ok {
+			project = container.Info.Labels["com.docker.compose.project"]
+		}
+		ch <- prometheus.MustNewConstMetric(c.serviceHealthy, prometheus.GaugeValue,
+			boolToFloat(service.Healthy), project, name)
+	}
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
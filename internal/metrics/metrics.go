@@ -0,0 +1,155 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "container_debug"
+
+var (
+	updateDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "monitor",
+		Name:      "update_duration_seconds",
+		Help:      "Duration of Monitor.UpdateStatus calls.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"host"})
+
+	updateErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "monitor",
+		Name:      "update_errors_total",
+		Help:      "Total number of failed Monitor.UpdateStatus calls.",
+	}, []string{"host"})
+
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Total number of HTTP requests handled by the debug server.",
+	}, []string{"method", "route", "code"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of HTTP requests handled by the debug server.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	wsActive = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "websocket",
+		Name:      "sessions_active",
+		Help:      "Number of currently open WebSocket sessions.",
+	}, []string{"kind"})
+
+	wsSessions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "websocket",
+		Name:      "sessions_total",
+		Help:      "Total number of WebSocket sessions opened.",
+	}, []string{"kind"})
+
+	wsRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "websocket",
+		Name:      "sessions_rejected_total",
+		Help:      "Total number of WebSocket sessions rejected by origin checks or session limits.",
+	}, []string{"kind", "reason"})
+
+	wsDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "websocket",
+		Name:      "session_duration_seconds",
+		Help:      "Duration of WebSocket sessions.",
+		Buckets:   []float64{1, 10, 60, 300, 900, 1800, 3600, 14400},
+	}, []string{"kind"})
+)
+
+// Handler 返回 Prometheus 抓取接口
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveUpdate 记录一次状态更新的耗时和结果
+func ObserveUpdate(host string, duration time.Duration, err error) {
+	updateDuration.WithLabelValues(host).Observe(duration.Seconds())
+	if err != nil {
+		updateErrors.WithLabelValues(host).Inc()
+	}
+}
+
+// TrackWebSocket 记录一个 WebSocket 会话的开始，返回的函数在会话结束时调用
+func TrackWebSocket(kind string) func() {
+	start := time.Now()
+	wsSessions.WithLabelValues(kind).Inc()
+	wsActive.WithLabelValues(kind).Inc()
+	return func() {
+		wsActive.WithLabelValues(kind).Dec()
+		wsDuration.WithLabelValues(kind).Observe(time.Since(start).Seconds())
+	}
+}
+
+// RejectWebSocket 记录一个被拒绝的 WebSocket 会话，reason 为 origin 或 limit
+func RejectWebSocket(kind, reason string) {
+	wsRejected.WithLabelValues(kind, reason).Inc()
+}
+
+// Middleware 统计 HTTP 请求数量和耗时
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := &responseWriter{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rw, r)
+
+		// 使用路由模板作为标签，避免容器 ID 等参数导致标签基数膨胀
+		route := "unmatched"
+		if current := mux.CurrentRoute(r); current != nil {
+			if tpl, err := current.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+
+		httpRequests.WithLabelValues(r.Method, route, strconv.Itoa(rw.status)).Inc()
+		httpDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// responseWriter 记录响应状态码，同时保留 WebSocket 升级所需的 Hijacker
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	// 升级为 WebSocket 后状态码即为 101
+	w.status = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
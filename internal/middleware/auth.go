@@ -1,36 +1,166 @@
 package middleware
 
 import (
-	"crypto/subtle"
 	"net/http"
+	"strings"
+
+	"github.com/YooLeon/container-debug-online/internal/auth"
+	"github.com/YooLeon/container-debug-online/internal/tlsutil"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
 )
 
-// 定义需要密码保护的路径
-var protectedPaths = map[string]bool{
-	"/containers": true,
-	"/ws":         true,
-	// 可以添加更多需要保护的路径
+// publicHandler 标记不需要认证的路由
+type publicHandler struct {
+	http.Handler
+}
+
+// Public 将路由的 handler 声明为公开，其余路由默认都需要认证
+func Public(handler http.Handler) http.Handler {
+	return publicHandler{handler}
+}
+
+// PublicFunc 与 Public 相同，用于 http.HandlerFunc
+func PublicFunc(handler http.HandlerFunc) http.Handler {
+	return Public(handler)
+}
+
+// IsPublic 判断路由是否声明为公开
+func IsPublic(route *mux.Route) bool {
+	if route == nil {
+		return false
+	}
+	_, ok := route.GetHandler().(publicHandler)
+	return ok
 }
 
-// AuthMiddleware 创建认证中间件
-func AuthMiddleware(password string) func(http.Handler) http.Handler {
+// AuthMiddleware 创建认证中间件，认证通过后将用户名附加到请求的 context
+// 通过 router.Use 注册，除了用 Public 声明的路由外都需要认证
+// 请求可以携带 API 令牌（tokens 不为 nil 时）、会话 cookie（sessions 不为 nil 时）、经过校验的 TLS 客户端证书
+// 或使用 Basic 认证（users 不为 nil 时）。使用 cookie 的修改类请求还需要 CSRF 令牌，使用证书和 Basic 认证的需要 X-Requested-With 请求头。只配置单点登录时 users 为 nil，此时不接受 Basic 认证
+func AuthMiddleware(users *auth.Users, sessions *auth.Sessions, tokens *auth.Tokens) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// 如果没有设置密码或路径不需要保护，直接放行
-			if password == "" || !protectedPaths[r.URL.Path] {
+			// 如果没有配置账号和会话或路由是公开的，直接放行
+			if (users == nil && sessions == nil) || IsPublic(mux.CurrentRoute(r)) {
 				next.ServeHTTP(w, r)
 				return
 			}
 
+			// API 令牌，不需要 CSRF 令牌
+			if value, ok := bearerToken(r); ok {
+				var token *auth.Token
+				if tokens != nil {
+					token, _ = tokens.Authenticate(value, r.RemoteAddr)
+				}
+				if token != nil && !accountsExist(users, token.Accounts) {
+					zap.L().Warn("API token account no longer exists",
+						zap.String("token", token.ID),
+						zap.String("user", token.User),
+						zap.String("created_by", token.CreatedBy))
+					token = nil
+				}
+				if token == nil {
+					zap.L().Warn("Invalid API token",
+						zap.String("remote", r.RemoteAddr),
+						zap.String("path", r.URL.Path))
+					w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+					http.Error(w, "Unauthorized", http.StatusUnauthorized)
+					return
+				}
+				next.ServeHTTP(w, r.WithContext(auth.WithToken(r.Context(), token)))
+				return
+			}
+
+			// 会话 cookie，浏览器在 WebSocket 握手时同样会携带
+			if cookie, err := r.Cookie(auth.SessionCookie); err == nil && sessions != nil {
+				if session, ok := sessions.Get(cookie.Value); ok {
+					if !safeMethod(r.Method) && !session.CheckCSRF(r.Header.Get(auth.CSRFHeader)) {
+						zap.L().Warn("CSRF token mismatch",
+							zap.String("user", session.User),
+							zap.String("remote", r.RemoteAddr),
+							zap.String("path", r.URL.Path))
+						http.Error(w, "Invalid CSRF token", http.StatusForbidden)
+						return
+					}
+					next.ServeHTTP(w, r.WithContext(auth.WithUser(r.Context(), session.User, session.Groups...)))
+					return
+				}
+			}
+
+			// TLS 客户端证书，浏览器会自动发送证书，修改类请求需要 X-Requested-With 请求头防止 CSRF
+			if user, groups, ok := tlsutil.ClientIdentity(r.TLS); ok {
+				if !checkRequestedWith(w, r, user) {
+					return
+				}
+				next.ServeHTTP(w, r.WithContext(auth.WithUser(r.Context(), user, groups...)))
+				return
+			}
+
 			// 获取Basic Auth信息
 			user, pass, ok := r.BasicAuth()
-			if !ok || user != "admin" || subtle.ConstantTimeCompare([]byte(pass), []byte(password)) != 1 {
-				w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
+			if !ok || users == nil || !users.Authenticate(user, pass) {
+				if ok {
+					zap.L().Warn("Authentication failed",
+						zap.String("user", user),
+						zap.String("remote", r.RemoteAddr),
+						zap.String("path", r.URL.Path))
+				}
+				// 前端的请求由登录页处理，不弹出浏览器的认证对话框
+				if r.Header.Get("X-Requested-With") == "" && users != nil {
+					w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
+				}
 				http.Error(w, "Unauthorized", http.StatusUnauthorized)
 				return
 			}
+			// 浏览器会缓存并自动发送 Basic 认证信息，与客户端证书相同需要防止 CSRF
+			if !checkRequestedWith(w, r, user) {
+				return
+			}
 
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(w, r.WithContext(auth.WithUser(r.Context(), user)))
 		})
 	}
 }
+
+// accountsExist 判断令牌关联的账号是否仍在账号文件中
+func accountsExist(users *auth.Users, accounts []string) bool {
+	for _, name := range accounts {
+		if users == nil || !users.Has(name) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkRequestedWith 要求浏览器自动携带凭据（客户端证书、Basic 认证）的修改类请求带有 X-Requested-With 请求头
+// 跨站的表单提交不能设置自定义请求头，没有该请求头时写入 403 并返回 false
+func checkRequestedWith(w http.ResponseWriter, r *http.Request, user string) bool {
+	if safeMethod(r.Method) || r.Header.Get("X-Requested-With") != "" {
+		return true
+	}
+	zap.L().Warn("Missing X-Requested-With header",
+		zap.String("user", user),
+		zap.String("remote", r.RemoteAddr),
+		zap.String("path", r.URL.Path))
+	http.Error(w, "Missing X-Requested-With header", http.StatusForbidden)
+	return false
+}
+
+// bearerToken 读取 Authorization: Bearer 请求头中的令牌
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, value, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(value), true
+}
+
+// safeMethod 判断请求方法是否不修改状态
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,319 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/YooLeon/container-debug-online/internal/auth"
+	"github.com/YooLeon/container-debug-online/internal/rbac"
+	"github.com/gorilla/mux"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	users, err := auth.SingleUser("alice", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sessions, err := auth.NewSessions(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gotUser string
+	record := func(w http.ResponseWriter, r *http.Request) {
+		gotUser = auth.UserFromContext(r.Context())
+	}
+	handler := mux.NewRouter()
+	handler.Use(AuthMiddleware(users, sessions, nil))
+	handler.Handle("/health", PublicFunc(record))
+	handler.HandleFunc("/containers", record)
+	handler.HandleFunc("/container/logs", record)
+	handler.HandleFunc("/ws", record)
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		user        string
+		password    string
+		requestedBy bool // 带有 X-Requested-With
+		status      int
+		wantUser    string
+	}{
+		{"valid", "GET", "/containers", "alice", "secret", false, http.StatusOK, "alice"},
+		{"wrong password", "GET", "/containers", "alice", "wrong", false, http.StatusUnauthorized, ""},
+		{"unknown user", "GET", "/ws", "bob", "secret", false, http.StatusUnauthorized, ""},
+		{"no credentials", "GET", "/ws", "", "", false, http.StatusUnauthorized, ""},
+		{"protected by default", "GET", "/container/logs", "", "", false, http.StatusUnauthorized, ""},
+		{"public", "GET", "/health", "", "", false, http.StatusOK, ""},
+		// 浏览器会自动发送缓存的 Basic 认证信息，跨站表单不能设置 X-Requested-With
+		{"post without X-Requested-With", "POST", "/containers", "alice", "secret", false, http.StatusForbidden, ""},
+		{"post with X-Requested-With", "POST", "/containers", "alice", "secret", true, http.StatusOK, "alice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotUser = ""
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.user != "" {
+				req.SetBasicAuth(tt.user, tt.password)
+			}
+			if tt.requestedBy {
+				req.Header.Set("X-Requested-With", "XMLHttpRequest")
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if gotUser != tt.wantUser {
+				t.Errorf("user = %q, want %q", gotUser, tt.wantUser)
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewareSession(t *testing.T) {
+	users, err := auth.SingleUser("alice", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := auth.NewSessions(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, value, err := sessions.Create("alice", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gotUser string
+	handler := mux.NewRouter()
+	handler.Use(AuthMiddleware(users, sessions, nil))
+	handler.HandleFunc("/alerts/silences", func(w http.ResponseWriter, r *http.Request) {
+		gotUser = auth.UserFromContext(r.Context())
+	})
+
+	tests := []struct {
+		name     string
+		method   string
+		cookie   string
+		csrf     string
+		ajax     bool
+		status   int
+		wantUser string
+	}{
+		{"cookie", "GET", value, "", false, http.StatusOK, "alice"},
+		{"post without csrf", "POST", value, "", false, http.StatusForbidden, ""},
+		{"post with wrong csrf", "POST", value, "wrong", false, http.StatusForbidden, ""},
+		{"post with csrf", "POST", value, session.CSRFToken, false, http.StatusOK, "alice"},
+		{"tampered cookie", "GET", value + "x", "", false, http.StatusUnauthorized, ""},
+		{"frontend without login", "GET", "", "", true, http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotUser = ""
+			req := httptest.NewRequest(tt.method, "/alerts/silences", nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: auth.SessionCookie, Value: tt.cookie})
+			}
+			if tt.csrf != "" {
+				req.Header.Set(auth.CSRFHeader, tt.csrf)
+			}
+			if tt.ajax {
+				req.Header.Set("X-Requested-With", "XMLHttpRequest")
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if gotUser != tt.wantUser {
+				t.Errorf("user = %q, want %q", gotUser, tt.wantUser)
+			}
+			// 前端请求不弹出浏览器认证对话框
+			if rec.Code == http.StatusUnauthorized && (rec.Header().Get("WWW-Authenticate") == "") != tt.ajax {
+				t.Errorf("WWW-Authenticate = %q", rec.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewareSessionsOnly(t *testing.T) {
+	sessions, err := auth.NewSessions(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, value, err := sessions.Create("erin", []string{"platform"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gotGroups []string
+	handler := mux.NewRouter()
+	handler.Use(AuthMiddleware(nil, sessions, nil))
+	handler.HandleFunc("/hosts", func(w http.ResponseWriter, r *http.Request) {
+		gotGroups = auth.GroupsFromContext(r.Context())
+	})
+
+	// 没有账号时不接受 Basic 认证，也不弹出浏览器认证对话框
+	req := httptest.NewRequest("GET", "/hosts", nil)
+	req.SetBasicAuth("admin", "secret")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") != "" {
+		t.Errorf("basic auth: status = %d, WWW-Authenticate = %q", rec.Code, rec.Header().Get("WWW-Authenticate"))
+	}
+
+	req = httptest.NewRequest("GET", "/hosts", nil)
+	req.AddCookie(&http.Cookie{Name: auth.SessionCookie, Value: value})
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || len(gotGroups) != 1 || gotGroups[0] != "platform" {
+		t.Errorf("cookie: status = %d, groups = %v", rec.Code, gotGroups)
+	}
+}
+
+func TestAuthMiddlewareToken(t *testing.T) {
+	users, err := auth.SingleUser("alice", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := auth.LoadTokens(filepath.Join(t.TempDir(), "tokens.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, value, err := tokens.Create(auth.Token{
+		Name:      "ci",
+		User:      "alice",
+		Scope:     rbac.Scope{Actions: []rbac.Action{rbac.ActionLogs}},
+		CreatedBy: "alice",
+		ExpiresAt: time.Now().Add(time.Hour),
+		Accounts:  []string{"alice"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 创建者 bob 已从账号文件中删除
+	_, removedValue, err := tokens.Create(auth.Token{
+		Name:      "removed",
+		User:      "deployer",
+		Scope:     rbac.Scope{Actions: []rbac.Action{rbac.ActionLogs}},
+		CreatedBy: "bob",
+		ExpiresAt: time.Now().Add(time.Hour),
+		Accounts:  []string{"bob"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, revokedValue, err := tokens.Create(auth.Token{
+		Name:      "old",
+		User:      "alice",
+		Scope:     rbac.Scope{Actions: []rbac.Action{rbac.ActionLogs}},
+		CreatedBy: "alice",
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tokens.Revoke(revoked.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	var gotToken *auth.Token
+	handler := mux.NewRouter()
+	handler.Use(AuthMiddleware(users, nil, tokens))
+	handler.HandleFunc("/alerts/silences", func(w http.ResponseWriter, r *http.Request) {
+		gotToken = auth.TokenFromContext(r.Context())
+	})
+
+	tests := []struct {
+		name   string
+		header string
+		status int
+	}{
+		{"valid", "Bearer " + value, http.StatusOK},
+		{"lowercase scheme", "bearer " + value, http.StatusOK},
+		{"wrong secret", "Bearer " + value + "x", http.StatusUnauthorized},
+		{"revoked", "Bearer " + revokedValue, http.StatusUnauthorized},
+		{"account removed", "Bearer " + removedValue, http.StatusUnauthorized},
+		{"garbage", "Bearer nope", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotToken = nil
+			// 令牌请求不需要 CSRF 令牌
+			req := httptest.NewRequest("POST", "/alerts/silences", nil)
+			req.Header.Set("Authorization", tt.header)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if (gotToken != nil) != (tt.status == http.StatusOK) || (gotToken != nil && gotToken.ID != token.ID) {
+				t.Errorf("token = %+v", gotToken)
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewareClientCert(t *testing.T) {
+	sessions, err := auth.NewSessions(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gotUser string
+	var gotGroups []string
+	handler := mux.NewRouter()
+	handler.Use(AuthMiddleware(nil, sessions, nil))
+	handler.HandleFunc("/alerts/silences", func(w http.ResponseWriter, r *http.Request) {
+		gotUser, gotGroups = auth.UserFromContext(r.Context()), auth.GroupsFromContext(r.Context())
+	})
+
+	leaf := &x509.Certificate{Subject: pkix.Name{CommonName: "alice", OrganizationalUnit: []string{"platform"}}}
+	tests := []struct {
+		name     string
+		method   string
+		verified bool
+		ajax     bool
+		status   int
+	}{
+		{"verified", "GET", true, false, http.StatusOK},
+		{"post without X-Requested-With", "POST", true, false, http.StatusForbidden},
+		{"post from frontend", "POST", true, true, http.StatusOK},
+		// 只有经过服务端校验的证书才能用于认证
+		{"unverified", "GET", false, false, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotUser, gotGroups = "", nil
+			req := httptest.NewRequest(tt.method, "/alerts/silences", nil)
+			req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf}}
+			if tt.verified {
+				req.TLS.VerifiedChains = [][]*x509.Certificate{{leaf}}
+			}
+			if tt.ajax {
+				req.Header.Set("X-Requested-With", "XMLHttpRequest")
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if rec.Code == http.StatusOK && (gotUser != "alice" || len(gotGroups) != 1 || gotGroups[0] != "platform") {
+				t.Errorf("user = %q, groups = %v", gotUser, gotGroups)
+			}
+		})
+	}
+}
@@ -0,0 +1,264 @@
+// Package oidc 实现 OIDC 单点登录：授权码流程 + PKCE，ID token 通过提供方的 JWKS 校验
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	gooidc "github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+	"gopkg.in/yaml.v2"
+)
+
+// loginTimeout 从跳转到提供方到回调完成的最长时间
+const loginTimeout = 10 * time.Minute
+
+// Config OIDC 提供方配置
+type Config struct {
+	Issuer           string   `yaml:"issuer"`
+	ClientID         string   `yaml:"client_id"`
+	ClientSecret     string   `yaml:"client_secret"`
+	ClientSecretFile string   `yaml:"client_secret_file"`
+	RedirectURL      string   `yaml:"redirect_url"`   // 例如 https://debug.example.com/oidc/callback
+	Scopes           []string `yaml:"scopes"`         // 默认 openid profile email
+	UsernameClaim    string   `yaml:"username_claim"`  // 默认 preferred_username，缺失时依次使用已验证的 email、sub
+	UsernamePrefix   string   `yaml:"username_prefix"` // 加在用户名前，与本地账号和客户端证书的用户名区分，默认 oidc:
+	GroupsClaim      string   `yaml:"groups_claim"`    // 默认 groups
+}
+
+// LoadConfig 加载 OIDC 配置文件
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading oidc config: %v", err)
+	}
+
+	config := &Config{}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("error parsing oidc config: %v", err)
+	}
+	if config.ClientSecretFile != "" {
+		if config.ClientSecret != "" {
+			return nil, fmt.Errorf("invalid oidc configuration: client_secret and client_secret_file are mutually exclusive")
+		}
+		secret, err := os.ReadFile(config.ClientSecretFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading oidc client secret: %v", err)
+		}
+		config.ClientSecret = strings.TrimRight(string(secret), "\r\n")
+	}
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("invalid oidc configuration: %v", err)
+	}
+	return config, nil
+}
+
+func (c *Config) validate() error {
+	if c.Issuer == "" || c.ClientID == "" {
+		return fmt.Errorf("issuer and client_id are required")
+	}
+	redirect, err := url.Parse(c.RedirectURL)
+	if err != nil || redirect.Scheme == "" || redirect.Host == "" {
+		return fmt.Errorf("redirect_url must be an absolute URL")
+	}
+	if len(c.Scopes) == 0 {
+		c.Scopes = []string{gooidc.ScopeOpenID, "profile", "email"}
+	}
+	if c.UsernameClaim == "" {
+		c.UsernameClaim = "preferred_username"
+	}
+	if c.UsernamePrefix == "" {
+		c.UsernamePrefix = "oidc:"
+	}
+	if c.GroupsClaim == "" {
+		c.GroupsClaim = "groups"
+	}
+	return nil
+}
+
+// Identity 单点登录得到的用户
+type Identity struct {
+	User   string
+	Groups []string
+}
+
+// Provider 发起登录并处理回调
+type Provider struct {
+	config   *Config
+	oauth2   oauth2.Config
+	verifier *gooidc.IDTokenVerifier
+
+	mu      sync.Mutex
+	pending map[string]pendingLogin // key: state
+}
+
+// pendingLogin 尚未完成的登录
+type pendingLogin struct {
+	nonce    string
+	verifier string // PKCE code_verifier
+	expires  time.Time
+}
+
+// NewProvider 通过 issuer 的发现文档创建 Provider
+// ctx 同时用于之后获取 JWKS，不应在 Provider 使用期间取消
+func NewProvider(ctx context.Context, config *Config) (*Provider, error) {
+	provider, err := gooidc.NewProvider(ctx, config.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("error discovering oidc provider: %v", err)
+	}
+
+	scopes := config.Scopes
+	if !contains(scopes, gooidc.ScopeOpenID) {
+		scopes = append([]string{gooidc.ScopeOpenID}, scopes...)
+	}
+	return &Provider{
+		config: config,
+		oauth2: oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  config.RedirectURL,
+			Scopes:       scopes,
+		},
+		verifier: provider.Verifier(&gooidc.Config{ClientID: config.ClientID}),
+		pending:  make(map[string]pendingLogin),
+	}, nil
+}
+
+// AuthCodeURL 开始一次登录，返回提供方的授权地址和 state
+func (p *Provider) AuthCodeURL() (string, string, error) {
+	state, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	p.mu.Lock()
+	// 顺便清理超时的登录
+	now := time.Now()
+	for key, login := range p.pending {
+		if now.After(login.expires) {
+			delete(p.pending, key)
+		}
+	}
+	p.pending[state] = pendingLogin{nonce: nonce, verifier: verifier, expires: now.Add(loginTimeout)}
+	p.mu.Unlock()
+
+	return p.oauth2.AuthCodeURL(state, gooidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), state, nil
+}
+
+// Exchange 用授权码换取 ID token，校验签名、issuer、audience、有效期和 nonce 后返回用户
+// 每个 state 只能使用一次
+func (p *Provider) Exchange(ctx context.Context, state, code string) (*Identity, error) {
+	p.mu.Lock()
+	login, ok := p.pending[state]
+	delete(p.pending, state)
+	p.mu.Unlock()
+	if !ok || time.Now().After(login.expires) {
+		return nil, fmt.Errorf("unknown or expired login state")
+	}
+
+	token, err := p.oauth2.Exchange(ctx, code, oauth2.VerifierOption(login.verifier))
+	if err != nil {
+		return nil, fmt.Errorf("error exchanging authorization code: %v", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("token response has no id_token")
+	}
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("error verifying id token: %v", err)
+	}
+	if idToken.Nonce != login.nonce {
+		return nil, fmt.Errorf("id token nonce mismatch")
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("error parsing id token claims: %v", err)
+	}
+	identity := &Identity{User: p.username(claims, idToken.Subject)}
+	if identity.User == "" {
+		return nil, fmt.Errorf("id token has no %s claim", p.config.UsernameClaim)
+	}
+	if identity.Groups, err = stringList(claims[p.config.GroupsClaim]); err != nil {
+		return nil, fmt.Errorf("invalid %s claim: %v", p.config.GroupsClaim, err)
+	}
+	return identity, nil
+}
+
+// username 读取用户名声明并加上 username_prefix，默认的 preferred_username 缺失时依次使用已验证的 email、sub
+// 加上前缀后，提供方允许用户修改的声明不会与本地账号同名而继承其权限
+func (p *Provider) username(claims map[string]interface{}, subject string) string {
+	name := stringClaim(claims, p.config.UsernameClaim)
+	if name == "" && p.config.UsernameClaim == "preferred_username" {
+		if name = stringClaim(claims, "email"); name == "" {
+			name = subject
+		}
+	}
+	if name == "" {
+		return ""
+	}
+	return p.config.UsernamePrefix + name
+}
+
+// stringClaim 读取字符串声明，email 只在 email_verified 为 true 时使用
+func stringClaim(claims map[string]interface{}, claim string) string {
+	if claim == "email" {
+		if verified, _ := claims["email_verified"].(bool); !verified {
+			return ""
+		}
+	}
+	value, _ := claims[claim].(string)
+	return value
+}
+
+// stringList 解析组声明，支持字符串数组或单个字符串
+func stringList(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("expected a list of strings")
+			}
+			list = append(list, s)
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("expected a list of strings")
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
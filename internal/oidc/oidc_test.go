@@ -0,0 +1,190 @@
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/YooLeon/container-debug-online/internal/oidc/oidctest"
+)
+
+func newTestProvider(t *testing.T, mock *oidctest.Provider) *Provider {
+	t.Helper()
+	config := &Config{
+		Issuer:       mock.URL,
+		ClientID:     mock.ClientID,
+		ClientSecret: mock.ClientSecret,
+		RedirectURL:  "http://debug.example.com/oidc/callback",
+	}
+	if err := config.validate(); err != nil {
+		t.Fatal(err)
+	}
+	provider, err := NewProvider(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider
+}
+
+// authorize 像浏览器一样访问授权地址，返回回调中的 code 和 state
+func authorize(t *testing.T, authURL string) (string, string) {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize returned %d", resp.StatusCode)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func TestLogin(t *testing.T) {
+	mock := oidctest.NewProvider()
+	defer mock.Close()
+	mock.SetUser("u-1", map[string]interface{}{
+		"preferred_username": "erin",
+		"groups":             []string{"platform", "qa"},
+	})
+	provider := newTestProvider(t, mock)
+
+	authURL, state, err := provider.AuthCodeURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, _ := url.Parse(authURL)
+	if query.Query().Get("code_challenge_method") != "S256" || query.Query().Get("nonce") == "" {
+		t.Fatalf("authorization url lacks PKCE or nonce: %s", authURL)
+	}
+
+	code, returned := authorize(t, authURL)
+	if returned != state {
+		t.Fatalf("state = %q, want %q", returned, state)
+	}
+	identity, err := provider.Exchange(context.Background(), state, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.User != "oidc:erin" || !reflect.DeepEqual(identity.Groups, []string{"platform", "qa"}) {
+		t.Errorf("identity = %+v", identity)
+	}
+
+	// state 只能使用一次
+	if _, err := provider.Exchange(context.Background(), state, code); err == nil {
+		t.Error("state reused")
+	}
+}
+
+func TestLoginUsernameFallback(t *testing.T) {
+	mock := oidctest.NewProvider()
+	defer mock.Close()
+	provider := newTestProvider(t, mock)
+
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+		user   string
+	}{
+		{"verified email", map[string]interface{}{"email": "frank@example.com", "email_verified": true, "groups": "qa"}, "oidc:frank@example.com"},
+		// 未验证的邮箱可能与其他用户相同，使用 sub
+		{"unverified email", map[string]interface{}{"email": "admin", "email_verified": false}, "oidc:u-2"},
+		{"email_verified missing", map[string]interface{}{"email": "admin"}, "oidc:u-2"},
+	}
+	for _, tt := range tests {
+		mock.SetUser("u-2", tt.claims)
+		authURL, state, err := provider.AuthCodeURL()
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, _ := authorize(t, authURL)
+		identity, err := provider.Exchange(context.Background(), state, code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if identity.User != tt.user {
+			t.Errorf("%s: user = %q, want %q", tt.name, identity.User, tt.user)
+		}
+	}
+}
+
+func TestLoginRejected(t *testing.T) {
+	mock := oidctest.NewProvider()
+	defer mock.Close()
+	provider := newTestProvider(t, mock)
+
+	// 未知的 state
+	authURL, state, err := provider.AuthCodeURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := authorize(t, authURL)
+	if _, err := provider.Exchange(context.Background(), "forged", code); err == nil {
+		t.Error("unknown state accepted")
+	}
+
+	// 另一次登录的授权码，PKCE verifier 不匹配
+	otherURL, _, err := provider.AuthCodeURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherCode, _ := authorize(t, otherURL)
+	if _, err := provider.Exchange(context.Background(), state, otherCode); err == nil {
+		t.Error("code from another login accepted")
+	}
+
+	// 签名密钥不在 JWKS 中
+	mock.SignWithUnknownKey()
+	authURL, state, err = provider.AuthCodeURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ = authorize(t, authURL)
+	if _, err := provider.Exchange(context.Background(), state, code); err == nil {
+		t.Error("id token with unknown signing key accepted")
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	secretPath := filepath.Join(dir, "secret")
+	if err := os.WriteFile(secretPath, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "oidc.yaml")
+	content := "issuer: https://id.example.com\nclient_id: debug\nclient_secret_file: " + secretPath + "\nredirect_url: https://debug.example.com/oidc/callback\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ClientSecret != "s3cret" || config.UsernameClaim != "preferred_username" || config.GroupsClaim != "groups" || len(config.Scopes) != 3 {
+		t.Errorf("config = %+v", config)
+	}
+
+	for _, content := range []string{
+		"client_id: debug\nredirect_url: https://debug.example.com/oidc/callback\n",
+		"issuer: https://id.example.com\nclient_id: debug\nredirect_url: /oidc/callback\n",
+		"issuer: https://id.example.com\nclient_id: debug\nredirect_url: https://debug.example.com/oidc/callback\nclaims: [x]\n",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadConfig(path); err == nil {
+			t.Errorf("expected error for %q", content)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+// Package patterns 将日志行聚类为模板并跟踪各模板的出现频率
+package patterns
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Wildcard 表示模板中的可变部分
+const Wildcard = "<*>"
+
+const (
+	// treeDepth 前缀树的深度，按 token 数和前 treeDepth-2 个 token 分组
+	treeDepth = 4
+	// maxChildren 每个节点的最大子节点数，超出后归入通配节点
+	maxChildren = 100
+	// similarity 行与模板相同 token 的比例达到该值时合并
+	similarity = 0.4
+	// maxTokens 超过该数量的 token 合并到最后一个 token
+	maxTokens = 80
+)
+
+var (
+	numberToken = regexp.MustCompile(`^[-+]?\d+([.,:/]\d+)*[a-zA-Zµ%]{0,3}$`)
+	hexToken    = regexp.MustCompile(`^(0x[0-9a-fA-F]+|[0-9a-fA-F]{8,})$`)
+	uuidToken   = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	ipToken     = regexp.MustCompile(`^\d{1,3}(\.\d{1,3}){3}(:\d+)?$`)
+)
+
+// Cluster 表示一类日志及其模板
+type Cluster struct {
+	ID       int
+	Template []string
+	Size     int // 累计匹配的行数
+	leaf     *node
+}
+
+// String 返回以空格连接的模板
+func (c *Cluster) String() string {
+	return strings.Join(c.Template, " ")
+}
+
+type node struct {
+	children map[string]*node
+	clusters []*Cluster
+}
+
+func newNode() *node {
+	return &node{children: make(map[string]*node)}
+}
+
+// Miner 按 Drain 算法将日志行聚类：先按 token 数和前几个 token 在固定深度的树中找到候选模板，
+// 再选择最相似的模板合并，不同的 token 替换为通配符
+type Miner struct {
+	root   *node
+	nextID int
+	byID   map[int]*Cluster
+}
+
+// NewMiner 创建模板聚类器
+func NewMiner() *Miner {
+	return &Miner{root: newNode(), nextID: 1, byID: make(map[int]*Cluster)}
+}
+
+// Add 将一行日志归入模板，返回所属的模板
+func (m *Miner) Add(line string) *Cluster {
+	tokens := Tokenize(line)
+
+	leaf := m.leaf(tokens)
+	var best *Cluster
+	bestScore := -1.0
+	for _, cluster := range leaf.clusters {
+		if score := match(cluster.Template, tokens); score > bestScore {
+			best, bestScore = cluster, score
+		}
+	}
+
+	if best != nil && bestScore >= similarity {
+		for i, token := range tokens {
+			if best.Template[i] != token {
+				best.Template[i] = Wildcard
+			}
+		}
+		best.Size++
+		return best
+	}
+
+	cluster := &Cluster{ID: m.nextID, Template: tokens, Size: 1, leaf: leaf}
+	m.nextID++
+	leaf.clusters = append(leaf.clusters, cluster)
+	m.byID[cluster.ID] = cluster
+	return cluster
+}
+
+// Remove 删除模板，之后相同的日志会生成新模板
+func (m *Miner) Remove(id int) {
+	cluster, ok := m.byID[id]
+	if !ok {
+		return
+	}
+	delete(m.byID, id)
+
+	clusters := cluster.leaf.clusters
+	for i, c := range clusters {
+		if c == cluster {
+			cluster.leaf.clusters = append(clusters[:i], clusters[i+1:]...)
+			break
+		}
+	}
+}
+
+// Len 返回模板数量
+func (m *Miner) Len() int {
+	return len(m.byID)
+}
+
+// leaf 找到或创建 token 序列对应的叶子节点
+func (m *Miner) leaf(tokens []string) *node {
+	current := m.child(m.root, strconv.Itoa(len(tokens)))
+	for i := 0; i < treeDepth-2 && i < len(tokens); i++ {
+		key := tokens[i]
+		if key == Wildcard {
+			current = m.child(current, Wildcard)
+			continue
+		}
+		if _, ok := current.children[key]; !ok && len(current.children) >= maxChildren {
+			key = Wildcard
+		}
+		current = m.child(current, key)
+	}
+	return current
+}
+
+func (m *Miner) child(parent *node, key string) *node {
+	child, ok := parent.children[key]
+	if !ok {
+		child = newNode()
+		parent.children[key] = child
+	}
+	return child
+}
+
+// match 返回模板与 token 序列中相同 token 的比例，模板中的通配符不计入
+func match(template, tokens []string) float64 {
+	same := 0
+	for i, token := range template {
+		if token == tokens[i] {
+			same++
+		}
+	}
+	return float64(same) / float64(len(template))
+}
+
+// Tokenize 按空白切分日志行并将数字、十六进制、UUID 和 IP 替换为通配符，
+// key=value 形式只替换值，只使用第一行
+func Tokenize(line string) []string {
+	if i := strings.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+
+	tokens := strings.Fields(line)
+	if len(tokens) > maxTokens {
+		tokens = append(tokens[:maxTokens-1], strings.Join(tokens[maxTokens-1:], " "))
+	}
+	for i, token := range tokens {
+		if key, value, ok := strings.Cut(token, "="); ok && key != "" && variable(value) {
+			tokens[i] = key + "=" + Wildcard
+			continue
+		}
+		if variable(token) {
+			tokens[i] = Wildcard
+		}
+	}
+	if len(tokens) == 0 {
+		tokens = []string{""}
+	}
+	return tokens
+}
+
+// variable 判断 token 是否为可变值
+func variable(token string) bool {
+	token = strings.Trim(token, `"',;()[]{}`)
+	if token == "" {
+		return false
+	}
+	return numberToken.MatchString(token) || hexToken.MatchString(token) ||
+		uuidToken.MatchString(token) || ipToken.MatchString(token)
+}
@@ -0,0 +1,70 @@
+package patterns
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"GET /users took 35ms", "GET /users took <*>"},
+		{"user 42 logged in from 10.0.0.7:5123", "user <*> logged in from <*>"},
+		{"request id=7f3a9c21e4b0 status=200 path=/health", "request id=<*> status=<*> path=/health"},
+		{"trace 123e4567-e89b-12d3-a456-426614174000 done", "trace <*> done"},
+		{"panic: oops\ngoroutine 1 [running]:", "panic: oops"},
+		{"cpu at 97.5%", "cpu at <*>"},
+	}
+
+	for _, tt := range tests {
+		if got := strings.Join(Tokenize(tt.line), " "); got != tt.want {
+			t.Errorf("Tokenize(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestMinerClusters(t *testing.T) {
+	miner := NewMiner()
+
+	first := miner.Add("connected to db primary in 12ms")
+	second := miner.Add("connected to db replica in 30ms")
+	if first.ID != second.ID {
+		t.Fatalf("similar lines got different clusters %d and %d", first.ID, second.ID)
+	}
+	if got := second.String(); got != "connected to db <*> in <*>" {
+		t.Errorf("template = %q", got)
+	}
+	if second.Size != 2 {
+		t.Errorf("size = %d, want 2", second.Size)
+	}
+
+	// token 数不同或前缀不同的行属于不同模板
+	other := miner.Add("connected to db primary")
+	failed := miner.Add("failed to reach payment gateway after 3 retries")
+	if other.ID == first.ID || failed.ID == first.ID || other.ID == failed.ID {
+		t.Errorf("unrelated lines were merged: %d %d %d", first.ID, other.ID, failed.ID)
+	}
+	if miner.Len() != 3 {
+		t.Errorf("Len = %d, want 3", miner.Len())
+	}
+
+	miner.Remove(failed.ID)
+	if miner.Len() != 2 {
+		t.Errorf("Len after Remove = %d, want 2", miner.Len())
+	}
+	if again := miner.Add("failed to reach payment gateway after 5 retries"); again.ID == failed.ID {
+		t.Errorf("removed cluster was reused")
+	}
+}
+
+func TestMinerSameLengthDifferentMessages(t *testing.T) {
+	miner := NewMiner()
+
+	a := miner.Add("cache miss for key users")
+	b := miner.Add("cache eviction started by janitor")
+	if a.ID == b.ID {
+		t.Errorf("dissimilar lines merged into %q", b.String())
+	}
+}
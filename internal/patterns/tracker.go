@@ -0,0 +1,330 @@
+package patterns
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/YooLeon/container-debug-online/internal/docker"
+	"github.com/YooLeon/container-debug-online/internal/logs"
+	"go.uber.org/zap"
+)
+
+const (
+	// bucketSize 频率统计的时间粒度
+	bucketSize = time.Minute
+	// pruneInterval 清理过期统计的间隔
+	pruneInterval = time.Minute
+	// maxPatterns 每个服务保留的最大模板数，超出时删除最久未出现的模板
+	maxPatterns = 2000
+	// mergeWindow 跟随日志时的重排窗口
+	mergeWindow = 500 * time.Millisecond
+)
+
+// 模板在时间窗口内的状态
+const (
+	StatusNew     = "new"     // 基线期间没有出现过
+	StatusSpiking = "spiking" // 频率达到基线的 Factor 倍
+	StatusSteady  = ""
+)
+
+// pattern 记录一个模板的统计
+type pattern struct {
+	cluster   *Cluster
+	firstSeen time.Time
+	lastSeen  time.Time
+	example   string
+	buckets   map[int64]int // key: 分钟的 Unix 时间
+}
+
+// serviceMiner 保存一个服务的模板
+type serviceMiner struct {
+	miner    *Miner
+	patterns map[int]*pattern // key: Cluster.ID
+}
+
+// Tracker 持续跟随一个主机上所有服务的日志，聚类为模板并按分钟统计频率
+type Tracker struct {
+	mu        sync.Mutex
+	monitor   *docker.Monitor
+	logger    *zap.Logger
+	retention time.Duration
+	services  map[string]*serviceMiner
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+// NewTracker 创建模板跟踪器，统计保留 retention 时长
+func NewTracker(monitor *docker.Monitor, retention time.Duration, logger *zap.Logger) *Tracker {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Tracker{
+		monitor:   monitor,
+		logger:    logger,
+		retention: retention,
+		services:  make(map[string]*serviceMiner),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+// Host 返回跟踪器所属主机的名称
+func (t *Tracker) Host() string {
+	return t.monitor.Name()
+}
+
+// Start 开始跟随 compose 文件中所有服务的日志，先读取保留期内的历史日志作为基线
+func (t *Tracker) Start() {
+	options := &logs.Options{
+		Since:  time.Now().Add(-t.retention),
+		Tail:   "all",
+		Stream: logs.StreamAll,
+		Format: logs.FormatJSON,
+	}
+	for _, service := range t.monitor.GetComposeConfig().SortedServices {
+		t.wg.Add(1)
+		go func(service string) {
+			defer t.wg.Done()
+			target := logs.ServiceTarget(t.monitor, service)
+			for frame := range logs.Aggregate(t.ctx, t.monitor.Runtime(), []logs.Target{target}, options, mergeWindow, t.logger) {
+				entry := frame.Entry()
+				line := entry.Line
+				// JSON 日志按消息聚类
+				if parsed := entry.JSON(); parsed != nil && parsed.Message != "" {
+					line = parsed.Message
+				}
+				t.observe(service, frame.Time, line)
+			}
+		}(service)
+	}
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		ticker := time.NewTicker(pruneInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				t.prune(time.Now())
+			case <-t.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Close 停止跟随日志
+func (t *Tracker) Close() error {
+	t.cancel()
+	t.wg.Wait()
+	return nil
+}
+
+// observe 将一行日志归入模板并计数
+func (t *Tracker) observe(service string, ts time.Time, line string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	sm, ok := t.services[service]
+	if !ok {
+		sm = &serviceMiner{miner: NewMiner(), patterns: make(map[int]*pattern)}
+		t.services[service] = sm
+	}
+
+	cluster := sm.miner.Add(line)
+	p, ok := sm.patterns[cluster.ID]
+	if !ok {
+		if len(sm.patterns) >= maxPatterns {
+			sm.evictOldest()
+		}
+		p = &pattern{cluster: cluster, firstSeen: ts, buckets: make(map[int64]int)}
+		sm.patterns[cluster.ID] = p
+	}
+	if ts.Before(p.firstSeen) {
+		p.firstSeen = ts
+	}
+	if ts.After(p.lastSeen) {
+		p.lastSeen = ts
+		p.example = line
+	}
+	p.buckets[bucketOf(ts)]++
+}
+
+// evictOldest 删除最久未出现的模板
+func (sm *serviceMiner) evictOldest() {
+	var oldest *pattern
+	for _, p := range sm.patterns {
+		if oldest == nil || p.lastSeen.Before(oldest.lastSeen) {
+			oldest = p
+		}
+	}
+	if oldest != nil {
+		sm.remove(oldest)
+	}
+}
+
+func (sm *serviceMiner) remove(p *pattern) {
+	delete(sm.patterns, p.cluster.ID)
+	sm.miner.Remove(p.cluster.ID)
+}
+
+// prune 删除保留期之前的统计，删除保留期内没有出现的模板
+func (t *Tracker) prune(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	cutoff := bucketOf(now.Add(-t.retention))
+	for _, sm := range t.services {
+		for _, p := range sm.patterns {
+			for bucket := range p.buckets {
+				if bucket < cutoff {
+					delete(p.buckets, bucket)
+				}
+			}
+			if len(p.buckets) == 0 {
+				sm.remove(p)
+			}
+		}
+	}
+}
+
+func bucketOf(ts time.Time) int64 {
+	return ts.Truncate(bucketSize).Unix()
+}
+
+// bucketCeil 返回时间所在分钟的下一个桶，整分钟时返回自身，用于把未满一分钟的部分计入窗口
+func bucketCeil(ts time.Time) int64 {
+	bucket := bucketOf(ts)
+	if !ts.Equal(ts.Truncate(bucketSize)) {
+		bucket += int64(bucketSize / time.Second)
+	}
+	return bucket
+}
+
+// count 统计桶 [from, to) 内的出现次数
+func (p *pattern) count(from, to int64) int {
+	total := 0
+	for bucket, n := range p.buckets {
+		if bucket >= from && bucket < to {
+			total += n
+		}
+	}
+	return total
+}
+
+// Pattern 表示一个模板在时间窗口内与基线相比的统计
+type Pattern struct {
+	Service       string    `json:"service"`
+	ID            int       `json:"id"`
+	Template      string    `json:"template"`
+	Status        string    `json:"status,omitempty"`
+	Count         int       `json:"count"`          // 窗口内的次数
+	BaselineCount int       `json:"baseline_count"` // 基线期间的次数
+	Rate          float64   `json:"rate"`           // 窗口内每分钟次数
+	BaselineRate  float64   `json:"baseline_rate"`  // 基线期间每分钟次数
+	FirstSeen     time.Time `json:"first_seen"`
+	LastSeen      time.Time `json:"last_seen"`
+	Example       string    `json:"example"`
+}
+
+// ReportOptions 表示模板报告的参数
+type ReportOptions struct {
+	Services      []string  // 为空时包含所有服务
+	Start         time.Time // 窗口开始
+	End           time.Time // 窗口结束
+	BaselineStart time.Time // 基线为 [BaselineStart, Start)
+	Factor        float64   // 窗口频率达到基线的该倍数视为突增
+	MinCount      int       // 窗口内至少出现的次数才视为突增
+	All           bool      // 包含没有变化的模板
+}
+
+// Report 返回窗口内新出现或突增的模板，新模板在前，其余按频率变化倍数降序
+func (t *Tracker) Report(options ReportOptions) []Pattern {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	windowMinutes := options.End.Sub(options.Start).Minutes()
+	// 按分钟粒度统计：窗口包含 Start 和 End 所在的分钟，基线在 Start 所在的分钟之前结束，两者不重叠
+	windowFrom, windowTo := bucketOf(options.Start), bucketCeil(options.End)
+	baselineFrom := bucketOf(options.BaselineStart)
+	baselineMinutes := options.Start.Sub(options.BaselineStart).Minutes()
+
+	result := []Pattern{}
+	for service, sm := range t.services {
+		if len(options.Services) > 0 && !contains(options.Services, service) {
+			continue
+		}
+		for _, p := range sm.patterns {
+			count := p.count(windowFrom, windowTo)
+			if count == 0 {
+				continue
+			}
+
+			report := Pattern{
+				Service:       service,
+				ID:            p.cluster.ID,
+				Template:      p.cluster.String(),
+				Count:         count,
+				BaselineCount: p.count(baselineFrom, windowFrom),
+				FirstSeen:     p.firstSeen,
+				LastSeen:      p.lastSeen,
+				Example:       p.example,
+			}
+			if windowMinutes > 0 {
+				report.Rate = float64(report.Count) / windowMinutes
+			}
+			if baselineMinutes > 0 {
+				report.BaselineRate = float64(report.BaselineCount) / baselineMinutes
+			}
+
+			switch {
+			case report.BaselineCount == 0 && !p.firstSeen.Before(options.Start.Truncate(bucketSize)):
+				report.Status = StatusNew
+			case report.Count >= options.MinCount && report.Rate >= options.Factor*report.BaselineRate:
+				report.Status = StatusSpiking
+			}
+			if report.Status == StatusSteady && !options.All {
+				continue
+			}
+			result = append(result, report)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if (a.Status == StatusNew) != (b.Status == StatusNew) {
+			return a.Status == StatusNew
+		}
+		if ra, rb := ratio(a), ratio(b); ra != rb {
+			return ra > rb
+		}
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Service != b.Service {
+			return a.Service < b.Service
+		}
+		return a.ID < b.ID
+	})
+	return result
+}
+
+// ratio 返回窗口频率与基线频率之比，基线为零时按每小时一次计算
+func ratio(p Pattern) float64 {
+	baseline := p.BaselineRate
+	if baseline == 0 {
+		baseline = 1.0 / 60
+	}
+	return p.Rate / baseline
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package patterns
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+
+func newTestTracker() *Tracker {
+	return &Tracker{retention: 24 * time.Hour, services: make(map[string]*serviceMiner)}
+}
+
+func reportOptions() ReportOptions {
+	return ReportOptions{
+		Start:         now.Add(-15 * time.Minute),
+		End:           now,
+		BaselineStart: now.Add(-75 * time.Minute),
+		Factor:        3,
+		MinCount:      5,
+	}
+}
+
+func TestReport(t *testing.T) {
+	tracker := newTestTracker()
+
+	// 基线期间每分钟一次
+	for i := 16; i < 75; i++ {
+		ts := now.Add(-time.Duration(i) * time.Minute)
+		tracker.observe("api", ts, fmt.Sprintf("GET /users took %dms", i))
+		tracker.observe("api", ts, fmt.Sprintf("cache hit ratio %d", i))
+	}
+	// 窗口内 GET 突增，cache 保持不变，出现新的错误
+	for i := 0; i < 15; i++ {
+		ts := now.Add(-time.Duration(i)*time.Minute - time.Second)
+		for j := 0; j < 5; j++ {
+			tracker.observe("api", ts, fmt.Sprintf("GET /users took %dms", j))
+		}
+		tracker.observe("api", ts, fmt.Sprintf("cache hit ratio %d", i))
+	}
+	tracker.observe("api", now.Add(-time.Minute), "connection refused to db:5432")
+	tracker.observe("worker", now.Add(-2*time.Minute), "job 17 failed")
+
+	report := tracker.Report(reportOptions())
+	if len(report) != 3 {
+		t.Fatalf("report = %+v", report)
+	}
+
+	// 新模板在前
+	if report[0].Status != StatusNew || report[1].Status != StatusNew {
+		t.Errorf("expected new patterns first: %+v", report[:2])
+	}
+	spike := report[2]
+	if spike.Status != StatusSpiking || spike.Template != "GET /users took <*>" {
+		t.Errorf("spike = %+v", spike)
+	}
+	if spike.Count != 75 || spike.BaselineCount != 59 {
+		t.Errorf("counts = %d / %d", spike.Count, spike.BaselineCount)
+	}
+	if spike.Rate != 5 {
+		t.Errorf("rate = %v, want 5", spike.Rate)
+	}
+
+	// 只看 worker
+	options := reportOptions()
+	options.Services = []string{"worker"}
+	report = tracker.Report(options)
+	if len(report) != 1 || report[0].Service != "worker" || report[0].Template != "job <*> failed" || report[0].Example != "job 17 failed" {
+		t.Errorf("worker report = %+v", report)
+	}
+
+	// all 包含没有变化的模板
+	options = reportOptions()
+	options.All = true
+	report = tracker.Report(options)
+	if len(report) != 4 || report[3].Status != StatusSteady || report[3].Template != "cache hit ratio <*>" {
+		t.Errorf("full report = %+v", report)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	tracker := newTestTracker()
+	tracker.observe("api", now.Add(-30*time.Hour), "old message 1")
+	tracker.observe("api", now.Add(-time.Hour), "recent message 1")
+
+	tracker.prune(now)
+
+	sm := tracker.services["api"]
+	if len(sm.patterns) != 1 || sm.miner.Len() != 1 {
+		t.Fatalf("patterns after prune = %d, clusters = %d", len(sm.patterns), sm.miner.Len())
+	}
+	for _, p := range sm.patterns {
+		if p.example != "recent message 1" {
+			t.Errorf("kept %q", p.example)
+		}
+	}
+}
+
+func TestReportIncludesCurrentMinute(t *testing.T) {
+	tracker := newTestTracker()
+	end := now.Add(40 * time.Second)
+	tracker.observe("api", now.Add(10*time.Second), "disk 91% full")
+
+	options := reportOptions()
+	options.End = end
+	report := tracker.Report(options)
+	if len(report) != 1 || report[0].Count != 1 || report[0].Status != StatusNew {
+		t.Errorf("report = %+v", report)
+	}
+}
+
+func TestReportStartMinuteNotInBaseline(t *testing.T) {
+	tracker := newTestTracker()
+	options := reportOptions()
+	options.Start = now.Add(-14*time.Minute - 30*time.Second)
+	tracker.observe("api", now.Add(-14*time.Minute-20*time.Second), "certificate expires in 3 days")
+
+	report := tracker.Report(options)
+	if len(report) != 1 || report[0].Count != 1 || report[0].BaselineCount != 0 || report[0].Status != StatusNew {
+		t.Errorf("report = %+v", report)
+	}
+}
@@ -0,0 +1,260 @@
+// Package rbac 按角色控制用户对项目、服务和容器的操作权限
+package rbac
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Action 表示一类操作
+type Action string
+
+const (
+	ActionList      Action = "list"      // 查看容器列表、状态、崩溃记录和告警
+	ActionLogs      Action = "logs"      // 查看实时日志、归档日志、搜索和日志模板
+	ActionDownload  Action = "download"  // 下载日志
+	ActionTerminal  Action = "terminal"  // 打开交互式终端
+	ActionExec      Action = "exec"      // 在容器中执行命令
+	ActionLifecycle Action = "lifecycle" // 启动、停止、重启容器
+	ActionFiles     Action = "files"     // 浏览、上传、下载容器内的文件
+	ActionAdmin     Action = "admin"     // 管理告警静默、所有 API 令牌等全局设置
+)
+
+// Actions 所有操作，按权限从低到高排列
+var Actions = []Action{ActionList, ActionLogs, ActionDownload, ActionTerminal, ActionExec, ActionLifecycle, ActionFiles, ActionAdmin}
+
+// 内置角色
+const (
+	RoleViewer   = "viewer"
+	RoleLogs     = "logs"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+var roles = map[string][]Action{
+	RoleViewer:   {ActionList},
+	RoleLogs:     {ActionList, ActionLogs, ActionDownload},
+	RoleOperator: {ActionList, ActionLogs, ActionDownload, ActionTerminal, ActionExec, ActionLifecycle},
+	RoleAdmin:    Actions,
+}
+
+// Resource 表示被操作的对象。Container 为空表示服务级别的数据，不按容器名限制；
+// 项目和服务为空时只有不限定项目或服务的绑定匹配，例如没有 compose 标签的容器
+type Resource struct {
+	Project   string
+	Service   string
+	Container string
+}
+
+// Subject 表示发起请求的用户，Groups 来自单点登录的组声明
+// 使用 API 令牌时 Scope 进一步限制用户的权限
+type Subject struct {
+	User   string
+	Groups []string
+	Scope  *Scope
+}
+
+// Scope 限定 API 令牌可执行的操作和项目，Projects 为空时不限项目
+type Scope struct {
+	Actions  []Action `json:"actions"`
+	Projects []string `json:"projects,omitempty"`
+}
+
+// Validate 检查操作是否存在，项目 glob 是否合法
+func (s *Scope) Validate() error {
+	if len(s.Actions) == 0 {
+		return fmt.Errorf("no actions")
+	}
+	for _, action := range s.Actions {
+		if !containsAction(Actions, action) {
+			return fmt.Errorf("unknown action: %q", action)
+		}
+	}
+	for _, pattern := range s.Projects {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// Permits 判断范围是否包含对资源的操作，nil 表示不限
+func (s *Scope) Permits(action Action, resource Resource) bool {
+	if s == nil {
+		return true
+	}
+	return containsAction(s.Actions, action) && matchScope(s.Projects, resource.Project)
+}
+
+// permitsAny 判断范围是否包含至少一部分资源上的操作
+func (s *Scope) permitsAny(action Action) bool {
+	return s == nil || containsAction(s.Actions, action)
+}
+
+// Binding 将用户或组绑定到一个角色，可用 glob 限定项目、服务和容器名称，未指定时不限
+type Binding struct {
+	Users      []string `yaml:"users"`  // 用户名，"*" 表示所有已认证用户
+	Groups     []string `yaml:"groups"` // 单点登录的组名
+	Role       string   `yaml:"role"`
+	Projects   []string `yaml:"projects"`
+	Services   []string `yaml:"services"`
+	Containers []string `yaml:"containers"`
+}
+
+// Policy 权限策略，nil 表示不做限制
+type Policy struct {
+	DefaultRole string    `yaml:"default_role"` // 所有请求都具有的角色，不限范围，为空时只有绑定的权限
+	Bindings    []Binding `yaml:"bindings"`
+}
+
+// LoadPolicy 从 YAML 文件加载权限策略
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading policy file: %v", err)
+	}
+
+	var policy Policy
+	if err := yaml.UnmarshalStrict(data, &policy); err != nil {
+		return nil, fmt.Errorf("error parsing policy file: %v", err)
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// Validate 检查角色是否存在，glob 是否合法
+func (p *Policy) Validate() error {
+	if _, ok := roles[p.DefaultRole]; p.DefaultRole != "" && !ok {
+		return fmt.Errorf("unknown default role: %s", p.DefaultRole)
+	}
+	for i, binding := range p.Bindings {
+		if _, ok := roles[binding.Role]; !ok {
+			return fmt.Errorf("binding %d: unknown role: %q", i+1, binding.Role)
+		}
+		if len(binding.Users) == 0 && len(binding.Groups) == 0 {
+			return fmt.Errorf("binding %d: no users or groups", i+1)
+		}
+		for _, patterns := range [][]string{binding.Users, binding.Groups, binding.Projects, binding.Services, binding.Containers} {
+			for _, pattern := range patterns {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return fmt.Errorf("binding %d: invalid pattern %q", i+1, pattern)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Allowed 判断用户能否对资源执行操作
+func (p *Policy) Allowed(subject Subject, action Action, resource Resource) bool {
+	if !subject.Scope.Permits(action, resource) {
+		return false
+	}
+	return p.allowed(subject, action, func(binding *Binding) bool { return binding.covers(resource) })
+}
+
+// allowed 判断默认角色或 covers 返回 true 的绑定是否包含该操作，不检查令牌范围
+func (p *Policy) allowed(subject Subject, action Action, covers func(binding *Binding) bool) bool {
+	if p == nil {
+		return true
+	}
+
+	if hasAction(p.DefaultRole, action) {
+		return true
+	}
+	for i := range p.Bindings {
+		binding := &p.Bindings[i]
+		if binding.matches(subject) && hasAction(binding.Role, action) && covers(binding) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowedActions 返回用户能对资源执行的所有操作
+func (p *Policy) AllowedActions(subject Subject, resource Resource) []Action {
+	actions := make([]Action, 0, len(Actions))
+	for _, action := range Actions {
+		if p.Allowed(subject, action, resource) {
+			actions = append(actions, action)
+		}
+	}
+	return actions
+}
+
+// AllowedAny 判断用户是否对至少一部分资源有该操作的权限，不论绑定限定的范围
+func (p *Policy) AllowedAny(subject Subject, action Action) bool {
+	if !subject.Scope.permitsAny(action) {
+		return false
+	}
+	return p.allowed(subject, action, func(*Binding) bool { return true })
+}
+
+// AllowedGlobal 判断用户是否不受范围限制地拥有该操作的权限，只有默认角色和未限定项目、服务、容器的绑定满足，
+// 使用 API 令牌时令牌也不能限定项目。用于告警静默、他人的 API 令牌和审计日志等不属于某个项目的数据
+func (p *Policy) AllowedGlobal(subject Subject, action Action) bool {
+	if !subject.Scope.permitsAny(action) || subject.Scope != nil && len(subject.Scope.Projects) > 0 {
+		return false
+	}
+	return p.allowed(subject, action, (*Binding).unscoped)
+}
+
+// unscoped 判断绑定是否没有限定范围
+func (b *Binding) unscoped() bool {
+	return len(b.Projects) == 0 && len(b.Services) == 0 && len(b.Containers) == 0
+}
+
+// matches 判断绑定是否适用于用户，未认证的请求不匹配任何绑定
+func (b *Binding) matches(subject Subject) bool {
+	if subject.User == "" {
+		return false
+	}
+	if matchAny(b.Users, subject.User) {
+		return true
+	}
+	for _, group := range subject.Groups {
+		if matchAny(b.Groups, group) {
+			return true
+		}
+	}
+	return false
+}
+
+// covers 判断绑定的范围是否包含资源，服务级别的数据不按容器名限制
+func (b *Binding) covers(resource Resource) bool {
+	return matchScope(b.Projects, resource.Project) &&
+		matchScope(b.Services, resource.Service) &&
+		(resource.Container == "" || matchScope(b.Containers, resource.Container))
+}
+
+func hasAction(role string, action Action) bool {
+	return containsAction(roles[role], action)
+}
+
+func containsAction(actions []Action, action Action) bool {
+	for _, a := range actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// matchScope 未限定范围时匹配任何值，包括空值；限定了范围时值必须存在并匹配
+func matchScope(patterns []string, name string) bool {
+	return len(patterns) == 0 || name != "" && matchAny(patterns, name)
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,215 @@
+package rbac
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testPolicy = `
+bindings:
+  - users: [alice]
+    role: admin
+  - users: [bob]
+    role: operator
+    projects: [shop]
+    services: ["api*"]
+  - users: [bob, "dev-*"]
+    role: logs
+    projects: [shop]
+  - users: [carol]
+    role: viewer
+    containers: [shop-web-1]
+`
+
+func loadTestPolicy(t *testing.T, content string) (*Policy, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return LoadPolicy(path)
+}
+
+func TestAllowed(t *testing.T) {
+	policy, err := loadTestPolicy(t, testPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	api := Resource{Project: "shop", Service: "api", Container: "shop-api-1"}
+	db := Resource{Project: "shop", Service: "db", Container: "shop-db-1"}
+	web := Resource{Project: "shop", Service: "web", Container: "shop-web-1"}
+	other := Resource{Project: "billing", Service: "api", Container: "billing-api-1"}
+
+	tests := []struct {
+		user     string
+		action   Action
+		resource Resource
+		want     bool
+	}{
+		{"alice", ActionFiles, other, true},
+		{"bob", ActionTerminal, api, true},
+		{"bob", ActionTerminal, db, false},
+		{"bob", ActionLogs, db, true},
+		{"bob", ActionLogs, other, false},
+		{"dev-1", ActionDownload, db, true},
+		{"dev-1", ActionTerminal, api, false},
+		{"carol", ActionList, web, true},
+		{"carol", ActionList, db, false},
+		{"carol", ActionLogs, web, false},
+		{"dave", ActionList, api, false},
+		{"", ActionList, api, false},
+		// 服务级别的资源不按容器名限制
+		{"carol", ActionList, Resource{Project: "shop", Service: "db"}, true},
+		// 没有 compose 标签的容器不匹配限定了项目或服务的绑定
+		{"alice", ActionTerminal, Resource{Container: "standalone"}, true},
+		{"bob", ActionTerminal, Resource{Project: "shop", Container: "standalone"}, false},
+		{"bob", ActionLogs, Resource{Container: "standalone"}, false},
+		{"carol", ActionList, Resource{Container: "standalone"}, false},
+	}
+	for _, tt := range tests {
+		if got := policy.Allowed(Subject{User: tt.user}, tt.action, tt.resource); got != tt.want {
+			t.Errorf("Allowed(%s, %s, %+v) = %v, want %v", tt.user, tt.action, tt.resource, got, tt.want)
+		}
+	}
+
+	if got := policy.AllowedActions(Subject{User: "bob"}, api); !reflect.DeepEqual(got, []Action{ActionList, ActionLogs, ActionDownload, ActionTerminal, ActionExec, ActionLifecycle}) {
+		t.Errorf("bob actions on api = %v", got)
+	}
+	if got := policy.AllowedActions(Subject{User: "bob"}, db); !reflect.DeepEqual(got, []Action{ActionList, ActionLogs, ActionDownload}) {
+		t.Errorf("bob actions on db = %v", got)
+	}
+	if !policy.AllowedAny(Subject{User: "bob"}, ActionTerminal) || policy.AllowedAny(Subject{User: "carol"}, ActionLogs) {
+		t.Error("unexpected AllowedAny result")
+	}
+}
+
+func TestAllowedGlobal(t *testing.T) {
+	policy, err := loadTestPolicy(t, testPolicy+"  - users: [dana]\n    role: admin\n    projects: [shop]\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !policy.AllowedGlobal(Subject{User: "alice"}, ActionAdmin) {
+		t.Error("unscoped admin should be global")
+	}
+	if !policy.AllowedAny(Subject{User: "dana"}, ActionAdmin) || policy.AllowedGlobal(Subject{User: "dana"}, ActionAdmin) {
+		t.Error("project-scoped admin should not be global")
+	}
+	if policy.AllowedGlobal(Subject{User: "bob"}, ActionLogs) {
+		t.Error("bob's bindings are all scoped")
+	}
+	if policy.AllowedGlobal(Subject{User: "alice", Scope: &Scope{Actions: []Action{ActionAdmin}, Projects: []string{"shop"}}}, ActionAdmin) ||
+		!policy.AllowedGlobal(Subject{User: "alice", Scope: &Scope{Actions: []Action{ActionAdmin}}}, ActionAdmin) {
+		t.Error("token scope not applied")
+	}
+
+	withDefault, err := loadTestPolicy(t, "default_role: viewer\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !withDefault.AllowedGlobal(Subject{}, ActionList) || withDefault.AllowedGlobal(Subject{}, ActionLogs) {
+		t.Error("default role should be global")
+	}
+}
+
+func TestDefaultRole(t *testing.T) {
+	policy, err := loadTestPolicy(t, "default_role: viewer\nbindings:\n  - users: [bob]\n    role: logs\n    services: [api]\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := Resource{Project: "shop", Service: "db"}
+	if !policy.Allowed(Subject{User: "dave"}, ActionList, db) || !policy.Allowed(Subject{}, ActionList, db) {
+		t.Error("default role should allow list for everyone")
+	}
+	if policy.Allowed(Subject{User: "dave"}, ActionLogs, db) || policy.Allowed(Subject{User: "bob"}, ActionLogs, db) {
+		t.Error("default role should not allow logs")
+	}
+	if !policy.Allowed(Subject{User: "bob"}, ActionLogs, Resource{Service: "api"}) {
+		t.Error("binding should add to the default role")
+	}
+}
+
+func TestGroups(t *testing.T) {
+	policy, err := loadTestPolicy(t, "bindings:\n  - groups: [platform-*]\n    role: operator\n  - groups: [qa]\n    role: logs\n    services: [web]\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	api := Resource{Project: "shop", Service: "api"}
+	if !policy.Allowed(Subject{User: "erin", Groups: []string{"staff", "platform-oncall"}}, ActionTerminal, api) {
+		t.Error("platform group should get operator")
+	}
+	if policy.Allowed(Subject{User: "frank", Groups: []string{"qa"}}, ActionLogs, api) ||
+		!policy.Allowed(Subject{User: "frank", Groups: []string{"qa"}}, ActionLogs, Resource{Service: "web"}) {
+		t.Error("qa group should only see web logs")
+	}
+	if policy.Allowed(Subject{Groups: []string{"platform-oncall"}}, ActionList, api) {
+		t.Error("unauthenticated request matched a group binding")
+	}
+}
+
+func TestScope(t *testing.T) {
+	policy, err := loadTestPolicy(t, testPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scope := &Scope{Actions: []Action{ActionList, ActionLogs}, Projects: []string{"shop"}}
+	api := Resource{Project: "shop", Service: "api"}
+	if !policy.Allowed(Subject{User: "bob", Scope: scope}, ActionLogs, api) {
+		t.Error("scope should allow logs in shop")
+	}
+	if policy.Allowed(Subject{User: "bob", Scope: scope}, ActionTerminal, api) {
+		t.Error("scope should not allow terminal")
+	}
+	if policy.Allowed(Subject{User: "alice", Scope: scope}, ActionList, Resource{Project: "billing"}) {
+		t.Error("scope should not allow other projects")
+	}
+	if policy.Allowed(Subject{User: "alice", Scope: scope}, ActionList, Resource{Container: "standalone"}) {
+		t.Error("project scope should not allow containers without a project")
+	}
+	if !policy.AllowedAny(Subject{User: "alice", Scope: scope}, ActionLogs) || policy.AllowedAny(Subject{User: "alice", Scope: scope}, ActionAdmin) {
+		t.Error("unexpected AllowedAny result for scope")
+	}
+	// 范围不能超出用户本身的权限
+	if policy.Allowed(Subject{User: "carol", Scope: scope}, ActionLogs, Resource{Project: "shop", Service: "web", Container: "shop-web-1"}) {
+		t.Error("scope granted more than the policy")
+	}
+	// 没有策略时同样受范围限制
+	var none *Policy
+	if none.Allowed(Subject{User: "bob", Scope: scope}, ActionTerminal, api) || !none.Allowed(Subject{User: "bob", Scope: scope}, ActionList, api) {
+		t.Error("scope not applied without a policy")
+	}
+
+	for _, invalid := range []Scope{{}, {Actions: []Action{"root"}}, {Actions: []Action{ActionList}, Projects: []string{"["}}} {
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("expected error for %+v", invalid)
+		}
+	}
+}
+
+func TestNilPolicy(t *testing.T) {
+	var policy *Policy
+	if !policy.Allowed(Subject{}, ActionTerminal, Resource{}) || len(policy.AllowedActions(Subject{}, Resource{})) != len(Actions) {
+		t.Error("nil policy should allow everything")
+	}
+}
+
+func TestLoadPolicyInvalid(t *testing.T) {
+	for _, content := range []string{
+		"bindings:\n  - users: [bob]\n    role: root\n",
+		"bindings:\n  - role: admin\n",
+		"bindings:\n  - groups: [\"[\"]\n    role: admin\n",
+		"bindings:\n  - users: [bob]\n    role: admin\n    services: [\"[\"]\n",
+		"default_role: superuser\n",
+		"bindings:\n  - users: [bob]\n    role: admin\n    hosts: [a]\n",
+	} {
+		if _, err := loadTestPolicy(t, content); err == nil {
+			t.Errorf("expected error for %q", content)
+		}
+	}
+}
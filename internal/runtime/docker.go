@@ -0,0 +1,185 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/YooLeon/container-debug-online/internal/config"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/tlsconfig"
+)
+
+// dockerRuntime 直接使用 Docker 客户端实现 Runtime
+type dockerRuntime struct {
+	*client.Client
+}
+
+var _ Runtime = (*dockerRuntime)(nil)
+
+// NewDocker 创建 Docker 运行时
+func NewDocker(host config.HostConfig) (Runtime, error) {
+	cli, err := newClient(host)
+	if err != nil {
+		return nil, err
+	}
+	return &dockerRuntime{Client: cli}, nil
+}
+
+func (d *dockerRuntime) Name() string {
+	return Docker
+}
+
+// newClient 根据主机配置创建 Docker API 客户端
+func newClient(host config.HostConfig) (*client.Client, error) {
+	var opts []client.Opt
+
+	switch {
+	case host.Host == "":
+		// 使用 DOCKER_HOST 等环境变量
+		opts = append(opts, client.FromEnv)
+	case strings.HasPrefix(host.Host, "ssh://"):
+		dialer, err := newSSHDialer(host, remoteCommand(host))
+		if err != nil {
+			return nil, err
+		}
+		// 主机名仅用于构造请求 URL，实际连接通过 ssh 转发
+		opts = append(opts,
+			client.WithHost("http://docker.example.com"),
+			client.WithDialContext(dialer))
+	case host.TLS != nil:
+		httpClient, err := newTLSHTTPClient(host.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("host %s: %v", host.Name, err)
+		}
+		// WithHost 需要在 WithHTTPClient 之后应用，以配置新的 Transport
+		opts = append(opts, client.WithHTTPClient(httpClient), client.WithHost(host.Host))
+	default:
+		opts = append(opts, client.WithHost(host.Host))
+	}
+	opts = append(opts, client.WithAPIVersionNegotiation())
+
+	cli, err := client.NewClientWithOpts(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("host %s: %v", host.Name, err)
+	}
+	return cli, nil
+}
+
+func newTLSHTTPClient(cfg *config.TLSConfig) (*http.Client, error) {
+	tlsConfig, err := tlsconfig.Client(tlsconfig.Options{
+		CAFile:             cfg.CA,
+		CertFile:           cfg.Cert,
+		KeyFile:            cfg.Key,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+		ExclusiveRootPools: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS config: %v", err)
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		// 与 Docker 客户端默认行为一致，重定向视为错误
+		CheckRedirect: client.CheckRedirect,
+	}, nil
+}
+
+// remoteCommand 返回远程主机上用于转发 API 连接的命令
+func remoteCommand(host config.HostConfig) string {
+	if host.Runtime == Podman {
+		return "podman"
+	}
+	return "docker"
+}
+
+// newSSHDialer 返回通过 `ssh ... <command> system dial-stdio` 连接远程引擎的拨号函数
+func newSSHDialer(host config.HostConfig, command string) (func(ctx context.Context, network, addr string) (net.Conn, error), error) {
+	u, err := url.Parse(host.Host)
+	if err != nil {
+		return nil, fmt.Errorf("host %s: invalid ssh url: %v", host.Name, err)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("host %s: ssh url has no hostname", host.Name)
+	}
+
+	args := []string{"-o", "BatchMode=yes"}
+	if u.User != nil {
+		args = append(args, "-l", u.User.Username())
+	}
+	if u.Port() != "" {
+		args = append(args, "-p", u.Port())
+	}
+	if host.SSHIdentity != "" {
+		args = append(args, "-i", host.SSHIdentity)
+	}
+	args = append(args, "--", u.Hostname(), command, "system", "dial-stdio")
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return newCommandConn(ctx, "ssh", args...)
+	}, nil
+}
+
+// commandConn 将子进程的标准输入输出包装为 net.Conn
+type commandConn struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+}
+
+func newCommandConn(ctx context.Context, name string, args ...string) (net.Conn, error) {
+	// 连接的生命周期长于拨号上下文，不使用 CommandContext
+	cmd := exec.Command(name, args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %v", name, err)
+	}
+	if err := ctx.Err(); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, err
+	}
+	return &commandConn{cmd: cmd, stdin: stdin, stdout: stdout}, nil
+}
+
+func (c *commandConn) Read(p []byte) (int, error)  { return c.stdout.Read(p) }
+func (c *commandConn) Write(p []byte) (int, error) { return c.stdin.Write(p) }
+
+// CloseWrite 关闭写端，供 hijack 连接半关闭使用
+func (c *commandConn) CloseWrite() error {
+	return c.stdin.Close()
+}
+
+func (c *commandConn) Close() error {
+	c.stdin.Close()
+	if c.cmd.Process != nil {
+		c.cmd.Process.Kill()
+	}
+	c.cmd.Wait()
+	return nil
+}
+
+func (c *commandConn) LocalAddr() net.Addr  { return commandAddr{} }
+func (c *commandConn) RemoteAddr() net.Addr { return commandAddr{} }
+
+func (c *commandConn) SetDeadline(t time.Time) error      { return nil }
+func (c *commandConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *commandConn) SetWriteDeadline(t time.Time) error { return nil }
+
+type commandAddr struct{}
+
+func (commandAddr) Network() string { return "command" }
+func (commandAddr) String() string  { return "command" }
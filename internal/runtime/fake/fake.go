@@ -0,0 +1,527 @@
+// Package fake 提供内存中的容器运行时，用于在没有 dockerd 的情况下测试
+package fake
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/YooLeon/container-debug-online/internal/runtime"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/go-connections/nat"
+)
+
+// LogLine 表示容器输出的一行日志
+type LogLine struct {
+	Time   time.Time
+	Stream string // stdout 或 stderr
+	Text   string // 不含换行符
+}
+
+// Container 描述一个可编排的假容器
+type Container struct {
+	ID           string
+	Name         string
+	Project      string
+	Service      string
+	State        string // running, exited ...
+	Tty          bool
+	Labels       map[string]string
+	ExitCode     int
+	RestartCount int
+	OOMKilled    bool
+	StartedAt    time.Time
+	FinishedAt   time.Time
+	IPAddress    string
+	ExposedPorts []string // 例如 "8080/tcp"
+	Health       *types.Health
+	Logs         []LogLine
+}
+
+// Exec 记录一次 exec 会话
+type Exec struct {
+	ID          string
+	ContainerID string
+	Config      types.ExecConfig
+	Resizes     []types.ResizeOptions
+}
+
+// Runtime 是 runtime.Runtime 的内存实现
+// 容器的日志按 Tty 选择原始或多路复用格式，exec 会话回显输入
+type Runtime struct {
+	mu          sync.Mutex
+	containers  map[string]*Container
+	followers   map[string][]chan LogLine // key: containerID
+	execs       map[string]*Exec
+	subscribers []chan events.Message
+	nextExec    int
+	closed      bool
+}
+
+var _ runtime.Runtime = (*Runtime)(nil)
+
+// New 创建空的假运行时
+func New() *Runtime {
+	return &Runtime{
+		containers: make(map[string]*Container),
+		followers:  make(map[string][]chan LogLine),
+		execs:      make(map[string]*Exec),
+	}
+}
+
+// AddContainer 添加或替换容器
+func (r *Runtime) AddContainer(c Container) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if c.State == "" {
+		c.State = "running"
+	}
+	labels := make(map[string]string)
+	for k, v := range c.Labels {
+		labels[k] = v
+	}
+	if c.Project != "" {
+		labels["com.docker.compose.project"] = c.Project
+	}
+	if c.Service != "" {
+		labels["com.docker.compose.service"] = c.Service
+	}
+	c.Labels = labels
+	r.containers[c.ID] = &c
+}
+
+// RemoveContainer 删除容器，正在跟随的日志流会结束
+func (r *Runtime) RemoveContainer(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.containers, id)
+	for _, ch := range r.followers[id] {
+		close(ch)
+	}
+	delete(r.followers, id)
+}
+
+// SetState 修改容器状态
+func (r *Runtime) SetState(id, state string, exitCode int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if c, ok := r.containers[id]; ok {
+		c.State = state
+		c.ExitCode = exitCode
+		if state != "running" {
+			c.FinishedAt = time.Now()
+		}
+	}
+}
+
+// AppendLog 追加日志并推送给正在跟随的日志流
+func (r *Runtime) AppendLog(id string, line LogLine) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, ok := r.containers[id]
+	if !ok {
+		return
+	}
+	if line.Time.IsZero() {
+		line.Time = time.Now()
+	}
+	if line.Stream == "" {
+		line.Stream = "stdout"
+	}
+	c.Logs = append(c.Logs, line)
+	for _, ch := range r.followers[id] {
+		select {
+		case ch <- line:
+		default:
+		}
+	}
+}
+
+// Emit 向所有事件订阅者发送事件
+func (r *Runtime) Emit(msg events.Message) {
+	r.mu.Lock()
+	subscribers := append([]chan events.Message(nil), r.subscribers...)
+	r.mu.Unlock()
+
+	for _, ch := range subscribers {
+		ch <- msg
+	}
+}
+
+// Execs 返回已创建的 exec 会话
+func (r *Runtime) Execs() []Exec {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	execs := make([]Exec, 0, len(r.execs))
+	for _, exec := range r.execs {
+		copied := *exec
+		copied.Resizes = append([]types.ResizeOptions(nil), exec.Resizes...)
+		execs = append(execs, copied)
+	}
+	sort.Slice(execs, func(i, j int) bool { return execs[i].ID < execs[j].ID })
+	return execs
+}
+
+func (r *Runtime) Name() string {
+	return "fake"
+}
+
+func (r *Runtime) ContainerList(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	list := make([]types.Container, 0, len(r.containers))
+	for _, c := range r.containers {
+		if !options.All && c.State != "running" {
+			continue
+		}
+		if !matchLabels(c.Labels, options.Filters.Get("label")) {
+			continue
+		}
+		list = append(list, types.Container{
+			ID:     c.ID,
+			Names:  []string{"/" + c.Name},
+			State:  c.State,
+			Status: c.State,
+			Labels: c.Labels,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+// matchLabels 判断容器标签是否满足 label 过滤条件，条件为 key 或 key=value
+func matchLabels(labels map[string]string, conditions []string) bool {
+	for _, condition := range conditions {
+		key, value, hasValue := strings.Cut(condition, "=")
+		actual, ok := labels[key]
+		if !ok || (hasValue && actual != value) {
+			return false
+		}
+	}
+	return true
+}
+
+// find 按 ID、ID 前缀或名称查找容器，调用方需持有锁
+func (r *Runtime) find(ref string) (*Container, error) {
+	if c, ok := r.containers[ref]; ok {
+		return c, nil
+	}
+	for _, c := range r.containers {
+		if c.Name == ref || (len(ref) >= 4 && strings.HasPrefix(c.ID, ref)) {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("Error: No such container: %s", ref)
+}
+
+func (r *Runtime) ContainerInspect(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, err := r.find(containerID)
+	if err != nil {
+		return types.ContainerJSON{}, err
+	}
+
+	exposed := nat.PortSet{}
+	for _, port := range c.ExposedPorts {
+		exposed[nat.Port(port)] = struct{}{}
+	}
+
+	return types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:           c.ID,
+			Name:         "/" + c.Name,
+			RestartCount: c.RestartCount,
+			State: &types.ContainerState{
+				Status:     c.State,
+				Running:    c.State == "running",
+				OOMKilled:  c.OOMKilled,
+				ExitCode:   c.ExitCode,
+				StartedAt:  formatTime(c.StartedAt),
+				FinishedAt: formatTime(c.FinishedAt),
+				Health:     c.Health,
+			},
+		},
+		Config: &container.Config{
+			Tty:          c.Tty,
+			Labels:       c.Labels,
+			ExposedPorts: exposed,
+		},
+		NetworkSettings: &types.NetworkSettings{
+			DefaultNetworkSettings: types.DefaultNetworkSettings{IPAddress: c.IPAddress},
+			Networks:               map[string]*network.EndpointSettings{},
+		},
+	}, nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "0001-01-01T00:00:00Z"
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+func (r *Runtime) ContainerLogs(ctx context.Context, containerID string, options types.ContainerLogsOptions) (io.ReadCloser, error) {
+	since, err := parseTime(options.Since)
+	if err != nil {
+		return nil, err
+	}
+	until, err := parseTime(options.Until)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	c, err := r.find(containerID)
+	if err != nil {
+		r.mu.Unlock()
+		return nil, err
+	}
+
+	var lines []LogLine
+	for _, line := range c.Logs {
+		if !since.IsZero() && line.Time.Before(since) {
+			continue
+		}
+		if !until.IsZero() && line.Time.After(until) {
+			continue
+		}
+		if !wantStream(options, line.Stream) {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if options.Tail != "" && options.Tail != "all" {
+		if n, err := strconv.Atoi(options.Tail); err == nil && n < len(lines) {
+			lines = lines[len(lines)-n:]
+		}
+	}
+
+	var follow chan LogLine
+	if options.Follow {
+		follow = make(chan LogLine, 1024)
+		r.followers[c.ID] = append(r.followers[c.ID], follow)
+	}
+	tty := c.Tty
+	id := c.ID
+	r.mu.Unlock()
+
+	pr, pw := io.Pipe()
+	go func() {
+		defer r.unfollow(id, follow)
+
+		for _, line := range lines {
+			if err := writeLog(pw, line, tty, options.Timestamps); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		if follow == nil {
+			pw.Close()
+			return
+		}
+		for {
+			select {
+			case line, ok := <-follow:
+				if !ok {
+					pw.Close()
+					return
+				}
+				if !wantStream(options, line.Stream) {
+					continue
+				}
+				if err := writeLog(pw, line, tty, options.Timestamps); err != nil {
+					pw.CloseWithError(err)
+					return
+				}
+			case <-ctx.Done():
+				pw.CloseWithError(ctx.Err())
+				return
+			}
+		}
+	}()
+
+	return pr, nil
+}
+
+func (r *Runtime) unfollow(id string, follow chan LogLine) {
+	if follow == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	followers := r.followers[id]
+	for i, ch := range followers {
+		if ch == follow {
+			r.followers[id] = append(followers[:i], followers[i+1:]...)
+			break
+		}
+	}
+}
+
+func wantStream(options types.ContainerLogsOptions, stream string) bool {
+	if stream == "stderr" {
+		return options.ShowStderr
+	}
+	return options.ShowStdout
+}
+
+// writeLog 按 Docker 的格式写出一行日志：TTY 为原始输出，否则带 8 字节头的多路复用帧
+func writeLog(w io.Writer, line LogLine, tty, timestamps bool) error {
+	text := line.Text + "\n"
+	if timestamps {
+		text = line.Time.UTC().Format(time.RFC3339Nano) + " " + text
+	}
+	if tty {
+		_, err := io.WriteString(w, text)
+		return err
+	}
+
+	stream := stdcopy.Stdout
+	if line.Stream == "stderr" {
+		stream = stdcopy.Stderr
+	}
+	_, err := stdcopy.NewStdWriter(w, stream).Write([]byte(text))
+	return err
+}
+
+// parseTime 解析 Docker 日志接口的时间参数：Unix 时间戳、RFC3339 或相对时长
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Unix(0, int64(seconds*float64(time.Second))), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time value: %s", value)
+}
+
+func (r *Runtime) ContainerExecCreate(ctx context.Context, containerID string, config types.ExecConfig) (types.IDResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, err := r.find(containerID)
+	if err != nil {
+		return types.IDResponse{}, err
+	}
+	if c.State != "running" {
+		return types.IDResponse{}, fmt.Errorf("Container %s is not running", c.ID)
+	}
+
+	r.nextExec++
+	id := fmt.Sprintf("exec-%d", r.nextExec)
+	r.execs[id] = &Exec{ID: id, ContainerID: c.ID, Config: config}
+	return types.IDResponse{ID: id}, nil
+}
+
+// ContainerExecAttach 返回一个回显输入的会话
+func (r *Runtime) ContainerExecAttach(ctx context.Context, execID string, config types.ExecStartCheck) (types.HijackedResponse, error) {
+	r.mu.Lock()
+	exec, ok := r.execs[execID]
+	r.mu.Unlock()
+	if !ok {
+		return types.HijackedResponse{}, fmt.Errorf("No such exec instance: %s", execID)
+	}
+
+	client, server := net.Pipe()
+	go func() {
+		defer server.Close()
+
+		var out io.Writer = server
+		if !exec.Config.Tty {
+			out = stdcopy.NewStdWriter(server, stdcopy.Stdout)
+		}
+		buf := make([]byte, 1024)
+		for {
+			n, err := server.Read(buf)
+			if err != nil {
+				return
+			}
+			if _, err := out.Write(buf[:n]); err != nil {
+				return
+			}
+		}
+	}()
+
+	return types.NewHijackedResponse(client, ""), nil
+}
+
+func (r *Runtime) ContainerExecResize(ctx context.Context, execID string, options types.ResizeOptions) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	exec, ok := r.execs[execID]
+	if !ok {
+		return fmt.Errorf("No such exec instance: %s", execID)
+	}
+	exec.Resizes = append(exec.Resizes, options)
+	return nil
+}
+
+func (r *Runtime) Events(ctx context.Context, options types.EventsOptions) (<-chan events.Message, <-chan error) {
+	messages := make(chan events.Message, 16)
+	errs := make(chan error, 1)
+
+	r.mu.Lock()
+	r.subscribers = append(r.subscribers, messages)
+	r.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		for i, ch := range r.subscribers {
+			if ch == messages {
+				r.subscribers = append(r.subscribers[:i], r.subscribers[i+1:]...)
+				break
+			}
+		}
+		errs <- ctx.Err()
+	}()
+
+	return messages, errs
+}
+
+func (r *Runtime) ContainerStats(ctx context.Context, containerID string, stream bool) (types.ContainerStats, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.find(containerID); err != nil {
+		return types.ContainerStats{}, err
+	}
+	return types.ContainerStats{
+		Body:   io.NopCloser(strings.NewReader("{}\n")),
+		OSType: "linux",
+	}, nil
+}
+
+func (r *Runtime) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	return nil
+}
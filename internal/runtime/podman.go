@@ -0,0 +1,164 @@
+package runtime
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/YooLeon/container-debug-online/internal/config"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/client"
+)
+
+// podman-compose 使用的标签，与 docker compose 标签一一对应
+var podmanComposeLabels = map[string]string{
+	"io.podman.compose.project":       "com.docker.compose.project",
+	"io.podman.compose.service":       "com.docker.compose.service",
+	"io.podman.compose.config-files":  "com.docker.compose.project.config_files",
+	"io.podman.compose.working-dir":   "com.docker.compose.project.working_dir",
+	"io.podman.compose.container-num": "com.docker.compose.container-number",
+}
+
+// Podman 的容器状态与 Docker 不完全一致
+var podmanStates = map[string]string{
+	"configured":  "created",
+	"initialized": "created",
+	"stopped":     "exited",
+	"stopping":    "running",
+}
+
+// podmanRuntime 通过 Podman 的 Docker 兼容接口实现 Runtime，并抹平兼容接口的差异
+type podmanRuntime struct {
+	*client.Client
+}
+
+var _ Runtime = (*podmanRuntime)(nil)
+
+// NewPodman 创建 Podman 运行时，未指定地址时使用默认的 Podman 套接字
+func NewPodman(host config.HostConfig) (Runtime, error) {
+	if host.Host == "" {
+		host.Host = defaultPodmanHost()
+	}
+	cli, err := newClient(host)
+	if err != nil {
+		return nil, err
+	}
+	return &podmanRuntime{Client: cli}, nil
+}
+
+// defaultPodmanHost 返回 Podman 默认的 API 套接字，rootless 模式位于 XDG_RUNTIME_DIR 下
+func defaultPodmanHost() string {
+	if host := os.Getenv("CONTAINER_HOST"); host != "" {
+		return host
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" && os.Geteuid() != 0 {
+		return "unix://" + dir + "/podman/podman.sock"
+	}
+	return "unix:///run/podman/podman.sock"
+}
+
+func (p *podmanRuntime) Name() string {
+	return Podman
+}
+
+func (p *podmanRuntime) ContainerList(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error) {
+	containers, err := p.Client.ContainerList(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	for i := range containers {
+		containers[i].Labels = normalizeLabels(containers[i].Labels)
+		containers[i].State = normalizeState(containers[i].State)
+	}
+	return containers, nil
+}
+
+func (p *podmanRuntime) ContainerInspect(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+	inspect, err := p.Client.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return inspect, err
+	}
+
+	if inspect.Config != nil {
+		inspect.Config.Labels = normalizeLabels(inspect.Config.Labels)
+	}
+	if inspect.ContainerJSONBase != nil && inspect.State != nil {
+		inspect.State.Status = normalizeState(inspect.State.Status)
+		// 未配置健康检查时 Podman 仍返回空的 Health 结构
+		if inspect.State.Health != nil && inspect.State.Health.Status == "" {
+			inspect.State.Health = nil
+		}
+	}
+	return inspect, nil
+}
+
+// ContainerExecResize 在 exec 会话真正启动前调整大小会失败，短暂重试
+func (p *podmanRuntime) ContainerExecResize(ctx context.Context, execID string, options types.ResizeOptions) error {
+	var err error
+	for attempt := 0; attempt < 5; attempt++ {
+		err = p.Client.ContainerExecResize(ctx, execID, options)
+		if err == nil || !strings.Contains(err.Error(), "not running") {
+			return err
+		}
+		select {
+		case <-time.After(100 * time.Millisecond):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return err
+}
+
+// Events 将 Podman 事件的动作名转换为 Docker 的写法
+func (p *podmanRuntime) Events(ctx context.Context, options types.EventsOptions) (<-chan events.Message, <-chan error) {
+	messages, errs := p.Client.Events(ctx, options)
+	normalized := make(chan events.Message)
+
+	go func() {
+		defer close(normalized)
+		for {
+			select {
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				if msg.Action == "died" {
+					msg.Action = "die"
+				}
+				msg.Actor.Attributes = normalizeLabels(msg.Actor.Attributes)
+				select {
+				case normalized <- msg:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return normalized, errs
+}
+
+// normalizeLabels 为 podman-compose 创建的容器补充 docker compose 标签
+func normalizeLabels(labels map[string]string) map[string]string {
+	if labels == nil {
+		return nil
+	}
+	for podmanLabel, dockerLabel := range podmanComposeLabels {
+		if value, ok := labels[podmanLabel]; ok && labels[dockerLabel] == "" {
+			labels[dockerLabel] = value
+		}
+	}
+	return labels
+}
+
+func normalizeState(state string) string {
+	state = strings.ToLower(state)
+	if normalized, ok := podmanStates[state]; ok {
+		return normalized
+	}
+	return state
+}
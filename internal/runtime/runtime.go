@@ -0,0 +1,49 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/YooLeon/container-debug-online/internal/config"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+)
+
+// 支持的容器运行时
+const (
+	Docker = "docker"
+	Podman = "podman"
+)
+
+// Runtime 抽象容器运行时，Monitor 和 Handler 只通过该接口访问容器
+// 方法签名与 Docker 客户端保持一致，Podman 通过其 Docker 兼容接口实现
+type Runtime interface {
+	// Name 返回运行时类型
+	Name() string
+
+	ContainerList(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error)
+	ContainerInspect(ctx context.Context, containerID string) (types.ContainerJSON, error)
+	ContainerLogs(ctx context.Context, containerID string, options types.ContainerLogsOptions) (io.ReadCloser, error)
+
+	ContainerExecCreate(ctx context.Context, containerID string, config types.ExecConfig) (types.IDResponse, error)
+	ContainerExecAttach(ctx context.Context, execID string, config types.ExecStartCheck) (types.HijackedResponse, error)
+	ContainerExecResize(ctx context.Context, execID string, options types.ResizeOptions) error
+
+	Events(ctx context.Context, options types.EventsOptions) (<-chan events.Message, <-chan error)
+	ContainerStats(ctx context.Context, containerID string, stream bool) (types.ContainerStats, error)
+
+	Close() error
+}
+
+// New 根据主机配置创建容器运行时
+func New(host config.HostConfig) (Runtime, error) {
+	switch host.Runtime {
+	case "", Docker:
+		return NewDocker(host)
+	case Podman:
+		return NewPodman(host)
+	default:
+		return nil, fmt.Errorf("host %s: unknown runtime '%s'", host.Name, host.Runtime)
+	}
+}
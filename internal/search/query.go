@@ -0,0 +1,239 @@
+// Package search 解析日志搜索语句并提供用于索引的三元组
+package search
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/YooLeon/container-debug-online/internal/logs"
+)
+
+// fieldToken 匹配字段条件，如 service:api、level>=warn、user.id=42
+var fieldToken = regexp.MustCompile(`^[A-Za-z_@][\w.@-]*(:|!=|>=|<=|=|>|<)`)
+
+// Term 表示一个文本条件，Text 已转为小写，不区分大小写匹配
+type Term struct {
+	Text   string
+	Regexp *regexp.Regexp
+	Negate bool
+}
+
+// Query 表示解析后的搜索语句，所有条件同时满足才算匹配
+type Query struct {
+	Terms      []Term
+	Fields     []logs.FieldFilter
+	Services   []string
+	Streams    []string
+	Containers []string
+}
+
+// Parse 解析搜索语句，条件之间以空格分隔：
+//
+//	timeout            包含该词（不区分大小写）
+//	"connection reset" 包含该短语
+//	/5\d\d/            匹配正则
+//	-health            前缀 - 表示排除
+//	service:api        限定服务，另有 stream:stderr、container:demo-api-1
+//	level>=warn        JSON 日志字段条件，key:value 等同于 key=value
+func Parse(input string) (*Query, error) {
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+
+	query := &Query{}
+	for _, token := range tokens {
+		if token.quoted {
+			query.Terms = append(query.Terms, Term{Text: strings.ToLower(token.text), Negate: token.negate})
+			continue
+		}
+		if token.regexp {
+			re, err := regexp.Compile(token.text)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regexp /%s/: %v", token.text, err)
+			}
+			query.Terms = append(query.Terms, Term{Regexp: re, Negate: token.negate})
+			continue
+		}
+
+		if match := fieldToken.FindStringSubmatch(token.text); match != nil && !token.negate {
+			key := strings.TrimSuffix(match[0], match[1])
+			value := token.text[len(match[0]):]
+			if match[1] == ":" {
+				switch key {
+				case "service":
+					query.Services = append(query.Services, value)
+					continue
+				case "stream":
+					if value != logs.StreamStdout && value != logs.StreamStderr {
+						return nil, fmt.Errorf("invalid stream: %s", value)
+					}
+					query.Streams = append(query.Streams, value)
+					continue
+				case "container":
+					query.Containers = append(query.Containers, value)
+					continue
+				}
+				token.text = key + "=" + value
+			}
+			filter, err := logs.ParseFieldFilter(token.text)
+			if err != nil {
+				return nil, err
+			}
+			query.Fields = append(query.Fields, filter)
+			continue
+		}
+
+		query.Terms = append(query.Terms, Term{Text: strings.ToLower(token.text), Negate: token.negate})
+	}
+
+	if len(query.Terms) == 0 && len(query.Fields) == 0 {
+		return nil, fmt.Errorf("empty query")
+	}
+	return query, nil
+}
+
+type token struct {
+	text   string
+	quoted bool
+	regexp bool
+	negate bool
+}
+
+// tokenize 按空格切分，保留引号内的短语和斜杠内的正则，\" 与 \/ 为转义
+func tokenize(input string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(input) {
+		if input[i] == ' ' || input[i] == '\t' {
+			i++
+			continue
+		}
+
+		var t token
+		if input[i] == '-' && i+1 < len(input) && input[i+1] != ' ' {
+			t.negate = true
+			i++
+		}
+
+		if delim := input[i]; delim == '"' || delim == '/' {
+			var text strings.Builder
+			closed := false
+			for i++; i < len(input); i++ {
+				if input[i] == '\\' && i+1 < len(input) && input[i+1] == delim {
+					text.WriteByte(delim)
+					i++
+					continue
+				}
+				if input[i] == delim {
+					closed = true
+					i++
+					break
+				}
+				text.WriteByte(input[i])
+			}
+			if !closed {
+				return nil, fmt.Errorf("unterminated %c in query", delim)
+			}
+			t.text = text.String()
+			t.quoted = delim == '"'
+			t.regexp = delim == '/'
+			if t.text == "" {
+				continue
+			}
+			tokens = append(tokens, t)
+			continue
+		}
+
+		start := i
+		for i < len(input) && input[i] != ' ' && input[i] != '\t' {
+			i++
+		}
+		t.text = input[start:i]
+		tokens = append(tokens, t)
+	}
+	return tokens, nil
+}
+
+// Match 判断一条日志是否满足所有条件
+func (q *Query) Match(frame *logs.Frame) bool {
+	if len(q.Services) > 0 && !contains(q.Services, frame.Service) {
+		return false
+	}
+	if len(q.Streams) > 0 && !contains(q.Streams, frame.Stream) {
+		return false
+	}
+	if len(q.Containers) > 0 && !contains(q.Containers, frame.Container) && !containsPrefix(q.Containers, frame.ContainerID) {
+		return false
+	}
+
+	lower := strings.ToLower(frame.Line)
+	for _, term := range q.Terms {
+		var found bool
+		if term.Regexp != nil {
+			found = term.Regexp.MatchString(frame.Line)
+		} else {
+			found = strings.Contains(lower, term.Text)
+		}
+		if found == term.Negate {
+			return false
+		}
+	}
+
+	if len(q.Fields) > 0 {
+		entry := frame.Entry()
+		parsed := entry.JSON()
+		for _, filter := range q.Fields {
+			if !filter.Match(parsed) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Trigrams 返回匹配的日志必须包含的三元组，用于通过索引排除分段
+func (q *Query) Trigrams() []uint32 {
+	set := make(map[uint32]struct{})
+	for _, term := range q.Terms {
+		if term.Negate {
+			continue
+		}
+		text := term.Text
+		if term.Regexp != nil {
+			// 正则只使用字面前缀，(?i) 等标志使前缀为空
+			text, _ = term.Regexp.LiteralPrefix()
+		}
+		AddTrigrams(set, text)
+	}
+
+	trigrams := make([]uint32, 0, len(set))
+	for trigram := range set {
+		trigrams = append(trigrams, trigram)
+	}
+	return trigrams
+}
+
+// MatchesService 判断服务是否在搜索范围内
+func (q *Query) MatchesService(service string) bool {
+	return len(q.Services) == 0 || contains(q.Services, service)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsPrefix(prefixes []string, value string) bool {
+	for _, prefix := range prefixes {
+		if len(prefix) >= 4 && strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
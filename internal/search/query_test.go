@@ -0,0 +1,141 @@
+package search
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/YooLeon/container-debug-online/internal/logs"
+)
+
+func TestParse(t *testing.T) {
+	query, err := Parse(`timeout "connection reset" /5\d\d/ -health service:api stream:stderr container:demo-api-1 level>=warn user.id:42`)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	if len(query.Terms) != 4 {
+		t.Fatalf("terms = %+v", query.Terms)
+	}
+	if query.Terms[0].Text != "timeout" || query.Terms[1].Text != "connection reset" {
+		t.Errorf("text terms = %+v", query.Terms[:2])
+	}
+	if query.Terms[2].Regexp == nil || query.Terms[2].Regexp.String() != `5\d\d` {
+		t.Errorf("regexp term = %+v", query.Terms[2])
+	}
+	if !query.Terms[3].Negate || query.Terms[3].Text != "health" {
+		t.Errorf("negated term = %+v", query.Terms[3])
+	}
+	if len(query.Services) != 1 || query.Services[0] != "api" ||
+		len(query.Streams) != 1 || query.Streams[0] != "stderr" ||
+		len(query.Containers) != 1 || query.Containers[0] != "demo-api-1" {
+		t.Errorf("scopes = %v %v %v", query.Services, query.Streams, query.Containers)
+	}
+
+	want := []logs.FieldFilter{
+		{Key: "level", Operator: ">=", Value: "warn"},
+		{Key: "user.id", Operator: "=", Value: "42"},
+	}
+	if len(query.Fields) != len(want) {
+		t.Fatalf("fields = %+v", query.Fields)
+	}
+	for i, filter := range want {
+		if query.Fields[i] != filter {
+			t.Errorf("field %d = %+v, want %+v", i, query.Fields[i], filter)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, input := range []string{"", "   ", `"unterminated`, "/bad(/", "stream:stdin", "level>=loud", "service:api"} {
+		if _, err := Parse(input); err == nil {
+			t.Errorf("Parse(%q) succeeded", input)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	api := logs.Frame{Service: "api", Stream: "stdout", Container: "demo-api-1", ContainerID: "a1a1a1a1a1a1"}
+
+	tests := []struct {
+		query string
+		line  string
+		want  bool
+	}{
+		{"timeout", "Request TIMEOUT after 5s", true},
+		{"timeout", "request finished", false},
+		{`"connection reset"`, "read: connection reset by peer", true},
+		{`"connection reset"`, "connection was reset", false},
+		{`/status=5\d\d/`, "GET /users status=503", true},
+		{`/status=5\d\d/`, "GET /users status=200", false},
+		{"GET -health", "GET /health", false},
+		{"GET -health", "GET /users", true},
+		{"GET service:api", "GET /users", true},
+		{"GET service:worker", "GET /users", false},
+		{"GET stream:stderr", "GET /users", false},
+		{"GET container:a1a1", "GET /users", true},
+		{"level>=warn", `{"level":"error","msg":"db down"}`, true},
+		{"level>=warn", `{"level":"info","msg":"ok"}`, false},
+		{"level>=warn", "plain error", false},
+		{"down user.id:42", `{"msg":"db down","user":{"id":42}}`, true},
+	}
+
+	for _, tt := range tests {
+		query, err := Parse(tt.query)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.query, err)
+		}
+		frame := api
+		frame.Line = tt.line
+		if got := query.Match(&frame); got != tt.want {
+			t.Errorf("%q matching %q = %v, want %v", tt.query, tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestTrigrams(t *testing.T) {
+	query, err := Parse(`Timeout -health /conn\w+/ ab`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[uint32]struct{})
+	for _, trigram := range query.Trigrams() {
+		got[trigram] = struct{}{}
+	}
+	want := make(map[uint32]struct{})
+	AddTrigrams(want, "timeout")
+	AddTrigrams(want, "conn")
+	if len(got) != len(want) {
+		t.Fatalf("got %d trigrams, want %d", len(got), len(want))
+	}
+	for trigram := range want {
+		if _, ok := got[trigram]; !ok {
+			t.Errorf("missing trigram %06x", trigram)
+		}
+	}
+}
+
+func TestTrigramsRoundTrip(t *testing.T) {
+	set := make(map[uint32]struct{})
+	AddTrigrams(set, "connection reset by peer")
+
+	var buf bytes.Buffer
+	if err := WriteTrigrams(&buf, set); err != nil {
+		t.Fatal(err)
+	}
+	trigrams, err := ReadTrigrams(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trigrams) != len(set) {
+		t.Fatalf("read %d trigrams, want %d", len(trigrams), len(set))
+	}
+	for i, trigram := range trigrams {
+		if _, ok := set[trigram]; !ok {
+			t.Errorf("unexpected trigram %06x", trigram)
+		}
+		if i > 0 && trigrams[i-1] >= trigram {
+			t.Errorf("trigrams not sorted at %d", i)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package search
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// AddTrigrams 将文本转为小写后的所有三字节组合加入 set，不足三字节的文本不产生三元组
+func AddTrigrams(set map[uint32]struct{}, text string) {
+	text = strings.ToLower(text)
+	for i := 0; i+3 <= len(text); i++ {
+		set[uint32(text[i])<<16|uint32(text[i+1])<<8|uint32(text[i+2])] = struct{}{}
+	}
+}
+
+// WriteTrigrams 按升序写出三元组，每个占 4 字节
+func WriteTrigrams(w io.Writer, set map[uint32]struct{}) error {
+	trigrams := make([]uint32, 0, len(set))
+	for trigram := range set {
+		trigrams = append(trigrams, trigram)
+	}
+	sort.Slice(trigrams, func(i, j int) bool { return trigrams[i] < trigrams[j] })
+
+	writer := bufio.NewWriter(w)
+	var buf [4]byte
+	for _, trigram := range trigrams {
+		binary.LittleEndian.PutUint32(buf[:], trigram)
+		if _, err := writer.Write(buf[:]); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+// ReadTrigrams 读取 WriteTrigrams 写出的三元组
+func ReadTrigrams(r io.Reader) ([]uint32, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data)%4 != 0 {
+		return nil, fmt.Errorf("invalid trigram file size %d", len(data))
+	}
+
+	trigrams := make([]uint32, len(data)/4)
+	for i := range trigrams {
+		trigrams[i] = binary.LittleEndian.Uint32(data[i*4:])
+	}
+	return trigrams, nil
+}
@@ -0,0 +1,222 @@
+// Package tlsutil 提供 HTTPS 服务的 TLS 配置：证书轮换后自动重新加载、客户端证书校验和开发用的自签名证书
+package tlsutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// reloadInterval 握手时最多每隔该时间检查一次证书文件是否变化
+const reloadInterval = 10 * time.Second
+
+// 客户端证书校验方式
+const (
+	ClientAuthRequire  = "require"  // 握手时必须提供有效的客户端证书
+	ClientAuthOptional = "optional" // 提供了客户端证书时才校验，没有证书的请求使用其他认证方式
+)
+
+// Options TLS 配置
+type Options struct {
+	CertFile     string
+	KeyFile      string
+	SelfSigned   bool   // 未指定证书时生成自签名证书，仅用于开发
+	ClientCAFile string // 不为空时启用客户端证书认证
+	ClientAuth   string // require 或 optional
+}
+
+// Enabled 判断是否启用 TLS
+func (o Options) Enabled() bool {
+	return o.CertFile != "" || o.KeyFile != "" || o.SelfSigned
+}
+
+// ServerConfig 创建服务端 TLS 配置，未启用 TLS 时返回 nil
+func ServerConfig(opts Options) (*tls.Config, error) {
+	if !opts.Enabled() {
+		if opts.ClientCAFile != "" {
+			return nil, fmt.Errorf("client certificate authentication requires TLS")
+		}
+		return nil, nil
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	switch {
+	case opts.SelfSigned && (opts.CertFile != "" || opts.KeyFile != ""):
+		return nil, fmt.Errorf("self-signed mode cannot be combined with a certificate file")
+	case opts.SelfSigned:
+		cert, err := SelfSigned()
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	case opts.CertFile == "" || opts.KeyFile == "":
+		return nil, fmt.Errorf("both a certificate and a key file are required")
+	default:
+		reloader, err := NewCertReloader(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.GetCertificate = reloader.GetCertificate
+	}
+
+	if opts.ClientCAFile != "" {
+		data, err := os.ReadFile(opts.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading client CA file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in client CA file %s", opts.ClientCAFile)
+		}
+		config.ClientCAs = pool
+		switch opts.ClientAuth {
+		case ClientAuthRequire, "":
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		case ClientAuthOptional:
+			config.ClientAuth = tls.VerifyClientCertIfGiven
+		default:
+			return nil, fmt.Errorf("unknown client auth mode %q, use %s or %s", opts.ClientAuth, ClientAuthRequire, ClientAuthOptional)
+		}
+	}
+	return config, nil
+}
+
+// CertReloader 在证书或私钥文件变化后重新加载证书，用于证书自动轮换
+// 加载失败（例如新证书和私钥还没有全部写入）时继续使用旧证书
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	certMod   time.Time
+	keyMod    time.Time
+	lastCheck time.Time
+}
+
+// NewCertReloader 加载证书，文件无效时返回错误
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile, interval: reloadInterval}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate 用于 tls.Config.GetCertificate
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if time.Since(r.lastCheck) >= r.interval {
+		r.lastCheck = time.Now()
+		if r.changed() {
+			// 失败时保留旧证书，下次检查时重试
+			r.reload()
+		}
+	}
+	return r.cert, nil
+}
+
+// changed 判断文件的修改时间是否变化，调用方需持有锁
+func (r *CertReloader) changed() bool {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return false
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return false
+	}
+	return !certInfo.ModTime().Equal(r.certMod) || !keyInfo.ModTime().Equal(r.keyMod)
+}
+
+// reload 读取证书和私钥，调用方需持有锁（初始化时除外）
+func (r *CertReloader) reload() error {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return fmt.Errorf("error reading certificate: %v", err)
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return fmt.Errorf("error reading private key: %v", err)
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("error loading certificate: %v", err)
+	}
+	r.cert = &cert
+	r.certMod, r.keyMod = certInfo.ModTime(), keyInfo.ModTime()
+	return nil
+}
+
+// SelfSigned 生成有效期 30 天的自签名证书，包含 localhost、本机主机名和回环地址
+func SelfSigned() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	hosts := []string{"localhost"}
+	if hostname, err := os.Hostname(); err == nil && hostname != "localhost" {
+		hosts = append(hosts, hostname)
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "container-debug-online (development)"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(30 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              hosts,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("error creating self-signed certificate: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// Fingerprint 返回证书的 SHA-256 指纹，用于核对自签名证书
+func Fingerprint(cert tls.Certificate) string {
+	if len(cert.Certificate) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(cert.Certificate[0])
+	return hex.EncodeToString(sum[:])
+}
+
+// ClientIdentity 返回已通过校验的客户端证书对应的用户：CommonName（为空时使用第一个邮箱地址）为用户名，
+// OrganizationalUnit 为组，没有经过校验的证书时返回 false
+func ClientIdentity(state *tls.ConnectionState) (string, []string, bool) {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return "", nil, false
+	}
+	leaf := state.VerifiedChains[0][0]
+	user := leaf.Subject.CommonName
+	if user == "" && len(leaf.EmailAddresses) > 0 {
+		user = leaf.EmailAddresses[0]
+	}
+	if user == "" {
+		return "", nil, false
+	}
+	return user, leaf.Subject.OrganizationalUnit, true
+}
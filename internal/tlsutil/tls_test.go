@@ -0,0 +1,196 @@
+package tlsutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCert 生成由 parent 签发的证书，parent 为 nil 时生成自签名的 CA
+func testCert(t *testing.T, subject pkix.Name, parent *tls.Certificate, usage x509.ExtKeyUsage) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		DNSNames:     []string{"localhost"},
+	}
+	signer, signerKey := template, interface{}(key)
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// writePEM 将证书和私钥写入文件
+func writePEM(t *testing.T, cert tls.Certificate, certFile, keyFile string) {
+	t.Helper()
+	keyDER, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if keyFile != "" {
+		if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	first := testCert(t, pkix.Name{CommonName: "first"}, nil, x509.ExtKeyUsageServerAuth)
+	writePEM(t, first, certFile, keyFile)
+
+	reloader, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloader.interval = 0
+	if cert, _ := reloader.GetCertificate(nil); Fingerprint(*cert) != Fingerprint(first) {
+		t.Fatal("unexpected initial certificate")
+	}
+
+	// 轮换证书
+	second := testCert(t, pkix.Name{CommonName: "second"}, nil, x509.ExtKeyUsageServerAuth)
+	writePEM(t, second, certFile, keyFile)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	os.Chtimes(keyFile, later, later)
+	if cert, _ := reloader.GetCertificate(nil); Fingerprint(*cert) != Fingerprint(second) {
+		t.Error("certificate not reloaded")
+	}
+
+	// 只写入了一半的证书保持旧证书
+	third := testCert(t, pkix.Name{CommonName: "third"}, nil, x509.ExtKeyUsageServerAuth)
+	writePEM(t, third, certFile, "")
+	later = later.Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	if cert, _ := reloader.GetCertificate(nil); Fingerprint(*cert) != Fingerprint(second) {
+		t.Error("mismatched key pair replaced the certificate")
+	}
+
+	if _, err := NewCertReloader(filepath.Join(dir, "missing.crt"), keyFile); err == nil {
+		t.Error("loaded a missing certificate")
+	}
+}
+
+func TestServerConfigInvalid(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writePEM(t, testCert(t, pkix.Name{CommonName: "server"}, nil, x509.ExtKeyUsageServerAuth), certFile, keyFile)
+
+	if config, err := ServerConfig(Options{}); config != nil || err != nil {
+		t.Errorf("disabled TLS = %v, %v", config, err)
+	}
+	for _, opts := range []Options{
+		{ClientCAFile: certFile},
+		{CertFile: certFile},
+		{SelfSigned: true, CertFile: certFile, KeyFile: keyFile},
+		{SelfSigned: true, ClientCAFile: certFile, ClientAuth: "sometimes"},
+		{SelfSigned: true, ClientCAFile: keyFile},
+	} {
+		if _, err := ServerConfig(opts); err == nil {
+			t.Errorf("expected error for %+v", opts)
+		}
+	}
+}
+
+func TestClientCertificates(t *testing.T) {
+	dir := t.TempDir()
+	ca := testCert(t, pkix.Name{CommonName: "test ca"}, nil, x509.ExtKeyUsageClientAuth)
+	caFile := filepath.Join(dir, "ca.crt")
+	writePEM(t, ca, caFile, "")
+	client := testCert(t, pkix.Name{CommonName: "alice", OrganizationalUnit: []string{"platform"}}, &ca, x509.ExtKeyUsageClientAuth)
+	// 不受信任的 CA 签发的证书
+	rogueCA := testCert(t, pkix.Name{CommonName: "rogue ca"}, nil, x509.ExtKeyUsageClientAuth)
+	rogue := testCert(t, pkix.Name{CommonName: "mallory"}, &rogueCA, x509.ExtKeyUsageClientAuth)
+
+	for _, mode := range []string{ClientAuthOptional, ClientAuthRequire} {
+		t.Run(mode, func(t *testing.T) {
+			config, err := ServerConfig(Options{SelfSigned: true, ClientCAFile: caFile, ClientAuth: mode})
+			if err != nil {
+				t.Fatal(err)
+			}
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				user, groups, ok := ClientIdentity(r.TLS)
+				fmt.Fprintf(w, "%s %v %v", user, groups, ok)
+			}))
+			server.TLS = config
+			server.Config.ErrorLog = log.New(io.Discard, "", 0)
+			server.StartTLS()
+			defer server.Close()
+
+			// 即使服务端要求的 CA 不匹配也发送证书
+			get := func(cert *tls.Certificate) (string, error) {
+				httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: true,
+					GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+						if cert == nil {
+							return &tls.Certificate{}, nil
+						}
+						return cert, nil
+					},
+				}}}
+				resp, err := httpClient.Get(server.URL)
+				if err != nil {
+					return "", err
+				}
+				defer resp.Body.Close()
+				body, err := io.ReadAll(resp.Body)
+				return string(body), err
+			}
+
+			if body, err := get(&client); err != nil || body != "alice [platform] true" {
+				t.Errorf("client certificate: %q, %v", body, err)
+			}
+			if _, err := get(&rogue); err == nil {
+				t.Error("accepted certificate from an untrusted CA")
+			}
+			body, err := get(nil)
+			if mode == ClientAuthOptional && (err != nil || !strings.HasSuffix(body, "false")) {
+				t.Errorf("no certificate: %q, %v", body, err)
+			}
+			if mode == ClientAuthRequire && err == nil {
+				t.Error("required client certificate was not enforced")
+			}
+		})
+	}
+}
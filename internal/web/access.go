@@ -0,0 +1,100 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/YooLeon/container-debug-online/internal/auth"
+	"github.com/YooLeon/container-debug-online/internal/rbac"
+	"github.com/docker/docker/api/types"
+	"go.uber.org/zap"
+)
+
+// WithPolicy 启用基于角色的权限控制，未设置时所有用户拥有全部权限
+func WithPolicy(policy *rbac.Policy) Option {
+	return func(h *Handler) {
+		h.policy = policy
+	}
+}
+
+// serviceResource 返回主机上 compose 服务的权限资源，container 为空时表示服务级数据
+// project 为主机的 compose 项目，由调用方通过 host.monitor.Project() 获取：Project 会获取状态锁，持有状态锁时不能调用
+func serviceResource(project, service, container string) rbac.Resource {
+	return rbac.Resource{Project: project, Service: service, Container: container}
+}
+
+// containerResource 返回容器的权限资源，项目和服务只取自容器的 compose 标签
+// 没有标签的独立容器不属于主机的 compose 项目，限定项目或服务的绑定不能覆盖
+func containerResource(name string, labels map[string]string) rbac.Resource {
+	return rbac.Resource{
+		Project:   labels["com.docker.compose.project"],
+		Service:   labels["com.docker.compose.service"],
+		Container: name,
+	}
+}
+
+// inspectResource 返回 inspect 结果中容器的权限资源
+func inspectResource(inspect types.ContainerJSON) rbac.Resource {
+	return containerResource(strings.TrimPrefix(inspect.Name, "/"), inspect.Config.Labels)
+}
+
+// serviceContainerName 推断未运行服务的容器名：compose 文件中的 container_name，否则按 compose 的命名规则
+func (host *hostHandle) serviceContainerName(service, project string) string {
+	if name := host.monitor.GetComposeConfig().Services[service].Container_name; name != "" {
+		return name
+	}
+	if project == "" {
+		return ""
+	}
+	return project + "-" + service + "-1"
+}
+
+// subject 返回请求的用户，使用 API 令牌时附带令牌的范围
+func subject(r *http.Request) rbac.Subject {
+	s := rbac.Subject{User: auth.UserFromContext(r.Context()), Groups: auth.GroupsFromContext(r.Context())}
+	if token := auth.TokenFromContext(r.Context()); token != nil {
+		s.Scope = &token.Scope
+	}
+	return s
+}
+
+// allowed 判断请求的用户能否对资源执行操作
+func (h *Handler) allowed(r *http.Request, action rbac.Action, resource rbac.Resource) bool {
+	return h.policy.Allowed(subject(r), action, resource)
+}
+
+// forbidden 记录并拒绝没有权限的请求
+func (h *Handler) forbidden(w http.ResponseWriter, r *http.Request, action rbac.Action) {
+	h.logger.Warn("Permission denied",
+		zap.String("user", auth.UserFromContext(r.Context())),
+		zap.String("action", string(action)),
+		zap.String("path", r.URL.Path))
+	http.Error(w, "Forbidden", http.StatusForbidden)
+}
+
+// authorizeAny 检查用户是否对至少一部分资源有该操作的权限，具体数据由调用方再按资源过滤
+func (h *Handler) authorizeAny(w http.ResponseWriter, r *http.Request, action rbac.Action) bool {
+	if !h.policy.AllowedAny(subject(r), action) {
+		h.forbidden(w, r, action)
+		return false
+	}
+	return true
+}
+
+// authorizeGlobal 检查用户是否不受范围限制地拥有该操作的权限，用于不属于某个项目的全局数据
+func (h *Handler) authorizeGlobal(w http.ResponseWriter, r *http.Request, action rbac.Action) bool {
+	if !h.policy.AllowedGlobal(subject(r), action) {
+		h.forbidden(w, r, action)
+		return false
+	}
+	return true
+}
+
+// authorizeContainer 检查用户对容器的权限，没有权限时写入错误响应
+func (h *Handler) authorizeContainer(w http.ResponseWriter, r *http.Request, inspect types.ContainerJSON, action rbac.Action) bool {
+	if !h.allowed(r, action, inspectResource(inspect)) {
+		h.forbidden(w, r, action)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,160 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/YooLeon/container-debug-online/internal/audit"
+	"github.com/YooLeon/container-debug-online/internal/logs"
+	"github.com/YooLeon/container-debug-online/internal/rbac"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+// aggregateWindow 聚合日志的重排窗口，用于等待其他服务中时间更早的日志
+const aggregateWindow = 500 * time.Millisecond
+
+// AggregateLogsHandler 同时跟随多个服务或容器的日志，按时间戳合并后通过 WebSocket 发送
+// services 和 containers 为逗号分隔的列表，都未指定时跟随 compose 文件中的所有服务
+func (h *Handler) AggregateLogsHandler(w http.ResponseWriter, r *http.Request) {
+	w, record := h.audit(w, r, audit.ActionLogsStream)
+	defer record.finish()
+
+	host, ok := h.hostFor(w, r)
+	if !ok {
+		return
+	}
+	record.host(host)
+	if !h.authorizeAny(w, r, rbac.ActionLogs) {
+		return
+	}
+
+	logOptions, err := logs.ParseOptions(r.URL.Query(), "100")
+	if err == nil && logOptions.Format == logs.FormatCSV {
+		err = fmt.Errorf("csv format is only available for downloads")
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	targets, resource, ok := h.logTargets(w, r, host, rbac.ActionLogs)
+	if !ok {
+		return
+	}
+
+	ws, done, ok := h.upgrade(w, r, "aggregate")
+	if !ok {
+		return
+	}
+	defer done()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	// 客户端断开时停止跟随
+	go func() {
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				cancel()
+				return
+			}
+		}
+	}()
+
+	for frame := range logs.Aggregate(ctx, host.monitor.Runtime(), targets, logOptions, aggregateWindow, h.logger) {
+		// 跳过没有权限的容器
+		if !h.allowed(r, rbac.ActionLogs, resource(frame)) {
+			continue
+		}
+		if logOptions.Format == logs.FormatJSON {
+			err = ws.WriteJSON(frame)
+		} else {
+			err = ws.WriteMessage(websocket.TextMessage, []byte(frame.Service+" | "+frame.Entry().Text()))
+		}
+		if err != nil {
+			h.logger.Error("Error sending log message", zap.Error(err))
+			return
+		}
+	}
+
+	ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+}
+
+// logTargets 将请求中的服务名（services）和容器引用（containers）转换为日志来源
+// 指定的容器需要有 action 权限，否则写入 403 并返回 false；服务中没有权限的容器由调用方逐条跳过
+// resource 返回每条日志对应的权限资源：指定的容器按其标签，服务的容器按主机的 compose 项目
+func (h *Handler) logTargets(w http.ResponseWriter, r *http.Request, host *hostHandle, action rbac.Action) (targets []logs.Target, resource func(logs.Frame) rbac.Resource, ok bool) {
+	services := splitList(r.URL.Query().Get("services"))
+	containers := splitList(r.URL.Query().Get("containers"))
+	composeConfig := host.monitor.GetComposeConfig()
+	if len(services) == 0 && len(containers) == 0 {
+		services = composeConfig.SortedServices
+	}
+
+	targets = make([]logs.Target, 0, len(services)+len(containers))
+	for _, service := range services {
+		if _, ok := composeConfig.Services[service]; !ok {
+			http.Error(w, "unknown service: "+service, http.StatusBadRequest)
+			return nil, nil, false
+		}
+		targets = append(targets, logs.ServiceTarget(host.monitor, service))
+	}
+
+	rt := host.monitor.Runtime()
+	resources := make(map[string]rbac.Resource) // key: 指定的容器名
+	for _, ref := range containers {
+		inspect, err := rt.ContainerInspect(r.Context(), ref)
+		if err != nil {
+			http.Error(w, "unknown container: "+ref, http.StatusBadRequest)
+			return nil, nil, false
+		}
+		if !h.authorizeContainer(w, r, inspect, action) {
+			return nil, nil, false
+		}
+		name := strings.TrimPrefix(inspect.Name, "/")
+		resources[name] = inspectResource(inspect)
+		service := inspect.Config.Labels["com.docker.compose.service"]
+		if service == "" {
+			service = name
+		}
+
+		// 按名称跟随，compose 重建的容器保留原名称
+		targets = append(targets, logs.Target{
+			Service: service,
+			Resolve: func(ctx context.Context) string {
+				inspect, err := rt.ContainerInspect(ctx, name)
+				if err != nil {
+					return ""
+				}
+				return inspect.ID
+			},
+			Matches: func(attributes map[string]string) bool {
+				return attributes["name"] == name
+			},
+		})
+	}
+
+	project := host.monitor.Project()
+	resource = func(frame logs.Frame) rbac.Resource {
+		if res, ok := resources[frame.Container]; ok {
+			return res
+		}
+		return serviceResource(project, frame.Service, frame.Container)
+	}
+	return targets, resource, true
+}
+
+// splitList 拆分逗号分隔的参数
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
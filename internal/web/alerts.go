@@ -0,0 +1,119 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/YooLeon/container-debug-online/internal/alert"
+	"github.com/YooLeon/container-debug-online/internal/audit"
+	"github.com/YooLeon/container-debug-online/internal/rbac"
+	"github.com/gorilla/mux"
+)
+
+// AlertsHandler 返回当前的告警列表
+func (h *Handler) AlertsHandler(w http.ResponseWriter, r *http.Request) {
+	if h.alerts == nil {
+		http.Error(w, "Alerting is not enabled", http.StatusNotFound)
+		return
+	}
+	if !h.authorizeAny(w, r, rbac.ActionList) {
+		return
+	}
+
+	alerts := h.alerts.Alerts()
+	visible := alerts[:0]
+	for _, a := range alerts {
+		if host, ok := h.hosts[a.Host]; ok && !h.allowed(r, rbac.ActionList, serviceResource(host.monitor.Project(), a.Service, "")) {
+			continue
+		}
+		visible = append(visible, a)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(visible)
+}
+
+// SilencesHandler 查询或创建告警静默
+func (h *Handler) SilencesHandler(w http.ResponseWriter, r *http.Request) {
+	if h.alerts == nil {
+		http.Error(w, "Alerting is not enabled", http.StatusNotFound)
+		return
+	}
+
+	// 只审计创建，静默可能作用于所有项目，创建需要不限范围的 admin 权限
+	authorize, action := h.authorizeAny, rbac.ActionList
+	var record *auditRecord
+	if r.Method == http.MethodPost {
+		authorize, action = h.authorizeGlobal, rbac.ActionAdmin
+		w, record = h.audit(w, r, audit.ActionSilenceCreate)
+		defer record.finish()
+	}
+	if !authorize(w, r, action) {
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(h.alerts.Silences())
+		return
+	}
+
+	var req struct {
+		alert.Silence
+		Duration string `json:"duration"` // 可替代 end，例如 "2h"
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid silence: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	silence := req.Silence
+	if req.Duration != "" {
+		duration, err := time.ParseDuration(req.Duration)
+		if err != nil {
+			http.Error(w, "Invalid duration: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if silence.Start.IsZero() {
+			silence.Start = time.Now()
+		}
+		silence.End = silence.Start.Add(duration)
+	}
+
+	record.param("rule", silence.Rule)
+	record.param("host", silence.Host)
+	record.param("service", silence.Service)
+	record.param("end", silence.End.UTC().Format(time.RFC3339))
+	record.param("comment", silence.Comment)
+	created, err := h.alerts.AddSilence(silence)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	record.set(func(event *audit.Event) { event.Target = created.ID })
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+// DeleteSilenceHandler 删除告警静默，需要不限范围的 admin 权限
+func (h *Handler) DeleteSilenceHandler(w http.ResponseWriter, r *http.Request) {
+	if h.alerts == nil {
+		http.Error(w, "Alerting is not enabled", http.StatusNotFound)
+		return
+	}
+	w, record := h.audit(w, r, audit.ActionSilenceDelete)
+	defer record.finish()
+	record.set(func(event *audit.Event) { event.Target = mux.Vars(r)["id"] })
+	if !h.authorizeGlobal(w, r, rbac.ActionAdmin) {
+		return
+	}
+
+	if !h.alerts.RemoveSilence(mux.Vars(r)["id"]) {
+		http.Error(w, "Silence not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,332 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/YooLeon/container-debug-online/internal/archive"
+	"github.com/YooLeon/container-debug-online/internal/audit"
+	"github.com/YooLeon/container-debug-online/internal/logs"
+	"github.com/YooLeon/container-debug-online/internal/rbac"
+	"github.com/YooLeon/container-debug-online/internal/search"
+	"go.uber.org/zap"
+)
+
+// WithLogArchive 启用日志归档接口，collector 关联到其所归档的主机
+func WithLogArchive(collector *archive.Collector) Option {
+	return func(h *Handler) {
+		if host, ok := h.hosts[collector.Host()]; ok {
+			host.archive = collector
+		}
+	}
+}
+
+// archiveFor 返回启用了日志归档的请求主机，未启用或没有日志权限时写入错误响应
+func (h *Handler) archiveFor(w http.ResponseWriter, r *http.Request) (*hostHandle, bool) {
+	host, ok := h.hostFor(w, r)
+	if !ok {
+		return nil, false
+	}
+	if host.archive == nil {
+		http.Error(w, "Log archive is not enabled", http.StatusNotFound)
+		return nil, false
+	}
+	if !h.authorizeAny(w, r, rbac.ActionLogs) {
+		return nil, false
+	}
+	return host, true
+}
+
+// ArchiveHandler 列出归档分段，可用 service 参数限定服务
+func (h *Handler) ArchiveHandler(w http.ResponseWriter, r *http.Request) {
+	host, ok := h.archiveFor(w, r)
+	if !ok {
+		return
+	}
+	collector := host.archive
+
+	services := splitList(r.URL.Query().Get("service"))
+	if len(services) == 0 {
+		var err error
+		if services, err = collector.Services(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	response := []archive.Segment{}
+	project := host.monitor.Project()
+	for _, service := range services {
+		if !h.allowed(r, rbac.ActionLogs, serviceResource(project, service, "")) {
+			continue
+		}
+		segments, err := collector.Segments(service)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		response = append(response, segments...)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// ArchiveLogsHandler 查询服务的归档日志，容器删除后仍可读取
+// service 必填，其余参数与日志下载相同，download=1 时作为附件返回
+func (h *Handler) ArchiveLogsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	download := query.Get("download") == "1" || query.Get("download") == "true"
+	action, auditAction := rbac.ActionLogs, audit.ActionLogsArchive
+	if download {
+		action, auditAction = rbac.ActionDownload, audit.ActionLogsDownload
+	}
+	w, record := h.audit(w, r, auditAction)
+	defer record.finish()
+
+	host, ok := h.archiveFor(w, r)
+	if !ok {
+		return
+	}
+	record.host(host)
+
+	service := query.Get("service")
+	if service == "" {
+		http.Error(w, "service is required", http.StatusBadRequest)
+		return
+	}
+	project := host.monitor.Project()
+	record.set(func(event *audit.Event) {
+		event.Project, event.Service = project, service
+	})
+	if !h.allowed(r, action, serviceResource(project, service, "")) {
+		h.forbidden(w, r, action)
+		return
+	}
+	logOptions, err := logs.ParseOptions(query, "all")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	compression, err := logs.ParseCompression(query.Get("compress"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tail := -1
+	if logOptions.Tail != "all" {
+		tail, _ = strconv.Atoi(logOptions.Tail)
+	}
+
+	cursor, err := host.archive.Read(r.Context(), service, logOptions.Since, logOptions.Until)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer cursor.Close()
+
+	contentType := logs.ContentType(logOptions.Format)
+	if compression != logs.CompressNone {
+		contentType = logs.CompressionContentType(compression)
+	}
+	w.Header().Set("Content-Type", contentType)
+	if download {
+		filename := service + logs.Extension(logOptions.Format) + logs.CompressionExtension(compression)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	}
+
+	out, err := logs.Compress(w, compression)
+	if err != nil {
+		h.logger.Error("Error creating compressor", zap.Error(err))
+		return
+	}
+	defer func() {
+		if err := out.Close(); err != nil {
+			h.logger.Error("Error finishing compressed logs", zap.Error(err))
+		}
+	}()
+
+	// 服务中可能有没有权限的容器
+	allowed := func(frame *logs.Frame) bool {
+		return h.allowed(r, action, serviceResource(project, frame.Service, frame.Container))
+	}
+	if err := encodeArchive(cursor, logOptions, tail, allowed, out); err != nil {
+		record.fail(err)
+		h.logger.Error("Error reading archived logs", zap.String("service", service), zap.Error(err))
+	}
+}
+
+// 搜索参数的默认值与上限
+const (
+	defaultSearchContext = 2
+	maxSearchContext     = 20
+	defaultSearchLimit   = 100
+	maxSearchLimit       = 1000
+)
+
+// SearchHandler 在归档日志中全文搜索，q 为搜索语句，见 search.Parse
+// since、until 限定时间范围，context 为每个匹配前后的行数，limit 为最多返回的匹配数，
+// multiline、multiline_pattern 与日志接口相同
+func (h *Handler) SearchHandler(w http.ResponseWriter, r *http.Request) {
+	w, record := h.audit(w, r, audit.ActionLogsSearch)
+	defer record.finish()
+
+	host, ok := h.archiveFor(w, r)
+	if !ok {
+		return
+	}
+	record.host(host)
+
+	query := r.URL.Query()
+	parsed, err := search.Parse(query.Get("q"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// 时间范围与日志接口的 since、until 写法相同
+	logOptions, err := logs.ParseOptions(url.Values{"since": query["since"], "until": query["until"]}, "all")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	contextLines, err := intParam(query.Get("context"), defaultSearchContext, maxSearchContext)
+	if err != nil {
+		http.Error(w, "invalid context: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := intParam(query.Get("limit"), defaultSearchLimit, maxSearchLimit)
+	if err != nil || limit == 0 {
+		http.Error(w, "invalid limit: "+query.Get("limit"), http.StatusBadRequest)
+		return
+	}
+
+	multiline, err := logs.ParseMultiline(query.Get("multiline"), query.Get("multiline_pattern"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// 只搜索有权限的服务，服务中没有权限的容器在计入 limit 之前跳过
+	services, err := host.archive.Services()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	project := host.monitor.Project()
+	permitted := []string{}
+	for _, service := range services {
+		if h.allowed(r, rbac.ActionLogs, serviceResource(project, service, "")) {
+			permitted = append(permitted, service)
+		}
+	}
+
+	result, err := host.archive.Search(r.Context(), archive.SearchOptions{
+		Query:     parsed,
+		Since:     logOptions.Since,
+		Until:     logOptions.Until,
+		Context:   contextLines,
+		Limit:     limit,
+		Multiline: multiline,
+		Services:  permitted,
+		Allowed: func(frame *logs.Frame) bool {
+			return h.allowed(r, rbac.ActionLogs, serviceResource(project, frame.Service, frame.Container))
+		},
+	})
+	if err != nil {
+		h.logger.Error("Error searching archived logs", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// intParam 解析非负整数参数，为空时返回 defaultValue，超过 max 时返回 max
+func intParam(value string, defaultValue, max int) (int, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("must be a non-negative integer: %s", value)
+	}
+	if n > max {
+		n = max
+	}
+	return n, nil
+}
+
+// encodeArchive 过滤归档日志并编码写入 w，tail 大于等于 0 时只保留最后 tail 个事件，allowed 返回 false 的行被跳过
+// 配置了多行分组时按容器合并后再过滤
+func encodeArchive(cursor *archive.Cursor, logOptions *logs.Options, tail int, allowed func(*logs.Frame) bool, w io.Writer) error {
+	encoder, err := logs.NewEncoder(w, logOptions.Format)
+	if err != nil {
+		return err
+	}
+	var grouper *logs.FrameGrouper
+	if logOptions.Multiline != nil {
+		grouper = logs.NewFrameGrouper(logOptions.Multiline)
+	}
+
+	var buffered []logs.Frame
+	emit := func(frame logs.Frame) error {
+		entry := frame.Entry()
+		if !logOptions.Match(&entry) {
+			return nil
+		}
+		frame = logs.NewFrame(&entry, frame.Container, frame.ContainerID, frame.Service)
+
+		if tail < 0 {
+			return encoder.Encode(frame)
+		}
+		if tail == 0 {
+			return nil
+		}
+		if len(buffered) == tail {
+			buffered = buffered[1:]
+		}
+		buffered = append(buffered, frame)
+		return nil
+	}
+
+	for {
+		frame, err := cursor.Next()
+		if err != nil {
+			if err != io.EOF {
+				return err
+			}
+			break
+		}
+		if !allowed(&frame) || logOptions.Stream != logs.StreamAll && frame.Stream != logOptions.Stream {
+			continue
+		}
+		if grouper != nil {
+			var done bool
+			if frame, done = grouper.Add(frame); !done {
+				continue
+			}
+		}
+		if err := emit(frame); err != nil {
+			return err
+		}
+	}
+	if grouper != nil {
+		for _, frame := range grouper.Flush() {
+			if err := emit(frame); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, frame := range buffered {
+		if err := encoder.Encode(frame); err != nil {
+			return err
+		}
+	}
+	return encoder.Flush()
+}
@@ -0,0 +1,271 @@
+package web
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/YooLeon/container-debug-online/internal/audit"
+	"github.com/YooLeon/container-debug-online/internal/auth"
+	"github.com/YooLeon/container-debug-online/internal/rbac"
+	"github.com/docker/docker/api/types"
+	"go.uber.org/zap"
+)
+
+// WithAudit 记录用户操作的审计事件并启用审计日志查询接口
+func WithAudit(log *audit.Log) Option {
+	return func(h *Handler) {
+		h.auditLog = log
+	}
+}
+
+// WithCommandAudit 将终端中提交的命令记录到审计日志，记录前用 redactor 脱敏，需要同时启用 WithAudit
+func WithCommandAudit(redactor *audit.Redactor) Option {
+	return func(h *Handler) {
+		h.redactor = redactor
+	}
+}
+
+// auditRecord 一次请求的审计事件，请求结束时写入审计日志
+// 未启用审计日志时为 nil，所有方法都不做任何事
+type auditRecord struct {
+	h     *Handler
+	w     *statusWriter
+	start time.Time
+	event audit.Event
+}
+
+// audit 开始记录请求的审计事件，用户、来源地址和查询参数取自请求
+// 返回的 ResponseWriter 用于记录响应状态码，调用方需要 defer record.finish()
+func (h *Handler) audit(w http.ResponseWriter, r *http.Request, action string) (http.ResponseWriter, *auditRecord) {
+	if h.auditLog == nil {
+		return w, nil
+	}
+
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	event := audit.Event{
+		User:   auth.UserFromContext(r.Context()),
+		Remote: remote,
+		Action: action,
+	}
+	if token := auth.TokenFromContext(r.Context()); token != nil {
+		event.Token = token.ID
+	}
+	if query := r.URL.Query(); len(query) > 0 {
+		event.Params = make(map[string]string, len(query))
+		for key, values := range query {
+			event.Params[key] = strings.Join(values, ",")
+		}
+	}
+
+	sw := &statusWriter{ResponseWriter: w}
+	return sw, &auditRecord{h: h, w: sw, start: time.Now(), event: event}
+}
+
+// host 记录操作的主机
+func (a *auditRecord) host(host *hostHandle) {
+	if a != nil {
+		a.event.Host = host.name()
+	}
+}
+
+// container 记录操作的容器
+func (a *auditRecord) container(host *hostHandle, inspect types.ContainerJSON) {
+	if a == nil {
+		return
+	}
+	resource := inspectResource(inspect)
+	a.event.Host = host.name()
+	a.event.Project, a.event.Service, a.event.Container = resource.Project, resource.Service, resource.Container
+}
+
+// param 记录请求体中的参数
+func (a *auditRecord) param(key, value string) {
+	if a == nil || value == "" {
+		return
+	}
+	if a.event.Params == nil {
+		a.event.Params = make(map[string]string)
+	}
+	a.event.Params[key] = value
+}
+
+// set 补充事件的其他字段，例如操作对象或登录的用户名
+func (a *auditRecord) set(fn func(event *audit.Event)) {
+	if a != nil {
+		fn(&a.event)
+	}
+}
+
+// fail 记录响应状态码无法体现的错误，例如 WebSocket 建立后执行失败
+func (a *auditRecord) fail(err error) {
+	if a != nil && err != nil {
+		a.event.Error = err.Error()
+	}
+}
+
+// finish 根据响应状态码确定结果并写入审计日志
+func (a *auditRecord) finish() {
+	if a == nil {
+		return
+	}
+	a.event.DurationMS = time.Since(a.start).Milliseconds()
+	a.event.Status = a.w.status
+	if a.event.Status == 0 {
+		a.event.Status = http.StatusOK
+	}
+	switch {
+	case a.event.Status == http.StatusUnauthorized || a.event.Status == http.StatusForbidden:
+		a.event.Result = audit.ResultDenied
+	case a.event.Status >= 400 || a.event.Error != "":
+		a.event.Result = audit.ResultFailure
+	default:
+		a.event.Result = audit.ResultSuccess
+	}
+
+	if err := a.h.auditLog.Record(a.event); err != nil {
+		a.h.logger.Error("Failed to record audit event",
+			zap.String("action", a.event.Action),
+			zap.String("user", a.event.User),
+			zap.Error(err))
+	}
+}
+
+// commandLog 记录终端会话中提交的命令，未启用命令记录时为 nil
+type commandLog struct {
+	h     *Handler
+	event audit.Event // 会话的用户、来源和容器
+
+	mu     sync.Mutex // 输入和输出在不同的 goroutine 中处理
+	parser *audit.CommandParser
+}
+
+// commands 开始记录终端会话中的命令，session 为执行实例的 ID，与终端会话的审计事件关联
+func (a *auditRecord) commands(session string) *commandLog {
+	if a == nil || a.h.redactor == nil {
+		return nil
+	}
+	event := a.event
+	event.Action = audit.ActionCommand
+	event.Params = map[string]string{"exec": session}
+	return &commandLog{h: a.h, event: event, parser: audit.NewCommandParser()}
+}
+
+// output 处理终端输出，用于识别密码提示，提示之后输入的内容不记录
+func (c *commandLog) output(data []byte) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.parser.Output(string(data))
+	c.mu.Unlock()
+}
+
+// input 处理终端输入，记录其中提交的命令
+func (c *commandLog) input(data string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	commands := c.parser.Write(data)
+	c.mu.Unlock()
+	for _, cmd := range commands {
+		event := c.event
+		event.Time = time.Now()
+		event.Result = audit.ResultSuccess
+		event.Params = map[string]string{
+			"exec":    c.event.Params["exec"],
+			"command": c.h.redactor.Redact(cmd.Line),
+		}
+		if cmd.Pasted {
+			event.Params["pasted"] = "true"
+		}
+		if cmd.Approximate {
+			event.Params["approximate"] = "true"
+		}
+		if cmd.Secret {
+			event.Params["secret"] = "true"
+		}
+		if err := c.h.auditLog.Record(event); err != nil {
+			c.h.logger.Error("Failed to record terminal command",
+				zap.String("user", event.User),
+				zap.String("exec", event.Params["exec"]),
+				zap.Error(err))
+		}
+	}
+}
+
+// statusWriter 记录响应状态码，同时保留 WebSocket 升级所需的 Hijacker
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil && w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// AuditHandler 查询审计日志，查询本身也会记录
+// 审计日志包含所有项目的操作，需要不限范围的 admin 权限
+func (h *Handler) AuditHandler(w http.ResponseWriter, r *http.Request) {
+	if h.auditLog == nil || !h.auditLog.Queryable() {
+		http.Error(w, "Audit log file is not enabled", http.StatusNotFound)
+		return
+	}
+	w, record := h.audit(w, r, audit.ActionQuery)
+	defer record.finish()
+	if !h.authorizeGlobal(w, r, rbac.ActionAdmin) {
+		return
+	}
+
+	query, err := audit.ParseQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	events, err := h.auditLog.Query(query)
+	if err != nil {
+		h.logger.Error("Failed to query audit log", zap.Error(err))
+		http.Error(w, "Failed to query audit log", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
@@ -0,0 +1,254 @@
+package web
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/YooLeon/container-debug-online/internal/audit"
+	"github.com/YooLeon/container-debug-online/internal/logs"
+	"github.com/YooLeon/container-debug-online/internal/rbac"
+	"github.com/docker/docker/api/types"
+	"go.uber.org/zap"
+)
+
+// 多服务日志下载的归档格式
+const (
+	archiveTar = "tar"
+	archiveZip = "zip"
+)
+
+// encodeLogs 读取容器日志，过滤后按 logOptions.Format 编码写入 w
+func (h *Handler) encodeLogs(ctx context.Context, logReader io.Reader, inspect types.ContainerJSON, logOptions *logs.Options, w io.Writer) error {
+	encoder, err := logs.NewEncoder(w, logOptions.Format)
+	if err != nil {
+		return err
+	}
+
+	containerName := strings.TrimPrefix(inspect.Name, "/")
+	serviceName := inspect.Config.Labels["com.docker.compose.service"]
+	reader := logOptions.NewReader(ctx, logReader, inspect.Config.Tty)
+	for {
+		entry, err := reader.Next()
+		if err != nil {
+			if err == io.EOF {
+				return encoder.Flush()
+			}
+			return err
+		}
+		if !logOptions.Match(&entry) {
+			continue
+		}
+		if err := encoder.Encode(logs.NewFrame(&entry, containerName, inspect.ID, serviceName)); err != nil {
+			return err
+		}
+	}
+}
+
+// DownloadServiceLogsHandler 将多个服务的日志打包下载，每个服务一个文件
+// archive 为 tar (默认，可用 compress 压缩) 或 zip，其余参数与单容器下载相同
+func (h *Handler) DownloadServiceLogsHandler(w http.ResponseWriter, r *http.Request) {
+	w, record := h.audit(w, r, audit.ActionLogsDownload)
+	defer record.finish()
+
+	host, ok := h.hostFor(w, r)
+	if !ok {
+		return
+	}
+	record.host(host)
+	if !h.authorizeAny(w, r, rbac.ActionDownload) {
+		return
+	}
+
+	query := r.URL.Query()
+	logOptions, err := logs.ParseOptions(query, "all")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	compression, err := logs.ParseCompression(query.Get("compress"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	archive := query.Get("archive")
+	switch archive {
+	case "":
+		archive = archiveTar
+	case archiveTar:
+	case archiveZip:
+		if compression != logs.CompressNone {
+			http.Error(w, "zip archives are already compressed", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "unsupported archive: "+archive, http.StatusBadRequest)
+		return
+	}
+
+	targets, _, ok := h.logTargets(w, r, host, rbac.ActionDownload)
+	if !ok {
+		return
+	}
+
+	filename := fmt.Sprintf("logs-%s.%s%s", host.name(), archive, logs.CompressionExtension(compression))
+	contentType := "application/x-tar"
+	if archive == archiveZip {
+		contentType = "application/zip"
+	} else if compression != logs.CompressNone {
+		contentType = logs.CompressionContentType(compression)
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+
+	out, err := logs.Compress(w, compression)
+	if err != nil {
+		h.logger.Error("Error creating compressor", zap.Error(err))
+		return
+	}
+	defer func() {
+		if err := out.Close(); err != nil {
+			record.fail(err)
+			h.logger.Error("Error finishing compressed logs", zap.Error(err))
+		}
+	}()
+
+	var writer archiveWriter
+	if archive == archiveZip {
+		writer = &zipArchive{writer: zip.NewWriter(out)}
+	} else {
+		writer = &tarArchive{writer: tar.NewWriter(out)}
+	}
+	defer func() {
+		if err := writer.Close(); err != nil {
+			h.logger.Error("Error finishing log archive", zap.Error(err))
+		}
+	}()
+
+	// 记录实际打包的容器，没有权限的容器不会包含在内
+	names := make(map[string]int)
+	var included []string
+	for _, target := range targets {
+		containerID := target.Resolve(r.Context())
+		if containerID == "" {
+			continue
+		}
+		inspect, err := host.monitor.Runtime().ContainerInspect(r.Context(), containerID)
+		if err != nil {
+			h.logger.Error("Error inspecting container",
+				zap.String("service", target.Service),
+				zap.String("containerID", containerID),
+				zap.Error(err))
+			record.fail(err)
+			return
+		}
+		// 跳过没有权限的容器
+		if !h.allowed(r, rbac.ActionDownload, inspectResource(inspect)) {
+			continue
+		}
+
+		// 同名服务的文件名加上序号
+		name := target.Service
+		if n := names[name]; n > 0 {
+			name = fmt.Sprintf("%s-%d", name, n+1)
+		}
+		names[target.Service]++
+
+		included = append(included, strings.TrimPrefix(inspect.Name, "/"))
+		record.param("included", strings.Join(included, ","))
+		if err := h.archiveLogs(r.Context(), host, inspect, name+logs.Extension(logOptions.Format), logOptions, writer); err != nil {
+			record.fail(err)
+			h.logger.Error("Error archiving logs",
+				zap.String("service", target.Service),
+				zap.String("containerID", containerID),
+				zap.Error(err))
+			return
+		}
+	}
+}
+
+// archiveLogs 将一个容器的日志写入归档
+func (h *Handler) archiveLogs(ctx context.Context, host *hostHandle, inspect types.ContainerJSON, name string, logOptions *logs.Options, writer archiveWriter) error {
+	logReader, err := host.monitor.Runtime().ContainerLogs(ctx, inspect.ID, logOptions.ContainerLogsOptions(false))
+	if err != nil {
+		return err
+	}
+	defer logReader.Close()
+
+	return writer.WriteFile(name, func(w io.Writer) error {
+		return h.encodeLogs(ctx, logReader, inspect, logOptions, w)
+	})
+}
+
+// archiveWriter 将日志文件写入归档
+type archiveWriter interface {
+	WriteFile(name string, write func(w io.Writer) error) error
+	Close() error
+}
+
+// zipArchive 直接流式写入 zip 条目
+type zipArchive struct {
+	writer *zip.Writer
+}
+
+func (a *zipArchive) WriteFile(name string, write func(w io.Writer) error) error {
+	w, err := a.writer.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	return write(w)
+}
+
+func (a *zipArchive) Close() error {
+	return a.writer.Close()
+}
+
+// tarArchive tar 条目需要预先知道大小，先写入临时文件
+type tarArchive struct {
+	writer *tar.Writer
+}
+
+func (a *tarArchive) WriteFile(name string, write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp("", "container-logs-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if err := write(tmp); err != nil {
+		return err
+	}
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if err := a.writer.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    size,
+		ModTime: time.Now(),
+	}); err != nil {
+		return err
+	}
+	_, err = io.Copy(a.writer, tmp)
+	return err
+}
+
+func (a *tarArchive) Close() error {
+	return a.writer.Close()
+}
@@ -1,14 +1,21 @@
 package web
 
 import (
-	"bufio"
-	"encoding/binary"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 
+	"github.com/YooLeon/container-debug-online/internal/alert"
+	"github.com/YooLeon/container-debug-online/internal/audit"
+	"github.com/YooLeon/container-debug-online/internal/auth"
 	"github.com/YooLeon/container-debug-online/internal/docker"
+	"github.com/YooLeon/container-debug-online/internal/logs"
+	"github.com/YooLeon/container-debug-online/internal/metrics"
+	"github.com/YooLeon/container-debug-online/internal/oidc"
+	"github.com/YooLeon/container-debug-online/internal/rbac"
 	"github.com/docker/docker/api/types"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
@@ -16,11 +23,44 @@ import (
 )
 
 type Handler struct {
-	monitor *docker.Monitor
-	logger  *zap.Logger
+	hosts     map[string]*hostHandle
+	hostNames []string // 按配置顺序，第一个为默认主机
+	logger    *zap.Logger
+	alerts    *alert.Engine
+	policy    *rbac.Policy // nil 时不做权限控制
+	users     *auth.Users
+	sessions  *auth.Sessions  // nil 时不启用登录
+	oidc      *oidc.Provider  // nil 时不启用单点登录
+	tokens    *auth.Tokens    // nil 时不启用 API 令牌
+	auditLog  *audit.Log      // nil 时不记录审计事件
+	redactor  *audit.Redactor // nil 时不记录终端中的命令
+	metrics   http.Handler    // Prometheus 指标
+
+	wsOptions  WebSocketOptions
+	wsSessions *wsLimiter
+}
+
+// Option 配置 Handler 的可选功能
+type Option func(*Handler)
+
+// WithCrashTracker 启用崩溃检测相关接口，tracker 关联到其所跟踪的主机
+func WithCrashTracker(tracker *docker.CrashTracker) Option {
+	return func(h *Handler) {
+		if host, ok := h.hosts[tracker.Host()]; ok {
+			host.crashes = tracker
+		}
+	}
+}
+
+// WithAlertEngine 启用告警相关接口
+func WithAlertEngine(engine *alert.Engine) Option {
+	return func(h *Handler) {
+		h.alerts = engine
+	}
 }
 
 type ContainerResponse struct {
+	Host            string            `json:"host"`
 	ID              string            `json:"id"`
 	Name            string            `json:"name"`
 	Status          string            `json:"status"`
@@ -30,24 +70,38 @@ type ContainerResponse struct {
 	Labels          map[string]string `json:"labels"`
 	ExitCode        int              `json:"exit_code"`
 	HealthStatus    *docker.HealthStatus `json:"health_status"`
+	RestartCount    int               `json:"restart_count"`
+	OOMKilled       bool              `json:"oom_killed"`
+	CrashLoop       bool              `json:"crash_loop"`
+	Actions         []rbac.Action     `json:"actions"` // 当前用户对该容器允许的操作
 }
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
-}
-
-func NewHandler(monitor *docker.Monitor) *Handler {
-	return &Handler{
-		monitor: monitor,
-		logger:  zap.L(),
+// NewHandler 创建 HTTP handler，monitors 中的第一个作为默认主机
+func NewHandler(monitors []*docker.Monitor, opts ...Option) *Handler {
+	h := &Handler{
+		hosts:      make(map[string]*hostHandle),
+		logger:     zap.L(),
+		wsOptions:  DefaultWebSocketOptions,
+		wsSessions: &wsLimiter{users: make(map[string]int)},
+		metrics:    metrics.Handler(),
+	}
+	for _, monitor := range monitors {
+		h.hosts[monitor.Name()] = &hostHandle{monitor: monitor}
+		h.hostNames = append(h.hostNames, monitor.Name())
+	}
+	for _, opt := range opts {
+		opt(h)
 	}
+	return h
 }
 
 func (h *Handler) ContainersHandler(w http.ResponseWriter, r *http.Request) {
-	status := h.monitor.GetAllStatus()
-	config := h.monitor.GetComposeConfig()
+	host, ok := h.hostFor(w, r)
+	if !ok {
+		return
+	}
+	status := host.monitor.GetAllStatus()
+	config := host.monitor.GetComposeConfig()
 
 	var response []ContainerResponse
 	for _, serviceName := range config.SortedServices {
@@ -62,6 +116,7 @@ func (h *Handler) ContainersHandler(w http.ResponseWriter, r *http.Request) {
 				}
 
 				response = append(response, ContainerResponse{
+					Host:        host.name(),
 					ID:          serviceStatus.ContainerID,
 					Name:        containerStatus.Info.Name,
 					
@@ -72,10 +127,14 @@ func (h *Handler) ContainersHandler(w http.ResponseWriter, r *http.Request) {
 					Labels:      containerStatus.Info.Labels,
 					ExitCode:    containerStatus.ExitCode,
 					HealthStatus: containerStatus.Health,
+					RestartCount: containerStatus.RestartCount,
+					OOMKilled:    containerStatus.OOMKilled,
+					CrashLoop:    host.crashes != nil && host.crashes.CrashLoop(serviceName),
 				})
 			} else {
 				// 服务存在但容器未找到
 				response = append(response, ContainerResponse{
+					Host:        host.name(),
 					ID:          "",
 					Name:        fmt.Sprintf("%s (not running)", serviceName),
 					Status:      "not found",
@@ -90,6 +149,7 @@ func (h *Handler) ContainersHandler(w http.ResponseWriter, r *http.Request) {
 		} else {
 			// 服务配置存在但服务状态未找到
 			response = append(response, ContainerResponse{
+				Host:        host.name(),
 				ID:          "",
 				Name:        fmt.Sprintf("%s (not started)", serviceName),
 				Status:      "not started",
@@ -103,8 +163,52 @@ func (h *Handler) ContainersHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// 只返回有查看权限的容器，并列出允许的操作
+	user := subject(r)
+	project := host.monitor.Project()
+	visible := response[:0]
+	for _, container := range response {
+		resource := serviceResource(project, container.Service, container.Name)
+		if container.ID == "" {
+			resource.Container = host.serviceContainerName(container.Service, project)
+		}
+		if !h.policy.Allowed(user, rbac.ActionList, resource) {
+			continue
+		}
+		container.Actions = h.policy.AllowedActions(user, resource)
+		visible = append(visible, container)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(visible)
+}
+
+// CrashesHandler 返回服务的退出记录，可通过 service 参数过滤
+func (h *Handler) CrashesHandler(w http.ResponseWriter, r *http.Request) {
+	host, ok := h.hostFor(w, r)
+	if !ok {
+		return
+	}
+	if host.crashes == nil {
+		http.Error(w, "Crash tracking is not enabled", http.StatusNotFound)
+		return
+	}
+
+	if !h.authorizeAny(w, r, rbac.ActionList) {
+		return
+	}
+
+	crashes := host.crashes.Crashes(r.URL.Query().Get("service"))
+	project := host.monitor.Project()
+	visible := crashes[:0]
+	for _, service := range crashes {
+		if h.allowed(r, rbac.ActionList, serviceResource(project, service.Service, "")) {
+			visible = append(visible, service)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(visible)
 }
 
 // HealthCheckResponse 定义健康检查响应结构
@@ -112,6 +216,7 @@ type HealthCheckResponse struct {
 	Status      string                 `json:"status"`      // 总体状态：healthy/unhealthy
 	LastCheck   string                 `json:"last_check"`  // 最后检查时间
 	Services    map[string]ServiceHealth `json:"services"`    // 各服务的健康状态
+	Hosts       map[string]string      `json:"hosts"`       // 各主机的总体状态
 }
 
 // ServiceHealth 定义服务健康状态
@@ -123,13 +228,30 @@ type ServiceHealth struct {
 }
 
 func (h *Handler) HealthCheckHandler(w http.ResponseWriter, r *http.Request) {
-	status := h.monitor.GetAllStatus()
+	host, ok := h.hostFor(w, r)
+	if !ok {
+		return
+	}
+	status := host.monitor.GetAllStatus()
 
 	// 检查所有服务和容器的健康状态
 	allHealthy := true
 	serviceHealths := make(map[string]ServiceHealth)
 
+	// 未指定主机时，总体状态覆盖所有主机
+	hostHealths := make(map[string]string)
+	for _, name := range h.hostNames {
+		hostHealths[name] = "healthy"
+		if !h.hosts[name].healthy() {
+			hostHealths[name] = "unhealthy"
+			if r.URL.Query().Get("host") == "" {
+				allHealthy = false
+			}
+		}
+	}
+
 	// 收集每个服务的健康状态
+	project := host.monitor.Project()
 	for serviceName, service := range status.Services {
 		// 获取容器状态
 		containerStatus, exists := status.Containers[service.ContainerID]
@@ -151,6 +273,14 @@ func (h *Handler) HealthCheckHandler(w http.ResponseWriter, r *http.Request) {
 			allHealthy = false
 		}
 
+		// 总体状态包含所有服务，服务详情只返回有查看权限的
+		resource := serviceResource(project, serviceName, host.serviceContainerName(serviceName, project))
+		if exists {
+			resource.Container = containerStatus.Info.Name
+		}
+		if !h.allowed(r, rbac.ActionList, resource) {
+			continue
+		}
 		serviceHealths[serviceName] = serviceHealth
 	}
 
@@ -158,6 +288,7 @@ func (h *Handler) HealthCheckHandler(w http.ResponseWriter, r *http.Request) {
 		Status:    "healthy",
 		LastCheck: status.LastUpdate.Format("2006-01-02 15:04:05"),
 		Services:  serviceHealths,
+		Hosts:     hostHealths,
 	}
 
 	if !allHealthy {
@@ -170,52 +301,89 @@ func (h *Handler) HealthCheckHandler(w http.ResponseWriter, r *http.Request) {
 
 // TerminalHandler 处理终端 WebSocket 连接
 func (h *Handler) TerminalHandler(w http.ResponseWriter, r *http.Request) {
+	w, record := h.audit(w, r, audit.ActionTerminal)
+	defer record.finish()
+
 	containerID := r.URL.Query().Get("container")
 	if containerID == "" {
 		http.Error(w, "Missing container ID", http.StatusBadRequest)
 		return
 	}
+	host, ok := h.hostFor(w, r)
+	if !ok {
+		return
+	}
 
-	// 升级 HTTP 连接为 WebSocket
-	ws, err := upgrader.Upgrade(w, r, nil)
+	inspect, err := host.monitor.Runtime().ContainerInspect(r.Context(), containerID)
 	if err != nil {
-		h.logger.Error("Failed to upgrade connection", zap.Error(err))
+		h.logger.Error("Error inspecting container", zap.Error(err))
+		http.Error(w, "Container not found", http.StatusNotFound)
+		return
+	}
+	record.container(host, inspect)
+	if !h.authorizeContainer(w, r, inspect, rbac.ActionTerminal) {
+		return
+	}
+
+	// 升级 HTTP 连接为 WebSocket
+	ws, done, ok := h.upgrade(w, r, "terminal")
+	if !ok {
 		return
 	}
-	defer ws.Close()
+	defer done()
 
 	// 在容器中创建执行实例
-	exec, err := h.monitor.Client().ContainerExecCreate(r.Context(), containerID, types.ExecConfig{
+	cmd := []string{"/bin/sh"}
+	record.param("cmd", strings.Join(cmd, " "))
+	exec, err := host.monitor.Runtime().ContainerExecCreate(r.Context(), containerID, types.ExecConfig{
 		AttachStdin:  true,
 		AttachStdout: true,
 		AttachStderr: true,
 		Tty:          true,
-		Cmd:          []string{"/bin/sh"},
+		Cmd:          cmd,
 		Env:          []string{"TERM=xterm-256color"},
 	})
 	if err != nil {
+		record.fail(err)
 		h.logger.Error("Failed to create exec", zap.Error(err))
 		ws.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("Error: %v", err)))
 		return
 	}
 
 	// 附加到执行实例
-	resp, err := h.monitor.Client().ContainerExecAttach(r.Context(), exec.ID, types.ExecStartCheck{
+	resp, err := host.monitor.Runtime().ContainerExecAttach(r.Context(), exec.ID, types.ExecStartCheck{
 		Tty: true,
 	})
+	record.param("exec", exec.ID)
 	if err != nil {
+		record.fail(err)
 		h.logger.Error("Failed to attach to exec", zap.Error(err))
 		ws.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("Error: %v", err)))
 		return
 	}
 	defer resp.Close()
 
-	// 处理输入
+	commands := record.commands(exec.ID)
+
+	h.logger.Info("Terminal session started",
+		zap.String("user", auth.UserFromContext(r.Context())),
+		zap.String("host", host.name()),
+		zap.String("container", containerID),
+		zap.String("remote", r.RemoteAddr))
+
+	// 处理输入，客户端断开或消息超过大小限制时结束执行实例的连接，使输出循环退出
 	go func() {
+		defer resp.Close()
 		for {
 			messageType, p, err := ws.ReadMessage()
 			if err != nil {
-				h.logger.Error("Failed to read message", zap.Error(err))
+				if err == websocket.ErrReadLimit {
+					h.logger.Warn("Terminal message too large",
+						zap.String("user", auth.UserFromContext(r.Context())),
+						zap.Int64("limit", h.wsOptions.MaxMessageSize))
+				} else if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived) {
+					h.logger.Error("Failed to read message", zap.Error(err))
+				}
 				return
 			}
 
@@ -234,10 +402,11 @@ func (h *Handler) TerminalHandler(w http.ResponseWriter, r *http.Request) {
 
 				switch msg.Type {
 				case "resize":
-					if err := h.monitor.ResizeExecTTY(exec.ID, msg.Rows, msg.Cols); err != nil {
+					if err := host.monitor.ResizeExecTTY(exec.ID, msg.Rows, msg.Cols); err != nil {
 						h.logger.Error("Failed to resize terminal", zap.Error(err))
 					}
 				case "input":
+					commands.input(msg.Data)
 					if _, err := resp.Conn.Write([]byte(msg.Data)); err != nil {
 						h.logger.Error("Failed to write to terminal", zap.Error(err))
 					}
@@ -257,6 +426,7 @@ func (h *Handler) TerminalHandler(w http.ResponseWriter, r *http.Request) {
 			break
 		}
 
+		commands.output(buf[:nr])
 		if err := ws.WriteMessage(websocket.BinaryMessage, buf[:nr]); err != nil {
 			h.logger.Error("Failed to write message", zap.Error(err))
 			break
@@ -266,6 +436,9 @@ func (h *Handler) TerminalHandler(w http.ResponseWriter, r *http.Request) {
 
 // ContainerLogsHandler 处理容器日志 WebSocket 连接
 func (h *Handler) ContainerLogsHandler(w http.ResponseWriter, r *http.Request) {
+	w, record := h.audit(w, r, audit.ActionLogsStream)
+	defer record.finish()
+
 	vars := mux.Vars(r)
 	containerID := vars["id"]
 	if containerID == "" {
@@ -275,30 +448,40 @@ func (h *Handler) ContainerLogsHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Missing container ID", http.StatusBadRequest)
 		return
 	}
+	host, ok := h.hostFor(w, r)
+	if !ok {
+		return
+	}
 
-	ws, err := upgrader.Upgrade(w, r, nil)
+	// 解析日志过滤参数，默认只发送最近 100 行
+	logOptions, err := logs.ParseOptions(r.URL.Query(), "100")
+	if err == nil && logOptions.Format == logs.FormatCSV {
+		err = fmt.Errorf("csv format is only available for downloads")
+	}
 	if err != nil {
-		h.logger.Error("Failed to upgrade connection", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	defer ws.Close()
-	// 设置日志选项
-	options := types.ContainerLogsOptions{
-		ShowStdout: true,
-		ShowStderr: true,
-		Follow:     true,
-		Timestamps: true,
-		Tail:       "100",
-		// 添加 TTY 选项，处理终端大小问题
-		Details: false,
-	}
+	// 指定了 until 时日志不会再增长，发送完毕即结束
+	options := logOptions.ContainerLogsOptions(logOptions.Until.IsZero())
 
-	// 获取容器信息，检查是否使用了 TTY，同时获取服务名称
-	inspect, err := h.monitor.Client().ContainerInspect(r.Context(), containerID)
+	// 获取容器信息，检查权限和是否使用了 TTY，同时获取服务名称
+	inspect, err := host.monitor.Runtime().ContainerInspect(r.Context(), containerID)
 	if err != nil {
 		h.logger.Error("Error inspecting container", zap.Error(err))
+		http.Error(w, "Container not found", http.StatusNotFound)
 		return
 	}
+	record.container(host, inspect)
+	if !h.authorizeContainer(w, r, inspect, rbac.ActionLogs) {
+		return
+	}
+
+	ws, done, ok := h.upgrade(w, r, "logs")
+	if !ok {
+		return
+	}
+	defer done()
 
 	// 从容器标签中取服务名称
 	serviceName := inspect.Config.Labels["com.docker.compose.service"]
@@ -307,93 +490,91 @@ func (h *Handler) ContainerLogsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 客户端断开时停止跟随，客户端不需要发送消息
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				cancel()
+				return
+			}
+		}
+	}()
+
 	// 获取容器日志流
-	ctx := r.Context()
-	logReader, err := h.monitor.Client().ContainerLogs(ctx, containerID, options)
+	logReader, err := host.monitor.Runtime().ContainerLogs(ctx, containerID, options)
 	if err != nil {
 		ws.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("Error getting logs: %v", err)))
 		return
 	}
 	defer logReader.Close()
 
-	// 根据容器是否使用 TTY 选择不同的处理方式
-	if inspect.Config.Tty {
-		// 容器使用 TTY，直接读取日志
-		reader := bufio.NewReader(logReader)
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			default:
-				line, err := reader.ReadString('\n')
-				if err != nil {
-					if err != io.EOF {
-						h.logger.Error("Error reading log line", zap.Error(err))
-					}
-					return
-				}
-				if err := ws.WriteMessage(websocket.TextMessage, []byte(line)); err != nil {
-					h.logger.Error("Error sending log message", zap.Error(err))
-					return
-				}
+	// 按行读取日志，TTY 容器为原始输出，否则为 stdout/stderr 多路复用帧
+	reader := logOptions.NewReader(ctx, logReader, inspect.Config.Tty)
+	containerName := strings.TrimPrefix(inspect.Name, "/")
+	for {
+		entry, err := reader.Next()
+		if err != nil {
+			if err != io.EOF && ctx.Err() == nil {
+				h.logger.Error("Error reading logs", zap.Error(err))
 			}
+			return
+		}
+		if !logOptions.Match(&entry) {
+			continue
 		}
-	} else {
-		// 容器未使用 TTY，需要处理 stdout/stderr 流
-		hdr := make([]byte, 8)
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			default:
-				// 读取 Docker 日志头信息
-				_, err := io.ReadFull(logReader, hdr)
-				if err != nil {
-					if err != io.EOF {
-						h.logger.Error("Error reading log header", zap.Error(err))
-					}
-					return
-				}
-
-				// 获取消息大小
-				count := binary.BigEndian.Uint32(hdr[4:])
-				if count == 0 {
-					continue
-				}
-
-				// 读取实际的日志内容
-				buf := make([]byte, count)
-				_, err = io.ReadFull(logReader, buf)
-				if err != nil {
-					h.logger.Error("Error reading log message", zap.Error(err))
-					return
-				}
 
-				// 发送日志内容到客户端
-				if err := ws.WriteMessage(websocket.TextMessage, buf); err != nil {
-					h.logger.Error("Error sending log message", zap.Error(err))
-					return
-				}
-			}
+		if logOptions.Format == logs.FormatJSON {
+			err = ws.WriteJSON(logs.NewFrame(&entry, containerName, inspect.ID, serviceName))
+		} else {
+			err = ws.WriteMessage(websocket.TextMessage, []byte(entry.Text()))
+		}
+		if err != nil {
+			h.logger.Error("Error sending log message", zap.Error(err))
+			return
 		}
 	}
-
 }
 
+// DownloadLogsHandler 下载单个容器的日志，支持 text、ndjson、csv 格式与 gzip、zstd 压缩
 func (h *Handler) DownloadLogsHandler(w http.ResponseWriter, r *http.Request) {
+	w, record := h.audit(w, r, audit.ActionLogsDownload)
+	defer record.finish()
+
 	containerID := r.URL.Query().Get("container")
 	if containerID == "" {
 		http.Error(w, "Missing container ID", http.StatusBadRequest)
 		return
 	}
+	host, ok := h.hostFor(w, r)
+	if !ok {
+		return
+	}
+
+	// 解析日志过滤参数，默认下载全部日志
+	logOptions, err := logs.ParseOptions(r.URL.Query(), "all")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	compression, err := logs.ParseCompression(r.URL.Query().Get("compress"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// 获取容器信息以确定服务名
-	inspect, err := h.monitor.Client().ContainerInspect(r.Context(), containerID)
+	inspect, err := host.monitor.Runtime().ContainerInspect(r.Context(), containerID)
 	if err != nil {
 		h.logger.Error("Error inspecting container", zap.Error(err))
 		http.Error(w, "Failed to get container info", http.StatusInternalServerError)
 		return
 	}
+	record.container(host, inspect)
+	if !h.authorizeContainer(w, r, inspect, rbac.ActionDownload) {
+		return
+	}
 
 	// 从容器标签中获取服务名称
 	serviceName := inspect.Config.Labels["com.docker.compose.service"]
@@ -403,71 +584,35 @@ func (h *Handler) DownloadLogsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 设置响应头
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.log", serviceName))
-
-	// 获取所有日志
-	options := types.ContainerLogsOptions{
-		ShowStdout: true,
-		ShowStderr: true,
-		Follow:     false,
-		Timestamps: true,
-		Details:    false,
-	}
-
-	logs, err := h.monitor.Client().ContainerLogs(r.Context(), containerID, options)
+	// 获取日志
+	logReader, err := host.monitor.Runtime().ContainerLogs(r.Context(), containerID, logOptions.ContainerLogsOptions(false))
 	if err != nil {
 		h.logger.Error("Error getting logs", zap.Error(err))
 		http.Error(w, "Failed to get logs", http.StatusInternalServerError)
 		return
 	}
-	defer logs.Close()
-
-	// 根据容器是否使用 TTY 选择不同的处理方式
-	if inspect.Config.Tty {
-		// TTY 模式：直接复制日志内容
-		_, err = io.Copy(w, logs)
-		if err != nil {
-			h.logger.Error("Error copying logs", zap.Error(err))
-			return
-		}
-	} else {
-		// 非 TTY 模式：需要处理 Docker 日志格式
-		reader := bufio.NewReader(logs)
-		for {
-			// 读取头部 8 字节
-			header := make([]byte, 8)
-			_, err := io.ReadFull(reader, header)
-			if err != nil {
-				if err != io.EOF {
-					h.logger.Error("Error reading log header", zap.Error(err))
-				}
-				break
-			}
-
-			// 获取消息大小
-			size := binary.BigEndian.Uint32(header[4:])
-			if size == 0 {
-				continue
-			}
+	defer logReader.Close()
 
-			// 读取实际的日志内容
-			content := make([]byte, size)
-			_, err = io.ReadFull(reader, content)
-			if err != nil {
-				if err != io.EOF {
-					h.logger.Error("Error reading log content", zap.Error(err))
-				}
-				break
-			}
+	// 设置响应头
+	filename := serviceName + logs.Extension(logOptions.Format) + logs.CompressionExtension(compression)
+	contentType := logs.ContentType(logOptions.Format)
+	if compression != logs.CompressNone {
+		contentType = logs.CompressionContentType(compression)
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
 
-			// 写入日志内容
-			_, err = w.Write(content)
-			if err != nil {
-				h.logger.Error("Error writing log content", zap.Error(err))
-				break
-			}
-		}
+	out, err := logs.Compress(w, compression)
+	if err != nil {
+		h.logger.Error("Error creating compressor", zap.Error(err))
+		return
+	}
+	if err := h.encodeLogs(r.Context(), logReader, inspect, logOptions, out); err != nil {
+		record.fail(err)
+		h.logger.Error("Error writing logs", zap.Error(err))
+	}
+	if err := out.Close(); err != nil {
+		record.fail(err)
+		h.logger.Error("Error finishing compressed logs", zap.Error(err))
 	}
 }
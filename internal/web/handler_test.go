@@ -0,0 +1,1462 @@
+package web
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/YooLeon/container-debug-online/internal/alert"
+	"github.com/YooLeon/container-debug-online/internal/archive"
+	"github.com/YooLeon/container-debug-online/internal/audit"
+	"github.com/YooLeon/container-debug-online/internal/auth"
+	"github.com/YooLeon/container-debug-online/internal/config"
+	"github.com/YooLeon/container-debug-online/internal/docker"
+	"github.com/YooLeon/container-debug-online/internal/logs"
+	"github.com/YooLeon/container-debug-online/internal/patterns"
+	"github.com/YooLeon/container-debug-online/internal/rbac"
+	"github.com/YooLeon/container-debug-online/internal/runtime/fake"
+	"github.com/docker/docker/api/types/events"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/klauspost/compress/zstd"
+	"go.uber.org/zap"
+)
+
+const (
+	apiID    = "a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1"
+	workerID = "b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2"
+
+	standaloneID = "e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5"
+)
+
+var logTime = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// newTestRuntime 创建包含两个服务的假运行时：api 使用多路复用日志，worker 使用 TTY
+func newTestRuntime() *fake.Runtime {
+	rt := fake.New()
+	rt.AddContainer(fake.Container{
+		ID:      apiID,
+		Name:    "demo-api-1",
+		Project: "demo",
+		Service: "api",
+		Logs: []fake.LogLine{
+			{Time: logTime, Stream: "stdout", Text: "api started"},
+			{Time: logTime.Add(time.Second), Stream: "stderr", Text: "api warning"},
+		},
+	})
+	rt.AddContainer(fake.Container{
+		ID:           workerID,
+		Name:         "demo-worker-1",
+		Project:      "demo",
+		Service:      "worker",
+		Tty:          true,
+		ExposedPorts: []string{"9000/tcp"}, // 没有 IP，端口检查失败
+		RestartCount: 2,
+		Logs: []fake.LogLine{
+			{Time: logTime.Add(500 * time.Millisecond), Text: "worker started"},
+		},
+	})
+	return rt
+}
+
+// testUserHeader 和 testGroupsHeader 测试中用于指定请求用户和所属组（逗号分隔）的请求头，代替认证中间件
+const (
+	testUserHeader   = "X-Test-User"
+	testGroupsHeader = "X-Test-Groups"
+)
+
+// newTestServer 使用假运行时创建监控器和路由
+func newTestServer(t *testing.T, rt *fake.Runtime, opts ...Option) (*httptest.Server, *docker.Monitor) {
+	t.Helper()
+
+	composeConfig := &config.ComposeConfig{
+		Project: "demo",
+		Services: map[string]config.ServiceConfig{
+			"api":    {Image: "demo/api"},
+			"worker": {Image: "demo/worker"},
+			"db":     {Image: "postgres"},
+		},
+		SortedServices: []string{"api", "db", "worker"},
+	}
+	monitor := docker.NewMonitor("local", rt, zap.NewNop(), time.Second, composeConfig)
+	if err := monitor.UpdateStatus(); err != nil {
+		t.Fatalf("UpdateStatus: %v", err)
+	}
+
+	handler := NewHandler([]*docker.Monitor{monitor}, opts...)
+	handler.logger = zap.NewNop()
+
+	router := mux.NewRouter()
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if user := r.Header.Get(testUserHeader); user != "" {
+				r = r.WithContext(auth.WithUser(r.Context(), user, splitList(r.Header.Get(testGroupsHeader))...))
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	router.HandleFunc("/ws", handler.TerminalHandler)
+	router.HandleFunc("/containers", handler.ContainersHandler)
+	router.HandleFunc("/containers/{id}/logs", handler.ContainerLogsHandler)
+	router.HandleFunc("/container/logs/download", handler.DownloadLogsHandler)
+	router.HandleFunc("/health", handler.HealthCheckHandler)
+	router.HandleFunc("/hosts", handler.HostsHandler)
+	router.HandleFunc("/logs/aggregate", handler.AggregateLogsHandler)
+	router.HandleFunc("/logs/download", handler.DownloadServiceLogsHandler)
+	router.HandleFunc("/archive", handler.ArchiveHandler)
+	router.HandleFunc("/archive/logs", handler.ArchiveLogsHandler)
+	router.HandleFunc("/search", handler.SearchHandler)
+	router.HandleFunc("/patterns", handler.PatternsHandler)
+	router.HandleFunc("/tokens", handler.TokensHandler)
+	router.HandleFunc("/tokens/{id}", handler.RevokeTokenHandler)
+	router.HandleFunc("/audit", handler.AuditHandler)
+	router.HandleFunc("/alerts/silences", handler.SilencesHandler)
+	router.HandleFunc("/alerts/silences/{id}", handler.DeleteSilenceHandler)
+
+	server := httptest.NewServer(router)
+	t.Cleanup(func() {
+		server.Close()
+		monitor.Close()
+	})
+	return server, monitor
+}
+
+func getJSON(t *testing.T, url string, v interface{}) *http.Response {
+	t.Helper()
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("decoding %s: %v", url, err)
+	}
+	return resp
+}
+
+func dial(t *testing.T, server *httptest.Server, path string) *websocket.Conn {
+	t.Helper()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + path
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial %s: %v", path, err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return ws
+}
+
+func readMessage(t *testing.T, ws *websocket.Conn) string {
+	t.Helper()
+
+	_, data, err := ws.ReadMessage()
+	if err != nil {
+		t.Fatalf("reading message: %v", err)
+	}
+	return string(data)
+}
+
+func TestContainersHandler(t *testing.T) {
+	server, _ := newTestServer(t, newTestRuntime())
+
+	var containers []ContainerResponse
+	getJSON(t, server.URL+"/containers", &containers)
+
+	if len(containers) != 3 {
+		t.Fatalf("got %d containers, want 3: %+v", len(containers), containers)
+	}
+
+	api, db, worker := containers[0], containers[1], containers[2]
+	if api.Service != "api" || api.ID != apiID || api.Name != "demo-api-1" || api.Status != "running" || !api.Healthy {
+		t.Errorf("unexpected api container: %+v", api)
+	}
+	if db.Service != "db" || db.Status != "not started" || db.Healthy {
+		t.Errorf("unexpected db container: %+v", db)
+	}
+	if worker.Service != "worker" || worker.Healthy || worker.RestartCount != 2 {
+		t.Errorf("unexpected worker container: %+v", worker)
+	}
+	if healthy, ok := worker.PortsHealth["9000"]; !ok || healthy {
+		t.Errorf("worker port 9000 health = %v, %v; want false, true", healthy, ok)
+	}
+	if api.Host != "local" {
+		t.Errorf("host = %q, want local", api.Host)
+	}
+}
+
+func TestContainersHandlerUnknownHost(t *testing.T) {
+	server, _ := newTestServer(t, newTestRuntime())
+
+	resp, err := http.Get(server.URL + "/containers?host=missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestHealthCheckHandler(t *testing.T) {
+	rt := newTestRuntime()
+	server, monitor := newTestServer(t, rt)
+
+	var health HealthCheckResponse
+	getJSON(t, server.URL+"/health", &health)
+
+	if health.Status != "unhealthy" {
+		t.Errorf("status = %q, want unhealthy", health.Status)
+	}
+	if !health.Services["api"].Healthy || health.Services["worker"].Healthy {
+		t.Errorf("unexpected services: %+v", health.Services)
+	}
+	if health.Hosts["local"] != "unhealthy" {
+		t.Errorf("hosts = %+v", health.Hosts)
+	}
+
+	// 移除不健康的服务后整体恢复健康
+	rt.RemoveContainer(workerID)
+	if err := monitor.UpdateStatus(); err != nil {
+		t.Fatal(err)
+	}
+	health = HealthCheckResponse{}
+	getJSON(t, server.URL+"/health", &health)
+	if health.Status != "healthy" {
+		t.Errorf("status after removing worker = %q, want healthy", health.Status)
+	}
+}
+
+func TestTerminalHandler(t *testing.T) {
+	rt := newTestRuntime()
+	server, _ := newTestServer(t, rt)
+	ws := dial(t, server, "/ws?container="+apiID)
+
+	if err := ws.WriteJSON(map[string]interface{}{"type": "resize", "cols": 120, "rows": 40}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.WriteJSON(map[string]interface{}{"type": "input", "data": "ls -l\n"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var output string
+	for !strings.Contains(output, "ls -l\n") {
+		output += readMessage(t, ws)
+	}
+
+	execs := rt.Execs()
+	if len(execs) != 1 {
+		t.Fatalf("got %d exec sessions, want 1", len(execs))
+	}
+	if execs[0].ContainerID != apiID || !execs[0].Config.Tty {
+		t.Errorf("unexpected exec: %+v", execs[0])
+	}
+	if len(execs[0].Resizes) != 1 || execs[0].Resizes[0].Width != 120 || execs[0].Resizes[0].Height != 40 {
+		t.Errorf("resizes = %+v, want one 120x40", execs[0].Resizes)
+	}
+}
+
+func TestTerminalHandlerStoppedContainer(t *testing.T) {
+	rt := newTestRuntime()
+	rt.SetState(apiID, "exited", 1)
+	server, _ := newTestServer(t, rt)
+	ws := dial(t, server, "/ws?container="+apiID)
+
+	if msg := readMessage(t, ws); !strings.HasPrefix(msg, "Error:") || !strings.Contains(msg, "not running") {
+		t.Errorf("message = %q, want not running error", msg)
+	}
+}
+
+func TestContainerLogsHandler(t *testing.T) {
+	tests := []struct {
+		name      string
+		container string
+		want      []string
+	}{
+		{"multiplexed", apiID, []string{"api started\n", "api warning\n"}},
+		{"tty", workerID, []string{"worker started\n"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := newTestRuntime()
+			server, _ := newTestServer(t, rt)
+			ws := dial(t, server, "/containers/"+tt.container+"/logs")
+
+			for _, want := range tt.want {
+				assertLogLine(t, readMessage(t, ws), want)
+			}
+
+			// 跟随模式下追加的日志也会推送
+			rt.AppendLog(tt.container, fake.LogLine{Time: logTime.Add(time.Minute), Text: "appended"})
+			assertLogLine(t, readMessage(t, ws), "appended\n")
+		})
+	}
+}
+
+// assertLogLine 检查带时间戳前缀的日志行
+func assertLogLine(t *testing.T, got, want string) {
+	t.Helper()
+
+	timestamp, line, ok := strings.Cut(got, " ")
+	if !ok {
+		t.Fatalf("log line %q has no timestamp", got)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, timestamp); err != nil {
+		t.Errorf("invalid timestamp in %q: %v", got, err)
+	}
+	if line != want {
+		t.Errorf("log line = %q, want %q", line, want)
+	}
+}
+
+func TestDownloadLogsHandler(t *testing.T) {
+	tests := []struct {
+		name      string
+		container string
+		filename  string
+		want      []string
+	}{
+		{"multiplexed", apiID, "api.log", []string{"api started", "api warning"}},
+		{"tty", workerID, "worker.log", []string{"worker started"}},
+	}
+
+	server, _ := newTestServer(t, newTestRuntime())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Get(server.URL + "/container/logs/download?container=" + tt.container)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status = %d, want 200", resp.StatusCode)
+			}
+			if got := resp.Header.Get("Content-Disposition"); got != "attachment; filename="+tt.filename {
+				t.Errorf("Content-Disposition = %q", got)
+			}
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(strings.TrimSuffix(string(body), "\n"), "\n")
+			if len(lines) != len(tt.want) {
+				t.Fatalf("got %d lines, want %d: %q", len(lines), len(tt.want), body)
+			}
+			for i, want := range tt.want {
+				assertLogLine(t, lines[i]+"\n", want+"\n")
+			}
+		})
+	}
+}
+
+func TestDownloadLogsHandlerUnknownContainer(t *testing.T) {
+	server, _ := newTestServer(t, newTestRuntime())
+
+	resp, err := http.Get(server.URL + "/container/logs/download?container=missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", resp.StatusCode)
+	}
+}
+
+func TestDownloadLogsHandlerFilters(t *testing.T) {
+	rt := newTestRuntime()
+	rt.AppendLog(apiID, fake.LogLine{Time: logTime.Add(2 * time.Second), Stream: "stdout", Text: "GET /health 200"})
+	rt.AppendLog(apiID, fake.LogLine{Time: logTime.Add(3 * time.Second), Stream: "stdout", Text: "GET /users 500"})
+	server, _ := newTestServer(t, rt)
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"stderr only", "stream=stderr", []string{"api warning"}},
+		{"stdout only", "stream=stdout", []string{"api started", "GET /health 200", "GET /users 500"}},
+		{"tail", "tail=1", []string{"GET /users 500"}},
+		{"include", "include=^GET", []string{"GET /health 200", "GET /users 500"}},
+		{"include and exclude", "include=GET&exclude=/health", []string{"GET /users 500"}},
+		{"since", "since=" + logTime.Add(2*time.Second).Format(time.RFC3339), []string{"GET /health 200", "GET /users 500"}},
+		{"until", "until=" + logTime.Add(time.Second).Format(time.RFC3339), []string{"api started", "api warning"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Get(server.URL + "/container/logs/download?container=" + apiID + "&" + tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, line := range strings.Split(strings.TrimSuffix(string(body), "\n"), "\n") {
+				if _, message, ok := strings.Cut(line, " "); ok {
+					got = append(got, message)
+				}
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("lines = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogsHandlersRejectInvalidOptions(t *testing.T) {
+	server, _ := newTestServer(t, newTestRuntime())
+
+	for _, path := range []string{
+		"/container/logs/download?container=" + apiID + "&since=yesterday",
+		"/container/logs/download?container=" + apiID + "&tail=-1",
+		"/container/logs/download?container=" + apiID + "&stream=stdin",
+		"/containers/" + apiID + "/logs?include=(",
+	} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("GET %s: status = %d, want 400", path, resp.StatusCode)
+		}
+	}
+}
+
+func TestContainerLogsHandlerInclude(t *testing.T) {
+	rt := newTestRuntime()
+	server, _ := newTestServer(t, rt)
+	ws := dial(t, server, "/containers/"+apiID+"/logs?include=warn|appended")
+
+	assertLogLine(t, readMessage(t, ws), "api warning\n")
+
+	rt.AppendLog(apiID, fake.LogLine{Text: "skipped"})
+	rt.AppendLog(apiID, fake.LogLine{Text: "appended"})
+	assertLogLine(t, readMessage(t, ws), "appended\n")
+}
+
+func TestContainerLogsHandlerJSONFrames(t *testing.T) {
+	rt := newTestRuntime()
+	server, _ := newTestServer(t, rt)
+	ws := dial(t, server, "/containers/"+apiID+"/logs?format=json")
+
+	want := []logs.Frame{
+		{Time: logTime, Stream: "stdout", Line: "api started"},
+		{Time: logTime.Add(time.Second), Stream: "stderr", Line: "api warning"},
+	}
+	for _, w := range want {
+		var frame logs.Frame
+		if err := ws.ReadJSON(&frame); err != nil {
+			t.Fatal(err)
+		}
+		if !frame.Time.Equal(w.Time) || frame.Stream != w.Stream || frame.Line != w.Line {
+			t.Errorf("frame = %+v, want %+v", frame, w)
+		}
+		if frame.Container != "demo-api-1" || frame.ContainerID != apiID || frame.Service != "api" {
+			t.Errorf("frame identity = %+v", frame)
+		}
+	}
+}
+
+func TestAggregateLogsHandler(t *testing.T) {
+	rt := newTestRuntime()
+	server, _ := newTestServer(t, rt)
+	ws := dial(t, server, "/logs/aggregate?services=api,worker&format=json")
+
+	readFrames := func(n int) []logs.Frame {
+		frames := make([]logs.Frame, n)
+		for i := range frames {
+			if err := ws.ReadJSON(&frames[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return frames
+	}
+
+	// 两个服务的日志按时间戳交错
+	got := readFrames(3)
+	want := []struct{ service, line string }{
+		{"api", "api started"},
+		{"worker", "worker started"},
+		{"api", "api warning"},
+	}
+	for i, w := range want {
+		if got[i].Service != w.service || got[i].Line != w.line {
+			t.Errorf("frame %d = %s/%q, want %s/%q", i, got[i].Service, got[i].Line, w.service, w.line)
+		}
+	}
+
+	// 重建 api 容器后自动附加到新容器
+	const newID = "c3c3c3c3c3c3c3c3c3c3c3c3c3c3c3c3"
+	rt.RemoveContainer(apiID)
+	rt.AddContainer(fake.Container{
+		ID:      newID,
+		Name:    "demo-api-1",
+		Project: "demo",
+		Service: "api",
+		Logs:    []fake.LogLine{{Time: time.Now(), Text: "api restarted"}},
+	})
+	rt.Emit(events.Message{
+		Type:   events.ContainerEventType,
+		Action: "start",
+		Actor: events.Actor{ID: newID, Attributes: map[string]string{
+			"name":                       "demo-api-1",
+			"com.docker.compose.project": "demo",
+			"com.docker.compose.service": "api",
+		}},
+	})
+
+	frame := readFrames(1)[0]
+	if frame.Line != "api restarted" || frame.ContainerID != newID || frame.Service != "api" {
+		t.Errorf("frame after recreation = %+v", frame)
+	}
+}
+
+func TestAggregateLogsHandlerText(t *testing.T) {
+	server, _ := newTestServer(t, newTestRuntime())
+	ws := dial(t, server, "/logs/aggregate?until=0s&include=started")
+
+	var lines []string
+	for {
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			break
+		}
+		lines = append(lines, string(data))
+	}
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "api | ") || !strings.HasPrefix(lines[1], "worker | ") {
+		t.Errorf("lines = %q", lines)
+	}
+}
+
+func TestAggregateLogsHandlerUnknownService(t *testing.T) {
+	server, _ := newTestServer(t, newTestRuntime())
+
+	resp, err := http.Get(server.URL + "/logs/aggregate?services=missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestContainerLogsHandlerJSONFields(t *testing.T) {
+	rt := newTestRuntime()
+	rt.AppendLog(apiID, fake.LogLine{Time: logTime.Add(2 * time.Second), Text: `{"level":"info","msg":"request","user_id":7}`})
+	rt.AppendLog(apiID, fake.LogLine{Time: logTime.Add(3 * time.Second), Text: `{"level":"error","msg":"request failed","trace_id":"t-1","user_id":42}`})
+	server, _ := newTestServer(t, rt)
+	ws := dial(t, server, "/containers/"+apiID+"/logs?format=json&level=warn&filter=user_id=42")
+
+	var frame logs.Frame
+	if err := ws.ReadJSON(&frame); err != nil {
+		t.Fatal(err)
+	}
+	if frame.Level != "error" || frame.Message != "request failed" || frame.TraceID != "t-1" {
+		t.Errorf("frame = %+v", frame)
+	}
+	if frame.Fields["user_id"] != float64(42) {
+		t.Errorf("fields = %v", frame.Fields)
+	}
+}
+
+func TestDownloadLogsHandlerMultiline(t *testing.T) {
+	rt := newTestRuntime()
+	for i, line := range []string{"java.lang.RuntimeException: boom", "\tat App.run(App.java:1)", "\tat App.main(App.java:2)", "next"} {
+		rt.AppendLog(apiID, fake.LogLine{Time: logTime.Add(time.Duration(10+i) * time.Second), Text: line})
+	}
+	server, _ := newTestServer(t, rt)
+
+	resp, err := http.Get(server.URL + "/container/logs/download?container=" + apiID + "&multiline=java&include=RuntimeException")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	// 整个异常作为一个事件匹配过滤条件
+	_, event, _ := strings.Cut(string(body), " ")
+	if event != "java.lang.RuntimeException: boom\n\tat App.run(App.java:1)\n\tat App.main(App.java:2)\n" {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func get(t *testing.T, url string) (*http.Response, []byte) {
+	t.Helper()
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: status %d: %s", url, resp.StatusCode, body)
+	}
+	return resp, body
+}
+
+func TestDownloadLogsHandlerFormats(t *testing.T) {
+	server, _ := newTestServer(t, newTestRuntime())
+	base := server.URL + "/container/logs/download?container=" + apiID
+
+	resp, body := get(t, base+"&format=ndjson")
+	if resp.Header.Get("Content-Type") != "application/x-ndjson" || !strings.Contains(resp.Header.Get("Content-Disposition"), "api.ndjson") {
+		t.Errorf("headers = %v", resp.Header)
+	}
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	var frame logs.Frame
+	if len(lines) != 2 || json.Unmarshal([]byte(lines[1]), &frame) != nil || frame.Stream != "stderr" || frame.Line != "api warning" {
+		t.Errorf("ndjson body = %q", body)
+	}
+
+	_, body = get(t, base+"&format=csv")
+	records, err := csv.NewReader(bytes.NewReader(body)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || records[0][0] != "ts" || records[2][1] != "stderr" || records[2][3] != "api" || records[2][5] != "api warning" {
+		t.Errorf("csv records = %q", records)
+	}
+}
+
+func TestDownloadLogsHandlerCompression(t *testing.T) {
+	server, _ := newTestServer(t, newTestRuntime())
+	base := server.URL + "/container/logs/download?container=" + apiID
+
+	resp, body := get(t, base+"&compress=gzip")
+	if !strings.Contains(resp.Header.Get("Content-Disposition"), "api.log.gz") {
+		t.Errorf("Content-Disposition = %q", resp.Header.Get("Content-Disposition"))
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, _ := io.ReadAll(gz)
+	if strings.Count(string(plain), "\n") != 2 || !strings.Contains(string(plain), "api started") {
+		t.Errorf("gzip content = %q", plain)
+	}
+
+	_, body = get(t, base+"&compress=zstd")
+	zr, err := zstd.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	plain, _ = io.ReadAll(zr)
+	if !strings.Contains(string(plain), "api warning") {
+		t.Errorf("zstd content = %q", plain)
+	}
+}
+
+func TestDownloadServiceLogsHandler(t *testing.T) {
+	server, _ := newTestServer(t, newTestRuntime())
+
+	// tar.gz，每个服务一个文件
+	_, body := get(t, server.URL+"/logs/download?compress=gzip")
+	gz, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(tr)
+		files[header.Name] = string(content)
+	}
+	if len(files) != 2 || !strings.Contains(files["api.log"], "api warning") || !strings.Contains(files["worker.log"], "worker started") {
+		t.Errorf("tar files = %q", files)
+	}
+
+	// zip，只包含指定服务
+	resp, body := get(t, server.URL+"/logs/download?archive=zip&services=worker&format=csv")
+	if resp.Header.Get("Content-Type") != "application/zip" {
+		t.Errorf("Content-Type = %q", resp.Header.Get("Content-Type"))
+	}
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zr.File) != 1 || zr.File[0].Name != "worker.csv" {
+		t.Fatalf("zip files = %v", zr.File)
+	}
+	f, _ := zr.File[0].Open()
+	content, _ := io.ReadAll(f)
+	if !strings.HasPrefix(string(content), "ts,stream,container,service,level,line\n") || !strings.Contains(string(content), "worker started") {
+		t.Errorf("worker.csv = %q", content)
+	}
+}
+
+func TestDownloadServiceLogsHandlerInvalid(t *testing.T) {
+	server, _ := newTestServer(t, newTestRuntime())
+
+	for _, query := range []string{"archive=rar", "archive=zip&compress=gzip", "compress=brotli", "services=missing"} {
+		resp, err := http.Get(server.URL + "/logs/download?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", query, resp.StatusCode)
+		}
+	}
+}
+
+func TestArchiveHandlersDisabled(t *testing.T) {
+	server, _ := newTestServer(t, newTestRuntime())
+
+	for _, path := range []string{"/archive", "/archive/logs?service=api", "/search?q=api", "/patterns"} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("%s: status = %d, want 404", path, resp.StatusCode)
+		}
+	}
+}
+
+func TestArchiveLogsHandler(t *testing.T) {
+	rt := newTestRuntime()
+	rt.AppendLog(apiID, fake.LogLine{Time: logTime.Add(2 * time.Second), Stream: "stdout", Text: `{"level":"error","msg":"db down"}`})
+
+	composeConfig := &config.ComposeConfig{
+		Project:        "demo",
+		Services:       map[string]config.ServiceConfig{"api": {Image: "demo/api"}},
+		SortedServices: []string{"api"},
+	}
+	monitor := docker.NewMonitor("local", rt, zap.NewNop(), time.Second, composeConfig)
+	if err := monitor.UpdateStatus(); err != nil {
+		t.Fatalf("UpdateStatus: %v", err)
+	}
+	collector, err := archive.NewCollector(monitor, archive.Options{
+		Dir:         t.TempDir(),
+		SegmentSize: 1 << 20,
+		SegmentAge:  time.Hour,
+		Retention:   time.Hour,
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewCollector: %v", err)
+	}
+	collector.Start()
+
+	handler := NewHandler([]*docker.Monitor{monitor}, WithLogArchive(collector))
+	handler.logger = zap.NewNop()
+	router := mux.NewRouter()
+	router.HandleFunc("/archive", handler.ArchiveHandler)
+	router.HandleFunc("/archive/logs", handler.ArchiveLogsHandler)
+	router.HandleFunc("/search", handler.SearchHandler)
+	server := httptest.NewServer(router)
+	t.Cleanup(func() {
+		server.Close()
+		collector.Close()
+		monitor.Close()
+	})
+
+	// 等待归档写入后删除容器
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, body := get(t, server.URL+"/archive/logs?service=api")
+		if strings.Count(string(body), "\n") >= 3 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	rt.RemoveContainer(apiID)
+
+	var segments []archive.Segment
+	getJSON(t, server.URL+"/archive", &segments)
+	if len(segments) != 1 || segments[0].Service != "api" || segments[0].ContainerID != apiID[:12] {
+		t.Errorf("segments = %+v", segments)
+	}
+
+	_, body := get(t, server.URL+"/archive/logs?service=api")
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	if len(lines) != 3 || !strings.HasSuffix(lines[0], " api started") {
+		t.Fatalf("archived logs = %q", body)
+	}
+
+	_, body = get(t, server.URL+"/archive/logs?service=api&stream=stderr")
+	if strings.TrimSpace(string(body)) != logTime.Add(time.Second).Format(logs.TimestampFormat)+" api warning" {
+		t.Errorf("stderr logs = %q", body)
+	}
+
+	_, body = get(t, server.URL+"/archive/logs?service=api&tail=1&format=json")
+	var frame logs.Frame
+	if err := json.Unmarshal(body, &frame); err != nil {
+		t.Fatalf("decoding %q: %v", body, err)
+	}
+	if frame.Level != "error" || frame.Message != "db down" || frame.Container != "demo-api-1" || frame.Service != "api" {
+		t.Errorf("frame = %+v", frame)
+	}
+
+	// 多行分组作用于归档日志，过滤条件匹配整个事件
+	_, body = get(t, server.URL+"/archive/logs?"+url.Values{"service": {"api"}, "stream": {"stdout"}, "multiline_pattern": {`^\{`}, "include": {"db down"}}.Encode())
+	if want := logTime.Format(logs.TimestampFormat) + " api started\n" + `{"level":"error","msg":"db down"}` + "\n"; string(body) != want {
+		t.Errorf("grouped logs = %q, want %q", body, want)
+	}
+
+	resp, body := get(t, server.URL+"/archive/logs?service=api&level=warn&compress=gzip&download=1")
+	if resp.Header.Get("Content-Disposition") != "attachment; filename=api.log.gz" {
+		t.Errorf("Content-Disposition = %q", resp.Header.Get("Content-Disposition"))
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := io.ReadAll(gz)
+	if !strings.Contains(string(content), "db down") || strings.Contains(string(content), "api started") {
+		t.Errorf("filtered logs = %q", content)
+	}
+
+	var result archive.SearchResult
+	getJSON(t, server.URL+"/search?"+url.Values{"q": {`level>=error "db down"`}, "context": {"1"}}.Encode(), &result)
+	if len(result.Matches) != 1 || result.Matches[0].Level != "error" || len(result.Matches[0].Before) != 1 || result.Matches[0].Before[0].Line != "api warning" {
+		t.Errorf("search result = %+v", result)
+	}
+
+	for _, query := range []string{"q=", "q=%22open", "q=api&limit=0", "q=api&context=x", "q=api&since=yesterday"} {
+		resp, err := http.Get(server.URL + "/search?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("search %q: status = %d, want 400", query, resp.StatusCode)
+		}
+	}
+
+	for _, query := range []string{"", "service=../x", "service=api&multiline=cobol", "service=api&compress=brotli"} {
+		resp, err := http.Get(server.URL + "/archive/logs?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%q: status = %d, want 400", query, resp.StatusCode)
+		}
+	}
+}
+
+func TestPatternsHandler(t *testing.T) {
+	rt := newTestRuntime()
+	recent := time.Now().Add(-30 * time.Second)
+	for i := 0; i < 3; i++ {
+		rt.AppendLog(apiID, fake.LogLine{Time: recent.Add(time.Duration(i) * time.Millisecond), Stream: "stderr", Text: fmt.Sprintf("payment %d declined", i)})
+	}
+
+	_, monitor := newTestServer(t, rt)
+	tracker := patterns.NewTracker(monitor, time.Hour, zap.NewNop())
+	tracker.Start()
+	t.Cleanup(func() { tracker.Close() })
+
+	handler := NewHandler([]*docker.Monitor{monitor}, WithPatternTracker(tracker))
+	handler.logger = zap.NewNop()
+	router := mux.NewRouter()
+	router.HandleFunc("/patterns", handler.PatternsHandler)
+	patternServer := httptest.NewServer(router)
+	t.Cleanup(patternServer.Close)
+
+	var response PatternsResponse
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		getJSON(t, patternServer.URL+"/patterns?services=api&window=5m", &response)
+		if len(response.Patterns) > 0 && response.Patterns[0].Count == 3 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if len(response.Patterns) != 1 {
+		t.Fatalf("patterns = %+v", response.Patterns)
+	}
+	pattern := response.Patterns[0]
+	if pattern.Status != patterns.StatusNew || pattern.Template != "payment <*> declined" || pattern.Count != 3 || pattern.Service != "api" {
+		t.Errorf("pattern = %+v", pattern)
+	}
+	if response.End.Sub(response.Start) != 5*time.Minute || response.Start.Sub(response.BaselineStart) != time.Hour {
+		t.Errorf("window = %v - %v, baseline from %v", response.Start, response.End, response.BaselineStart)
+	}
+
+	for _, query := range []string{"window=soon", "baseline=-1h", "factor=0", "min_count=-1"} {
+		resp, err := http.Get(patternServer.URL + "/patterns?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", query, resp.StatusCode)
+		}
+	}
+}
+
+// getAs 以指定用户发送 GET 请求
+func getAs(t *testing.T, user, url string) *http.Response {
+	t.Helper()
+	return requestAs(t, user, "GET", url, "")
+}
+
+// requestAs 以 user 的身份发送请求，user 为空时不带用户
+func requestAs(t *testing.T, user, method, url, body string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user != "" {
+		req.Header.Set(testUserHeader, user)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestPolicy(t *testing.T) {
+	policy := &rbac.Policy{Bindings: []rbac.Binding{
+		{Users: []string{"bob"}, Role: rbac.RoleOperator, Projects: []string{"demo"}, Services: []string{"api"}},
+		{Users: []string{"carol"}, Role: rbac.RoleLogs, Containers: []string{"demo-worker-*"}},
+		{Users: []string{"dave"}, Role: rbac.RoleOperator, Projects: []string{"demo"}},
+	}}
+	rt := newTestRuntime()
+	// 没有 compose 标签的容器不属于任何服务，只有不限定服务的绑定可以访问
+	rt.AddContainer(fake.Container{ID: standaloneID, Name: "standalone", Logs: []fake.LogLine{{Time: logTime, Text: "standalone"}}})
+	server, _ := newTestServer(t, rt, WithPolicy(policy))
+
+	// 容器列表只包含有权限的容器，并列出允许的操作
+	tests := []struct {
+		user    string
+		service string
+		actions []rbac.Action
+	}{
+		{"bob", "api", []rbac.Action{rbac.ActionList, rbac.ActionLogs, rbac.ActionDownload, rbac.ActionTerminal, rbac.ActionExec, rbac.ActionLifecycle}},
+		{"carol", "worker", []rbac.Action{rbac.ActionList, rbac.ActionLogs, rbac.ActionDownload}},
+	}
+	for _, tt := range tests {
+		var containers []ContainerResponse
+		if err := json.NewDecoder(getAs(t, tt.user, server.URL+"/containers").Body).Decode(&containers); err != nil {
+			t.Fatal(err)
+		}
+		if len(containers) != 1 || containers[0].Service != tt.service || fmt.Sprint(containers[0].Actions) != fmt.Sprint(tt.actions) {
+			t.Errorf("%s containers = %+v", tt.user, containers)
+		}
+	}
+
+	var containers []ContainerResponse
+	if err := json.NewDecoder(getAs(t, "", server.URL+"/containers").Body).Decode(&containers); err != nil || len(containers) != 0 {
+		t.Errorf("anonymous containers = %+v, %v", containers, err)
+	}
+
+	// 健康检查的总体状态不受影响，服务详情按权限过滤
+	var health HealthCheckResponse
+	if err := json.NewDecoder(getAs(t, "carol", server.URL+"/health").Body).Decode(&health); err != nil {
+		t.Fatal(err)
+	}
+	if health.Status != "unhealthy" || len(health.Services) != 1 || health.Services["worker"].Status == "" {
+		t.Errorf("carol health = %+v", health)
+	}
+
+	// 主机概况只统计有权限的服务和容器
+	for _, tt := range []struct {
+		user                 string
+		services, containers int
+	}{
+		{"bob", 1, 1},
+		{"carol", 1, 1},
+		{"dave", 2, 2},
+	} {
+		var hosts []HostInfo
+		if err := json.NewDecoder(getAs(t, tt.user, server.URL+"/hosts").Body).Decode(&hosts); err != nil {
+			t.Fatal(err)
+		}
+		if len(hosts) != 1 || hosts[0].Services != tt.services || hosts[0].Containers != tt.containers {
+			t.Errorf("%s hosts = %+v", tt.user, hosts)
+		}
+	}
+
+	// 没有权限的操作返回 403
+	forbidden := []struct {
+		user string
+		path string
+	}{
+		{"carol", "/ws?container=" + apiID},
+		{"carol", "/containers/" + apiID + "/logs"},
+		{"carol", "/container/logs/download?container=" + apiID},
+		{"bob", "/ws?container=" + workerID},
+		{"bob", "/ws?container=" + standaloneID},
+		{"bob", "/containers/" + standaloneID + "/logs"},
+		{"carol", "/containers/" + standaloneID + "/logs"},
+		// 独立容器不属于主机的 compose 项目
+		{"dave", "/ws?container=" + standaloneID},
+		{"dave", "/containers/" + standaloneID + "/logs"},
+		{"dave", "/container/logs/download?container=" + standaloneID},
+		{"dave", "/logs/aggregate?containers=" + standaloneID},
+		{"dave", "/logs/download?containers=" + standaloneID},
+		{"bob", "/logs/aggregate?containers=" + workerID},
+		{"bob", "/logs/download?services=api&containers=demo-worker-1"},
+		{"", "/logs/aggregate"},
+		{"", "/logs/download"},
+	}
+	for _, tt := range forbidden {
+		if resp := getAs(t, tt.user, server.URL+tt.path); resp.StatusCode != http.StatusForbidden {
+			t.Errorf("%s %s: status = %d, want 403", tt.user, tt.path, resp.StatusCode)
+		}
+	}
+	if resp := getAs(t, "carol", server.URL+"/container/logs/download?container="+workerID); resp.StatusCode != http.StatusOK {
+		t.Errorf("carol worker download: status = %d", resp.StatusCode)
+	}
+	if resp := getAs(t, "dave", server.URL+"/logs/download?containers="+apiID); resp.StatusCode != http.StatusOK {
+		t.Errorf("dave api download: status = %d", resp.StatusCode)
+	}
+
+	// 多服务下载跳过没有权限的容器
+	resp := getAs(t, "bob", server.URL+"/logs/download?archive=zip")
+	body, _ := io.ReadAll(resp.Body)
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zr.File) != 1 || zr.File[0].Name != "api.log" {
+		t.Errorf("bob archive entries = %d", len(zr.File))
+	}
+}
+
+func TestTokensHandler(t *testing.T) {
+	tokens, err := auth.LoadTokens(filepath.Join(t.TempDir(), "tokens.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := &rbac.Policy{Bindings: []rbac.Binding{
+		{Users: []string{"alice"}, Role: rbac.RoleAdmin},
+		{Users: []string{"bob", "carol"}, Role: rbac.RoleOperator},
+		{Users: []string{"dana"}, Role: rbac.RoleAdmin, Projects: []string{"demo"}},
+	}}
+	server, _ := newTestServer(t, newTestRuntime(), WithPolicy(policy), WithTokens(tokens))
+
+	request := func(user, method, path, body string) *http.Response {
+		return requestAs(t, user, method, server.URL+path, body)
+	}
+	create := func(user, body string) (TokenResponse, int) {
+		resp := request(user, "POST", "/tokens", body)
+		var created TokenResponse
+		json.NewDecoder(resp.Body).Decode(&created)
+		return created, resp.StatusCode
+	}
+
+	bobToken, status := create("bob", `{"name":"bob-ci","actions":["logs"],"projects":["demo"]}`)
+	if status != http.StatusCreated || bobToken.User != "bob" || time.Until(bobToken.ExpiresAt) < 29*24*time.Hour {
+		t.Fatalf("bob token: status = %d, %+v", status, bobToken)
+	}
+	// 只有 admin 能为其他用户创建令牌
+	if _, status := create("bob", `{"name":"deploy","user":"deployer","actions":["list"]}`); status != http.StatusForbidden {
+		t.Errorf("bob creating a service token: status = %d", status)
+	}
+	// 限定项目的 admin 不能冒用其他用户
+	if _, status := create("dana", `{"name":"impersonate","user":"alice","actions":["admin"]}`); status != http.StatusForbidden {
+		t.Errorf("project-scoped admin creating a token for alice: status = %d", status)
+	}
+	serviceToken, status := create("alice", `{"name":"deploy","user":"deployer","actions":["list"]}`)
+	if status != http.StatusCreated || serviceToken.User != "deployer" || serviceToken.CreatedBy != "alice" {
+		t.Fatalf("service token: status = %d, %+v", status, serviceToken)
+	}
+	if _, status := create("", `{"name":"anon","actions":["list"]}`); status != http.StatusForbidden {
+		t.Errorf("anonymous create: status = %d", status)
+	}
+
+	list := func(user string) []auth.Token {
+		var list []auth.Token
+		json.NewDecoder(request(user, "GET", "/tokens", "").Body).Decode(&list)
+		return list
+	}
+	if got := list("bob"); len(got) != 1 || got[0].ID != bobToken.ID {
+		t.Errorf("bob tokens = %+v", got)
+	}
+	if got := list("alice"); len(got) != 2 {
+		t.Errorf("alice tokens = %+v", got)
+	}
+	if got := list("dana"); len(got) != 0 {
+		t.Errorf("dana tokens = %+v", got)
+	}
+
+	// 不能吊销别人的令牌，admin 可以
+	if resp := request("carol", "DELETE", "/tokens/"+bobToken.ID, ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("carol revoking bob's token: status = %d", resp.StatusCode)
+	}
+	if resp := request("dana", "DELETE", "/tokens/"+bobToken.ID, ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("dana revoking bob's token: status = %d", resp.StatusCode)
+	}
+	if resp := request("alice", "DELETE", "/tokens/"+bobToken.ID, ""); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("alice revoking bob's token: status = %d", resp.StatusCode)
+	}
+	if token, _ := tokens.Get(bobToken.ID); token.RevokedAt == nil {
+		t.Error("token not revoked")
+	}
+
+	// 继承了组的令牌有效期不超过 maxGroupTokenTTL
+	req, _ := http.NewRequest("POST", server.URL+"/tokens", strings.NewReader(`{"name":"oncall","actions":["logs"],"expires_in":"720h"}`))
+	req.Header.Set(testUserHeader, "erin")
+	req.Header.Set(testGroupsHeader, "oncall")
+	groupResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer groupResp.Body.Close()
+	var groupToken TokenResponse
+	json.NewDecoder(groupResp.Body).Decode(&groupToken)
+	if groupResp.StatusCode != http.StatusCreated || fmt.Sprint(groupToken.Groups) != "[oncall]" || time.Until(groupToken.ExpiresAt) > maxGroupTokenTTL {
+		t.Errorf("group token: status = %d, %+v", groupResp.StatusCode, groupToken)
+	}
+
+	// 没有权限策略时所有用户权限相同，没有人能为其他用户创建令牌
+	open, _ := newTestServer(t, newTestRuntime(), WithTokens(tokens))
+	if resp := requestAs(t, "bob", "POST", open.URL+"/tokens", `{"name":"x","user":"alice","actions":["list"]}`); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("creating a token for another user without a policy: status = %d", resp.StatusCode)
+	}
+}
+
+func TestSilencesRequireGlobalAdmin(t *testing.T) {
+	engine := alert.NewEngine(&alert.Config{}, zap.NewNop())
+	t.Cleanup(engine.Close)
+	policy := &rbac.Policy{Bindings: []rbac.Binding{
+		{Users: []string{"alice"}, Role: rbac.RoleAdmin},
+		{Users: []string{"dana"}, Role: rbac.RoleAdmin, Projects: []string{"demo"}},
+	}}
+	server, _ := newTestServer(t, newTestRuntime(), WithPolicy(policy), WithAlertEngine(engine))
+
+	// 限定项目的 admin 可以查看，但不能创建或删除可能作用于所有项目的静默
+	if resp := requestAs(t, "dana", "GET", server.URL+"/alerts/silences", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("dana listing silences: status = %d", resp.StatusCode)
+	}
+	body := `{"service":"api","duration":"1h"}`
+	if resp := requestAs(t, "dana", "POST", server.URL+"/alerts/silences", body); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("dana creating a silence: status = %d", resp.StatusCode)
+	}
+	resp := requestAs(t, "alice", "POST", server.URL+"/alerts/silences", body)
+	var created alert.Silence
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil || resp.StatusCode != http.StatusCreated {
+		t.Fatalf("alice creating a silence: status = %d, %v", resp.StatusCode, err)
+	}
+	if resp := requestAs(t, "dana", "DELETE", server.URL+"/alerts/silences/"+created.ID, ""); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("dana deleting a silence: status = %d", resp.StatusCode)
+	}
+	if resp := requestAs(t, "alice", "DELETE", server.URL+"/alerts/silences/"+created.ID, ""); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("alice deleting a silence: status = %d", resp.StatusCode)
+	}
+}
+
+func TestWebSocketOrigin(t *testing.T) {
+	opts := DefaultWebSocketOptions
+	opts.AllowedOrigins = []string{"https://*.example.com"}
+	server, _ := newTestServer(t, newTestRuntime(), WithWebSocketOptions(opts))
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/containers/" + apiID + "/logs"
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	tests := []struct {
+		origin string
+		proto  string // X-Forwarded-Proto
+		ok     bool
+	}{
+		{"", "", true},
+		{server.URL, "", true},
+		{"https://" + host, "", false},
+		{"https://" + host, "https", true},
+		{server.URL, "https", false},
+		{"https://debug.example.com", "", true},
+		{"https://evil.test", "", false},
+		{"https://example.com.evil.test", "", false},
+		{"null", "", false},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		if tt.origin != "" {
+			header.Set("Origin", tt.origin)
+		}
+		if tt.proto != "" {
+			header.Set("X-Forwarded-Proto", tt.proto)
+		}
+		ws, resp, err := websocket.DefaultDialer.Dial(url, header)
+		if tt.ok {
+			if err != nil {
+				t.Errorf("origin %q (%s): %v", tt.origin, tt.proto, err)
+				continue
+			}
+			ws.Close()
+		} else if err == nil || resp.StatusCode != http.StatusForbidden {
+			t.Errorf("origin %q (%s): want 403, got %v", tt.origin, tt.proto, err)
+		}
+	}
+
+	for _, invalid := range []string{"example.com", "https://example.com/path", "https://["} {
+		opts.AllowedOrigins = []string{invalid}
+		if err := opts.Validate(); err == nil {
+			t.Errorf("expected error for origin %q", invalid)
+		}
+	}
+}
+
+func TestWebSocketSessionLimits(t *testing.T) {
+	opts := DefaultWebSocketOptions
+	opts.MaxSessions = 2
+	opts.MaxSessionsPerUser = 1
+	server, _ := newTestServer(t, newTestRuntime(), WithWebSocketOptions(opts))
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?container=" + apiID
+
+	dialAs := func(user string) (*websocket.Conn, int) {
+		ws, resp, err := websocket.DefaultDialer.Dial(url, http.Header{testUserHeader: {user}})
+		if err != nil {
+			if resp == nil {
+				t.Fatal(err)
+			}
+			return nil, resp.StatusCode
+		}
+		t.Cleanup(func() { ws.Close() })
+		return ws, resp.StatusCode
+	}
+
+	alice, status := dialAs("alice")
+	if status != http.StatusSwitchingProtocols {
+		t.Fatalf("alice: status = %d", status)
+	}
+	if _, status := dialAs("alice"); status != http.StatusTooManyRequests {
+		t.Errorf("second alice session: status = %d", status)
+	}
+	if _, status := dialAs("bob"); status != http.StatusSwitchingProtocols {
+		t.Errorf("bob: status = %d", status)
+	}
+	if _, status := dialAs("carol"); status != http.StatusTooManyRequests {
+		t.Errorf("carol over the global limit: status = %d", status)
+	}
+
+	// 客户端断开后终端会话结束并释放名额
+	alice.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, status = dialAs("alice"); status == http.StatusSwitchingProtocols {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("alice session not released: status = %d", status)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestWebSocketMessageSize(t *testing.T) {
+	opts := DefaultWebSocketOptions
+	opts.MaxMessageSize = 256
+	server, _ := newTestServer(t, newTestRuntime(), WithWebSocketOptions(opts))
+	ws := dial(t, server, "/ws?container="+apiID)
+
+	if err := ws.WriteJSON(map[string]interface{}{"type": "input", "data": strings.Repeat("x", 1024)}); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if _, _, err := ws.ReadMessage(); err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+				t.Errorf("read error = %v, want message too big", err)
+			}
+			break
+		}
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	auditLog, err := audit.Open(audit.Options{File: filepath.Join(t.TempDir(), "audit.jsonl")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer auditLog.Close()
+	policy := &rbac.Policy{Bindings: []rbac.Binding{
+		{Users: []string{"alice"}, Role: rbac.RoleAdmin},
+		{Users: []string{"bob"}, Role: rbac.RoleOperator, Services: []string{"api"}},
+		{Users: []string{"dana"}, Role: rbac.RoleAdmin, Projects: []string{"demo"}},
+	}}
+	server, _ := newTestServer(t, newTestRuntime(), WithPolicy(policy), WithAudit(auditLog))
+
+	query := func(user, params string) ([]audit.Event, int) {
+		var events []audit.Event
+		resp := getAs(t, user, server.URL+"/audit?"+params)
+		json.NewDecoder(resp.Body).Decode(&events)
+		return events, resp.StatusCode
+	}
+
+	resp := getAs(t, "bob", server.URL+"/container/logs/download?container="+apiID+"&since=1h")
+	io.ReadAll(resp.Body)
+	if resp := getAs(t, "bob", server.URL+"/container/logs/download?container="+workerID); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("bob downloading worker logs: status = %d", resp.StatusCode)
+	}
+
+	// 终端会话结束时记录，耗时为会话时长
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws?container="+apiID, http.Header{testUserHeader: {"bob"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	ws.Close()
+	var terminal []audit.Event
+	for deadline := time.Now().Add(5 * time.Second); len(terminal) == 0 && time.Now().Before(deadline); {
+		terminal, _ = query("alice", "action=terminal")
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(terminal) != 1 {
+		t.Fatalf("terminal events = %+v", terminal)
+	}
+	if e := terminal[0]; e.User != "bob" || e.Container != "demo-api-1" || e.Service != "api" || e.Host != "local" ||
+		e.Result != audit.ResultSuccess || e.Params["cmd"] != "/bin/sh" || e.Params["exec"] == "" || e.DurationMS < 50 || e.Remote != "127.0.0.1" {
+		t.Errorf("terminal event = %+v", e)
+	}
+
+	downloads, status := query("alice", "action=logs.download")
+	if status != http.StatusOK || len(downloads) != 2 {
+		t.Fatalf("download events: status = %d, %+v", status, downloads)
+	}
+	if e := downloads[0]; e.Container != "demo-worker-1" || e.Result != audit.ResultDenied || e.Status != http.StatusForbidden {
+		t.Errorf("denied download = %+v", e)
+	}
+	if e := downloads[1]; e.Container != "demo-api-1" || e.Result != audit.ResultSuccess || e.Params["since"] != "1h" {
+		t.Errorf("download = %+v", e)
+	}
+
+	// 查询需要不限范围的 admin 权限，查询本身也会记录
+	if _, status := query("bob", ""); status != http.StatusForbidden {
+		t.Errorf("bob querying the audit log: status = %d", status)
+	}
+	if _, status := query("dana", ""); status != http.StatusForbidden {
+		t.Errorf("project-scoped admin querying the audit log: status = %d", status)
+	}
+	if events, _ := query("alice", "action=audit.query&user=bob"); len(events) != 1 || events[0].Result != audit.ResultDenied {
+		t.Errorf("audit query events = %+v", events)
+	}
+	if _, status := query("alice", "limit=0"); status != http.StatusBadRequest {
+		t.Errorf("invalid query: status = %d", status)
+	}
+}
+
+func TestTerminalCommandAudit(t *testing.T) {
+	auditLog, err := audit.Open(audit.Options{File: filepath.Join(t.TempDir(), "audit.jsonl")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer auditLog.Close()
+	redactor, err := audit.NewRedactor(audit.DefaultRedactPatterns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, _ := newTestServer(t, newTestRuntime(), WithAudit(auditLog), WithCommandAudit(redactor))
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws?container="+apiID, http.Header{testUserHeader: {"bob"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	for _, data := range []string{"ls -x\x7fl\r", "export API_TOKEN=abc123\r", "\x1b[200~echo pasted\x1b[201~\r"} {
+		if err := ws.WriteJSON(map[string]interface{}{"type": "input", "data": data}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var events []audit.Event
+	for deadline := time.Now().Add(5 * time.Second); len(events) < 3 && time.Now().Before(deadline); {
+		events, _ = auditLog.Query(audit.Query{Action: audit.ActionCommand})
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(events) != 3 {
+		t.Fatalf("command events = %+v", events)
+	}
+	// 按时间倒序
+	want := []string{"echo pasted", "export API_TOKEN=[REDACTED]", "ls -l"}
+	for i, e := range events {
+		if e.Params["command"] != want[i] || e.User != "bob" || e.Container != "demo-api-1" || e.Params["exec"] == "" {
+			t.Errorf("event %d = %+v, want command %q", i, e, want[i])
+		}
+	}
+	if events[0].Params["pasted"] != "true" {
+		t.Errorf("pasted command not marked: %+v", events[0])
+	}
+}
+
+func TestTerminalPasswordPrompt(t *testing.T) {
+	auditLog, err := audit.Open(audit.Options{File: filepath.Join(t.TempDir(), "audit.jsonl")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer auditLog.Close()
+	redactor, err := audit.NewRedactor(audit.DefaultRedactPatterns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, _ := newTestServer(t, newTestRuntime(), WithAudit(auditLog), WithCommandAudit(redactor))
+	ws := dial(t, server, "/ws?container="+apiID)
+
+	// 测试运行时回显输入，先让终端输出密码提示，收到回显后再输入密码
+	send := func(data string) {
+		t.Helper()
+		if err := ws.WriteJSON(map[string]interface{}{"type": "input", "data": data}); err != nil {
+			t.Fatal(err)
+		}
+		var echoed string
+		for len(echoed) < len(data) {
+			_, p, err := ws.ReadMessage()
+			if err != nil {
+				t.Fatal(err)
+			}
+			echoed += string(p)
+		}
+	}
+	send("[sudo] password for bob: ")
+	send("\x15hunter2\r")
+	send("ls\r")
+
+	var events []audit.Event
+	for deadline := time.Now().Add(5 * time.Second); len(events) < 2 && time.Now().Before(deadline); {
+		events, _ = auditLog.Query(audit.Query{Action: audit.ActionCommand})
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(events) != 2 {
+		t.Fatalf("command events = %+v", events)
+	}
+	if e := events[1]; e.Params["command"] != "[REDACTED]" || e.Params["secret"] != "true" {
+		t.Errorf("password event = %+v", e)
+	}
+	if e := events[0]; e.Params["command"] != "ls" || e.Params["secret"] != "" {
+		t.Errorf("command event = %+v", e)
+	}
+	all, _ := auditLog.Query(audit.Query{})
+	if data, _ := json.Marshal(all); strings.Contains(string(data), "hunter2") {
+		t.Error("audit log contains the password")
+	}
+}
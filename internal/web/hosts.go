@@ -0,0 +1,123 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/YooLeon/container-debug-online/internal/archive"
+	"github.com/YooLeon/container-debug-online/internal/docker"
+	"github.com/YooLeon/container-debug-online/internal/patterns"
+	"github.com/YooLeon/container-debug-online/internal/rbac"
+)
+
+// hostHandle 保存一个 Docker 主机的监控器及其附属功能
+type hostHandle struct {
+	monitor  *docker.Monitor
+	crashes  *docker.CrashTracker
+	archive  *archive.Collector
+	patterns *patterns.Tracker
+}
+
+func (host *hostHandle) name() string {
+	return host.monitor.Name()
+}
+
+// healthy 判断主机上所有已知服务是否健康
+func (host *hostHandle) healthy() bool {
+	status := host.monitor.GetAllStatus()
+	status.RLock()
+	defer status.RUnlock()
+
+	for _, service := range status.Services {
+		if !service.Healthy {
+			return false
+		}
+	}
+	return true
+}
+
+// hostFor 根据 host 参数选择主机，未指定时使用默认主机
+// 主机不存在时写入错误响应并返回 false
+func (h *Handler) hostFor(w http.ResponseWriter, r *http.Request) (*hostHandle, bool) {
+	name := r.URL.Query().Get("host")
+	if name == "" && len(h.hostNames) > 0 {
+		name = h.hostNames[0]
+	}
+
+	host, ok := h.hosts[name]
+	if !ok {
+		http.Error(w, "Unknown host: "+name, http.StatusNotFound)
+		return nil, false
+	}
+	return host, true
+}
+
+// HostInfo 表示一个 Docker 主机的概况
+type HostInfo struct {
+	Name            string    `json:"name"`
+	Default         bool      `json:"default"`
+	Healthy         bool      `json:"healthy"`
+	Services        int       `json:"services"`
+	HealthyServices int       `json:"healthy_services"`
+	Containers      int       `json:"containers"`
+	LastUpdate      time.Time `json:"last_update"`
+}
+
+// HostsHandler 返回所有已配置主机的概况，服务和容器数只包含有查看权限的
+// 与健康检查相同，主机的总体状态包含所有服务
+func (h *Handler) HostsHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.authorizeAny(w, r, rbac.ActionList) {
+		return
+	}
+
+	response := make([]HostInfo, 0, len(h.hostNames))
+	for i, name := range h.hostNames {
+		host := h.hosts[name]
+		// Project 会获取状态锁，需要在加锁之前调用
+		project := host.monitor.Project()
+		status := host.monitor.GetAllStatus()
+		status.RLock()
+		info := HostInfo{
+			Name:       name,
+			Default:    i == 0,
+			Healthy:    true,
+			LastUpdate: status.LastUpdate,
+		}
+		for serviceName, service := range status.Services {
+			if !service.Healthy {
+				info.Healthy = false
+			}
+			resource := serviceResource(project, serviceName, host.serviceContainerName(serviceName, project))
+			if container, ok := status.Containers[service.ContainerID]; ok {
+				resource.Container = container.Info.Name
+			}
+			if !h.allowed(r, rbac.ActionList, resource) {
+				continue
+			}
+			info.Services++
+			if service.Healthy {
+				info.HealthyServices++
+			}
+		}
+		for _, container := range status.Containers {
+			if h.allowed(r, rbac.ActionList, containerResource(container.Info.Name, container.Info.Labels)) {
+				info.Containers++
+			}
+		}
+		status.RUnlock()
+		response = append(response, info)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// MetricsHandler 导出 Prometheus 指标
+// 指标包含所有主机和项目的容器、服务和健康状态，需要不限范围的 list 权限
+func (h *Handler) MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.authorizeGlobal(w, r, rbac.ActionList) {
+		return
+	}
+	h.metrics.ServeHTTP(w, r)
+}
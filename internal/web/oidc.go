@@ -0,0 +1,109 @@
+package web
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+
+	"github.com/YooLeon/container-debug-online/internal/audit"
+	"github.com/YooLeon/container-debug-online/internal/oidc"
+	"go.uber.org/zap"
+)
+
+// oidcStateCookie 将登录的 state 绑定到发起登录的浏览器
+const oidcStateCookie = "container_debug_oidc_state"
+
+// WithOIDC 启用 OIDC 单点登录，需要同时通过 WithSessions 启用会话
+func WithOIDC(provider *oidc.Provider) Option {
+	return func(h *Handler) {
+		h.oidc = provider
+	}
+}
+
+// OIDCLoginHandler 跳转到 OIDC 提供方开始登录
+func (h *Handler) OIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if h.sessions == nil || h.oidc == nil {
+		http.Error(w, "Single sign-on is not enabled", http.StatusNotFound)
+		return
+	}
+
+	authURL, state, err := h.oidc.AuthCodeURL()
+	if err != nil {
+		h.logger.Error("Failed to start single sign-on", zap.Error(err))
+		http.Error(w, "Failed to start single sign-on", http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/oidc",
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   secureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCCallbackHandler 处理提供方的回调，校验 ID token 后创建会话并跳转到首页
+// 失败时跳转回登录页
+func (h *Handler) OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if h.sessions == nil || h.oidc == nil {
+		http.Error(w, "Single sign-on is not enabled", http.StatusNotFound)
+		return
+	}
+	w, record := h.audit(w, r, audit.ActionLogin)
+	defer record.finish()
+	// 不记录授权码和 state
+	record.set(func(event *audit.Event) { event.Params = map[string]string{"method": "oidc"} })
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Path:     "/oidc",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   secureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	fail := func(reason string, fields ...zap.Field) {
+		record.fail(errors.New(reason))
+		h.logger.Warn("Single sign-on failed", append(fields,
+			zap.String("reason", reason),
+			zap.String("remote", r.RemoteAddr))...)
+		http.Redirect(w, r, "/login.html?error=sso", http.StatusFound)
+	}
+
+	query := r.URL.Query()
+	if errCode := query.Get("error"); errCode != "" {
+		fail("provider returned an error", zap.String("error", errCode), zap.String("description", query.Get("error_description")))
+		return
+	}
+	state := query.Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		fail("state does not match the browser")
+		return
+	}
+	identity, err := h.oidc.Exchange(r.Context(), state, query.Get("code"))
+	if err != nil {
+		fail("invalid authorization response", zap.Error(err))
+		return
+	}
+
+	record.set(func(event *audit.Event) { event.User = identity.User })
+
+	session, value, err := h.sessions.Create(identity.User, identity.Groups)
+	if err != nil {
+		h.logger.Error("Failed to create session", zap.Error(err))
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+	h.logger.Info("User logged in",
+		zap.String("user", identity.User),
+		zap.Strings("groups", identity.Groups),
+		zap.String("method", "oidc"),
+		zap.String("remote", r.RemoteAddr))
+
+	http.SetCookie(w, h.sessions.Cookie(value, session, secureRequest(r)))
+	http.Redirect(w, r, "/", http.StatusFound)
+}
@@ -0,0 +1,124 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/YooLeon/container-debug-online/internal/patterns"
+	"github.com/YooLeon/container-debug-online/internal/rbac"
+)
+
+// 模板报告参数的默认值
+const (
+	defaultPatternWindow   = 15 * time.Minute
+	defaultPatternBaseline = time.Hour
+	defaultPatternFactor   = 3
+	defaultPatternMinCount = 5
+)
+
+// WithPatternTracker 启用日志模板接口，tracker 关联到其所跟踪的主机
+func WithPatternTracker(tracker *patterns.Tracker) Option {
+	return func(h *Handler) {
+		if host, ok := h.hosts[tracker.Host()]; ok {
+			host.patterns = tracker
+		}
+	}
+}
+
+// PatternsResponse 表示模板报告
+type PatternsResponse struct {
+	Start         time.Time          `json:"start"`
+	End           time.Time          `json:"end"`
+	BaselineStart time.Time          `json:"baseline_start"`
+	Patterns      []patterns.Pattern `json:"patterns"`
+}
+
+// PatternsHandler 返回最近 window 内新出现或突增的日志模板，与之前 baseline 时长内的频率比较
+//
+//	services   服务列表，默认所有服务
+//	window     比较窗口，默认 15m
+//	baseline   窗口之前的基线时长，默认 1h
+//	factor     频率达到基线的倍数视为突增，默认 3
+//	min_count  窗口内至少出现的次数才视为突增，默认 5
+//	all        为 true 时包含没有变化的模板
+func (h *Handler) PatternsHandler(w http.ResponseWriter, r *http.Request) {
+	host, ok := h.hostFor(w, r)
+	if !ok {
+		return
+	}
+	if host.patterns == nil {
+		http.Error(w, "Pattern detection is not enabled", http.StatusNotFound)
+		return
+	}
+	if !h.authorizeAny(w, r, rbac.ActionLogs) {
+		return
+	}
+
+	query := r.URL.Query()
+	window, err := durationParam(query.Get("window"), defaultPatternWindow)
+	if err != nil {
+		http.Error(w, "invalid window: "+query.Get("window"), http.StatusBadRequest)
+		return
+	}
+	baseline, err := durationParam(query.Get("baseline"), defaultPatternBaseline)
+	if err != nil {
+		http.Error(w, "invalid baseline: "+query.Get("baseline"), http.StatusBadRequest)
+		return
+	}
+	factor := float64(defaultPatternFactor)
+	if value := query.Get("factor"); value != "" {
+		if factor, err = strconv.ParseFloat(value, 64); err != nil || factor <= 0 {
+			http.Error(w, "invalid factor: "+value, http.StatusBadRequest)
+			return
+		}
+	}
+	minCount, err := intParam(query.Get("min_count"), defaultPatternMinCount, int(^uint(0)>>1))
+	if err != nil {
+		http.Error(w, "invalid min_count: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	all, _ := strconv.ParseBool(query.Get("all"))
+
+	end := time.Now()
+	options := patterns.ReportOptions{
+		Services:      splitList(query.Get("services")),
+		Start:         end.Add(-window),
+		End:           end,
+		BaselineStart: end.Add(-window - baseline),
+		Factor:        factor,
+		MinCount:      minCount,
+		All:           all,
+	}
+
+	report := host.patterns.Report(options)
+	project := host.monitor.Project()
+	visible := report[:0]
+	for _, pattern := range report {
+		if h.allowed(r, rbac.ActionLogs, serviceResource(project, pattern.Service, "")) {
+			visible = append(visible, pattern)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(PatternsResponse{
+		Start:         options.Start,
+		End:           options.End,
+		BaselineStart: options.BaselineStart,
+		Patterns:      visible,
+	})
+}
+
+// durationParam 解析正的时长参数，为空时返回 defaultValue
+func durationParam(value string, defaultValue time.Duration) (time.Duration, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid duration: %s", value)
+	}
+	return d, nil
+}
@@ -0,0 +1,118 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/YooLeon/container-debug-online/internal/audit"
+	"github.com/YooLeon/container-debug-online/internal/auth"
+	"go.uber.org/zap"
+)
+
+// WithSessions 启用登录页使用的会话接口，users 为 nil 时只能通过单点登录创建会话
+func WithSessions(users *auth.Users, sessions *auth.Sessions) Option {
+	return func(h *Handler) {
+		h.users = users
+		h.sessions = sessions
+	}
+}
+
+// LoginRequest 登录请求
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// LoginMethods 登录页可用的登录方式
+type LoginMethods struct {
+	Password bool `json:"password"`
+	OIDC     bool `json:"oidc"`
+}
+
+// LoginHandler GET 返回可用的登录方式；POST 校验账号密码，成功后设置会话 cookie 并返回会话信息（含 CSRF 令牌）
+func (h *Handler) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(LoginMethods{
+			Password: h.sessions != nil && h.users != nil,
+			OIDC:     h.sessions != nil && h.oidc != nil,
+		})
+		return
+	}
+
+	if h.sessions == nil || h.users == nil {
+		http.Error(w, "Password login is not enabled", http.StatusNotFound)
+		return
+	}
+	w, record := h.audit(w, r, audit.ActionLogin)
+	defer record.finish()
+	record.param("method", "password")
+
+	var req LoginRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		http.Error(w, "Invalid login request", http.StatusBadRequest)
+		return
+	}
+	record.set(func(event *audit.Event) { event.User = req.Username })
+	if !h.users.Authenticate(req.Username, req.Password) {
+		h.logger.Warn("Login failed",
+			zap.String("user", req.Username),
+			zap.String("remote", r.RemoteAddr))
+		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+		return
+	}
+
+	session, value, err := h.sessions.Create(req.Username, nil)
+	if err != nil {
+		h.logger.Error("Failed to create session", zap.Error(err))
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+	h.logger.Info("User logged in",
+		zap.String("user", req.Username),
+		zap.String("remote", r.RemoteAddr))
+
+	http.SetCookie(w, h.sessions.Cookie(value, session, secureRequest(r)))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
+
+// LogoutHandler 删除会话并清除 cookie
+func (h *Handler) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if h.sessions == nil {
+		http.Error(w, "Login is not enabled", http.StatusNotFound)
+		return
+	}
+	w, record := h.audit(w, r, audit.ActionLogout)
+	defer record.finish()
+
+	if cookie, err := r.Cookie(auth.SessionCookie); err == nil {
+		h.sessions.Delete(cookie.Value)
+	}
+	http.SetCookie(w, auth.ClearCookie(secureRequest(r)))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SessionHandler 返回当前会话，前端用来获取 CSRF 令牌
+// 使用 Basic 认证时只返回用户名
+func (h *Handler) SessionHandler(w http.ResponseWriter, r *http.Request) {
+	if h.sessions == nil {
+		http.Error(w, "Login is not enabled", http.StatusNotFound)
+		return
+	}
+
+	session := &auth.Session{User: auth.UserFromContext(r.Context())}
+	if cookie, err := r.Cookie(auth.SessionCookie); err == nil {
+		if current, ok := h.sessions.Get(cookie.Value); ok {
+			session = current
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
+
+// secureRequest 判断请求是否通过 HTTPS 到达，包括经过反向代理的情况
+func secureRequest(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
@@ -1,3 +1,26 @@
+// 登录会话的 CSRF 令牌，修改状态的请求需要携带
+let csrfToken = '';
+
+// api 发送 API 请求，未登录时跳转到登录页
+async function api(url, options = {}) {
+    const headers = Object.assign({ 'X-Requested-With': 'XMLHttpRequest' }, options.headers);
+    const method = (options.method || 'GET').toUpperCase();
+    if (csrfToken && !['GET', 'HEAD', 'OPTIONS'].includes(method)) {
+        headers['X-CSRF-Token'] = csrfToken;
+    }
+    const response = await fetch(url, Object.assign({}, options, { headers, credentials: 'same-origin' }));
+    if (response.status === 401) {
+        window.location.href = '/login.html';
+    }
+    return response;
+}
+
+// wsURL 返回与页面协议一致的 WebSocket 地址，HTTPS 页面使用 wss
+function wsURL(path) {
+    const scheme = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
+    return `${scheme}//${window.location.host}${path}`;
+}
+
 class TerminalManager {
     constructor() {
         this.terminals = new Map();
@@ -6,8 +29,12 @@ class TerminalManager {
         this.isServerConnected = true;
         this.checkInterval = null;
         this.containerLoadInterval = null;
+        this.host = '';
+        this.hosts = [];
 
-        // 初始化时加载容器列表
+        // 初始化时加载会话、主机和容器列表
+        this.loadSession();
+        this.loadHosts();
         this.loadContainers();
         // 启动定期更新
         this.startContainerUpdates();
@@ -33,9 +60,81 @@ class TerminalManager {
         `;
     }
 
+    // loadSession 获取 CSRF 令牌并显示退出按钮，未启用认证时接口返回 404
+    async loadSession() {
+        try {
+            const response = await api('/session');
+            if (!response.ok) return;
+            const session = await response.json();
+            csrfToken = session.csrf_token || '';
+            if (!csrfToken) return;
+
+            const logoutBtn = document.createElement('button');
+            logoutBtn.className = 'action-btn logout-btn';
+            logoutBtn.innerHTML = '<i class="fas fa-sign-out-alt"></i>';
+            logoutBtn.title = `退出 ${session.user}`;
+            logoutBtn.onclick = async () => {
+                await api('/logout', { method: 'POST' });
+                window.location.href = '/login.html';
+            };
+            document.querySelector('.sidebar-header h2').appendChild(logoutBtn);
+        } catch (error) {
+            console.error('Failed to load session:', error);
+        }
+    }
+
+    async loadHosts() {
+        try {
+            const response = await api('/hosts');
+            if (!response.ok) return;
+            this.hosts = await response.json();
+            this.updateHostSelector();
+        } catch (error) {
+            console.error('Failed to load hosts:', error);
+        }
+    }
+
+    updateHostSelector() {
+        let selector = document.getElementById('host-selector');
+        // 只有一个主机时不显示选择器
+        if (this.hosts.length <= 1) {
+            if (selector) selector.remove();
+            return;
+        }
+
+        if (!selector) {
+            selector = document.createElement('select');
+            selector.id = 'host-selector';
+            selector.className = 'host-selector';
+            selector.onchange = () => {
+                this.host = selector.value;
+                this.loadContainers();
+            };
+            document.querySelector('.sidebar-header').appendChild(selector);
+        }
+
+        selector.innerHTML = '';
+        this.hosts.forEach(host => {
+            const option = document.createElement('option');
+            option.value = host.name;
+            option.textContent = `${host.name} (${host.healthy_services}/${host.services})`;
+            if (host.name === this.host || (!this.host && host.default)) {
+                option.selected = true;
+            }
+            selector.appendChild(option);
+        });
+        this.host = selector.value;
+    }
+
+    // hostParam 返回当前主机的查询参数
+    hostParam() {
+        return this.host ? `host=${encodeURIComponent(this.host)}` : '';
+    }
+
     async loadContainers() {
         try {
-            const response = await fetch('/containers');
+            const hostParam = this.hostParam();
+            const response = await api(`/containers${hostParam ? '?' + hostParam : ''}`);
             const containers = await response.json();
             this.containers = containers;
             this.updateContainerList();
@@ -76,6 +175,13 @@ class TerminalManager {
                 } else {
                     status.textContent = container.status;
                 }
+                if (container.crash_loop) {
+                    status.textContent += ' · crash loop';
+                    status.classList.add('crash-loop');
+                }
+                if (container.restart_count > 0) {
+                    status.title = `Restarts: ${container.restart_count}${container.oom_killed ? '\nOOM killed' : ''}`;
+                }
             }
             
             if (container.health_status) {
@@ -96,15 +202,16 @@ class TerminalManager {
             connectBtn.innerHTML = `<i class="fas fa-terminal"></i> ${this.ws.has(container.id) ? 'Connected' : 'Connect'}`;
             
             // 检查容器是否可连接
+            const allowed = action => !container.actions || container.actions.includes(action);
             const canConnect = container.status.toLowerCase() === 'running' && container.id;
             
-            if (!this.isServerConnected || !canConnect) {
+            if (!this.isServerConnected || !canConnect || !allowed('terminal')) {
                 connectBtn.disabled = true;
                 connectBtn.classList.add('disabled');
                 // 添加提示信息
-                connectBtn.title = !this.isServerConnected ? '服务器未连接' : '容器未运行';
+                connectBtn.title = !this.isServerConnected ? '服务器未连接' : !canConnect ? '容器未运行' : '没有终端权限';
             } else {
-                connectBtn.onclick = () => this.connectToContainer(container.id, container.service);
+                connectBtn.onclick = () => this.connectToContainer(container.id, container.service, container.host);
             }
             
             const logsBtn = document.createElement('button');
@@ -112,12 +219,12 @@ class TerminalManager {
             logsBtn.innerHTML = '<i class="fas fa-file-alt"></i> Logs';
             
             // 日志按钮只在容器有 ID 时可用
-            if (!this.isServerConnected || !container.id) {
+            if (!this.isServerConnected || !container.id || !allowed('logs')) {
                 logsBtn.disabled = true;
                 logsBtn.classList.add('disabled');
-                logsBtn.title = !this.isServerConnected ? '服务器未连接' : '容器未创建';
+                logsBtn.title = !this.isServerConnected ? '服务器未连接' : !container.id ? '容器未创建' : '没有日志权限';
             } else {
-                logsBtn.onclick = () => this.showContainerLogs(container.id, container.service);
+                logsBtn.onclick = () => this.showContainerLogs(container.id, container.service, container.host);
             }
             
             actions.appendChild(healthStatus);
@@ -304,7 +411,7 @@ class TerminalManager {
         }
     }
 
-    async connectToContainer(containerId, containerName) {
+    async connectToContainer(containerId, containerName, host = '') {
         try {
             if (this.terminals.has(containerId)) {
                 return;
@@ -312,7 +419,7 @@ class TerminalManager {
 
             const { terminal, content } = this.createTerminal(containerId, containerName);
             
-            const ws = new WebSocket(`ws://${window.location.host}/ws?container=${containerId}`);
+            const ws = new WebSocket(wsURL(`/ws?container=${containerId}&host=${encodeURIComponent(host)}`));
             
             ws.onopen = () => {
                 this.terminals.set(containerId, {
@@ -404,7 +511,7 @@ class TerminalManager {
         this.updateContainerList();
     }
 
-    showContainerLogs(containerId, serviceName) {
+    showContainerLogs(containerId, serviceName, host = '') {
         // 先清理之前的 WebSocket 连接
         if (this.logWs) {
             this.logWs.close();
@@ -470,7 +577,7 @@ class TerminalManager {
             }
         });
 
-        const ws = new WebSocket(`ws://${window.location.host}/container/logs?container=${containerId}`);
+        const ws = new WebSocket(wsURL(`/container/logs?container=${containerId}&host=${encodeURIComponent(host)}&format=json`));
         
         ws.onopen = () => {
             console.log('Log WebSocket connected');
@@ -479,7 +586,7 @@ class TerminalManager {
 
         ws.onmessage = (event) => {
             const wasScrolledToBottom = autoScroll;
-            logsContent.textContent += event.data;
+            this.appendLogFrame(logsContent, event.data);
             
             // 只有在之前处于底部时才自动滚动
             if (wasScrolledToBottom) {
@@ -505,7 +612,7 @@ class TerminalManager {
         closeBtn.onclick = closeModal;
         downloadBtn.onclick = async () => {
             try {
-                const response = await fetch(`/container/logs/download?container=${containerId}`);
+                const response = await api(`/container/logs/download?container=${containerId}&host=${encodeURIComponent(host)}`);
                 if (!response.ok) throw new Error('Failed to download logs');
                 
                 const blob = await response.blob();
@@ -531,6 +638,27 @@ class TerminalManager {
         this.logWs = ws;
     }
 
+    // 将一条 JSON 日志帧追加到日志面板，stderr 使用不同颜色
+    appendLogFrame(logsContent, data) {
+        let frame;
+        try {
+            frame = JSON.parse(data);
+        } catch (e) {
+            // 错误信息以纯文本发送
+            logsContent.appendChild(document.createTextNode(data + '\n'));
+            return;
+        }
+
+        const line = document.createElement('span');
+        line.className = `log-line ${frame.stream}`;
+        if (frame.level) {
+            line.classList.add(`level-${frame.level}`);
+        }
+        line.dataset.ts = frame.ts;
+        line.textContent = `${frame.ts} ${frame.line}\n`;
+        logsContent.appendChild(line);
+    }
+
     handleDisconnect(containerId) {
         // 清理 WebSocket
         if (this.ws.has(containerId)) {
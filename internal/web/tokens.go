@@ -0,0 +1,207 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/YooLeon/container-debug-online/internal/audit"
+	"github.com/YooLeon/container-debug-online/internal/auth"
+	"github.com/YooLeon/container-debug-online/internal/rbac"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultTokenTTL 未指定 expires_in 时令牌的有效期
+	defaultTokenTTL = 30 * 24 * time.Hour
+	// maxTokenTTL 令牌的最长有效期
+	maxTokenTTL = 365 * 24 * time.Hour
+	// maxGroupTokenTTL 继承了用户所属组的令牌的最长有效期
+	// 组来自单点登录，只在创建时读取，用户离开组后令牌仍保留组的权限直到过期
+	maxGroupTokenTTL = 7 * 24 * time.Hour
+)
+
+// WithTokens 启用 API 令牌管理接口
+func WithTokens(tokens *auth.Tokens) Option {
+	return func(h *Handler) {
+		h.tokens = tokens
+	}
+}
+
+// TokenRequest 创建 API 令牌的请求
+type TokenRequest struct {
+	Name      string        `json:"name"`
+	User      string        `json:"user"` // 为空时为当前用户，为其他用户（如服务账号）创建需要 admin 权限
+	Actions   []rbac.Action `json:"actions"`
+	Projects  []string      `json:"projects"`
+	ExpiresIn string        `json:"expires_in"` // 例如 "720h"，默认 30 天，最长一年
+}
+
+// TokenResponse 创建令牌的响应，Value 只在创建时返回
+type TokenResponse struct {
+	auth.Token
+	Value string `json:"token"`
+}
+
+// TokensHandler 查询或创建 API 令牌
+// 用户只能看到自己的令牌和自己创建的令牌，令牌管理员可以看到所有令牌并为其他用户创建令牌
+func (h *Handler) TokensHandler(w http.ResponseWriter, r *http.Request) {
+	// 只审计创建
+	var record *auditRecord
+	if r.Method == http.MethodPost {
+		w, record = h.audit(w, r, audit.ActionTokenCreate)
+		defer record.finish()
+	}
+
+	user, ok := h.tokenManager(w, r)
+	if !ok {
+		return
+	}
+	admin := h.tokenAdmin(r)
+
+	if r.Method != http.MethodPost {
+		visible := make([]auth.Token, 0)
+		for _, token := range h.tokens.List() {
+			if admin || ownsToken(user, &token) {
+				visible = append(visible, token)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(visible)
+		return
+	}
+
+	var req TokenRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		http.Error(w, "Invalid token request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	ttl := defaultTokenTTL
+	if req.ExpiresIn != "" {
+		var err error
+		if ttl, err = time.ParseDuration(req.ExpiresIn); err != nil || ttl <= 0 || ttl > maxTokenTTL {
+			http.Error(w, "Invalid expires_in: must be a positive duration of at most 8760h", http.StatusBadRequest)
+			return
+		}
+	}
+
+	token := auth.Token{
+		Name:      req.Name,
+		User:      req.User,
+		Scope:     rbac.Scope{Actions: req.Actions, Projects: req.Projects},
+		CreatedBy: user,
+		ExpiresAt: time.Now().Add(ttl).UTC(),
+	}
+	if token.User == "" || token.User == user {
+		token.User = user
+		token.Groups = auth.GroupsFromContext(r.Context())
+	} else if !admin {
+		h.forbidden(w, r, rbac.ActionAdmin)
+		return
+	}
+	if len(token.Groups) > 0 && ttl > maxGroupTokenTTL {
+		token.ExpiresAt = time.Now().Add(maxGroupTokenTTL).UTC()
+	}
+	// 账号文件中的账号被删除后令牌随之失效，见 middleware.AuthMiddleware
+	if h.users != nil {
+		if h.users.Has(token.User) {
+			token.Accounts = append(token.Accounts, token.User)
+		}
+		if token.CreatedBy != token.User && h.users.Has(token.CreatedBy) {
+			token.Accounts = append(token.Accounts, token.CreatedBy)
+		}
+	}
+
+	record.param("name", token.Name)
+	record.param("user", token.User)
+	record.param("actions", joinActions(token.Scope.Actions))
+	record.param("projects", strings.Join(token.Scope.Projects, ","))
+	record.param("expires", token.ExpiresAt.Format(time.RFC3339))
+	created, value, err := h.tokens.Create(token)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	record.set(func(event *audit.Event) { event.Target = created.ID })
+	h.logger.Info("API token created",
+		zap.String("token", created.ID),
+		zap.String("name", created.Name),
+		zap.String("user", created.User),
+		zap.String("created_by", user),
+		zap.Time("expires", created.ExpiresAt))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(TokenResponse{Token: *created, Value: value})
+}
+
+// RevokeTokenHandler 吊销 API 令牌，只能吊销自己的令牌，令牌管理员可以吊销所有令牌
+func (h *Handler) RevokeTokenHandler(w http.ResponseWriter, r *http.Request) {
+	w, record := h.audit(w, r, audit.ActionTokenRevoke)
+	defer record.finish()
+	id := mux.Vars(r)["id"]
+	record.set(func(event *audit.Event) { event.Target = id })
+
+	user, ok := h.tokenManager(w, r)
+	if !ok {
+		return
+	}
+
+	token, ok := h.tokens.Get(id)
+	if !ok || (!ownsToken(user, token) && !h.tokenAdmin(r)) {
+		http.Error(w, "Token not found", http.StatusNotFound)
+		return
+	}
+	if err := h.tokens.Revoke(id); err != nil {
+		h.logger.Error("Failed to revoke API token", zap.String("token", id), zap.Error(err))
+		http.Error(w, "Failed to revoke token", http.StatusInternalServerError)
+		return
+	}
+	h.logger.Info("API token revoked",
+		zap.String("token", id),
+		zap.String("name", token.Name),
+		zap.String("user", token.User),
+		zap.String("revoked_by", user))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// tokenAdmin 判断用户能否管理所有人的令牌：需要不限范围的 admin 权限
+// 以其他用户身份创建令牌相当于冒用其身份，因此未配置权限策略时没有令牌管理员
+func (h *Handler) tokenAdmin(r *http.Request) bool {
+	return h.policy != nil && h.policy.AllowedGlobal(subject(r), rbac.ActionAdmin)
+}
+
+// tokenManager 检查请求能否管理令牌，返回当前用户
+// 令牌只能由登录的用户管理，不能用令牌创建或吊销令牌
+func (h *Handler) tokenManager(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if h.tokens == nil {
+		http.Error(w, "API tokens are not enabled", http.StatusNotFound)
+		return "", false
+	}
+	user := auth.UserFromContext(r.Context())
+	if user == "" {
+		http.Error(w, "API tokens require authentication", http.StatusForbidden)
+		return "", false
+	}
+	if auth.TokenFromContext(r.Context()) != nil {
+		http.Error(w, "API tokens cannot manage tokens", http.StatusForbidden)
+		return "", false
+	}
+	return user, true
+}
+
+// joinActions 将操作列表转换为逗号分隔的字符串
+func joinActions(actions []rbac.Action) string {
+	names := make([]string, len(actions))
+	for i, action := range actions {
+		names[i] = string(action)
+	}
+	return strings.Join(names, ",")
+}
+
+// ownsToken 判断令牌属于用户或由用户创建
+func ownsToken(user string, token *auth.Token) bool {
+	return token.User == user || token.CreatedBy == user
+}
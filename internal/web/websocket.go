@@ -0,0 +1,168 @@
+package web
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/YooLeon/container-debug-online/internal/auth"
+	"github.com/YooLeon/container-debug-online/internal/metrics"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+// WebSocketOptions 限制终端和日志的 WebSocket 连接
+type WebSocketOptions struct {
+	AllowedOrigins     []string // 同源之外允许的 Origin，支持 glob，例如 https://*.example.com，"*" 表示允许所有
+	MaxSessions        int      // 所有用户同时打开的会话数，0 表示不限
+	MaxSessionsPerUser int      // 每个用户同时打开的会话数，未认证的请求按来源 IP 计算，0 表示不限
+	MaxMessageSize     int64    // 客户端消息的最大字节数，超过时关闭连接
+}
+
+// DefaultWebSocketOptions 默认只允许同源连接
+var DefaultWebSocketOptions = WebSocketOptions{
+	MaxSessions:        256,
+	MaxSessionsPerUser: 16,
+	MaxMessageSize:     64 << 10,
+}
+
+// Validate 检查 Origin 格式
+func (o WebSocketOptions) Validate() error {
+	for _, origin := range o.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		if _, err := path.Match(origin, ""); err != nil {
+			return fmt.Errorf("invalid origin pattern %q", origin)
+		}
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" {
+			return fmt.Errorf("origin %q must be scheme://host[:port]", origin)
+		}
+	}
+	if o.MaxSessions < 0 || o.MaxSessionsPerUser < 0 || o.MaxMessageSize <= 0 {
+		return fmt.Errorf("session limits must not be negative and the message size limit must be positive")
+	}
+	return nil
+}
+
+// WithWebSocketOptions 设置 WebSocket 的 Origin 检查和连接限制
+func WithWebSocketOptions(opts WebSocketOptions) Option {
+	return func(h *Handler) {
+		h.wsOptions = opts
+	}
+}
+
+// wsLimiter 统计打开的会话数
+type wsLimiter struct {
+	mu    sync.Mutex
+	total int
+	users map[string]int
+}
+
+// acquire 在未超出限制时占用一个会话
+func (l *wsLimiter) acquire(key string, opts WebSocketOptions) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if (opts.MaxSessions > 0 && l.total >= opts.MaxSessions) ||
+		(opts.MaxSessionsPerUser > 0 && l.users[key] >= opts.MaxSessionsPerUser) {
+		return false
+	}
+	l.total++
+	l.users[key]++
+	return true
+}
+
+func (l *wsLimiter) release(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.total--
+	if l.users[key]--; l.users[key] <= 0 {
+		delete(l.users, key)
+	}
+}
+
+// upgrade 检查 Origin 和会话数后将请求升级为 WebSocket，失败时已写入响应
+// 返回的函数在会话结束时调用，关闭连接并释放会话
+func (h *Handler) upgrade(w http.ResponseWriter, r *http.Request, kind string) (*websocket.Conn, func(), bool) {
+	if !h.checkOrigin(r) {
+		metrics.RejectWebSocket(kind, "origin")
+		h.logger.Warn("WebSocket origin rejected",
+			zap.String("origin", r.Header.Get("Origin")),
+			zap.String("user", auth.UserFromContext(r.Context())),
+			zap.String("remote", r.RemoteAddr),
+			zap.String("path", r.URL.Path))
+		http.Error(w, "Origin not allowed", http.StatusForbidden)
+		return nil, nil, false
+	}
+
+	key := sessionKey(r)
+	if !h.wsSessions.acquire(key, h.wsOptions) {
+		metrics.RejectWebSocket(kind, "limit")
+		h.logger.Warn("WebSocket session limit reached",
+			zap.String("kind", kind),
+			zap.String("user", auth.UserFromContext(r.Context())),
+			zap.String("remote", r.RemoteAddr))
+		http.Error(w, "Too many open sessions", http.StatusTooManyRequests)
+		return nil, nil, false
+	}
+
+	// Origin 已检查过
+	upgrader := websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		h.wsSessions.release(key)
+		h.logger.Error("Failed to upgrade connection", zap.Error(err))
+		return nil, nil, false
+	}
+	ws.SetReadLimit(h.wsOptions.MaxMessageSize)
+
+	done := metrics.TrackWebSocket(kind)
+	return ws, func() {
+		ws.Close()
+		done()
+		h.wsSessions.release(key)
+	}, true
+}
+
+// checkOrigin 允许没有 Origin 的非浏览器客户端、同源请求和配置中允许的 Origin
+// 同源需要协议和主机都相同，HTTP 页面不能连接 HTTPS 服务的 WebSocket
+func (h *Handler) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	scheme := "http"
+	if secureRequest(r) {
+		scheme = "https"
+	}
+	u, err := url.Parse(origin)
+	if err == nil && strings.EqualFold(u.Scheme, scheme) && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	for _, pattern := range h.wsOptions.AllowedOrigins {
+		if pattern == "*" {
+			return true
+		}
+		if ok, _ := path.Match(strings.ToLower(pattern), origin); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// sessionKey 按用户计算会话数，未认证的请求按来源 IP
+func sessionKey(r *http.Request) string {
+	if user := auth.UserFromContext(r.Context()); user != "" {
+		return "user:" + user
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
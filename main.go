@@ -1,26 +1,45 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/YooLeon/container-debug-online/internal/alert"
+	"github.com/YooLeon/container-debug-online/internal/archive"
+	"github.com/YooLeon/container-debug-online/internal/audit"
+	"github.com/YooLeon/container-debug-online/internal/auth"
 	"github.com/YooLeon/container-debug-online/internal/config"
 	"github.com/YooLeon/container-debug-online/internal/docker"
-	"github.com/YooLeon/container-debug-online/internal/middleware"
+	"github.com/YooLeon/container-debug-online/internal/metrics"
+	"github.com/YooLeon/container-debug-online/internal/oidc"
+	"github.com/YooLeon/container-debug-online/internal/patterns"
+	"github.com/YooLeon/container-debug-online/internal/rbac"
+	"github.com/YooLeon/container-debug-online/internal/runtime"
+	"github.com/YooLeon/container-debug-online/internal/tlsutil"
 	"github.com/YooLeon/container-debug-online/internal/web"
 
-	"github.com/docker/docker/client"
-	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 )
 
 func main() {
+	// hash-password 子命令：从标准输入读取密码，输出用于账号文件的 bcrypt 哈希
+	if len(os.Args) > 1 && os.Args[1] == "hash-password" {
+		if err := hashPassword(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// 加载配置
 	cfg := config.LoadConfig()
 
@@ -34,85 +53,264 @@ func main() {
 	// 替换全局logger
 	zap.ReplaceGlobals(logger)
 
-	// 创建 Docker client
-	cli, err := client.NewClientWithOpts(client.FromEnv)
-	if err != nil {
-		zap.L().Fatal("Failed to create docker client", zap.Error(err))
+	// 加载 Docker 主机配置，未指定时使用环境变量中的本地引擎
+	hosts := []config.HostConfig{{Name: config.DefaultHostName, Runtime: cfg.Runtime}}
+	if cfg.HostsPath != "" {
+		hosts, err = config.LoadHostsConfig(cfg.HostsPath)
+		if err != nil {
+			zap.L().Fatal("Failed to load hosts config", zap.Error(err))
+		}
+	}
+
+	// 加载告警规则
+	var alertEngine *alert.Engine
+	if cfg.AlertRulesPath != "" {
+		alertConfig, err := alert.LoadConfig(cfg.AlertRulesPath)
+		if err != nil {
+			zap.L().Fatal("Failed to load alert rules", zap.Error(err))
+		}
+		alertEngine = alert.NewEngine(alertConfig, zap.L())
+		defer alertEngine.Close()
+	}
+
+	var monitors []*docker.Monitor
+	var handlerOpts []web.Option
+	for _, host := range hosts {
+		// 创建容器运行时
+		rt, err := runtime.New(host)
+		if err != nil {
+			zap.L().Fatal("Failed to create container runtime", zap.Error(err))
+		}
+
+		// 加载 compose 配置
+		composePath := host.Compose
+		if composePath == "" {
+			composePath = cfg.ComposePath
+		}
+		composeConfig, err := config.LoadComposeConfig(composePath)
+		if err != nil {
+			zap.L().Fatal("Failed to load compose config", zap.String("host", host.Name), zap.Error(err))
+		}
+		composeConfig.Project = host.Project
+
+		// 创建 Docker 监控器
+		monitor := docker.NewMonitor(host.Name, rt, zap.L(), cfg.MonitorInterval, composeConfig)
+		defer monitor.Close()
+		monitors = append(monitors, monitor)
+
+		// 注册 Prometheus 状态采集器
+		if err := metrics.Register(monitor); err != nil {
+			zap.L().Fatal("Failed to register metrics collector", zap.Error(err))
+		}
+
+		// 创建崩溃检测器
+		crashTracker := docker.NewCrashTracker(monitor, docker.CrashOptions{
+			LoopRestarts: cfg.CrashLoopCount,
+			LoopWindow:   cfg.CrashLoopWindow,
+			LogLines:     cfg.CrashLogLines,
+		})
+		handlerOpts = append(handlerOpts, web.WithCrashTracker(crashTracker))
+
+		if alertEngine != nil {
+			alertEngine.Watch(monitor)
+		}
+
+		// 创建日志归档器
+		if cfg.LogArchiveDir != "" {
+			collector, err := archive.NewCollector(monitor, archive.Options{
+				Dir:         cfg.LogArchiveDir,
+				SegmentSize: cfg.LogArchiveSegmentSize,
+				SegmentAge:  cfg.LogArchiveSegmentAge,
+				Retention:   cfg.LogArchiveRetention,
+			}, zap.L())
+			if err != nil {
+				zap.L().Fatal("Failed to create log archive", zap.String("host", host.Name), zap.Error(err))
+			}
+			collector.Start()
+			defer collector.Close()
+			handlerOpts = append(handlerOpts, web.WithLogArchive(collector))
+		}
+
+		// 创建日志模板跟踪器
+		if cfg.LogPatterns {
+			tracker := patterns.NewTracker(monitor, cfg.LogPatternsRetention, zap.L())
+			tracker.Start()
+			defer tracker.Close()
+			handlerOpts = append(handlerOpts, web.WithPatternTracker(tracker))
+		}
+	}
+	if alertEngine != nil {
+		handlerOpts = append(handlerOpts, web.WithAlertEngine(alertEngine))
+	}
+
+	// 加载权限策略
+	if cfg.PolicyPath != "" {
+		policy, err := rbac.LoadPolicy(cfg.PolicyPath)
+		if err != nil {
+			zap.L().Fatal("Failed to load access policy", zap.Error(err))
+		}
+		handlerOpts = append(handlerOpts, web.WithPolicy(policy))
 	}
 
-	// 加载 compose 配置
-	composeConfig, err := config.LoadComposeConfig(cfg.ComposePath)
+	// 加载账号，启用认证时同时启用登录会话
+	users, err := loadUsers(cfg)
 	if err != nil {
-		zap.L().Fatal("Failed to load compose config", zap.Error(err))
+		zap.L().Fatal("Failed to load users", zap.Error(err))
 	}
 
-	// 创建 Docker 监控器
-	monitor := docker.NewMonitor(cli, zap.L(), cfg.MonitorInterval, composeConfig)
-	defer monitor.Close()
+	// 加载单点登录配置，提供方的发现文档在启动时获取
+	var oidcProvider *oidc.Provider
+	if cfg.OIDCPath != "" {
+		oidcConfig, err := oidc.LoadConfig(cfg.OIDCPath)
+		if err != nil {
+			zap.L().Fatal("Failed to load OIDC config", zap.Error(err))
+		}
+		if oidcProvider, err = oidc.NewProvider(context.Background(), oidcConfig); err != nil {
+			zap.L().Fatal("Failed to create OIDC provider", zap.Error(err))
+		}
+		handlerOpts = append(handlerOpts, web.WithOIDC(oidcProvider))
+	}
 
-	// 创建 HTTP handler
-	webHandler := web.NewHandler(monitor)
+	// TLS 配置，启用客户端证书认证时同样需要认证
+	tlsConfig, err := tlsutil.ServerConfig(tlsutil.Options{
+		CertFile:     cfg.TLSCert,
+		KeyFile:      cfg.TLSKey,
+		SelfSigned:   cfg.TLSSelfSigned,
+		ClientCAFile: cfg.TLSClientCA,
+		ClientAuth:   cfg.TLSClientAuth,
+	})
+	if err != nil {
+		zap.L().Fatal("Invalid TLS configuration", zap.Error(err))
+	}
+	if cfg.TLSSelfSigned {
+		zap.L().Warn("Serving a self-signed certificate, do not use in production",
+			zap.String("sha256", tlsutil.Fingerprint(tlsConfig.Certificates[0])))
+	}
 
-	// 创建路由器
-	router := mux.NewRouter()
+	var sessions *auth.Sessions
+	if users != nil || oidcProvider != nil || cfg.TLSClientCA != "" {
+		if sessions, err = auth.NewSessions(cfg.SessionTTL); err != nil {
+			zap.L().Fatal("Failed to create session store", zap.Error(err))
+		}
+		handlerOpts = append(handlerOpts, web.WithSessions(users, sessions))
+	}
 
-	// 健康检查路由（不需要认证）
-	router.HandleFunc("/health", webHandler.HealthCheckHandler).Methods("GET")
+	// 加载 API 令牌，只在启用认证时使用
+	var tokens *auth.Tokens
+	if cfg.TokensPath != "" {
+		if sessions == nil {
+			zap.L().Fatal("API tokens require authentication, configure users or OIDC")
+		}
+		if tokens, err = auth.LoadTokens(cfg.TokensPath); err != nil {
+			zap.L().Fatal("Failed to load API tokens", zap.Error(err))
+		}
+		handlerOpts = append(handlerOpts, web.WithTokens(tokens))
+	}
 
-	// 其他需要认证的路由
-	if cfg.Password != "" {
-		router.Use(middleware.AuthMiddleware(cfg.Password))
+	// 审计日志
+	if cfg.AuditLogPath != "" || cfg.AuditSyslog != "" {
+		auditLog, err := audit.Open(audit.Options{File: cfg.AuditLogPath, Syslog: cfg.AuditSyslog})
+		if err != nil {
+			zap.L().Fatal("Failed to open audit log", zap.Error(err))
+		}
+		defer auditLog.Close()
+		handlerOpts = append(handlerOpts, web.WithAudit(auditLog))
+	}
+
+	// 终端命令记录，在默认脱敏模式之外追加配置的模式
+	if cfg.AuditCommands {
+		if cfg.AuditLogPath == "" && cfg.AuditSyslog == "" {
+			zap.L().Fatal("Recording terminal commands requires an audit log, configure -audit-log or -audit-syslog")
+		}
+		patterns := audit.DefaultRedactPatterns
+		if cfg.AuditRedactPath != "" {
+			extra, err := audit.LoadRedactPatterns(cfg.AuditRedactPath)
+			if err != nil {
+				zap.L().Fatal("Failed to load redact patterns", zap.Error(err))
+			}
+			patterns = append(append([]string{}, patterns...), extra...)
+		}
+		redactor, err := audit.NewRedactor(patterns)
+		if err != nil {
+			zap.L().Fatal("Invalid redact patterns", zap.Error(err))
+		}
+		handlerOpts = append(handlerOpts, web.WithCommandAudit(redactor))
 	}
 
-	router.HandleFunc("/ws", webHandler.TerminalHandler)
-	router.HandleFunc("/containers", webHandler.ContainersHandler)
-	router.HandleFunc("/containers/{id}/logs", webHandler.ContainerLogsHandler)
-	router.HandleFunc("/container/logs", webHandler.ContainerLogsHandler)
-	router.HandleFunc("/container/logs/download", webHandler.DownloadLogsHandler)
+	// WebSocket 的 Origin 检查和连接限制
+	wsOptions := web.WebSocketOptions{
+		AllowedOrigins:     cfg.WSAllowedOrigins,
+		MaxSessions:        cfg.WSMaxSessions,
+		MaxSessionsPerUser: cfg.WSMaxSessionsPerUser,
+		MaxMessageSize:     cfg.WSMaxMessageSize,
+	}
+	if err := wsOptions.Validate(); err != nil {
+		zap.L().Fatal("Invalid WebSocket options", zap.Error(err))
+	}
+	handlerOpts = append(handlerOpts, web.WithWebSocketOptions(wsOptions))
 
-	// 静态文件服务
-	router.PathPrefix("/").Handler(http.FileServer(web.GetFileSystem()))
+	// 创建 HTTP handler
+	webHandler := web.NewHandler(monitors, handlerOpts...)
+	router := newRouter(webHandler, users, sessions, tokens)
 
 	// 创建 HTTP 服务器
 	server := &http.Server{
-		Addr:    fmt.Sprintf("%s:%d", cfg.ServerHost, cfg.ServerPort),
-		Handler: router,
+		Addr:      fmt.Sprintf("%s:%d", cfg.ServerHost, cfg.ServerPort),
+		Handler:   router,
+		TLSConfig: tlsConfig,
 	}
 
 	// 优雅关闭通道
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
-	if err := monitor.UpdateStatus(); err != nil {
-		zap.L().Error("Failed to update status", zap.Error(err))
-	}
+	done := make(chan struct{})
 
-	// 修改监控循环
-	go func() {
-		ticker := time.NewTicker(cfg.MonitorInterval)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-ticker.C:
-				if err := monitor.UpdateStatus(); err != nil {
-					zap.L().Error("Failed to update status", zap.Error(err))
+	// 每个主机独立轮询，避免慢速的远程主机阻塞其他主机
+	for _, monitor := range monitors {
+		go func(monitor *docker.Monitor) {
+			updateStatus := func() {
+				start := time.Now()
+				err := monitor.UpdateStatus()
+				metrics.ObserveUpdate(monitor.Name(), time.Since(start), err)
+				if err != nil {
+					zap.L().Error("Failed to update status", zap.String("host", monitor.Name()), zap.Error(err))
 				}
-			case <-stop:
-				return
 			}
-		}
-	}()
+			updateStatus()
+
+			ticker := time.NewTicker(cfg.MonitorInterval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ticker.C:
+					updateStatus()
+				case <-done:
+					return
+				}
+			}
+		}(monitor)
+	}
 
 	// 启动服务器
 	go func() {
-		log.Printf("Server starting on %s:%d", cfg.ServerHost, cfg.ServerPort)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if tlsConfig != nil {
+			log.Printf("Server starting on https://%s:%d", cfg.ServerHost, cfg.ServerPort)
+			// 证书由 TLSConfig 提供
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			log.Printf("Server starting on %s:%d", cfg.ServerHost, cfg.ServerPort)
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Server failed to start: %v", err)
 		}
 	}()
 
 	// 等待中断信号
 	<-stop
+	close(done)
 	log.Println("Shutting down server...")
 
 	// 创建关闭上下文
@@ -126,3 +324,39 @@ func main() {
 
 	log.Println("Server exited")
 }
+
+// loadUsers 按账号文件、密码文件、-password 或环境变量的顺序加载账号，都未配置时返回 nil
+func loadUsers(cfg *config.Config) (*auth.Users, error) {
+	switch {
+	case cfg.UsersPath != "":
+		return auth.LoadUsers(cfg.UsersPath)
+	case cfg.PasswordFile != "":
+		password, err := auth.ReadPasswordFile(cfg.PasswordFile)
+		if err != nil {
+			return nil, err
+		}
+		return auth.SingleUser("admin", password)
+	case cfg.Password != "":
+		return auth.SingleUser("admin", cfg.Password)
+	}
+	return nil, nil
+}
+
+// hashPassword 读取标准输入的第一行作为密码并输出 bcrypt 哈希
+func hashPassword() error {
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	password = strings.TrimRight(password, "\r\n")
+	if password == "" {
+		return fmt.Errorf("empty password")
+	}
+
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	fmt.Println(hash)
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/YooLeon/container-debug-online/internal/auth"
+	"github.com/YooLeon/container-debug-online/internal/metrics"
+	"github.com/YooLeon/container-debug-online/internal/middleware"
+	"github.com/YooLeon/container-debug-online/internal/web"
+	"github.com/gorilla/mux"
+)
+
+// newRouter 注册所有路由，users 或 sessions 不为 nil 时除了用 middleware.Public 声明的路由外都需要认证
+// tokens 不为 nil 时同时接受 API 令牌
+func newRouter(webHandler *web.Handler, users *auth.Users, sessions *auth.Sessions, tokens *auth.Tokens) *mux.Router {
+	router := mux.NewRouter()
+	router.Use(metrics.Middleware)
+	if users != nil || sessions != nil {
+		router.Use(middleware.AuthMiddleware(users, sessions, tokens))
+	}
+
+	// 公开路由：健康检查、登录和单点登录回调
+	router.Handle("/health", middleware.PublicFunc(webHandler.HealthCheckHandler)).Methods("GET")
+	router.Handle("/login", middleware.PublicFunc(webHandler.LoginHandler)).Methods("GET", "POST")
+	router.Handle("/oidc/login", middleware.PublicFunc(webHandler.OIDCLoginHandler)).Methods("GET")
+	router.Handle("/oidc/callback", middleware.PublicFunc(webHandler.OIDCCallbackHandler)).Methods("GET")
+
+	router.HandleFunc("/logout", webHandler.LogoutHandler).Methods("POST")
+	router.HandleFunc("/session", webHandler.SessionHandler).Methods("GET")
+	router.HandleFunc("/tokens", webHandler.TokensHandler).Methods("GET", "POST")
+	router.HandleFunc("/tokens/{id}", webHandler.RevokeTokenHandler).Methods("DELETE")
+	router.HandleFunc("/audit", webHandler.AuditHandler).Methods("GET")
+
+	router.HandleFunc("/metrics", webHandler.MetricsHandler).Methods("GET")
+	router.HandleFunc("/ws", webHandler.TerminalHandler)
+	router.HandleFunc("/hosts", webHandler.HostsHandler).Methods("GET")
+	router.HandleFunc("/containers", webHandler.ContainersHandler)
+	router.HandleFunc("/containers/{id}/logs", webHandler.ContainerLogsHandler)
+	router.HandleFunc("/container/logs", webHandler.ContainerLogsHandler)
+	router.HandleFunc("/container/logs/download", webHandler.DownloadLogsHandler)
+	router.HandleFunc("/logs/aggregate", webHandler.AggregateLogsHandler)
+	router.HandleFunc("/logs/download", webHandler.DownloadServiceLogsHandler).Methods("GET")
+	router.HandleFunc("/archive", webHandler.ArchiveHandler).Methods("GET")
+	router.HandleFunc("/archive/logs", webHandler.ArchiveLogsHandler).Methods("GET")
+	router.HandleFunc("/search", webHandler.SearchHandler).Methods("GET")
+	router.HandleFunc("/patterns", webHandler.PatternsHandler).Methods("GET")
+	router.HandleFunc("/crashes", webHandler.CrashesHandler).Methods("GET")
+	router.HandleFunc("/alerts", webHandler.AlertsHandler).Methods("GET")
+	router.HandleFunc("/alerts/silences", webHandler.SilencesHandler).Methods("GET", "POST")
+	router.HandleFunc("/alerts/silences/{id}", webHandler.DeleteSilenceHandler).Methods("DELETE")
+
+	// 静态文件服务（公开）
+	router.PathPrefix("/").Handler(middleware.Public(http.FileServer(web.GetFileSystem())))
+
+	return router
+}
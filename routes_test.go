@@ -0,0 +1,397 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/YooLeon/container-debug-online/internal/auth"
+	"github.com/YooLeon/container-debug-online/internal/config"
+	"github.com/YooLeon/container-debug-online/internal/docker"
+	"github.com/YooLeon/container-debug-online/internal/middleware"
+	"github.com/YooLeon/container-debug-online/internal/oidc"
+	"github.com/YooLeon/container-debug-online/internal/oidc/oidctest"
+	"github.com/YooLeon/container-debug-online/internal/rbac"
+	"github.com/YooLeon/container-debug-online/internal/runtime/fake"
+	"github.com/YooLeon/container-debug-online/internal/web"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+// publicRoutes 允许不认证访问的路由，新增公开路由时需要同步修改
+var publicRoutes = []string{"/", "/health", "/login", "/oidc/callback", "/oidc/login"}
+
+var routeVar = regexp.MustCompile(`\{[^}]+\}`)
+
+func newTestRouter(t *testing.T) *mux.Router {
+	t.Helper()
+
+	composeConfig := &config.ComposeConfig{Services: map[string]config.ServiceConfig{}}
+	monitor := docker.NewMonitor("local", fake.New(), zap.NewNop(), time.Second, composeConfig)
+	t.Cleanup(func() { monitor.Close() })
+
+	users, err := auth.SingleUser("admin", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := auth.NewSessions(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := auth.LoadTokens(filepath.Join(t.TempDir(), "tokens.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := web.NewHandler([]*docker.Monitor{monitor}, web.WithSessions(users, sessions), web.WithTokens(tokens))
+	return newRouter(handler, users, sessions, tokens)
+}
+
+func TestRoutesRequireAuth(t *testing.T) {
+	router := newTestRouter(t)
+
+	var public []string
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		if middleware.IsPublic(route) {
+			public = append(public, path)
+		}
+
+		methods, err := route.GetMethods()
+		if err != nil {
+			methods = []string{"GET"}
+		}
+		for _, method := range methods {
+			req := httptest.NewRequest(method, routeVar.ReplaceAllString(path, "x"), nil)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			unauthorized := rec.Code == http.StatusUnauthorized
+			if unauthorized == middleware.IsPublic(route) {
+				t.Errorf("%s %s: status = %d, public = %v", method, path, rec.Code, middleware.IsPublic(route))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(public)
+	if strings.Join(public, ",") != strings.Join(publicRoutes, ",") {
+		t.Errorf("public routes = %v, want %v", public, publicRoutes)
+	}
+}
+
+func TestRoutesWithCredentials(t *testing.T) {
+	router := newTestRouter(t)
+
+	req := httptest.NewRequest("GET", "/hosts", nil)
+	req.SetBasicAuth("admin", "secret")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", rec.Code)
+	}
+
+	// 未注册的路径由公开的静态文件服务处理
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/css/missing.css", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("static status = %d, want 404", rec.Code)
+	}
+}
+
+func TestLoginSession(t *testing.T) {
+	server := httptest.NewServer(newTestRouter(t))
+	defer server.Close()
+
+	// 错误的密码
+	resp, err := http.Post(server.URL+"/login", "application/json", strings.NewReader(`{"username":"admin","password":"wrong"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("wrong password: status = %d", resp.StatusCode)
+	}
+
+	resp, err = http.Post(server.URL+"/login", "application/json", strings.NewReader(`{"username":"admin","password":"secret"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var session auth.Session
+	json.NewDecoder(resp.Body).Decode(&session)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || session.User != "admin" || session.CSRFToken == "" {
+		t.Fatalf("login: status = %d, session = %+v", resp.StatusCode, session)
+	}
+	var cookie *http.Cookie
+	for _, c := range resp.Cookies() {
+		if c.Name == auth.SessionCookie {
+			cookie = c
+		}
+	}
+	if cookie == nil || !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("session cookie = %+v", cookie)
+	}
+
+	request := func(method, path, csrf string) int {
+		req, _ := http.NewRequest(method, server.URL+path, nil)
+		req.AddCookie(cookie)
+		if csrf != "" {
+			req.Header.Set(auth.CSRFHeader, csrf)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := request("GET", "/hosts", ""); status != http.StatusOK {
+		t.Errorf("GET /hosts with cookie: status = %d", status)
+	}
+
+	// WebSocket 握手同样使用 cookie 认证
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/logs/aggregate"
+	if _, resp, err := websocket.DefaultDialer.Dial(wsURL, nil); err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("websocket without cookie: %v", err)
+	}
+	ws, _, err := websocket.DefaultDialer.Dial(wsURL, http.Header{"Cookie": {cookie.String()}})
+	if err != nil {
+		t.Fatalf("websocket with cookie: %v", err)
+	}
+	ws.Close()
+
+	// 修改状态的请求需要 CSRF 令牌
+	if status := request("POST", "/logout", ""); status != http.StatusForbidden {
+		t.Errorf("logout without csrf: status = %d", status)
+	}
+	if status := request("POST", "/logout", session.CSRFToken); status != http.StatusNoContent {
+		t.Errorf("logout: status = %d", status)
+	}
+	if status := request("GET", "/hosts", ""); status != http.StatusUnauthorized {
+		t.Errorf("GET /hosts after logout: status = %d", status)
+	}
+}
+
+func TestOIDCLogin(t *testing.T) {
+	mock := oidctest.NewProvider()
+	defer mock.Close()
+
+	// 回调地址依赖测试服务器的地址，先启动服务器再创建路由
+	var router http.Handler
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		router.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	oidcPath := filepath.Join(dir, "oidc.yaml")
+	policyPath := filepath.Join(dir, "policy.yaml")
+	content := fmt.Sprintf("issuer: %s\nclient_id: %s\nclient_secret: %s\nredirect_url: %s/oidc/callback\n",
+		mock.URL, mock.ClientID, mock.ClientSecret, server.URL)
+	if err := os.WriteFile(oidcPath, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(policyPath, []byte("bindings:\n  - groups: [platform]\n    role: viewer\n  - users: [frank]\n    role: admin\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	oidcConfig, err := oidc.LoadConfig(oidcPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider, err := oidc.NewProvider(context.Background(), oidcConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := rbac.LoadPolicy(policyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := auth.NewSessions(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	composeConfig := &config.ComposeConfig{Services: map[string]config.ServiceConfig{}}
+	monitor := docker.NewMonitor("local", fake.New(), zap.NewNop(), time.Second, composeConfig)
+	defer monitor.Close()
+	handler := web.NewHandler([]*docker.Monitor{monitor},
+		web.WithSessions(nil, sessions), web.WithOIDC(provider), web.WithPolicy(policy))
+	router = newRouter(handler, nil, sessions, nil)
+
+	// 只配置单点登录时不接受 Basic 认证
+	var methods web.LoginMethods
+	if resp := getJSONAs(t, http.DefaultClient, server.URL+"/login", &methods); resp.StatusCode != http.StatusOK || methods.Password || !methods.OIDC {
+		t.Fatalf("login methods = %+v", methods)
+	}
+	req, _ := http.NewRequest("GET", server.URL+"/hosts", nil)
+	req.SetBasicAuth("admin", "secret")
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("basic auth without users: %v", err)
+	}
+
+	login := func(subject string, claims map[string]interface{}) *http.Client {
+		mock.SetUser(subject, claims)
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := &http.Client{Jar: jar}
+		resp, err := client.Get(server.URL + "/oidc/login")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || resp.Request.URL.Path != "/" {
+			t.Fatalf("login ended at %s with status %d", resp.Request.URL, resp.StatusCode)
+		}
+		return client
+	}
+
+	client := login("u-1", map[string]interface{}{"preferred_username": "erin", "groups": []string{"platform"}})
+	var session auth.Session
+	getJSONAs(t, client, server.URL+"/session", &session)
+	if session.User != "oidc:erin" || len(session.Groups) != 1 || session.CSRFToken == "" {
+		t.Errorf("session = %+v", session)
+	}
+	if resp := getJSONAs(t, client, server.URL+"/hosts", nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /hosts as platform member: status = %d", resp.StatusCode)
+	}
+
+	// 不在策略中的组没有权限，单点登录的用户名带有前缀，不会继承同名本地账号的绑定
+	client = login("u-2", map[string]interface{}{"preferred_username": "frank", "groups": []string{"qa"}})
+	if resp := getJSONAs(t, client, server.URL+"/hosts", nil); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("GET /hosts as qa member: status = %d", resp.StatusCode)
+	}
+
+	// 回调的 state 必须与发起登录的浏览器一致
+	resp, err := http.Get(server.URL + "/oidc/callback?code=x&state=forged")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Request.URL.Path != "/login.html" || resp.Request.URL.Query().Get("error") != "sso" {
+		t.Errorf("forged callback ended at %s", resp.Request.URL)
+	}
+}
+
+// getJSONAs 使用 client 请求 url，状态为 200 且 v 不为 nil 时解析响应
+func getJSONAs(t *testing.T, client *http.Client, url string, v interface{}) *http.Response {
+	t.Helper()
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK && v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp
+}
+
+func TestAPITokens(t *testing.T) {
+	server := httptest.NewServer(newTestRouter(t))
+	defer server.Close()
+
+	request := func(method, path, body string, authorize func(*http.Request)) *http.Response {
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		authorize(req)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	basic := func(req *http.Request) {
+		req.SetBasicAuth("admin", "secret")
+		req.Header.Set("X-Requested-With", "curl")
+	}
+	bearer := func(value string) func(*http.Request) {
+		return func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+value) }
+	}
+
+	// 使用 Basic 认证创建只能查看列表的令牌
+	resp := request("POST", "/tokens", `{"name":"ci","actions":["list"],"expires_in":"1h"}`, basic)
+	var created web.TokenResponse
+	json.NewDecoder(resp.Body).Decode(&created)
+	if resp.StatusCode != http.StatusCreated || created.Value == "" || created.User != "admin" || created.CreatedBy != "admin" {
+		t.Fatalf("create: status = %d, token = %+v", resp.StatusCode, created)
+	}
+	if time.Until(created.ExpiresAt) > time.Hour {
+		t.Errorf("expires = %v", created.ExpiresAt)
+	}
+	// 创建者来自账号文件，账号被删除后令牌失效
+	if fmt.Sprint(created.Accounts) != "[admin]" {
+		t.Errorf("accounts = %v", created.Accounts)
+	}
+
+	if resp := request("GET", "/hosts", "", bearer(created.Value)); resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /hosts with token: status = %d", resp.StatusCode)
+	}
+	// 指标包含所有项目，限定了项目或没有 list 权限的令牌不能读取
+	if resp := request("GET", "/metrics", "", bearer(created.Value)); resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /metrics with list token: status = %d", resp.StatusCode)
+	}
+	for _, body := range []string{
+		`{"name":"project","actions":["list"],"projects":["demo"]}`,
+		`{"name":"logs","actions":["logs"]}`,
+	} {
+		var scoped web.TokenResponse
+		json.NewDecoder(request("POST", "/tokens", body, basic).Body).Decode(&scoped)
+		if resp := request("GET", "/metrics", "", bearer(scoped.Value)); resp.StatusCode != http.StatusForbidden {
+			t.Errorf("GET /metrics with %s: status = %d", body, resp.StatusCode)
+		}
+	}
+	// 超出令牌范围的操作
+	if resp := request("GET", "/logs/download", "", bearer(created.Value)); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("GET /logs/download with list token: status = %d", resp.StatusCode)
+	}
+	// 令牌不能管理令牌
+	if resp := request("POST", "/tokens", `{"name":"more","actions":["admin"]}`, bearer(created.Value)); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("POST /tokens with token: status = %d", resp.StatusCode)
+	}
+
+	// 列表包含最后使用时间，不包含令牌值
+	var list []map[string]interface{}
+	json.NewDecoder(request("GET", "/tokens", "", basic).Body).Decode(&list)
+	if len(list) != 3 || list[0]["last_used_at"] == nil || list[0]["token"] != nil || list[0]["hash"] != nil {
+		t.Errorf("tokens = %+v", list)
+	}
+
+	for _, body := range []string{
+		`{"name":"bad","actions":["root"]}`,
+		`{"name":"bad","actions":[]}`,
+		`{"name":"bad","actions":["list"],"expires_in":"10000h"}`,
+	} {
+		if resp := request("POST", "/tokens", body, basic); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: status = %d", body, resp.StatusCode)
+		}
+	}
+
+	if resp := request("DELETE", "/tokens/"+created.ID, "", basic); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("revoke: status = %d", resp.StatusCode)
+	}
+	if resp := request("GET", "/hosts", "", bearer(created.Value)); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("GET /hosts with revoked token: status = %d", resp.StatusCode)
+	}
+}